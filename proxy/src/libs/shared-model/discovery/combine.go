@@ -41,5 +41,9 @@ func (agg EndpointAgg) Combine(aggB EndpointAgg) EndpointAgg {
 		),
 		AverageDuration:      averageDuration,
 		AverageTotalDuration: averageSpoeAndProviderTotalDuration,
+		DurationSketch:       agg.DurationSketch.Combine(aggB.DurationSketch),
+		RequestSizeSketch:    agg.RequestSizeSketch.Combine(aggB.RequestSizeSketch),
+		ResponseSizeSketch:   agg.ResponseSizeSketch.Combine(aggB.ResponseSizeSketch),
+		ErrorBuckets:         CombineErrorBuckets(agg.ErrorBuckets, aggB.ErrorBuckets),
 	}
 }
@@ -19,6 +19,12 @@ type EndpointAgg struct {
 	StatusCodes          map[int]Count
 	AverageDuration      float32 // round trip time from proxy to provider
 	AverageTotalDuration float32 // total duration (spoe time + provider time)
+
+	DurationSketch     *Sketch
+	RequestSizeSketch  *Sketch
+	ResponseSizeSketch *Sketch
+	// ErrorBuckets are keyed by the start of the bucket (ms)
+	ErrorBuckets map[int64]ErrorBucket
 }
 
 type EndpointMapping map[Endpoint]EndpointAgg
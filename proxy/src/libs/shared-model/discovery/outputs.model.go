@@ -2,6 +2,10 @@ package shareddiscovery
 
 const (
 	EndpointDelimiter = ":::"
+
+	// OutputVersion is the version of the persisted format, legacy files have no version.
+	// Version 2 adds the time windows.
+	OutputVersion = 2
 )
 
 type (
@@ -12,10 +16,34 @@ type (
 	}
 
 	Output struct {
+		Version      int                                  `json:"version,omitempty"`
 		CreatedAt    string                               `json:"created_at"`
 		Interceptors []InterceptorOutput                  `json:"interceptors"`
 		Endpoints    map[string]EndpointOutput            `json:"endpoints"`
 		Consumers    map[string]map[string]EndpointOutput `json:"consumers"`
+		Windows      []WindowSeriesOutput                 `json:"windows,omitempty"`
+	}
+
+	// WindowSeriesOutput keeps the windows of a resolution, up to its retention
+	WindowSeriesOutput struct {
+		ResolutionSec int64          `json:"resolution_sec"`
+		RetentionSec  int64          `json:"retention_sec"`
+		Windows       []WindowOutput `json:"windows"`
+	}
+
+	WindowOutput struct {
+		Start     string                               `json:"start"`
+		End       string                               `json:"end"`
+		Endpoints map[string]EndpointOutput            `json:"endpoints"`
+		Consumers map[string]map[string]EndpointOutput `json:"consumers"`
+	}
+
+	// WindowsQueryOutput is the answer of a time range query over the windows
+	WindowsQueryOutput struct {
+		From          string         `json:"from"`
+		To            string         `json:"to"`
+		ResolutionSec int64          `json:"resolution_sec"`
+		Windows       []WindowOutput `json:"windows"`
 	}
 
 	EndpointOutput struct {
@@ -26,5 +54,28 @@ type (
 		StatusCodes          map[int]int `json:"status_codes"`
 		AverageDuration      float32     `json:"average_duration"`
 		AverageTotalDuration float32     `json:"average_total_duration"` //(spoe time + provider time)
+
+		Duration     *DistributionOutput `json:"duration,omitempty"`
+		RequestSize  *DistributionOutput `json:"request_size,omitempty"`
+		ResponseSize *DistributionOutput `json:"response_size,omitempty"`
+		ErrorRates   []ErrorRateOutput   `json:"error_rates,omitempty"`
+	}
+
+	// DistributionOutput summarizes a sketch, which is kept to be combined after persistence
+	DistributionOutput struct {
+		P50     float64 `json:"p50"`
+		P90     float64 `json:"p90"`
+		P99     float64 `json:"p99"`
+		Min     float64 `json:"min"`
+		Max     float64 `json:"max"`
+		Average float64 `json:"average"`
+		Sketch  *Sketch `json:"sketch"`
+	}
+
+	ErrorRateOutput struct {
+		Start     string  `json:"start"`
+		Count     int     `json:"count"`
+		Errors    int     `json:"errors"`
+		ErrorRate float64 `json:"error_rate"`
 	}
 )
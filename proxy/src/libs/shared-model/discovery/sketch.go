@@ -0,0 +1,197 @@
+package shareddiscovery
+
+import (
+	"math"
+	"slices"
+)
+
+const (
+	// sketchRelativeAccuracy bounds the relative error of the quantiles of a Sketch
+	sketchRelativeAccuracy = 0.01
+
+	// ErrorBucketSizeMs is the time span of an error rate bucket
+	ErrorBucketSizeMs int64 = 60 * 60 * 1000
+	// MaxErrorBuckets bounds the error rate buckets of an endpoint, the oldest are dropped first
+	MaxErrorBuckets = 7 * 24
+)
+
+var (
+	sketchGamma    = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// Sketch is a mergeable quantile sketch of non-negative values.
+// Values are counted in logarithmic buckets, so quantiles keep a relative error
+// of sketchRelativeAccuracy and sketches are merged by adding up their buckets.
+type Sketch struct {
+	Buckets map[int]Count `json:"buckets"`
+	// Zeros counts the values which are not positive
+	Zeros Count   `json:"zeros,omitempty"`
+	Count Count   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+func NewSketch(values ...float64) *Sketch {
+	sketch := &Sketch{Buckets: map[int]Count{}}
+	for _, value := range values {
+		sketch.Add(value)
+	}
+	return sketch
+}
+
+func (s *Sketch) Add(value float64) {
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+
+	if value <= 0 {
+		s.Zeros++
+		return
+	}
+	s.Buckets[sketchIndex(value)]++
+}
+
+// Combine returns the sketch of the values of both sketches, nil when both are nil
+func (s *Sketch) Combine(other *Sketch) *Sketch {
+	if s == nil && other == nil {
+		return nil
+	}
+	combined := NewSketch()
+	for _, sketch := range []*Sketch{s, other} {
+		if sketch == nil || sketch.Count == 0 {
+			continue
+		}
+		if combined.Count == 0 || sketch.Min < combined.Min {
+			combined.Min = sketch.Min
+		}
+		if combined.Count == 0 || sketch.Max > combined.Max {
+			combined.Max = sketch.Max
+		}
+		combined.Count += sketch.Count
+		combined.Sum += sketch.Sum
+		combined.Zeros += sketch.Zeros
+		for index, count := range sketch.Buckets {
+			combined.Buckets[index] += count
+		}
+	}
+	return combined
+}
+
+// Quantile returns the value at the quantile q, between 0 and 1
+func (s *Sketch) Quantile(q float64) float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	rank := Count(math.Ceil(q*float64(s.Count))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank < s.Zeros {
+		return s.Min
+	}
+
+	indexes := make([]int, 0, len(s.Buckets))
+	for index := range s.Buckets {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+
+	cumulative := s.Zeros
+	for _, index := range indexes {
+		cumulative += s.Buckets[index]
+		if cumulative > rank {
+			return math.Min(math.Max(sketchValue(index), s.Min), s.Max)
+		}
+	}
+	return s.Max
+}
+
+// CountAtMost returns the number of values up to the given value,
+// within the relative accuracy of the sketch
+func (s *Sketch) CountAtMost(value float64) Count {
+	if s == nil || s.Count == 0 || value < s.Min {
+		return 0
+	}
+	if value >= s.Max {
+		return s.Count
+	}
+	count := s.Zeros
+	if value <= 0 {
+		return count
+	}
+	maxIndex := sketchIndex(value)
+	for index, bucketCount := range s.Buckets {
+		if index <= maxIndex {
+			count += bucketCount
+		}
+	}
+	return count
+}
+
+func (s *Sketch) Average() float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+func sketchIndex(value float64) int {
+	return int(math.Ceil(math.Log(value) / sketchLogGamma))
+}
+
+// sketchValue is the value representing the bucket, within the relative accuracy of its values
+func sketchValue(index int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(index)) / (sketchGamma + 1)
+}
+
+// ErrorBucket counts the calls of a time bucket, and the failed ones among them
+type ErrorBucket struct {
+	Count  Count `json:"count"`
+	Errors Count `json:"errors"`
+}
+
+// IsErrorStatus tells whether the status code is a failed call, a server error or a rate limit
+func IsErrorStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == 429
+}
+
+// ErrorBucketStart returns the start of the error rate bucket of the timestamp (ms)
+func ErrorBucketStart(timestamp int64) int64 {
+	return timestamp - timestamp%ErrorBucketSizeMs
+}
+
+// CombineErrorBuckets adds up the buckets, keeping the MaxErrorBuckets most recent ones
+func CombineErrorBuckets(bucketsA, bucketsB map[int64]ErrorBucket) map[int64]ErrorBucket {
+	if bucketsA == nil && bucketsB == nil {
+		return nil
+	}
+	combined := make(map[int64]ErrorBucket, len(bucketsA)+len(bucketsB))
+	for _, buckets := range []map[int64]ErrorBucket{bucketsA, bucketsB} {
+		for start, bucket := range buckets {
+			current := combined[start]
+			combined[start] = ErrorBucket{
+				Count:  current.Count + bucket.Count,
+				Errors: current.Errors + bucket.Errors,
+			}
+		}
+	}
+
+	if len(combined) > MaxErrorBuckets {
+		starts := make([]int64, 0, len(combined))
+		for start := range combined {
+			starts = append(starts, start)
+		}
+		slices.Sort(starts)
+		for _, start := range starts[:len(starts)-MaxErrorBuckets] {
+			delete(combined, start)
+		}
+	}
+	return combined
+}
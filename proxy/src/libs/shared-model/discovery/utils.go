@@ -2,6 +2,7 @@ package shareddiscovery
 
 import (
 	sharedActions "lunar/shared-model/actions"
+	"slices"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -69,9 +70,86 @@ func ConvertEndpointFromPersisted(
 		StatusCodes:          convertMapOfIntToCount(endpoint.StatusCodes),
 		AverageDuration:      endpoint.AverageDuration,
 		AverageTotalDuration: endpoint.AverageTotalDuration,
+		DurationSketch:       endpoint.Duration.GetSketch(),
+		RequestSizeSketch:    endpoint.RequestSize.GetSketch(),
+		ResponseSizeSketch:   endpoint.ResponseSize.GetSketch(),
+		ErrorBuckets:         ConvertErrorRatesFromPersisted(endpoint.ErrorRates),
 	}
 }
 
+// NewDistributionOutput summarizes the sketch, nil when there is no sketch
+func NewDistributionOutput(sketch *Sketch) *DistributionOutput {
+	if sketch == nil {
+		return nil
+	}
+	return &DistributionOutput{
+		P50:     sketch.Quantile(0.5),
+		P90:     sketch.Quantile(0.9),
+		P99:     sketch.Quantile(0.99),
+		Min:     sketch.Min,
+		Max:     sketch.Max,
+		Average: sketch.Average(),
+		Sketch:  sketch,
+	}
+}
+
+func (d *DistributionOutput) GetSketch() *Sketch {
+	if d == nil || d.Sketch == nil {
+		return nil
+	}
+	if d.Sketch.Buckets == nil {
+		d.Sketch.Buckets = map[int]Count{}
+	}
+	return d.Sketch
+}
+
+// ConvertErrorRatesToPersisted lists the error buckets by their start time
+func ConvertErrorRatesToPersisted(buckets map[int64]ErrorBucket) []ErrorRateOutput {
+	if len(buckets) == 0 {
+		return nil
+	}
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	slices.Sort(starts)
+
+	output := make([]ErrorRateOutput, 0, len(starts))
+	for _, start := range starts {
+		bucket := buckets[start]
+		var errorRate float64
+		if bucket.Count > 0 {
+			errorRate = float64(bucket.Errors) / float64(bucket.Count)
+		}
+		output = append(output, ErrorRateOutput{
+			Start:     sharedActions.TimestampToStringFromInt64(start),
+			Count:     int(bucket.Count),
+			Errors:    int(bucket.Errors),
+			ErrorRate: errorRate,
+		})
+	}
+	return output
+}
+
+func ConvertErrorRatesFromPersisted(errorRates []ErrorRateOutput) map[int64]ErrorBucket {
+	if len(errorRates) == 0 {
+		return nil
+	}
+	buckets := make(map[int64]ErrorBucket, len(errorRates))
+	for _, errorRate := range errorRates {
+		start, err := sharedActions.TimestampFromStringToInt64(errorRate.Start)
+		if err != nil {
+			log.Error().Msgf("Error converting timestamp: %v", err)
+			continue
+		}
+		buckets[start] = ErrorBucket{
+			Count:  Count(errorRate.Count),
+			Errors: Count(errorRate.Errors),
+		}
+	}
+	return buckets
+}
+
 func convertMapOfIntToCount(ints map[int]int) map[int]Count {
 	result := make(map[int]Count)
 	for key, value := range ints {
@@ -0,0 +1,79 @@
+package shareddiscovery
+
+import (
+	"errors"
+	"fmt"
+	sharedActions "lunar/shared-model/actions"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoWindows = errors.New("no time windows are kept")
+
+// QueryWindows returns the windows overlapping [from, to).
+// The windows are taken from the series of the given resolution, or when it is zero,
+// from the finest series which retention still covers from.
+func (output Output) QueryWindows(
+	from, to, now time.Time,
+	resolution time.Duration,
+) (WindowsQueryOutput, error) {
+	series, err := output.selectWindowSeries(from, now, resolution)
+	if err != nil {
+		return WindowsQueryOutput{}, err
+	}
+
+	result := WindowsQueryOutput{
+		From:          sharedActions.TimestampToStringFromTime(from.UTC()),
+		To:            sharedActions.TimestampToStringFromTime(to.UTC()),
+		ResolutionSec: series.ResolutionSec,
+		Windows:       []WindowOutput{},
+	}
+	fromMs, toMs := from.UnixMilli(), to.UnixMilli()
+	for _, window := range series.Windows {
+		start, err := sharedActions.TimestampFromStringToInt64(window.Start)
+		if err != nil {
+			log.Error().Msgf("Error converting timestamp: %v", err)
+			continue
+		}
+		end := start + series.ResolutionSec*int64(time.Second/time.Millisecond)
+		if start < toMs && end > fromMs {
+			result.Windows = append(result.Windows, window)
+		}
+	}
+	return result, nil
+}
+
+func (output Output) selectWindowSeries(
+	from, now time.Time,
+	resolution time.Duration,
+) (WindowSeriesOutput, error) {
+	if len(output.Windows) == 0 {
+		return WindowSeriesOutput{}, ErrNoWindows
+	}
+
+	if resolution > 0 {
+		for _, series := range output.Windows {
+			if time.Duration(series.ResolutionSec)*time.Second == resolution {
+				return series, nil
+			}
+		}
+		return WindowSeriesOutput{}, fmt.Errorf("no time windows of %v are kept", resolution)
+	}
+
+	var finest, longest *WindowSeriesOutput
+	for i := range output.Windows {
+		series := &output.Windows[i]
+		if longest == nil || series.RetentionSec > longest.RetentionSec {
+			longest = series
+		}
+		covers := !now.Add(-time.Duration(series.RetentionSec) * time.Second).After(from)
+		if covers && (finest == nil || series.ResolutionSec < finest.ResolutionSec) {
+			finest = series
+		}
+	}
+	if finest != nil {
+		return *finest, nil
+	}
+	return *longest, nil
+}
@@ -0,0 +1,145 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	MetricsTemporalityCumulative = "cumulative"
+	MetricsTemporalityDelta      = "delta"
+
+	metricsEndpointEnvVar = "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"
+)
+
+// MetricsConfig configures the push export of the metrics to an OTLP endpoint.
+// Metrics are pushed when an endpoint is set, either here or by OTEL_EXPORTER_OTLP_METRICS_ENDPOINT,
+// and are served for Prometheus unless DisablePrometheus is set.
+type MetricsConfig struct {
+	// Endpoint is a URL (http://collector:4317) or a host:port, which is exported to without TLS
+	Endpoint string
+	// Protocol is either grpc (default) or http
+	Protocol string
+	Headers  map[string]string
+	TLS      *TLSConfig
+	// Interval between the exports, the OTEL_METRIC_EXPORT_INTERVAL or 60s when not set
+	Interval time.Duration
+	// Temporality is either cumulative (default) or delta
+	Temporality       string
+	DisablePrometheus bool
+}
+
+func (c *MetricsConfig) getEndpoint() string {
+	if c != nil && c.Endpoint != "" {
+		return c.Endpoint
+	}
+	return os.Getenv(metricsEndpointEnvVar)
+}
+
+func (c *MetricsConfig) isPrometheusEnabled() bool {
+	return c == nil || !c.DisablePrometheus
+}
+
+// newMetricsReader creates a reader pushing the metrics periodically to the OTLP endpoint
+func newMetricsReader(ctx context.Context, config *MetricsConfig) (sdkMetric.Reader, error) {
+	exporter, err := newMetricsExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []sdkMetric.PeriodicReaderOption{}
+	if config != nil && config.Interval > 0 {
+		options = append(options, sdkMetric.WithInterval(config.Interval))
+	}
+	return sdkMetric.NewPeriodicReader(exporter, options...), nil
+}
+
+func newMetricsExporter(ctx context.Context, config *MetricsConfig) (sdkMetric.Exporter, error) {
+	if config == nil {
+		config = &MetricsConfig{}
+	}
+	endpoint := config.getEndpoint()
+	isURL := isEndpointURL(endpoint)
+
+	temporality, err := newTemporalitySelector(config.Temporality)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Protocol == OTLPProtocolHTTP {
+		options := []otlpmetrichttp.Option{otlpmetrichttp.WithTemporalitySelector(temporality)}
+		if isURL {
+			options = append(options, otlpmetrichttp.WithEndpointURL(endpoint))
+		} else {
+			options = append(options, otlpmetrichttp.WithEndpoint(endpoint), otlpmetrichttp.WithInsecure())
+		}
+		if len(config.Headers) > 0 {
+			options = append(options, otlpmetrichttp.WithHeaders(config.Headers))
+		}
+		if tlsConfig != nil {
+			options = append(options, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		}
+		return otlpmetrichttp.New(ctx, options...)
+	}
+
+	if config.Protocol != "" && config.Protocol != OTLPProtocolGRPC {
+		return nil, fmt.Errorf("unsupported metrics exporter protocol: %s", config.Protocol)
+	}
+
+	options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithTemporalitySelector(temporality)}
+	if isURL {
+		options = append(options, otlpmetricgrpc.WithEndpointURL(endpoint))
+	} else {
+		options = append(options, otlpmetricgrpc.WithEndpoint(endpoint), otlpmetricgrpc.WithInsecure())
+	}
+	if len(config.Headers) > 0 {
+		options = append(options, otlpmetricgrpc.WithHeaders(config.Headers))
+	}
+	if tlsConfig != nil {
+		options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	return otlpmetricgrpc.New(ctx, options...)
+}
+
+// newTemporalitySelector with delta temporality reports the counters and histograms as deltas,
+// up-down counters stay cumulative since their deltas are meaningless to most backends
+func newTemporalitySelector(temporality string) (sdkMetric.TemporalitySelector, error) {
+	switch temporality {
+	case "", MetricsTemporalityCumulative:
+		return sdkMetric.DefaultTemporalitySelector, nil
+	case MetricsTemporalityDelta:
+		return func(kind sdkMetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkMetric.InstrumentKindUpDownCounter,
+				sdkMetric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			default:
+				return metricdata.DeltaTemporality
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported metrics temporality: %s", temporality)
+	}
+}
+
+func logMetricsConfig(config *MetricsConfig) {
+	if config == nil {
+		return
+	}
+	log.Info().Msgf("Metrics exporter: protocol=%q, endpoint=%q, interval=%v, temporality=%q, prometheus=%v",
+		config.Protocol, config.getEndpoint(), config.Interval, config.Temporality, config.isPrometheusEnabled())
+}
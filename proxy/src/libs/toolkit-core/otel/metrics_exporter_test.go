@@ -0,0 +1,84 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricsReaderPushesOverHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var paths, tokens []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		tokens = append(tokens, r.Header.Get("X-Token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	reader, err := newMetricsReader(ctx, &MetricsConfig{
+		Endpoint: collector.URL,
+		Protocol: OTLPProtocolHTTP,
+		Headers:  map[string]string{"X-Token": "secret"},
+	})
+	require.NoError(t, err)
+
+	meterProvider := sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader))
+	counter, err := meterProvider.Meter("test").Int64Counter("flow_invocations")
+	require.NoError(t, err)
+	counter.Add(ctx, 1)
+
+	require.NoError(t, meterProvider.ForceFlush(ctx))
+	require.NoError(t, meterProvider.Shutdown(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, paths)
+	assert.Equal(t, "/v1/metrics", paths[0])
+	assert.Equal(t, "secret", tokens[0])
+}
+
+func TestMetricsExporterRejectsUnknownSettings(t *testing.T) {
+	_, err := newMetricsExporter(context.Background(),
+		&MetricsConfig{Endpoint: "localhost:4317", Protocol: "udp"})
+	assert.Error(t, err)
+
+	_, err = newMetricsExporter(context.Background(),
+		&MetricsConfig{Endpoint: "localhost:4317", Temporality: "sometimes"})
+	assert.Error(t, err)
+}
+
+func TestDeltaTemporalitySelector(t *testing.T) {
+	selector, err := newTemporalitySelector(MetricsTemporalityDelta)
+	require.NoError(t, err)
+
+	assert.Equal(t, metricdata.DeltaTemporality, selector(sdkMetric.InstrumentKindCounter))
+	assert.Equal(t, metricdata.DeltaTemporality, selector(sdkMetric.InstrumentKindHistogram))
+	assert.Equal(t, metricdata.CumulativeTemporality, selector(sdkMetric.InstrumentKindUpDownCounter))
+
+	selector, err = newTemporalitySelector("")
+	require.NoError(t, err)
+	assert.Equal(t, metricdata.CumulativeTemporality, selector(sdkMetric.InstrumentKindCounter))
+}
+
+func TestMetricsConfigDefaults(t *testing.T) {
+	t.Setenv(metricsEndpointEnvVar, "collector:4317")
+
+	var config *MetricsConfig
+	assert.True(t, config.isPrometheusEnabled())
+	assert.Equal(t, "collector:4317", config.getEndpoint())
+
+	config = &MetricsConfig{Endpoint: "http://other:4318", DisablePrometheus: true}
+	assert.False(t, config.isPrometheusEnabled())
+	assert.Equal(t, "http://other:4318", config.getEndpoint())
+}
@@ -8,6 +8,10 @@ import (
 )
 
 func ServeMetrics() {
+	if !prometheusEnabled {
+		log.Debug().Msg("Prometheus metrics are disabled, metrics are not served")
+		return
+	}
 	log.Debug().Msgf("Serving metrics at %s%s", prometheusHost, metricsRoute)
 	http.Handle(metricsRoute, promhttp.Handler())
 	err := http.ListenAndServe(prometheusHost, nil)
@@ -17,6 +21,10 @@ func ServeMetrics() {
 }
 
 func ServeMetricsForAsyncService() {
+	if !prometheusEnabled {
+		log.Debug().Msg("Prometheus metrics are disabled, metrics are not served for AsyncService")
+		return
+	}
 	log.Debug().Msgf("Serving metrics for AsyncService at %s%s", metricsAsyncServiceHost, metricsRoute)
 	http.Handle(metricsRoute, promhttp.Handler())
 	err := http.ListenAndServe(metricsAsyncServiceHost, nil)
@@ -4,12 +4,11 @@ import (
 	"context"
 	contextmanager "lunar/toolkit-core/context-manager"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/propagation"
 	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
@@ -17,7 +16,6 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"go.opentelemetry.io/otel/trace"
-	"google.golang.org/grpc"
 )
 
 const (
@@ -26,13 +24,15 @@ const (
 )
 
 var (
+	// prometheusEnabled is false when the metrics are only pushed to the OTLP endpoint
+	prometheusEnabled       = true
 	prometheusHost          = getMetricsServer()
 	metricsAsyncServiceHost = getMetricsAsyncServiceServer()
 )
 
 // Initializes an OTLP exporter, and configures the corresponding trace and
 // metric providers.
-func InitProvider(serviceName string) func() {
+func InitProvider(serviceName string, config ProviderConfig) func() {
 	log.Debug().Msgf("Initializing OpenTelemetry for %s", serviceName)
 	ctx := contextmanager.Get().GetContext()
 	resource, err := resource.New(ctx,
@@ -47,39 +47,55 @@ func InitProvider(serviceName string) func() {
 	)
 	handleErr(err, "Failed to create resource")
 
-	// The exporter embeds a default OpenTelemetry Reader and
-	// implements prometheus.Collector, allowing it to be used as
-	// both a Reader and Collector.
-	exporter, err := prometheus.New(
-		prometheus.WithoutScopeInfo(),
-	)
-	if err != nil {
-		// handleErr(err, "Failed to run exporter embeds")
-		log.Error().Err(err).Msg("Failed to run exporter embeds")
+	meterProviderOptions := []sdkMetric.Option{sdkMetric.WithResource(resource)}
+	prometheusEnabled = config.Metrics.isPrometheusEnabled()
+	if prometheusEnabled {
+		// The exporter embeds a default OpenTelemetry Reader and
+		// implements prometheus.Collector, allowing it to be used as
+		// both a Reader and Collector.
+		exporter, err := prometheus.New(
+			prometheus.WithoutScopeInfo(),
+		)
+		if err != nil {
+			// handleErr(err, "Failed to run exporter embeds")
+			log.Error().Err(err).Msg("Failed to run exporter embeds")
+		} else {
+			meterProviderOptions = append(meterProviderOptions, sdkMetric.WithReader(exporter))
+		}
 	}
-	meterProvider := sdkMetric.NewMeterProvider(
-		sdkMetric.WithReader(exporter),
-	)
+
+	if config.Metrics.getEndpoint() != "" {
+		logMetricsConfig(config.Metrics)
+		metricsReader, err := newMetricsReader(ctx, config.Metrics)
+		handleErr(err, "Failed to create the collector metrics exporter")
+		if err == nil {
+			meterProviderOptions = append(meterProviderOptions, sdkMetric.WithReader(metricsReader))
+		}
+	}
+
+	meterProvider := sdkMetric.NewMeterProvider(meterProviderOptions...)
 	SetRealMeter(meterProvider.Meter(meterName))
 
-	var tracerProvider sdktrace.TracerProvider
-	otelAgentAddr, traceProviderEnabled := os.LookupEnv(
-		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	var tracerProvider *sdktrace.TracerProvider
+	var traceExporter sdktrace.SpanExporter
+	traceProviderEnabled := config.Traces.getEndpoint() != ""
 
 	if traceProviderEnabled {
-		traceClient := otlptracegrpc.NewClient(
-			otlptracegrpc.WithInsecure(),
-			otlptracegrpc.WithEndpoint(otelAgentAddr),
-			otlptracegrpc.WithDialOption(grpc.WithBlock()))
-
-		traceExporter, err := otlptrace.New(ctx, traceClient)
+		logTraceConfig(config.Traces)
+		traceExporter, err = newTraceExporter(ctx, config.Traces)
 		handleErr(err, "Failed to create the collector trace exporter")
+		traceProviderEnabled = err == nil
+	}
 
-		bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
-		tracerProvider := sdktrace.NewTracerProvider(
-			sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	if traceProviderEnabled {
+		var spanProcessor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(traceExporter)
+		if tailSampling := config.Traces.getTailSampling(); tailSampling != nil {
+			spanProcessor = newTailSamplingProcessor(spanProcessor, *tailSampling)
+		}
+		tracerProvider = sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(NewSampler(config.Traces)),
 			sdktrace.WithResource(resource),
-			sdktrace.WithSpanProcessor(bsp),
+			sdktrace.WithSpanProcessor(spanProcessor),
 		)
 
 		// set global propagator to trace context (the default is no-op).
@@ -111,10 +127,20 @@ func handleErr(err error, message string) {
 	}
 }
 
-func Tracer(ctx context.Context, spanName string) (
+func Tracer(ctx context.Context, spanName string, options ...trace.SpanStartOption) (
 	context.Context, trace.Span,
 ) {
-	return otel.Tracer("lunar-engine").Start(ctx, spanName)
+	return otel.Tracer("lunar-engine").Start(ctx, spanName, options...)
+}
+
+// ExtractTraceContext returns ctx with the remote span of the incoming trace headers (traceparent),
+// so spans started from it continue the trace of the caller
+func ExtractTraceContext(ctx context.Context, headers map[string]string) context.Context {
+	carrier := propagation.MapCarrier{}
+	for key, value := range headers {
+		carrier[strings.ToLower(key)] = value
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
 }
 
 func getMetricsServer() string {
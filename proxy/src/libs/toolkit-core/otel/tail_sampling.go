@@ -0,0 +1,166 @@
+package otel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTailDecisionWait = 30 * time.Second
+	defaultTailMaxTraces    = 10000
+)
+
+// TailSamplingConfig keeps the traces which were not sampled up front,
+// when one of their spans is an error, carries one of the KeepAttributes,
+// or is a local root span slower than LatencyThreshold.
+type TailSamplingConfig struct {
+	Enabled bool
+	// DecisionWait is how long the spans of a trace are buffered waiting for a reason to keep them
+	DecisionWait time.Duration
+	// MaxTraces bounds the buffer, the oldest traces are dropped first
+	MaxTraces        int
+	LatencyThreshold time.Duration
+	// KeepAttributes maps an attribute key to the values keeping the trace, any value when empty
+	KeepAttributes map[attribute.Key][]string
+}
+
+type tailTrace struct {
+	spans     []sdktrace.ReadOnlySpan
+	createdAt time.Time
+	kept      bool
+}
+
+// tailSamplingProcessor buffers the recorded spans of the traces which were not sampled,
+// and forwards the traces worth keeping to the next processor as sampled.
+// Sampled spans are forwarded as they end.
+type tailSamplingProcessor struct {
+	next   sdktrace.SpanProcessor
+	config TailSamplingConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	traces    map[trace.TraceID]*tailTrace
+	order     []trace.TraceID
+	lastSweep time.Time
+}
+
+func newTailSamplingProcessor(next sdktrace.SpanProcessor, config TailSamplingConfig) *tailSamplingProcessor {
+	if config.DecisionWait <= 0 {
+		config.DecisionWait = defaultTailDecisionWait
+	}
+	if config.MaxTraces <= 0 {
+		config.MaxTraces = defaultTailMaxTraces
+	}
+	return &tailSamplingProcessor{
+		next:   next,
+		config: config,
+		now:    time.Now,
+		traces: make(map[trace.TraceID]*tailTrace),
+	}
+}
+
+func (p *tailSamplingProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, span)
+}
+
+func (p *tailSamplingProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	if span.SpanContext().IsSampled() {
+		p.next.OnEnd(span)
+		return
+	}
+
+	p.mu.Lock()
+	now := p.now()
+	p.sweep(now)
+
+	traceID := span.SpanContext().TraceID()
+	buffered, found := p.traces[traceID]
+	if !found {
+		buffered = &tailTrace{createdAt: now}
+		p.traces[traceID] = buffered
+		p.order = append(p.order, traceID)
+		p.evictOverflow()
+	}
+
+	var toForward []sdktrace.ReadOnlySpan
+	switch {
+	case buffered.kept:
+		toForward = []sdktrace.ReadOnlySpan{span}
+	case p.shouldKeep(span):
+		buffered.kept = true
+		toForward = append(buffered.spans, span)
+		buffered.spans = nil
+	default:
+		buffered.spans = append(buffered.spans, span)
+	}
+	p.mu.Unlock()
+
+	for _, keptSpan := range toForward {
+		p.next.OnEnd(sampledSpan{ReadOnlySpan: keptSpan})
+	}
+}
+
+func (p *tailSamplingProcessor) shouldKeep(span sdktrace.ReadOnlySpan) bool {
+	if span.Status().Code == codes.Error {
+		return true
+	}
+	if p.config.LatencyThreshold > 0 && isLocalRoot(span) &&
+		span.EndTime().Sub(span.StartTime()) > p.config.LatencyThreshold {
+		return true
+	}
+	for _, attr := range span.Attributes() {
+		values, found := p.config.KeepAttributes[attr.Key]
+		if !found {
+			continue
+		}
+		if len(values) == 0 {
+			return true
+		}
+		for _, value := range values {
+			if attr.Value.Emit() == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sweep drops the traces older than the decision wait, at most once per second
+func (p *tailSamplingProcessor) sweep(now time.Time) {
+	if now.Sub(p.lastSweep) < time.Second {
+		return
+	}
+	p.lastSweep = now
+
+	expired := 0
+	for _, traceID := range p.order {
+		buffered, found := p.traces[traceID]
+		if found && now.Sub(buffered.createdAt) < p.config.DecisionWait {
+			break
+		}
+		delete(p.traces, traceID)
+		expired++
+	}
+	p.order = p.order[expired:]
+}
+
+func (p *tailSamplingProcessor) evictOverflow() {
+	for len(p.order) > p.config.MaxTraces {
+		delete(p.traces, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+func (p *tailSamplingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *tailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
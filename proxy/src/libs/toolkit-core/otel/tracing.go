@@ -0,0 +1,256 @@
+package otel
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// OTLPProtocolGRPC and OTLPProtocolHTTP are the protocols of the OTLP exporters
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+
+	tracesEndpointEnvVar = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	// FlowNameAttribute is read by the sampler to apply the per-flow sampling ratios
+	FlowNameAttribute = attribute.Key("lunar.flow.name")
+)
+
+// ProviderConfig configures the providers created by InitProvider
+type ProviderConfig struct {
+	Traces  *TraceConfig
+	Metrics *MetricsConfig
+}
+
+// TraceConfig configures the export and the sampling of the traces.
+// Traces are exported when an endpoint is set, either here or by OTEL_EXPORTER_OTLP_TRACES_ENDPOINT.
+type TraceConfig struct {
+	// Endpoint is a URL (http://collector:4317) or a host:port, which is exported to without TLS
+	Endpoint string
+	// Protocol is either grpc (default) or http
+	Protocol string
+	Headers  map[string]string
+	TLS      *TLSConfig
+
+	// SampleRatio is the ratio of sampled traces that have no sampled parent, 1 when not set
+	SampleRatio *float64
+	// FlowSampleRatios overrides SampleRatio, and the decision of a local parent,
+	// for the spans of the given flows
+	FlowSampleRatios map[string]float64
+	TailSampling     *TailSamplingConfig
+}
+
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// getEndpoint returns the configured endpoint, falling back to the environment
+func (c *TraceConfig) getEndpoint() string {
+	if c != nil && c.Endpoint != "" {
+		return c.Endpoint
+	}
+	return os.Getenv(tracesEndpointEnvVar)
+}
+
+func (c *TraceConfig) getTailSampling() *TailSamplingConfig {
+	if c == nil || c.TailSampling == nil || !c.TailSampling.Enabled {
+		return nil
+	}
+	return c.TailSampling
+}
+
+func newTraceExporter(ctx context.Context, config *TraceConfig) (*otlptrace.Exporter, error) {
+	if config == nil {
+		config = &TraceConfig{}
+	}
+	endpoint := config.getEndpoint()
+	isURL := isEndpointURL(endpoint)
+
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Protocol == OTLPProtocolHTTP {
+		options := []otlptracehttp.Option{}
+		if isURL {
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		} else {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+		}
+		if len(config.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(config.Headers))
+		}
+		if tlsConfig != nil {
+			options = append(options, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		}
+		return otlptrace.New(ctx, otlptracehttp.NewClient(options...))
+	}
+
+	if config.Protocol != "" && config.Protocol != OTLPProtocolGRPC {
+		return nil, fmt.Errorf("unsupported trace exporter protocol: %s", config.Protocol)
+	}
+
+	options := []otlptracegrpc.Option{otlptracegrpc.WithDialOption(grpc.WithBlock())}
+	if isURL {
+		options = append(options, otlptracegrpc.WithEndpointURL(endpoint))
+	} else {
+		options = append(options, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	}
+	if len(config.Headers) > 0 {
+		options = append(options, otlptracegrpc.WithHeaders(config.Headers))
+	}
+	if tlsConfig != nil {
+		options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	return otlptrace.New(ctx, otlptracegrpc.NewClient(options...))
+}
+
+// isEndpointURL tells whether the endpoint is a URL rather than a host:port
+func isEndpointURL(endpoint string) bool {
+	parsedURL, err := url.Parse(endpoint)
+	return err == nil && parsedURL.Scheme != "" && parsedURL.Host != ""
+}
+
+func (c *TLSConfig) build() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec
+	}
+	if c.CAFile != "" {
+		caCert, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read exporter CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse exporter CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load exporter client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// NewSampler follows the sampling decision of the parent span,
+// and samples the root spans by ratio.
+// A flow with its own ratio samples its flow spans by that ratio, unless they continue
+// a remote trace, since flow spans are started under the span of the routed message.
+// With tail sampling, the spans which are not sampled are still recorded,
+// so the tail sampling processor can keep their trace.
+func NewSampler(config *TraceConfig) sdktrace.Sampler {
+	ratio := 1.0
+	if config != nil && config.SampleRatio != nil {
+		ratio = *config.SampleRatio
+	}
+
+	var sampler sdktrace.Sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	if config != nil && len(config.FlowSampleRatios) > 0 {
+		flowSamplers := make(map[string]sdktrace.Sampler, len(config.FlowSampleRatios))
+		for flowName, flowRatio := range config.FlowSampleRatios {
+			flowSamplers[flowName] = sdktrace.TraceIDRatioBased(flowRatio)
+		}
+		sampler = &flowSampler{
+			parentSampler: sampler,
+			flowSamplers:  flowSamplers,
+		}
+	}
+
+	if config.getTailSampling() != nil {
+		return &recordingSampler{sampler: sampler}
+	}
+	return sampler
+}
+
+// flowSampler samples the spans of a flow by the ratio of the flow,
+// overriding the decision of a local parent
+type flowSampler struct {
+	parentSampler sdktrace.Sampler
+	flowSamplers  map[string]sdktrace.Sampler
+}
+
+func (s *flowSampler) ShouldSample(params sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if trace.SpanContextFromContext(params.ParentContext).IsRemote() {
+		return s.parentSampler.ShouldSample(params)
+	}
+	for _, attr := range params.Attributes {
+		if attr.Key != FlowNameAttribute {
+			continue
+		}
+		if sampler, found := s.flowSamplers[attr.Value.AsString()]; found {
+			return sampler.ShouldSample(params)
+		}
+		break
+	}
+	return s.parentSampler.ShouldSample(params)
+}
+
+func (s *flowSampler) Description() string {
+	return fmt.Sprintf("FlowSampler{parent:%s,flows:%d}", s.parentSampler.Description(), len(s.flowSamplers))
+}
+
+// recordingSampler records the spans dropped by the wrapped sampler
+type recordingSampler struct {
+	sampler sdktrace.Sampler
+}
+
+func (s *recordingSampler) ShouldSample(params sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.sampler.ShouldSample(params)
+	if result.Decision == sdktrace.Drop {
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+func (s *recordingSampler) Description() string {
+	return fmt.Sprintf("Recording{%s}", s.sampler.Description())
+}
+
+// isLocalRoot tells whether the span is the first span of the trace in this process
+func isLocalRoot(span sdktrace.ReadOnlySpan) bool {
+	return !span.Parent().IsValid() || span.Parent().IsRemote()
+}
+
+// sampledSpan exposes a recorded span as sampled, so the exporting processor exports it
+type sampledSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	spanContext := s.ReadOnlySpan.SpanContext()
+	return spanContext.WithTraceFlags(spanContext.TraceFlags().WithSampled(true))
+}
+
+func logTraceConfig(config *TraceConfig) {
+	if config == nil {
+		return
+	}
+	log.Info().Msgf("Trace exporter: protocol=%q, endpoint=%q, tls=%v, sampler=%s",
+		config.Protocol, config.getEndpoint(), config.TLS != nil, NewSampler(config).Description())
+}
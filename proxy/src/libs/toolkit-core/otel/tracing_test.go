@@ -0,0 +1,207 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracer(config *TraceConfig) (trace.Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	var processor sdktrace.SpanProcessor = sdktrace.NewSimpleSpanProcessor(exporter)
+	if tailSampling := config.getTailSampling(); tailSampling != nil {
+		processor = newTailSamplingProcessor(processor, *tailSampling)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(NewSampler(config)),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	return provider.Tracer("test"), exporter
+}
+
+func ratio(value float64) *float64 {
+	return &value
+}
+
+func TestSamplerAppliesFlowRatio(t *testing.T) {
+	tracer, exporter := newTestTracer(&TraceConfig{
+		SampleRatio:      ratio(0),
+		FlowSampleRatios: map[string]float64{"critical": 1},
+	})
+
+	_, span := tracer.Start(context.Background(), "flow#critical",
+		trace.WithAttributes(FlowNameAttribute.String("critical")))
+	span.End()
+	_, span = tracer.Start(context.Background(), "flow#other",
+		trace.WithAttributes(FlowNameAttribute.String("other")))
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "flow#critical", spans[0].Name)
+}
+
+func TestSamplerFlowRatioOverridesLocalParent(t *testing.T) {
+	tracer, exporter := newTestTracer(&TraceConfig{
+		SampleRatio:      ratio(1),
+		FlowSampleRatios: map[string]float64{"noisy": 0},
+	})
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "flow#noisy",
+		trace.WithAttributes(FlowNameAttribute.String("noisy")))
+	child.End()
+	_, child = tracer.Start(ctx, "flow#other",
+		trace.WithAttributes(FlowNameAttribute.String("other")))
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "flow#other", spans[0].Name)
+	assert.Equal(t, "parent", spans[1].Name)
+}
+
+func TestSamplerFollowsRemoteParentDecision(t *testing.T) {
+	tracer, exporter := newTestTracer(&TraceConfig{
+		SampleRatio:      ratio(0),
+		FlowSampleRatios: map[string]float64{"noisy": 0},
+	})
+
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), remote)
+	_, span := tracer.Start(ctx, "flow#noisy",
+		trace.WithAttributes(FlowNameAttribute.String("noisy")))
+	span.End()
+
+	assert.Len(t, exporter.GetSpans(), 1)
+}
+
+func TestSamplerRecordsDroppedSpansWithTailSampling(t *testing.T) {
+	sampler := NewSampler(&TraceConfig{
+		SampleRatio:  ratio(0),
+		TailSampling: &TailSamplingConfig{Enabled: true},
+	})
+
+	result := sampler.ShouldSample(sdktrace.SamplingParameters{
+		TraceID: trace.TraceID{1},
+		Name:    "flow#any",
+	})
+	assert.Equal(t, sdktrace.RecordOnly, result.Decision)
+}
+
+func TestTailSamplingKeepsErroredTraces(t *testing.T) {
+	tracer, exporter := newTestTracer(&TraceConfig{
+		SampleRatio:  ratio(0),
+		TailSampling: &TailSamplingConfig{Enabled: true},
+	})
+
+	ctx, root := tracer.Start(context.Background(), "flow#errored")
+	_, first := tracer.Start(ctx, "processor#first")
+	first.End()
+	_, failing := tracer.Start(ctx, "processor#failing")
+	failing.SetStatus(codes.Error, "failed")
+	failing.End()
+	root.End()
+
+	_, other := tracer.Start(context.Background(), "flow#healthy")
+	other.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.True(t, span.SpanContext.IsSampled())
+		assert.NotEqual(t, "flow#healthy", span.Name)
+	}
+}
+
+func TestTailSamplingKeepsTracesByAttribute(t *testing.T) {
+	tracer, exporter := newTestTracer(&TraceConfig{
+		SampleRatio: ratio(0),
+		TailSampling: &TailSamplingConfig{
+			Enabled: true,
+			KeepAttributes: map[attribute.Key][]string{
+				"lunar.retry.attempt":       nil,
+				"http.response.status_code": {"429"},
+			},
+		},
+	})
+
+	_, span := tracer.Start(context.Background(), "flow#retried",
+		trace.WithAttributes(attribute.Int("lunar.retry.attempt", 1)))
+	span.End()
+	_, span = tracer.Start(context.Background(), "flow#throttled",
+		trace.WithAttributes(attribute.Int("http.response.status_code", 429)))
+	span.End()
+	_, span = tracer.Start(context.Background(), "flow#ok",
+		trace.WithAttributes(attribute.Int("http.response.status_code", 200)))
+	span.End()
+
+	names := []string{}
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+	assert.ElementsMatch(t, []string{"flow#retried", "flow#throttled"}, names)
+}
+
+func TestTailSamplingKeepsSlowTraces(t *testing.T) {
+	tracer, exporter := newTestTracer(&TraceConfig{
+		SampleRatio: ratio(0),
+		TailSampling: &TailSamplingConfig{
+			Enabled:          true,
+			LatencyThreshold: time.Second,
+		},
+	})
+
+	start := time.Now()
+	_, span := tracer.Start(context.Background(), "flow#slow", trace.WithTimestamp(start))
+	span.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+	_, span = tracer.Start(context.Background(), "flow#fast", trace.WithTimestamp(start))
+	span.End(trace.WithTimestamp(start.Add(time.Millisecond)))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "flow#slow", spans[0].Name)
+}
+
+func TestTailSamplingDropsExpiredAndOverflowingTraces(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := newTailSamplingProcessor(sdktrace.NewSimpleSpanProcessor(exporter),
+		TailSamplingConfig{Enabled: true, DecisionWait: time.Minute, MaxTraces: 2})
+	now := time.Now()
+	processor.now = func() time.Time { return now }
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(NewSampler(&TraceConfig{
+			SampleRatio:  ratio(0),
+			TailSampling: &TailSamplingConfig{Enabled: true},
+		})),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	tracer := provider.Tracer("test")
+
+	for range 3 {
+		_, span := tracer.Start(context.Background(), "flow#buffered")
+		span.End()
+	}
+	assert.Len(t, processor.traces, 2)
+
+	now = now.Add(2 * time.Minute)
+	_, span := tracer.Start(context.Background(), "flow#late")
+	span.End()
+	assert.Len(t, processor.traces, 1)
+	assert.Empty(t, exporter.GetSpans())
+}
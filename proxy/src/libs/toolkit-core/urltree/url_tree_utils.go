@@ -112,3 +112,29 @@ func TryExtractPathParameter(urlPart string) (string, bool) {
 	}
 	return "", false
 }
+
+// URLsOverlap reports whether a URL can match both filter URLs,
+// where path parameters match any part and a trailing wildcard matches any suffix
+func URLsOverlap(first, second string) bool {
+	firstParts, secondParts := splitURL(first), splitURL(second)
+	for index := 0; ; index++ {
+		firstEnded, secondEnded := index == len(firstParts), index == len(secondParts)
+		if (!firstEnded && firstParts[index].Value == wildcard) ||
+			(!secondEnded && secondParts[index].Value == wildcard) {
+			return true
+		}
+		if firstEnded || secondEnded {
+			return firstEnded && secondEnded
+		}
+
+		firstPart, secondPart := firstParts[index], secondParts[index]
+		if firstPart.IsPartOfHost != secondPart.IsPartOfHost {
+			return false
+		}
+		_, firstIsParam := TryExtractPathParameter(firstPart.Value)
+		_, secondIsParam := TryExtractPathParameter(secondPart.Value)
+		if !firstIsParam && !secondIsParam && firstPart.Value != secondPart.Value {
+			return false
+		}
+	}
+}
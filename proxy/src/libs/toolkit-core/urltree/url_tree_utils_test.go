@@ -33,3 +33,19 @@ func TestTryExtractPathParameterReturnsTrueAndParamNameWhenWrappedInBraces(
 	assert.Equal(t, true, valid)
 	assert.Equal(t, "foo", paramName)
 }
+
+func TestURLsOverlap(t *testing.T) {
+	t.Parallel()
+	assert.True(t, urltree.URLsOverlap("api.com/users/1", "api.com/users/1"))
+	assert.True(t, urltree.URLsOverlap("api.com/users/{id}", "api.com/users/1"))
+	assert.True(t, urltree.URLsOverlap("api.com/users/{id}", "api.com/{resource}/2"))
+	assert.True(t, urltree.URLsOverlap("api.com/*", "api.com/users/1"))
+	assert.True(t, urltree.URLsOverlap("api.com/users/1", "api.com/*"))
+	assert.True(t, urltree.URLsOverlap("api.com", "api.com/*"))
+
+	assert.False(t, urltree.URLsOverlap("api.com/users/1", "api.com/users/2"))
+	assert.False(t, urltree.URLsOverlap("api.com/users/{id}", "api.com/orders/1"))
+	assert.False(t, urltree.URLsOverlap("api.com/users", "api.com/users/1"))
+	assert.False(t, urltree.URLsOverlap("api.com/*", "other.com/*"))
+	assert.False(t, urltree.URLsOverlap("api.com/v1", "api.com.v1"))
+}
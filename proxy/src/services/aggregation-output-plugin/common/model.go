@@ -20,6 +20,8 @@ type AccessLog struct {
 	Duration               int                    `json:"duration"`
 	TotalDuration          int                    `json:"total_duration"` // spoe time + provider time
 	StatusCode             int                    `json:"status_code"`
+	RequestSize            int                    `json:"request_size"`
+	ResponseSize           int                    `json:"response_size"`
 	Method                 string                 `json:"method"`
 	Host                   string                 `json:"host"`
 	URL                    string                 `json:"url"`
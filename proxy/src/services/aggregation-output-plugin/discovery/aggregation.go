@@ -141,7 +141,46 @@ func extractEndpointAgg(records []AccessLog) sharedDiscovery.EndpointAgg {
 		StatusCodes:          statusCodes,
 		AverageDuration:      averageDuration,
 		AverageTotalDuration: averageTotalDuration,
+		DurationSketch: sharedDiscovery.NewSketch(lo.Map(
+			records,
+			func(accessLog AccessLog, _ int) float64 { return float64(accessLog.Duration) },
+		)...),
+		RequestSizeSketch: sizeSketch(records,
+			func(accessLog AccessLog) int { return accessLog.RequestSize }),
+		ResponseSizeSketch: sizeSketch(records,
+			func(accessLog AccessLog) int { return accessLog.ResponseSize }),
+		ErrorBuckets: countErrorBuckets(records),
+	}
+}
+
+// sizeSketch skips the unknown sizes, it is nil when no size is known
+func sizeSketch(records []AccessLog, getSize func(AccessLog) int) *sharedDiscovery.Sketch {
+	var sketch *sharedDiscovery.Sketch
+	for _, record := range records {
+		size := getSize(record)
+		if size <= 0 {
+			continue
+		}
+		if sketch == nil {
+			sketch = sharedDiscovery.NewSketch()
+		}
+		sketch.Add(float64(size))
+	}
+	return sketch
+}
+
+func countErrorBuckets(records []AccessLog) map[int64]sharedDiscovery.ErrorBucket {
+	buckets := make(map[int64]sharedDiscovery.ErrorBucket)
+	for _, record := range records {
+		start := sharedDiscovery.ErrorBucketStart(record.Timestamp)
+		bucket := buckets[start]
+		bucket.Count++
+		if sharedDiscovery.IsErrorStatus(record.StatusCode) {
+			bucket.Errors++
+		}
+		buckets[start] = bucket
 	}
+	return buckets
 }
 
 func countStatusCodes(records []AccessLog) map[int]sharedDiscovery.Count {
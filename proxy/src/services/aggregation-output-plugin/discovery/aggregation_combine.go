@@ -24,6 +24,7 @@ func (aggA Agg) Combine(aggB Agg) Agg {
 			aggA.Consumers,
 			aggB.Consumers,
 		),
+		Windows: aggA.Windows.Combine(aggB.Windows),
 	}
 }
 
@@ -325,3 +325,49 @@ func TestCombineAggMapsWhenBothEmptyItReturnsEmptyMap(t *testing.T) {
 
 	assert.Equal(t, combined, empty)
 }
+
+func TestCombineEndpointAggDistributionsAndErrorRates(t *testing.T) {
+	t.Parallel()
+	aggA := endpointAggA()
+	aggA.DurationSketch = sharedDiscovery.NewSketch(10, 9)
+	aggA.ErrorBuckets = map[int64]sharedDiscovery.ErrorBucket{
+		1687759200000: {Count: 2, Errors: 1},
+	}
+
+	aggB := endpointAggB()
+	aggB.DurationSketch = sharedDiscovery.NewSketch(6, 12, 18)
+	aggB.ResponseSizeSketch = sharedDiscovery.NewSketch(1024)
+	aggB.ErrorBuckets = map[int64]sharedDiscovery.ErrorBucket{
+		1687759200000: {Count: 1},
+		1687935600000: {Count: 2, Errors: 2},
+	}
+
+	combined := aggA.Combine(aggB)
+
+	assert.Equal(t, sharedDiscovery.NewSketch(10, 9, 6, 12, 18), combined.DurationSketch)
+	assert.Nil(t, combined.RequestSizeSketch)
+	assert.Equal(t, sharedDiscovery.NewSketch(1024), combined.ResponseSizeSketch)
+	assert.Equal(t, map[int64]sharedDiscovery.ErrorBucket{
+		1687759200000: {Count: 3, Errors: 1},
+		1687935600000: {Count: 2, Errors: 2},
+	}, combined.ErrorBuckets)
+	assert.Equal(t, sharedDiscovery.NewSketch(10, 9), aggA.DurationSketch,
+		"combine should not modify its operands")
+}
+
+func TestCombineErrorBucketsKeepsMostRecent(t *testing.T) {
+	t.Parallel()
+	bucketsA := map[int64]sharedDiscovery.ErrorBucket{}
+	bucketsB := map[int64]sharedDiscovery.ErrorBucket{}
+	for i := range sharedDiscovery.MaxErrorBuckets {
+		bucketsA[int64(i)*sharedDiscovery.ErrorBucketSizeMs] = sharedDiscovery.ErrorBucket{Count: 1}
+		bucketsB[int64(i+1)*sharedDiscovery.ErrorBucketSizeMs] = sharedDiscovery.ErrorBucket{Count: 1}
+	}
+
+	combined := sharedDiscovery.CombineErrorBuckets(bucketsA, bucketsB)
+
+	assert.Len(t, combined, sharedDiscovery.MaxErrorBuckets)
+	_, found := combined[0]
+	assert.False(t, found, "oldest bucket should be dropped")
+	assert.Equal(t, sharedDiscovery.Count(2), combined[sharedDiscovery.ErrorBucketSizeMs].Count)
+}
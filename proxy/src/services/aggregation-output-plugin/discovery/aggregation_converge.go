@@ -21,8 +21,33 @@ func ConvergeAggregation(
 	if !convergenceOccurred {
 		return aggregation, nil
 	}
+
+	converged := normalizeAggregation(aggregation, tree)
+	converged.Interceptors = aggregation.Interceptors
+	converged.Windows = normalizeWindows(aggregation.Windows, tree)
+	return converged, nil
+}
+
+// normalizeAggregation combines the endpoints and consumers aggregations
+// of the endpoints which normalize to the same endpoint
+func normalizeAggregation(aggregation Agg, tree common.SimpleURLTreeI) Agg {
+	consumerAgg := map[string]sharedDiscovery.EndpointMapping{}
+	for consumer, mapping := range aggregation.Consumers {
+		consumerAgg[consumer] = normalizeEndpoints(mapping, tree)
+	}
+
+	return Agg{
+		Endpoints: normalizeEndpoints(aggregation.Endpoints, tree),
+		Consumers: consumerAgg,
+	}
+}
+
+func normalizeEndpoints(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg,
+	tree common.SimpleURLTreeI,
+) map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg {
 	endpointsAgg := map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg{}
-	for endpoint, agg := range aggregation.Endpoints {
+	for endpoint, agg := range endpoints {
 		normEndpoint := sharedDiscovery.Endpoint{
 			Method: endpoint.Method,
 			URL:    common.NormalizeURL(tree, endpoint.URL),
@@ -33,27 +58,5 @@ func ConvergeAggregation(
 		}
 		endpointsAgg[normEndpoint] = endpointsAgg[normEndpoint].Combine(agg)
 	}
-
-	consumerAgg := map[string]sharedDiscovery.EndpointMapping{}
-	for consumer, mapping := range aggregation.Consumers {
-		normMapping := sharedDiscovery.EndpointMapping{}
-		for endpoint, agg := range mapping {
-			normEndpoint := sharedDiscovery.Endpoint{
-				Method: endpoint.Method,
-				URL:    common.NormalizeURL(tree, endpoint.URL),
-			}
-			if _, exists := normMapping[normEndpoint]; !exists {
-				normMapping[normEndpoint] = agg
-				continue
-			}
-			normMapping[normEndpoint] = normMapping[normEndpoint].Combine(agg)
-		}
-		consumerAgg[consumer] = normMapping
-	}
-
-	return Agg{
-		Interceptors: aggregation.Interceptors,
-		Endpoints:    endpointsAgg,
-		Consumers:    consumerAgg,
-	}, nil
+	return endpointsAgg
 }
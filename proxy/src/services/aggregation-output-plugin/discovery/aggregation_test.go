@@ -102,6 +102,11 @@ func TestExtractAggs(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{200: 1, 400: 1},
 		AverageDuration:      7.5,
 		AverageTotalDuration: 4,
+		DurationSketch:       sharedDiscovery.NewSketch(10, 5),
+		ErrorBuckets: map[int64]sharedDiscovery.ErrorBucket{
+			1687240800000: {Count: 1},
+			1687932000000: {Count: 1},
+		},
 	}
 
 	wantEndpointBAgg := sharedDiscovery.EndpointAgg{
@@ -111,6 +116,8 @@ func TestExtractAggs(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{401: 1},
 		AverageDuration:      58,
 		AverageTotalDuration: 50,
+		DurationSketch:       sharedDiscovery.NewSketch(58),
+		ErrorBuckets:         map[int64]sharedDiscovery.ErrorBucket{1688018400000: {Count: 1}},
 	}
 	wantEndpointCAgg := sharedDiscovery.EndpointAgg{
 		MinTime:              1687675938000,
@@ -119,6 +126,8 @@ func TestExtractAggs(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{404: 1},
 		AverageDuration:      298,
 		AverageTotalDuration: 200,
+		DurationSketch:       sharedDiscovery.NewSketch(298),
+		ErrorBuckets:         map[int64]sharedDiscovery.ErrorBucket{1687672800000: {Count: 1}},
 	}
 
 	wantInterceptorAAgg := discovery.InterceptorAgg{
@@ -230,6 +239,8 @@ func TestExtractAggsWithParametericPathParts(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{401: 1},
 		AverageDuration:      58,
 		AverageTotalDuration: 50,
+		DurationSketch:       sharedDiscovery.NewSketch(58),
+		ErrorBuckets:         map[int64]sharedDiscovery.ErrorBucket{1687932000000: {Count: 1}},
 	}
 
 	res := discovery.ExtractAggs(accessLogs, tree)
@@ -310,6 +321,8 @@ func TestExtractAggsWithPathParamsAndOverlappingConstantPart(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{401: 1},
 		AverageDuration:      58,
 		AverageTotalDuration: 50,
+		DurationSketch:       sharedDiscovery.NewSketch(58),
+		ErrorBuckets:         map[int64]sharedDiscovery.ErrorBucket{1687932000000: {Count: 1}},
 	}
 
 	res := discovery.ExtractAggs(accessLogs, tree)
@@ -327,3 +340,49 @@ func TestExtractAggsWithPathParamsAndOverlappingConstantPart(t *testing.T) {
 	assert.True(t, found)
 	assert.Equal(t, resB, wantEndpointBAgg)
 }
+
+func TestExtractAggsDistributionsAndErrorRates(t *testing.T) {
+	t.Parallel()
+	endpoint := sharedDiscovery.Endpoint{
+		Method: "POST",
+		URL:    "foo.org/bar",
+	}
+
+	tree, err := common.BuildTree(
+		sharedDiscovery.KnownEndpoints{Endpoints: []sharedDiscovery.Endpoint{endpoint}},
+		2,
+	)
+	assert.Nil(t, err)
+
+	var accessLogs []discovery.AccessLog
+	for i := 1; i <= 100; i++ {
+		statusCode := 200
+		if i%10 == 0 {
+			statusCode = 503
+		}
+		accessLogs = append(accessLogs, discovery.AccessLog{
+			Timestamp:    1687935138000 + int64(i%2)*sharedDiscovery.ErrorBucketSizeMs,
+			Duration:     i,
+			StatusCode:   statusCode,
+			RequestSize:  i * 10,
+			ResponseSize: 0,
+			Method:       endpoint.Method,
+			URL:          endpoint.URL,
+		})
+	}
+
+	res := discovery.ExtractAggs(accessLogs, tree)
+	agg, found := res.Endpoints[endpoint]
+	assert.True(t, found)
+
+	assert.InEpsilon(t, 50, agg.DurationSketch.Quantile(0.5), 0.01)
+	assert.InEpsilon(t, 90, agg.DurationSketch.Quantile(0.9), 0.01)
+	assert.InEpsilon(t, 99, agg.DurationSketch.Quantile(0.99), 0.01)
+	assert.InEpsilon(t, 500, agg.RequestSizeSketch.Quantile(0.5), 0.01)
+	assert.Nil(t, agg.ResponseSizeSketch, "unknown sizes should not be counted")
+
+	assert.Equal(t, map[int64]sharedDiscovery.ErrorBucket{
+		1687932000000: {Count: 50, Errors: 10},
+		1687935600000: {Count: 50, Errors: 0},
+	}, agg.ErrorBuckets)
+}
@@ -19,6 +19,7 @@ type (
 		Interceptors map[common.Interceptor]InterceptorAgg
 		Endpoints    map[shared_discovery.Endpoint]shared_discovery.EndpointAgg
 		Consumers    map[string]shared_discovery.EndpointMapping
+		Windows      Windows
 	}
 
 	InterceptorAgg struct {
@@ -4,29 +4,21 @@ import (
 	"lunar/aggregation-plugin/common"
 	sharedActions "lunar/shared-model/actions"
 	sharedDiscovery "lunar/shared-model/discovery"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
 )
 
 func ConvertToPersisted(aggregations Agg) sharedDiscovery.Output {
 	output := sharedDiscovery.Output{
+		Version:      sharedDiscovery.OutputVersion,
 		Interceptors: []sharedDiscovery.InterceptorOutput{},
-		Endpoints:    map[string]sharedDiscovery.EndpointOutput{},
-		Consumers:    map[string]map[string]sharedDiscovery.EndpointOutput{},
-	}
-
-	for endpoint, agg := range aggregations.Endpoints {
-		key := dumpEndpoint(endpoint)
-		output.Endpoints[key] = convertEndpointToPersisted(agg)
-	}
-
-	for consumer, endpoints := range aggregations.Consumers {
-		output.Consumers[consumer] = map[string]sharedDiscovery.EndpointOutput{}
-		for endpoint, agg := range endpoints {
-			key := dumpEndpoint(endpoint)
-			output.Consumers[consumer][key] = convertEndpointToPersisted(agg)
-		}
+		Endpoints:    convertEndpointsToPersisted(aggregations.Endpoints),
+		Consumers:    convertConsumersToPersisted(aggregations.Consumers),
+		Windows:      convertWindowsToPersisted(aggregations.Windows),
 	}
 
 	for interceptor, agg := range aggregations.Interceptors {
@@ -48,8 +40,14 @@ func ConvertFromPersisted(output sharedDiscovery.Output) *Agg {
 		Consumers:    map[string]sharedDiscovery.EndpointMapping{},
 	}
 
+	if output.Version > sharedDiscovery.OutputVersion {
+		log.Warn().Msgf("Discovery state version %d is newer than %d, unknown fields are dropped",
+			output.Version, sharedDiscovery.OutputVersion)
+	}
+
 	aggregations.Endpoints = sharedDiscovery.ConvertEndpointsFromPersisted(output.Endpoints)
 	aggregations.Consumers = sharedDiscovery.ConvertConsumersFromPersisted(output.Consumers)
+	aggregations.Windows = convertWindowsFromPersisted(output.Windows)
 
 	for _, interceptor := range output.Interceptors {
 		timestamp, err := sharedActions.TimestampFromStringToInt64(interceptor.LastTransactionDate)
@@ -72,6 +70,83 @@ func dumpEndpoint(endpoint sharedDiscovery.Endpoint) string {
 	return strings.Join([]string{endpoint.Method, endpoint.URL}, sharedDiscovery.EndpointDelimiter)
 }
 
+func convertEndpointsToPersisted(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg,
+) map[string]sharedDiscovery.EndpointOutput {
+	output := map[string]sharedDiscovery.EndpointOutput{}
+	for endpoint, agg := range endpoints {
+		output[dumpEndpoint(endpoint)] = convertEndpointToPersisted(agg)
+	}
+	return output
+}
+
+func convertConsumersToPersisted(
+	consumers map[string]sharedDiscovery.EndpointMapping,
+) map[string]map[string]sharedDiscovery.EndpointOutput {
+	output := map[string]map[string]sharedDiscovery.EndpointOutput{}
+	for consumer, endpoints := range consumers {
+		output[consumer] = convertEndpointsToPersisted(endpoints)
+	}
+	return output
+}
+
+func convertWindowsToPersisted(windows Windows) []sharedDiscovery.WindowSeriesOutput {
+	if len(windows) == 0 {
+		return nil
+	}
+	output := make([]sharedDiscovery.WindowSeriesOutput, 0, len(windows))
+	for _, series := range windows {
+		seriesOutput := sharedDiscovery.WindowSeriesOutput{
+			ResolutionSec: int64(series.Resolution.Size / time.Second),
+			RetentionSec:  int64(series.Resolution.Retention / time.Second),
+			Windows:       make([]sharedDiscovery.WindowOutput, 0, len(series.Windows)),
+		}
+		starts := lo.Keys(series.Windows)
+		slices.Sort(starts)
+		for _, start := range starts {
+			agg := series.Windows[start]
+			seriesOutput.Windows = append(seriesOutput.Windows, sharedDiscovery.WindowOutput{
+				Start: sharedActions.TimestampToStringFromInt64(start),
+				End: sharedActions.TimestampToStringFromInt64(
+					start + series.Resolution.Size.Milliseconds()),
+				Endpoints: convertEndpointsToPersisted(agg.Endpoints),
+				Consumers: convertConsumersToPersisted(agg.Consumers),
+			})
+		}
+		output = append(output, seriesOutput)
+	}
+	return output
+}
+
+func convertWindowsFromPersisted(output []sharedDiscovery.WindowSeriesOutput) Windows {
+	if len(output) == 0 {
+		return nil
+	}
+	windows := make(Windows, 0, len(output))
+	for _, seriesOutput := range output {
+		series := WindowSeries{
+			Resolution: WindowResolution{
+				Size:      time.Duration(seriesOutput.ResolutionSec) * time.Second,
+				Retention: time.Duration(seriesOutput.RetentionSec) * time.Second,
+			},
+			Windows: make(map[int64]Agg, len(seriesOutput.Windows)),
+		}
+		for _, window := range seriesOutput.Windows {
+			start, err := sharedActions.TimestampFromStringToInt64(window.Start)
+			if err != nil {
+				log.Error().Msgf("Error converting timestamp: %v", err)
+				continue
+			}
+			series.Windows[start] = Agg{
+				Endpoints: sharedDiscovery.ConvertEndpointsFromPersisted(window.Endpoints),
+				Consumers: sharedDiscovery.ConvertConsumersFromPersisted(window.Consumers),
+			}
+		}
+		windows = append(windows, series)
+	}
+	return windows
+}
+
 func convertMapOfCountToInt(counts map[int]sharedDiscovery.Count) map[int]int {
 	result := make(map[int]int)
 	for key, value := range counts {
@@ -88,5 +163,9 @@ func convertEndpointToPersisted(agg sharedDiscovery.EndpointAgg) sharedDiscovery
 		StatusCodes:          convertMapOfCountToInt(agg.StatusCodes),
 		AverageDuration:      agg.AverageDuration,
 		AverageTotalDuration: agg.AverageTotalDuration,
+		Duration:             sharedDiscovery.NewDistributionOutput(agg.DurationSketch),
+		RequestSize:          sharedDiscovery.NewDistributionOutput(agg.RequestSizeSketch),
+		ResponseSize:         sharedDiscovery.NewDistributionOutput(agg.ResponseSizeSketch),
+		ErrorRates:           sharedDiscovery.ConvertErrorRatesToPersisted(agg.ErrorBuckets),
 	}
 }
@@ -1,6 +1,7 @@
 package discovery_test
 
 import (
+	"encoding/json"
 	"lunar/aggregation-plugin/common"
 	"lunar/aggregation-plugin/discovery"
 	sharedDiscovery "lunar/shared-model/discovery"
@@ -54,6 +55,7 @@ func TestItConvertsAggregationAndAddRequiredRatiosFromTotalCount(t *testing.T) {
 	outputAgg := discovery.ConvertToPersisted(discoveryAgg)
 
 	wantDiscoveryOutput := sharedDiscovery.Output{
+		Version: sharedDiscovery.OutputVersion,
 		Interceptors: []sharedDiscovery.InterceptorOutput{
 			{
 				Type:                "lunar-aiohttp-interceptor",
@@ -87,3 +89,38 @@ func TestItConvertsAggregationAndAddRequiredRatiosFromTotalCount(t *testing.T) {
 
 	assert.Equal(t, wantDiscoveryOutput, outputAgg)
 }
+
+func TestDistributionsAndErrorRatesSurvivePersistence(t *testing.T) {
+	endpoint := sharedDiscovery.Endpoint{
+		Method: "GET",
+		URL:    "foo.com/bar",
+	}
+	agg := endpointAgg()
+	agg.DurationSketch = sharedDiscovery.NewSketch(0, 5, 14)
+	agg.RequestSizeSketch = sharedDiscovery.NewSketch(120, 4096)
+	agg.ErrorBuckets = map[int64]sharedDiscovery.ErrorBucket{
+		1687762800000: {Count: 4, Errors: 1},
+		1687759200000: {Count: 2},
+	}
+
+	output := discovery.ConvertToPersisted(discovery.Agg{
+		Endpoints: map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg{endpoint: agg},
+	})
+
+	endpointOutput := output.Endpoints["GET:::foo.com/bar"]
+	assert.InEpsilon(t, 5, endpointOutput.Duration.P50, 0.01)
+	assert.Equal(t, 14.0, endpointOutput.Duration.Max)
+	assert.Nil(t, endpointOutput.ResponseSize)
+	assert.Equal(t, []sharedDiscovery.ErrorRateOutput{
+		{Start: "2023-06-26T06:00:00Z", Count: 2, Errors: 0, ErrorRate: 0},
+		{Start: "2023-06-26T07:00:00Z", Count: 4, Errors: 1, ErrorRate: 0.25},
+	}, endpointOutput.ErrorRates)
+
+	data, err := json.Marshal(output)
+	assert.Nil(t, err)
+	var persisted sharedDiscovery.Output
+	assert.Nil(t, json.Unmarshal(data, &persisted))
+
+	restored := discovery.ConvertFromPersisted(persisted)
+	assert.Equal(t, agg, restored.Endpoints[endpoint])
+}
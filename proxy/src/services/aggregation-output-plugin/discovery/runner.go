@@ -37,6 +37,11 @@ func Run(
 		log.Error().Stack().Err(err).Msg("🛑 Failed to update aggregations")
 		return err
 	}
+	combinedAggsToPersist.Windows = combinedAggsToPersist.Windows.Update(
+		filteredRecords.AccessLogs,
+		tree,
+		context_manager.Get().GetClock().Now(),
+	)
 
 	log.Trace().Msgf("📦 [discovery] Combined: %+v\n", combinedAggsToPersist)
 
@@ -13,6 +13,8 @@ import (
 type State struct {
 	aggregation      *Agg
 	DiscoverFilepath string
+	// Resolutions are the time windows kept besides the cumulative aggregation
+	Resolutions []WindowResolution
 }
 
 func (state *State) InitializeState() error {
@@ -26,6 +28,7 @@ func (state *State) InitializeState() error {
 		initialAgg := Agg{
 			Endpoints:    map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg{},
 			Interceptors: map[common.Interceptor]InterceptorAgg{},
+			Windows:      NewWindows(state.Resolutions),
 		}
 		state.aggregation = &initialAgg
 		bytes, marshalErr := json.Marshal(ConvertToPersisted(initialAgg))
@@ -46,6 +49,7 @@ func (state *State) InitializeState() error {
 		return err
 	}
 	state.aggregation = ConvertFromPersisted(output)
+	state.aggregation.Windows = state.aggregation.Windows.WithResolutions(state.Resolutions)
 	return nil
 }
 
@@ -0,0 +1,235 @@
+package discovery
+
+import (
+	"fmt"
+	"lunar/aggregation-plugin/common"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+)
+
+const (
+	// windowResolutionsEnvVar lists the window resolutions as size:retention pairs,
+	// e.g. "1m:1h,1h:168h". Windows are disabled when it is set empty.
+	windowResolutionsEnvVar = "LUNAR_DISCOVERY_WINDOWS"
+	// maxWindowsPerSeries bounds the windows kept for a resolution
+	maxWindowsPerSeries = 1000
+)
+
+var defaultWindowResolutions = []WindowResolution{
+	{Size: time.Minute, Retention: time.Hour},
+	{Size: time.Hour, Retention: 7 * 24 * time.Hour},
+}
+
+type WindowResolution struct {
+	Size      time.Duration
+	Retention time.Duration
+}
+
+func (resolution WindowResolution) maxWindows() int {
+	return int(resolution.Retention / resolution.Size)
+}
+
+// WindowSeries aggregates the access logs per window of its resolution
+type WindowSeries struct {
+	Resolution WindowResolution
+	// Windows are keyed by their start (ms), they hold no interceptors
+	Windows map[int64]Agg
+}
+
+// Windows are the window series of the configured resolutions
+type Windows []WindowSeries
+
+func LoadWindowResolutions() []WindowResolution {
+	raw, valid := os.LookupEnv(windowResolutionsEnvVar)
+	if !valid {
+		return defaultWindowResolutions
+	}
+	resolutions, err := ParseWindowResolutions(raw)
+	if err != nil {
+		log.Warn().Err(err).
+			Msgf("Could not parse %v, will use %v as default",
+				windowResolutionsEnvVar, defaultWindowResolutions)
+		return defaultWindowResolutions
+	}
+	log.Info().Msgf("Will keep discovery windows of %v", resolutions)
+	return resolutions
+}
+
+func ParseWindowResolutions(raw string) ([]WindowResolution, error) {
+	resolutions := []WindowResolution{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		sizeAndRetention := strings.Split(part, ":")
+		if len(sizeAndRetention) != 2 {
+			return nil, fmt.Errorf("window resolution %q is not size:retention", part)
+		}
+		size, err := time.ParseDuration(sizeAndRetention[0])
+		if err != nil {
+			return nil, fmt.Errorf("window size of %q: %w", part, err)
+		}
+		retention, err := time.ParseDuration(sizeAndRetention[1])
+		if err != nil {
+			return nil, fmt.Errorf("window retention of %q: %w", part, err)
+		}
+		resolution := WindowResolution{Size: size, Retention: retention}
+		switch {
+		case size < time.Second || size%time.Second != 0:
+			return nil, fmt.Errorf("window size of %q must be whole seconds", part)
+		case retention < size:
+			return nil, fmt.Errorf("window retention of %q is shorter than its size", part)
+		case resolution.maxWindows() > maxWindowsPerSeries:
+			return nil, fmt.Errorf("window resolution %q keeps more than %d windows",
+				part, maxWindowsPerSeries)
+		case slices.ContainsFunc(resolutions, func(other WindowResolution) bool {
+			return other.Size == size
+		}):
+			return nil, fmt.Errorf("window size of %q is duplicated", part)
+		}
+		resolutions = append(resolutions, resolution)
+	}
+	return resolutions, nil
+}
+
+func NewWindows(resolutions []WindowResolution) Windows {
+	return Windows(nil).WithResolutions(resolutions)
+}
+
+// WithResolutions keeps the windows of the given resolutions, other windows are dropped
+func (windows Windows) WithResolutions(resolutions []WindowResolution) Windows {
+	if len(resolutions) == 0 {
+		return nil
+	}
+	result := make(Windows, 0, len(resolutions))
+	for _, resolution := range resolutions {
+		series := WindowSeries{Resolution: resolution, Windows: map[int64]Agg{}}
+		if existing, found := windows.find(resolution.Size); found {
+			series.Windows = existing.Windows
+		}
+		result = append(result, series)
+	}
+	return result
+}
+
+// Update aggregates the access logs into their windows,
+// and drops the windows past the retention of their resolution
+func (windows Windows) Update(
+	accessLogs []AccessLog,
+	tree common.SimpleURLTreeI,
+	now time.Time,
+) Windows {
+	if len(windows) == 0 {
+		return windows
+	}
+	result := make(Windows, 0, len(windows))
+	for _, series := range windows {
+		updated := WindowSeries{
+			Resolution: series.Resolution,
+			Windows:    make(map[int64]Agg, len(series.Windows)),
+		}
+		for start, agg := range series.Windows {
+			updated.Windows[start] = agg
+		}
+
+		sizeMs := series.Resolution.Size.Milliseconds()
+		byWindow := lo.GroupBy(accessLogs, func(accessLog AccessLog) int64 {
+			return accessLog.Timestamp - accessLog.Timestamp%sizeMs
+		})
+		for start, logs := range byWindow {
+			windowAgg := ExtractAggs(logs, tree)
+			windowAgg.Interceptors = nil
+			if existing, found := updated.Windows[start]; found {
+				windowAgg = existing.Combine(windowAgg)
+			}
+			updated.Windows[start] = windowAgg
+		}
+
+		updated.prune(now)
+		result = append(result, updated)
+	}
+	return result
+}
+
+func (windows Windows) Combine(other Windows) Windows {
+	if len(windows) == 0 && len(other) == 0 {
+		return nil
+	}
+	result := make(Windows, 0, len(windows))
+	for _, series := range windows {
+		combined := WindowSeries{
+			Resolution: series.Resolution,
+			Windows:    make(map[int64]Agg, len(series.Windows)),
+		}
+		for start, agg := range series.Windows {
+			combined.Windows[start] = agg
+		}
+		if otherSeries, found := other.find(series.Resolution.Size); found {
+			for start, agg := range otherSeries.Windows {
+				if existing, exists := combined.Windows[start]; exists {
+					agg = existing.Combine(agg)
+				}
+				combined.Windows[start] = agg
+			}
+		}
+		result = append(result, combined)
+	}
+	for _, series := range other {
+		if _, found := windows.find(series.Resolution.Size); !found {
+			result = append(result, series)
+		}
+	}
+	return result
+}
+
+func (windows Windows) find(size time.Duration) (WindowSeries, bool) {
+	return lo.Find(windows, func(series WindowSeries) bool {
+		return series.Resolution.Size == size
+	})
+}
+
+// prune drops the windows ending before the retention,
+// and the oldest windows beyond the number of windows of the retention
+func (series WindowSeries) prune(now time.Time) {
+	cutoff := now.Add(-series.Resolution.Retention).UnixMilli()
+	sizeMs := series.Resolution.Size.Milliseconds()
+	for start := range series.Windows {
+		if start+sizeMs <= cutoff {
+			delete(series.Windows, start)
+		}
+	}
+
+	maxWindows := series.Resolution.maxWindows()
+	if len(series.Windows) <= maxWindows {
+		return
+	}
+	starts := lo.Keys(series.Windows)
+	slices.Sort(starts)
+	for _, start := range starts[:len(starts)-maxWindows] {
+		delete(series.Windows, start)
+	}
+}
+
+func normalizeWindows(windows Windows, tree common.SimpleURLTreeI) Windows {
+	if len(windows) == 0 {
+		return windows
+	}
+	result := make(Windows, 0, len(windows))
+	for _, series := range windows {
+		normalized := WindowSeries{
+			Resolution: series.Resolution,
+			Windows:    make(map[int64]Agg, len(series.Windows)),
+		}
+		for start, agg := range series.Windows {
+			normalized.Windows[start] = normalizeAggregation(agg, tree)
+		}
+		result = append(result, normalized)
+	}
+	return result
+}
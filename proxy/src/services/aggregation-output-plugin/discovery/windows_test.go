@@ -0,0 +1,161 @@
+package discovery_test
+
+import (
+	"encoding/json"
+	"lunar/aggregation-plugin/common"
+	"lunar/aggregation-plugin/discovery"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testWindowResolutions = []discovery.WindowResolution{
+	{Size: time.Minute, Retention: time.Hour},
+	{Size: time.Hour, Retention: 7 * 24 * time.Hour},
+}
+
+func windowsTestTree(t *testing.T, endpoints ...sharedDiscovery.Endpoint) common.SimpleURLTreeI {
+	tree, err := common.BuildTree(sharedDiscovery.KnownEndpoints{Endpoints: endpoints}, 2)
+	require.Nil(t, err)
+	return tree
+}
+
+func windowAccessLog(endpoint sharedDiscovery.Endpoint, timestamp time.Time) discovery.AccessLog {
+	return discovery.AccessLog{
+		Timestamp:   timestamp.UnixMilli(),
+		Duration:    10,
+		StatusCode:  200,
+		Method:      endpoint.Method,
+		URL:         endpoint.URL,
+		ConsumerTag: "consumerA",
+	}
+}
+
+func TestWindowsAggregatePerResolution(t *testing.T) {
+	t.Parallel()
+	endpoint := sharedDiscovery.Endpoint{Method: "GET", URL: "foo.org/bar"}
+	tree := windowsTestTree(t, endpoint)
+	now := time.Date(2023, 6, 28, 12, 30, 0, 0, time.UTC)
+
+	windows := discovery.NewWindows(testWindowResolutions).Update(
+		[]discovery.AccessLog{
+			windowAccessLog(endpoint, now.Add(-90*time.Second)),
+			windowAccessLog(endpoint, now.Add(-80*time.Second)),
+			windowAccessLog(endpoint, now.Add(-10*time.Second)),
+		},
+		tree,
+		now,
+	)
+
+	require.Len(t, windows, 2)
+	minutes := windows[0].Windows
+	require.Len(t, minutes, 2)
+	assert.Equal(t, sharedDiscovery.Count(2),
+		minutes[now.Add(-2*time.Minute).UnixMilli()].Endpoints[endpoint].Count)
+	assert.Equal(t, sharedDiscovery.Count(1),
+		minutes[now.Add(-time.Minute).UnixMilli()].Consumers["consumerA"][endpoint].Count)
+
+	hours := windows[1].Windows
+	require.Len(t, hours, 1)
+	assert.Equal(t, sharedDiscovery.Count(3),
+		hours[now.Add(-30*time.Minute).UnixMilli()].Endpoints[endpoint].Count)
+}
+
+func TestWindowsDropWindowsPastRetention(t *testing.T) {
+	t.Parallel()
+	endpoint := sharedDiscovery.Endpoint{Method: "GET", URL: "foo.org/bar"}
+	tree := windowsTestTree(t, endpoint)
+	start := time.Date(2023, 6, 28, 12, 0, 0, 0, time.UTC)
+
+	windows := discovery.NewWindows(testWindowResolutions[:1])
+	for minute := range 90 {
+		timestamp := start.Add(time.Duration(minute) * time.Minute)
+		windows = windows.Update(
+			[]discovery.AccessLog{windowAccessLog(endpoint, timestamp)},
+			tree,
+			timestamp,
+		)
+	}
+
+	minutes := windows[0].Windows
+	assert.Len(t, minutes, 60)
+	_, found := minutes[start.Add(29*time.Minute).UnixMilli()]
+	assert.False(t, found, "window past the retention should be dropped")
+	_, found = minutes[start.Add(30*time.Minute).UnixMilli()]
+	assert.True(t, found)
+}
+
+func TestWindowsSurvivePersistenceAndQueries(t *testing.T) {
+	t.Parallel()
+	endpoint := sharedDiscovery.Endpoint{Method: "GET", URL: "foo.org/bar"}
+	tree := windowsTestTree(t, endpoint)
+	now := time.Date(2023, 6, 28, 12, 30, 0, 0, time.UTC)
+
+	agg := discovery.Agg{Windows: discovery.NewWindows(testWindowResolutions)}
+	agg.Windows = agg.Windows.Update(
+		[]discovery.AccessLog{
+			windowAccessLog(endpoint, now.Add(-5*time.Minute)),
+			windowAccessLog(endpoint, now.Add(-2*time.Hour)),
+		},
+		tree,
+		now,
+	)
+
+	data, err := json.Marshal(discovery.ConvertToPersisted(agg))
+	require.Nil(t, err)
+	var output sharedDiscovery.Output
+	require.Nil(t, json.Unmarshal(data, &output))
+	assert.Equal(t, sharedDiscovery.OutputVersion, output.Version)
+
+	restored := discovery.ConvertFromPersisted(output)
+	assert.Equal(t, agg.Windows, restored.Windows)
+
+	lastTenMinutes, err := output.QueryWindows(now.Add(-10*time.Minute), now, now, 0)
+	require.Nil(t, err)
+	assert.Equal(t, int64(60), lastTenMinutes.ResolutionSec)
+	require.Len(t, lastTenMinutes.Windows, 1)
+	assert.Equal(t, "2023-06-28T12:25:00Z", lastTenMinutes.Windows[0].Start)
+	assert.Equal(t, 1, lastTenMinutes.Windows[0].Endpoints["GET:::foo.org/bar"].Count)
+
+	lastDay, err := output.QueryWindows(now.Add(-24*time.Hour), now, now, 0)
+	require.Nil(t, err)
+	assert.Equal(t, int64(3600), lastDay.ResolutionSec)
+	assert.Len(t, lastDay.Windows, 2)
+
+	_, err = output.QueryWindows(now.Add(-time.Hour), now, now, 5*time.Minute)
+	assert.NotNil(t, err)
+}
+
+func TestLegacyStateHasNoWindows(t *testing.T) {
+	t.Parallel()
+	legacy := `{"created_at":"","interceptors":[],"endpoints":{},"consumers":{}}`
+	var output sharedDiscovery.Output
+	require.Nil(t, json.Unmarshal([]byte(legacy), &output))
+
+	agg := discovery.ConvertFromPersisted(output)
+	assert.Nil(t, agg.Windows)
+	agg.Windows = agg.Windows.WithResolutions(testWindowResolutions)
+	assert.Len(t, agg.Windows, 2)
+
+	_, err := output.QueryWindows(time.Now().Add(-time.Hour), time.Now(), time.Now(), 0)
+	assert.ErrorIs(t, err, sharedDiscovery.ErrNoWindows)
+}
+
+func TestParseWindowResolutions(t *testing.T) {
+	t.Parallel()
+	resolutions, err := discovery.ParseWindowResolutions("1m:1h, 1h:168h")
+	require.Nil(t, err)
+	assert.Equal(t, testWindowResolutions, resolutions)
+
+	resolutions, err = discovery.ParseWindowResolutions("")
+	require.Nil(t, err)
+	assert.Empty(t, resolutions)
+
+	for _, invalid := range []string{"1m", "1m:30s", "1s:24h", "500ms:1m", "1m:1h,1m:2h", "x:1h"} {
+		_, err = discovery.ParseWindowResolutions(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -51,6 +51,7 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 	log.Info().Msgf("Initializing %s plugin", appName)
 	discoveryState := discovery.State{
 		DiscoverFilepath: discoveryStateLocation,
+		Resolutions:      discovery.LoadWindowResolutions(),
 	}
 	err := discoveryState.InitializeState()
 	if err != nil {
@@ -16,6 +16,12 @@ const (
 	AsyncServiceIdleSecEnvKey                 = "ASYNC_SERVICE_IDLE_SEC"
 	asyncServiceRemoveCompletedRequestsEnvKey = "ASYNC_SERVICE_REMOVE_COMPLETED_REQUESTS_AFTER_MIN"
 	asyncServiceRemoveRetrievedResponseEnvKey = "ASYNC_SERVICE_REMOVE_RETRIEVED_RESPONSE_AFTER_MIN"
+	asyncServiceStorageDirEnvKey              = "ASYNC_SERVICE_STORAGE_DIR"
+	asyncServiceCallbackMaxAttemptsEnvKey     = "ASYNC_SERVICE_CALLBACK_MAX_ATTEMPTS"
+	asyncServiceCallbackTimeoutEnvKey         = "ASYNC_SERVICE_CALLBACK_TIMEOUT_SEC"
+	asyncServiceCallbackMaxBackoffEnvKey      = "ASYNC_SERVICE_CALLBACK_MAX_BACKOFF_SEC"
+	asyncServiceRequestMaxAttemptsEnvKey      = "ASYNC_SERVICE_REQUEST_MAX_ATTEMPTS"
+	asyncServiceRequestTTLEnvKey              = "ASYNC_SERVICE_REQUEST_TTL_MIN"
 
 	defaultAsyncServiceBindPort       = "8010"
 	defaultEngineBindPort             = "8000"
@@ -23,6 +29,12 @@ const (
 	defaultIdleSec                    = 60
 	defaultRemoveCompletedRequestsMin = 60
 	defaultRemoveRetrievedResponseMin = 60
+	defaultStorageDir                 = "/var/lib/lunar-proxy/async-service"
+	defaultCallbackMaxAttempts        = 5
+	defaultCallbackTimeoutSec         = 10
+	defaultCallbackMaxBackoffSec      = 300
+	defaultRequestMaxAttempts         = 10
+	defaultRequestTTLMin              = 60
 )
 
 func GetEngineBindPort() string {
@@ -91,6 +103,66 @@ func GetAsyncServiceIdle() time.Duration {
 	return time.Duration(idle) * time.Second
 }
 
+func GetAsyncServiceStorageDir() string {
+	storageDir, err := GetEnv(asyncServiceStorageDirEnvKey)
+	if err != nil || storageDir == "" {
+		log.Debug().Msgf("%s not set, using default storage directory %s",
+			asyncServiceStorageDirEnvKey, defaultStorageDir)
+		return defaultStorageDir
+	}
+	return storageDir
+}
+
+func GetAsyncServiceCallbackMaxAttempts() int {
+	maxAttempts, err := GetEnvInt(asyncServiceCallbackMaxAttemptsEnvKey)
+	if err != nil || maxAttempts <= 0 {
+		log.Debug().Msgf("%s not set, using default callback max attempts %d",
+			asyncServiceCallbackMaxAttemptsEnvKey, defaultCallbackMaxAttempts)
+		return defaultCallbackMaxAttempts
+	}
+	return maxAttempts
+}
+
+func GetAsyncServiceCallbackTimeout() time.Duration {
+	timeout, err := GetEnvInt(asyncServiceCallbackTimeoutEnvKey)
+	if err != nil || timeout <= 0 {
+		log.Debug().Msgf("%s not set, using default callback timeout %d",
+			asyncServiceCallbackTimeoutEnvKey, defaultCallbackTimeoutSec)
+		timeout = defaultCallbackTimeoutSec
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func GetAsyncServiceCallbackMaxBackoff() time.Duration {
+	maxBackoff, err := GetEnvInt(asyncServiceCallbackMaxBackoffEnvKey)
+	if err != nil || maxBackoff <= 0 {
+		log.Debug().Msgf("%s not set, using default callback max backoff %d",
+			asyncServiceCallbackMaxBackoffEnvKey, defaultCallbackMaxBackoffSec)
+		maxBackoff = defaultCallbackMaxBackoffSec
+	}
+	return time.Duration(maxBackoff) * time.Second
+}
+
+func GetAsyncServiceRequestMaxAttempts() int {
+	maxAttempts, err := GetEnvInt(asyncServiceRequestMaxAttemptsEnvKey)
+	if err != nil || maxAttempts <= 0 {
+		log.Debug().Msgf("%s not set, using default request max attempts %d",
+			asyncServiceRequestMaxAttemptsEnvKey, defaultRequestMaxAttempts)
+		return defaultRequestMaxAttempts
+	}
+	return maxAttempts
+}
+
+func GetAsyncServiceRequestTTL() time.Duration {
+	ttl, err := GetEnvInt(asyncServiceRequestTTLEnvKey)
+	if err != nil || ttl <= 0 {
+		log.Debug().Msgf("%s not set, using default request TTL %d",
+			asyncServiceRequestTTLEnvKey, defaultRequestTTLMin)
+		ttl = defaultRequestTTLMin
+	}
+	return time.Duration(ttl) * time.Minute
+}
+
 func GetEnvInt(key string) (int, error) {
 	val, err := GetEnv(key)
 	if err != nil {
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	callbackSignaturePrefix = "sha256="
+	callbackInitialBackoff  = time.Second
+	callbackErrorBodyLimit  = 256
+)
+
+// CallbackPayload is the body POSTed to the callback URL once the request completes
+type CallbackPayload struct {
+	SequenceID string            `json:"sequence_id"`
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// ParseCallback extracts the callback registered with the request headers, if any
+func ParseCallback(request *http.Request) (*storage.Callback, error) {
+	callbackURL := request.Header.Get(AsyncServiceCallbackURLHeaderName)
+	if callbackURL == "" {
+		return nil, nil
+	}
+
+	parsedURL, err := url.Parse(callbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid callback URL: %w", err)
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid callback URL %s, expected an absolute http(s) URL", callbackURL)
+	}
+
+	return &storage.Callback{
+		URL:    callbackURL,
+		Secret: request.Header.Get(AsyncServiceCallbackSecretHeaderName),
+	}, nil
+}
+
+// SignCallback returns the signature header value of the payload sent at the given timestamp.
+// Receivers verify it by computing HMAC-SHA256 over '<timestamp>.<body>' with the shared secret.
+func SignCallback(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return callbackSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+type CallbackDeliverer struct {
+	client      *http.Client
+	maxAttempts int
+	maxBackoff  time.Duration
+}
+
+func NewCallbackDeliverer(timeout time.Duration, maxAttempts int, maxBackoff time.Duration) *CallbackDeliverer {
+	return &CallbackDeliverer{
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		maxBackoff:  maxBackoff,
+	}
+}
+
+// Deliver POSTs the response to its callback and returns the updated callback state
+func (d *CallbackDeliverer) Deliver(record storage.ResponseRecord) storage.Callback {
+	callback := *record.Callback
+	callback.Attempts++
+
+	err := d.send(record)
+	if err == nil {
+		callback.State = storage.CallbackDelivered
+		callback.LastError = ""
+		return callback
+	}
+
+	callback.LastError = err.Error()
+	if callback.Attempts >= d.maxAttempts {
+		callback.State = storage.CallbackDeadLetter
+		return callback
+	}
+	callback.NextAttemptAt = context_manager.Get().GetClock().Now().
+		Add(d.backoff(callback.Attempts))
+	return callback
+}
+
+func (d *CallbackDeliverer) send(record storage.ResponseRecord) error {
+	response := record.Response
+	payload, err := json.Marshal(CallbackPayload{
+		SequenceID: response.ID,
+		Status:     response.Status,
+		Headers:    response.Headers,
+		Body:       response.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal callback payload: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, record.Callback.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(context_manager.Get().GetClock().Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(utils.HeaderLunarRequestID, response.ID)
+	request.Header.Set(CallbackTimestampHeaderName, timestamp)
+	if record.Callback.Secret != "" {
+		request.Header.Set(CallbackSignatureHeaderName,
+			SignCallback(record.Callback.Secret, timestamp, payload))
+	}
+
+	callbackResponse, err := d.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("callback request failed: %w", err)
+	}
+	defer callbackResponse.Body.Close()
+
+	if callbackResponse.StatusCode < 200 || callbackResponse.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(callbackResponse.Body, callbackErrorBodyLimit))
+		return fmt.Errorf("callback returned %d: %s", callbackResponse.StatusCode, body)
+	}
+	return nil
+}
+
+// backoff doubles the wait after each failed attempt, up to maxBackoff
+func (d *CallbackDeliverer) backoff(attempts int) time.Duration {
+	backoff := callbackInitialBackoff
+	for i := 1; i < attempts && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.maxBackoff)
+}
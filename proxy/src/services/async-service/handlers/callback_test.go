@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	stream_types "lunar/engine/streams/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCallback(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	callback, err := ParseCallback(req)
+	require.NoError(t, err)
+	assert.Nil(t, callback)
+
+	req.Header.Set(AsyncServiceCallbackURLHeaderName, "https://hooks.example.com/done")
+	req.Header.Set(AsyncServiceCallbackSecretHeaderName, "s3cr3t")
+	callback, err = ParseCallback(req)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/done", callback.URL)
+	assert.Equal(t, "s3cr3t", callback.Secret)
+
+	for _, invalidURL := range []string{"/relative", "ftp://hooks.example.com", "https://"} {
+		req.Header.Set(AsyncServiceCallbackURLHeaderName, invalidURL)
+		_, err = ParseCallback(req)
+		assert.Error(t, err, invalidURL)
+	}
+}
+
+func TestCallbackDeliverySigned(t *testing.T) {
+	var received CallbackPayload
+	var signature, timestamp, seqID string
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		signature = req.Header.Get(CallbackSignatureHeaderName)
+		timestamp = req.Header.Get(CallbackTimestampHeaderName)
+		seqID = req.Header.Get(utils.HeaderLunarRequestID)
+		assert.Equal(t, SignCallback("s3cr3t", timestamp, body), signature)
+		assert.NoError(t, json.Unmarshal(body, &received))
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	deliverer := NewCallbackDeliverer(time.Second, 3, time.Minute)
+	callback := deliverer.Deliver(newCallbackRecord(receiver.URL, "s3cr3t"))
+
+	assert.Equal(t, storage.CallbackDelivered, callback.State)
+	assert.Equal(t, 1, callback.Attempts)
+	assert.Equal(t, "req-1", seqID)
+	assert.NotEmpty(t, timestamp)
+	assert.Contains(t, signature, callbackSignaturePrefix)
+	assert.Equal(t, CallbackPayload{
+		SequenceID: "req-1",
+		Status:     http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       `{"done":true}`,
+	}, received)
+}
+
+func TestCallbackDeliveryRetriesAndDeadLetter(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = writer.Write([]byte("down"))
+	}))
+	defer receiver.Close()
+
+	deliverer := NewCallbackDeliverer(time.Second, 3, 90*time.Second)
+	record := newCallbackRecord(receiver.URL, "")
+
+	before := time.Now()
+	callback := deliverer.Deliver(record)
+	assert.Equal(t, storage.CallbackPending, callback.State)
+	assert.Equal(t, 1, callback.Attempts)
+	assert.Contains(t, callback.LastError, "503")
+	assert.WithinDuration(t, before.Add(time.Second), callback.NextAttemptAt, 500*time.Millisecond)
+
+	record.Callback = &callback
+	callback = deliverer.Deliver(record)
+	assert.Equal(t, storage.CallbackPending, callback.State)
+	assert.Equal(t, 2, callback.Attempts)
+
+	record.Callback = &callback
+	callback = deliverer.Deliver(record)
+	assert.Equal(t, storage.CallbackDeadLetter, callback.State)
+	assert.Equal(t, 3, callback.Attempts)
+}
+
+func TestCallbackBackoff(t *testing.T) {
+	deliverer := NewCallbackDeliverer(time.Second, 10, 5*time.Second)
+	assert.Equal(t, time.Second, deliverer.backoff(1))
+	assert.Equal(t, 2*time.Second, deliverer.backoff(2))
+	assert.Equal(t, 4*time.Second, deliverer.backoff(3))
+	assert.Equal(t, 5*time.Second, deliverer.backoff(4))
+	assert.Equal(t, 5*time.Second, deliverer.backoff(20))
+}
+
+func newCallbackRecord(callbackURL, secret string) storage.ResponseRecord {
+	return storage.ResponseRecord{
+		Response: &stream_types.OnResponse{
+			ID:      "req-1",
+			Status:  http.StatusOK,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    `{"done":true}`,
+		},
+		Callback: &storage.Callback{
+			URL:    callbackURL,
+			Secret: secret,
+			State:  storage.CallbackPending,
+		},
+	}
+}
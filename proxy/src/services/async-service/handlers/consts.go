@@ -1,5 +1,3 @@
-//go:build pro
-
 package handlers
 
 const (
@@ -10,7 +8,14 @@ const (
 	AsyncServiceHeaderName         = "X-Lunar-Async"
 	AsyncServiceEnqueuedHeaderName = "X-Lunar-Enqueued"
 
+	AsyncServiceCallbackURLHeaderName    = "X-Lunar-Async-Callback-Url"
+	AsyncServiceCallbackSecretHeaderName = "X-Lunar-Async-Callback-Secret"
+	AsyncServiceCallbackStateHeaderName  = "X-Lunar-Async-Callback-State"
+	CallbackSignatureHeaderName          = "X-Lunar-Signature"
+	CallbackTimestampHeaderName          = "X-Lunar-Timestamp"
+
 	asyncServiceFlowIndicatorHeaderName      = "X-Lunar-Async-Flow"
+	asyncServiceAttemptHeaderName            = "X-Lunar-Async-Attempt"
 	asyncServiceResponseNotAllowedHeaderName = "X-Lunar-Async-State"
 	asyncServiceResponseRegister             = "register"
 	asyncServiceResponseBlocked              = "blocked"
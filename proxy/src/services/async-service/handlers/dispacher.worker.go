@@ -6,7 +6,6 @@ import (
 	"lunar/async-service/utils"
 	stream_types "lunar/engine/streams/types"
 	protocol_async "lunar/toolkit-core/network/protocols/async"
-	"net/http"
 
 	"github.com/rs/zerolog"
 )
@@ -73,7 +72,7 @@ func (w *worker) processJob(
 		response.SequenceID = asyncReq.ID
 	}
 
-	operation := w.getOperationBasedOnResponse(response, IDLogger)
+	operation := getOperationBasedOnResponse(response, IDLogger)
 	if operation == addResponse {
 		err = w.onResponse(asyncReq, response)
 		if err != nil {
@@ -122,31 +121,3 @@ func (w *worker) prepareRequest(
 
 	return request
 }
-
-func (w *worker) getOperationBasedOnResponse(
-	response *stream_types.OnResponse,
-	IDLogger zerolog.Logger,
-) workerResult {
-	if response.Status != http.StatusAccepted {
-		return addResponse
-	}
-
-	headerVal, found := response.Headers[asyncServiceResponseNotAllowedHeaderName]
-	if !found {
-		return addResponse
-	}
-
-	switch headerVal {
-	case asyncServiceResponseRegister:
-		return addToPending
-	case asyncServiceResponseBlocked:
-		return addToPending
-	case asyncServiceResponseError:
-		return addToIdle
-	case asyncServiceResponseRetry:
-		return addToIdle
-	default:
-		IDLogger.Debug().Msgf("Unknown header value: %s", headerVal)
-		return noOperation
-	}
-}
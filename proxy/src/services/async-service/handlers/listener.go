@@ -1,5 +1,3 @@
-//go:build pro
-
 package handlers
 
 import (
@@ -9,11 +7,13 @@ import (
 	"lunar/async-service/utils"
 	stream_types "lunar/engine/streams/types"
 	"net/http"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 )
 
 type AsyncListener struct {
+	serverMutex         sync.Mutex
 	server              *http.Server
 	onAsyncRegisterFunc OnAsyncRegisterFunc
 	onAsyncRetrieveFunc OnAsyncRetrieveFunc
@@ -36,9 +36,12 @@ func (l *AsyncListener) Start() error {
 	mux.HandleFunc(RetrievePath, l.retrieveHandler)
 	mux.HandleFunc(RegisterPath, l.registerHandler)
 	bindPort := config.GetAsyncServiceBindPort()
-	l.server = &http.Server{Addr: fmt.Sprintf(":%s", bindPort), Handler: mux}
+	server := &http.Server{Addr: fmt.Sprintf(":%s", bindPort), Handler: mux}
+	l.serverMutex.Lock()
+	l.server = server
+	l.serverMutex.Unlock()
 
-	if err := l.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
@@ -47,6 +50,8 @@ func (l *AsyncListener) Start() error {
 
 func (l *AsyncListener) Stop() bool {
 	log.Debug().Msgf("Stopping server")
+	l.serverMutex.Lock()
+	defer l.serverMutex.Unlock()
 	if l.server == nil {
 		log.Debug().Msg("Server is nil, nothing to stop")
 		return false
@@ -69,6 +74,9 @@ func (l *AsyncListener) retrieveHandler(writer http.ResponseWriter, req *http.Re
 	}
 
 	onResponse := l.onAsyncRetrieveFunc(&OnRetrieve{Request: req, SeqID: seqID})
+	if onResponse.CallbackState != "" {
+		writer.Header().Set(AsyncServiceCallbackStateHeaderName, onResponse.CallbackState)
+	}
 
 	switch onResponse.State {
 	case ResponseNotFound:
@@ -1,5 +1,3 @@
-//go:build pro
-
 package handlers
 
 import (
@@ -26,6 +24,8 @@ type OnResponse struct {
 	Response *stream_types.OnResponse
 	Msg      string
 	State    OnResponseState
+	// CallbackState is the delivery state of the registered callback, if any
+	CallbackState string
 }
 
 type OnRetrieve struct {
@@ -0,0 +1,242 @@
+//go:build !pro
+
+package handlers
+
+import (
+	"fmt"
+	"lunar/async-service/config"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	stream_types "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const responsesCleanupInterval = time.Minute
+
+// LocalDispatcher sends the requests kept in the local store to the Engine,
+// and stores their responses until they are retrieved.
+type LocalDispatcher struct {
+	store          *storage.LocalStore
+	numWorkers     int64
+	maxAttempts    int
+	requestTTL     time.Duration
+	runningWorkers atomic.Int64
+	processing     sync.Map
+	delivering     sync.Map
+	deliverer      *CallbackDeliverer
+	lastCleanup    time.Time
+	done           chan struct{}
+	stopOnce       sync.Once
+}
+
+func NewLocalDispatcher(store *storage.LocalStore) *LocalDispatcher {
+	return &LocalDispatcher{
+		store:       store,
+		numWorkers:  config.GetAsyncServiceWorkers(),
+		maxAttempts: config.GetAsyncServiceRequestMaxAttempts(),
+		requestTTL:  config.GetAsyncServiceRequestTTL(),
+		deliverer: NewCallbackDeliverer(
+			config.GetAsyncServiceCallbackTimeout(),
+			config.GetAsyncServiceCallbackMaxAttempts(),
+			config.GetAsyncServiceCallbackMaxBackoff(),
+		),
+		done: make(chan struct{}),
+	}
+}
+
+func (d *LocalDispatcher) Start() {
+	log.Debug().Msgf("Local dispatcher started with %d workers", d.numWorkers)
+	d.lastCleanup = context_manager.Get().GetClock().Now()
+	go d.start()
+}
+
+func (d *LocalDispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		log.Debug().Msg("Local dispatcher stopped")
+	})
+}
+
+// IsProcessing returns true while the request is sent to the Engine
+func (d *LocalDispatcher) IsProcessing(requestID string) bool {
+	_, found := d.processing.Load(requestID)
+	return found
+}
+
+func (d *LocalDispatcher) start() {
+	clock := context_manager.Get().GetClock()
+	asyncServiceIdle := config.GetAsyncServiceIdle()
+
+	for {
+		select {
+		case <-clock.After(asyncServiceIdle):
+			d.processRequests()
+			d.deliverCallbacks()
+			d.removeExpiredResponses()
+		case <-d.done:
+			log.Debug().Msg("Received done signal, exiting")
+			return
+		}
+	}
+}
+
+func (d *LocalDispatcher) processRequests() {
+	for _, record := range d.store.PendingRequests() {
+		if d.runningWorkers.Load() >= d.numWorkers {
+			return
+		}
+
+		requestID := record.Request.ID
+		if _, alreadyProcessing := d.processing.LoadOrStore(requestID, struct{}{}); alreadyProcessing {
+			continue
+		}
+
+		d.runningWorkers.Add(1)
+		go func(record storage.RequestRecord) {
+			defer func() {
+				d.processing.Delete(requestID)
+				d.runningWorkers.Add(-1)
+			}()
+			d.process(record, log.With().Str("request_id", requestID).Logger())
+		}(record)
+	}
+}
+
+func (d *LocalDispatcher) process(record storage.RequestRecord, IDLogger zerolog.Logger) {
+	if context_manager.Get().GetClock().Since(record.RegisteredAt) >= d.requestTTL {
+		d.fail(record.Request.ID, fmt.Sprintf("request expired after %s", d.requestTTL), IDLogger)
+		return
+	}
+
+	// MakeRequest updates the request URL, so the stored request is left untouched
+	request := *record.Request
+	// The attempt number lets the Engine async processors decide whether to ask for a retry
+	request.Headers = make(map[string]string, len(record.Request.Headers)+1)
+	for name, value := range record.Request.Headers {
+		request.Headers[name] = value
+	}
+	request.Headers[asyncServiceAttemptHeaderName] = strconv.Itoa(record.Attempts + 1)
+	response, err := utils.MakeRequest(&request)
+	if err != nil {
+		IDLogger.Trace().Err(err).Msg("Error making request")
+		d.recordAttempt(record.Request.ID, IDLogger)
+		return
+	}
+	if response == nil {
+		IDLogger.Trace().Msg("Response is nil")
+		d.recordAttempt(record.Request.ID, IDLogger)
+		return
+	}
+
+	// Responses are retrieved by the ID the request was registered with
+	response.ID = record.Request.ID
+	response.SequenceID = record.Request.ID
+
+	switch getOperationBasedOnResponse(response, IDLogger) {
+	case addResponse:
+		if err := d.store.StoreResponse(response); err != nil {
+			IDLogger.Warn().Err(err).Msg("Error storing response")
+			return
+		}
+		IDLogger.Trace().Msg("Finished processing.")
+	default:
+		// The Engine did not complete the request yet, it is sent again on the next round
+		d.recordAttempt(record.Request.ID, IDLogger)
+	}
+}
+
+func (d *LocalDispatcher) deliverCallbacks() {
+	for _, record := range d.store.DueCallbacks() {
+		if d.runningWorkers.Load() >= d.numWorkers {
+			return
+		}
+
+		requestID := record.Response.ID
+		if _, alreadyDelivering := d.delivering.LoadOrStore(requestID, struct{}{}); alreadyDelivering {
+			continue
+		}
+
+		d.runningWorkers.Add(1)
+		go func(record storage.ResponseRecord) {
+			defer func() {
+				d.delivering.Delete(requestID)
+				d.runningWorkers.Add(-1)
+			}()
+			d.deliver(record, log.With().Str("request_id", requestID).Logger())
+		}(record)
+	}
+}
+
+func (d *LocalDispatcher) deliver(record storage.ResponseRecord, IDLogger zerolog.Logger) {
+	callback := d.deliverer.Deliver(record)
+	switch callback.State {
+	case storage.CallbackDelivered:
+		IDLogger.Trace().Msgf("Callback delivered to %s", callback.URL)
+	case storage.CallbackDeadLetter:
+		IDLogger.Warn().Msgf("Callback to %s failed after %d attempts, moved to dead letter: %s",
+			callback.URL, callback.Attempts, callback.LastError)
+	default:
+		IDLogger.Debug().Msgf("Callback to %s failed (attempt %d), retrying at %s: %s",
+			callback.URL, callback.Attempts, callback.NextAttemptAt, callback.LastError)
+	}
+
+	if err := d.store.UpdateCallback(record.Response.ID, callback); err != nil {
+		IDLogger.Warn().Err(err).Msg("Error storing callback state")
+	}
+}
+
+func (d *LocalDispatcher) recordAttempt(requestID string, IDLogger zerolog.Logger) {
+	attempts, err := d.store.IncrementAttempts(requestID)
+	if err != nil {
+		IDLogger.Debug().Err(err).Msg("Error updating request attempts")
+		return
+	}
+	if attempts >= d.maxAttempts {
+		d.fail(requestID, fmt.Sprintf("request not completed after %d attempts", attempts), IDLogger)
+		return
+	}
+	IDLogger.Trace().Msgf("Request not completed after %d attempts", attempts)
+}
+
+// fail completes the request with a terminal error response,
+// which is retrieved (and delivered to the callback) like any other response
+func (d *LocalDispatcher) fail(requestID, reason string, IDLogger zerolog.Logger) {
+	IDLogger.Warn().Msgf("Giving up on request: %s", reason)
+	err := d.store.StoreResponse(&stream_types.OnResponse{
+		ID:         requestID,
+		SequenceID: requestID,
+		Status:     http.StatusGatewayTimeout,
+		Headers: map[string]string{
+			"Content-Type":                           "text/plain",
+			asyncServiceResponseNotAllowedHeaderName: asyncServiceResponseError,
+		},
+		Body: reason,
+	})
+	if err != nil {
+		IDLogger.Warn().Err(err).Msg("Error storing failed response")
+	}
+}
+
+func (d *LocalDispatcher) removeExpiredResponses() {
+	clock := context_manager.Get().GetClock()
+	if clock.Since(d.lastCleanup) < responsesCleanupInterval {
+		return
+	}
+	d.lastCleanup = clock.Now()
+
+	removed := d.store.RemoveExpiredResponses(
+		config.GetAsyncServiceRemoveCompletedRequests(),
+		config.GetAsyncServiceRemoveRetrievedResponse(),
+	)
+	if removed > 0 {
+		log.Debug().Msgf("Removed %d expired async responses", removed)
+	}
+}
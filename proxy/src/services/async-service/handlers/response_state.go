@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	stream_types "lunar/engine/streams/types"
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// getOperationBasedOnResponse decides what to do with a request based on the Engine response.
+// A 202 with the async state header means the Engine did not complete the request yet.
+func getOperationBasedOnResponse(
+	response *stream_types.OnResponse,
+	IDLogger zerolog.Logger,
+) workerResult {
+	if response.Status != http.StatusAccepted {
+		return addResponse
+	}
+
+	headerVal, found := response.Headers[asyncServiceResponseNotAllowedHeaderName]
+	if !found {
+		return addResponse
+	}
+
+	switch headerVal {
+	case asyncServiceResponseRegister:
+		return addToPending
+	case asyncServiceResponseBlocked:
+		return addToPending
+	case asyncServiceResponseError:
+		return addToIdle
+	case asyncServiceResponseRetry:
+		return addToIdle
+	default:
+		IDLogger.Debug().Msgf("Unknown header value: %s", headerVal)
+		return noOperation
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"lunar/async-service/runner"
+	"lunar/engine/utils/environment"
 	contextmanager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/logging"
 	"lunar/toolkit-core/otel"
@@ -21,7 +22,9 @@ func main() {
 	clock := ctxMng.GetClock()
 	_ = logging.ConfigureLogger("AsyncService", false, clock)
 
-	shutdown := otel.InitProvider("AsyncService")
+	shutdown := otel.InitProvider("AsyncService", otel.ProviderConfig{
+		Metrics: environment.LoadMetricsExporterConfig(),
+	})
 	go otel.ServeMetricsForAsyncService()
 	defer shutdown()
 
@@ -2,18 +2,109 @@
 
 package runner
 
-import "fmt"
+import (
+	"fmt"
+	"lunar/async-service/config"
+	"lunar/async-service/handlers"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
 
-type FreeRunner struct{}
+	"github.com/rs/zerolog/log"
+)
+
+// FreeRunner runs the async service on a single machine.
+// Registered requests and their responses are kept in a local store,
+// so they survive restarts of the service.
+type FreeRunner struct {
+	store              *storage.LocalStore
+	listener           *handlers.AsyncListener
+	dispatcher         *handlers.LocalDispatcher
+	responseTTLMonitor *ResponseTTLMonitor
+}
 
 func newRunner() (AsyncServiceI, error) {
-	return &FreeRunner{}, nil
+	store, err := storage.NewLocalStore(config.GetAsyncServiceStorageDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize async storage: %w", err)
+	}
+
+	runner := &FreeRunner{
+		store:              store,
+		listener:           handlers.NewListener(),
+		dispatcher:         handlers.NewLocalDispatcher(store),
+		responseTTLMonitor: NewResponseTTLMonitor(),
+	}
+	runner.listener.SetOnAsyncRegisterFunc(runner.onAsyncRegister)
+	runner.listener.SetOnAsyncRetrieveFunc(runner.onAsyncRetrieve)
+	return runner, nil
 }
 
 func (r *FreeRunner) Run() error {
-	return fmt.Errorf("this module is not available in the community edition")
+	if err := r.responseTTLMonitor.Init(); err != nil {
+		log.Warn().Err(err).Msg("Failed to initialize response TTL monitor")
+	}
+
+	r.dispatcher.Start()
+	log.Info().Msgf("%s started", utils.RunnerName)
+	return r.listener.Start()
 }
 
 func (r *FreeRunner) Stop() {
-	// No-op for FreeRunner
+	r.listener.Stop()
+	r.dispatcher.Stop()
+	log.Info().Msgf("%s stopped", utils.RunnerName)
+}
+
+func (r *FreeRunner) onAsyncRegister(onRegister *handlers.OnRegister) error {
+	callback, err := handlers.ParseCallback(onRegister.Request)
+	if err != nil {
+		return err
+	}
+
+	request := utils.ToRequestMessage(onRegister.Request)
+	if request.ID == "" {
+		return fmt.Errorf("missing %s header", utils.HeaderLunarRequestID)
+	}
+	// The callback details are for the async service only, and are not sent to the provider
+	delete(request.Headers, handlers.AsyncServiceCallbackURLHeaderName)
+	delete(request.Headers, handlers.AsyncServiceCallbackSecretHeaderName)
+
+	if err := r.store.StoreRequest(request, callback); err != nil {
+		return err
+	}
+	log.Trace().Msgf("Registered async request %s", request.ID)
+	return nil
+}
+
+func (r *FreeRunner) onAsyncRetrieve(onRetrieve *handlers.OnRetrieve) *handlers.OnResponse {
+	seqID := onRetrieve.SeqID
+	if seqID == "" {
+		seqID = onRetrieve.Request.Header.Get(utils.HeaderAsyncRetrieve)
+	}
+
+	if record, found := r.store.GetResponse(seqID); found {
+		if err := r.store.MarkRetrieved(seqID); err != nil {
+			log.Debug().Err(err).Msgf("Failed to mark response %s as retrieved", seqID)
+		}
+		r.responseTTLMonitor.Add(onRetrieve.Request, record.Response,
+			config.GetAsyncServiceRemoveRetrievedResponse())
+		onResponse := &handlers.OnResponse{
+			State:    handlers.ResponseCompleted,
+			Msg:      "Response retrieved successfully",
+			Response: record.Response,
+		}
+		if record.Callback != nil {
+			onResponse.CallbackState = string(record.Callback.State)
+		}
+		return onResponse
+	}
+
+	if _, found := r.store.GetRequest(seqID); found {
+		if r.dispatcher.IsProcessing(seqID) {
+			return &handlers.OnResponse{State: handlers.ResponseProcessing, Msg: "Request is being processed"}
+		}
+		return &handlers.OnResponse{State: handlers.ResponsePending, Msg: "Request is pending"}
+	}
+
+	return &handlers.OnResponse{State: handlers.ResponseNotFound, Msg: "Request not found"}
 }
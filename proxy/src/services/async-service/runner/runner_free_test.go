@@ -0,0 +1,289 @@
+//go:build !pro
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"lunar/async-service/handlers"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	stream_types "lunar/engine/streams/types"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const asyncStateHeaderName = "X-Lunar-Async-State"
+
+func TestFreeRunnerEndToEnd(t *testing.T) {
+	var engineCalls atomic.Int32
+	engine := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set(utils.HeaderLunarRequestID, req.Header.Get(utils.HeaderLunarRequestID))
+		// the first attempt is asked to be retried by the Engine
+		if engineCalls.Add(1) == 1 {
+			writer.Header().Set(asyncStateHeaderName, "retry")
+			writer.WriteHeader(http.StatusAccepted)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		writer.Header().Set("Content-Type", "text/plain")
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(writer, "%s %s?%s %s %s",
+			req.Method, req.URL.Path, req.URL.RawQuery, req.Header.Get("X-Lunar-Host"), body)
+	}))
+	defer engine.Close()
+
+	asyncPort := setupEnvironment(t, engine.URL)
+	runner := startRunner(t, asyncPort)
+	defer runner.Stop()
+
+	registerReq, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("http://localhost:%s/orders?limit=5", asyncPort),
+		strings.NewReader(`{"item":"book"}`))
+	require.NoError(t, err)
+	registerReq.Header.Set(utils.HeaderLunarRequestID, "e2e-request")
+	registerReq.Header.Set("X-Lunar-Host", "api.example.com")
+
+	registerResp, err := http.DefaultClient.Do(registerReq)
+	require.NoError(t, err)
+	require.NoError(t, registerResp.Body.Close())
+	require.Equal(t, http.StatusAccepted, registerResp.StatusCode)
+	require.Equal(t, "/retrieve?sequence_id=e2e-request",
+		registerResp.Header.Get(handlers.HeaderAsyncLocation))
+
+	status, body := waitForResponse(t, asyncPort, "e2e-request")
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, `POST /orders?limit=5 api.example.com {"item":"book"}`, body)
+	require.Equal(t, int32(2), engineCalls.Load())
+
+	// the response is kept after it was retrieved
+	status, _ = waitForResponse(t, asyncPort, "e2e-request")
+	require.Equal(t, http.StatusCreated, status)
+}
+
+func TestFreeRunnerResumesStoredRequests(t *testing.T) {
+	engine := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte("resumed " + req.URL.Path))
+	}))
+	defer engine.Close()
+
+	asyncPort := setupEnvironment(t, engine.URL)
+
+	// a request registered before the service was restarted
+	store, err := storage.NewLocalStore(os.Getenv("ASYNC_SERVICE_STORAGE_DIR"))
+	require.NoError(t, err)
+	require.NoError(t, store.StoreRequest(&stream_types.OnRequest{
+		ID:      "stored-request",
+		Method:  http.MethodGet,
+		Path:    "/stored",
+		Headers: map[string]string{utils.HeaderLunarRequestID: "stored-request"},
+	}, nil))
+
+	runner := startRunner(t, asyncPort)
+	defer runner.Stop()
+
+	status, body := waitForResponse(t, asyncPort, "stored-request")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "resumed /stored", body)
+}
+
+func TestFreeRunnerGivesUpAfterMaxAttempts(t *testing.T) {
+	var engineCalls atomic.Int32
+	var attemptHeaders sync.Map
+	engine := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		attemptHeaders.Store(engineCalls.Add(1), req.Header.Get("X-Lunar-Async-Attempt"))
+		writer.Header().Set(asyncStateHeaderName, "retry")
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer engine.Close()
+
+	asyncPort := setupEnvironment(t, engine.URL)
+	t.Setenv("ASYNC_SERVICE_REQUEST_MAX_ATTEMPTS", "2")
+	runner := startRunner(t, asyncPort)
+	defer runner.Stop()
+
+	registerAsync(t, asyncPort, "failing-request", nil)
+
+	status, body := waitForResponse(t, asyncPort, "failing-request")
+	require.Equal(t, http.StatusGatewayTimeout, status)
+	require.Equal(t, "request not completed after 2 attempts", body)
+	require.Equal(t, int32(2), engineCalls.Load())
+	for call, attempt := range map[int32]string{1: "1", 2: "2"} {
+		header, _ := attemptHeaders.Load(call)
+		require.Equal(t, attempt, header)
+	}
+}
+
+func TestFreeRunnerCallbackDelivery(t *testing.T) {
+	engine := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set("X-Callback-Url-Forwarded", req.Header.Get(handlers.AsyncServiceCallbackURLHeaderName))
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte("done"))
+	}))
+	defer engine.Close()
+
+	var receiverCalls atomic.Int32
+	delivered := make(chan handlers.CallbackPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		// the first delivery attempt fails and is retried
+		if receiverCalls.Add(1) == 1 {
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		if handlers.SignCallback("s3cr3t", req.Header.Get(handlers.CallbackTimestampHeaderName), body) !=
+			req.Header.Get(handlers.CallbackSignatureHeaderName) {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload handlers.CallbackPayload
+		_ = json.Unmarshal(body, &payload)
+		delivered <- payload
+	}))
+	defer receiver.Close()
+
+	asyncPort := setupEnvironment(t, engine.URL)
+	runner := startRunner(t, asyncPort)
+	defer runner.Stop()
+
+	registerAsync(t, asyncPort, "callback-request", map[string]string{
+		handlers.AsyncServiceCallbackURLHeaderName:    receiver.URL,
+		handlers.AsyncServiceCallbackSecretHeaderName: "s3cr3t",
+	})
+
+	select {
+	case payload := <-delivered:
+		require.Equal(t, "callback-request", payload.SequenceID)
+		require.Equal(t, http.StatusOK, payload.Status)
+		require.Equal(t, "done", payload.Body)
+		require.Empty(t, payload.Headers["X-Callback-Url-Forwarded"])
+	case <-time.After(10 * time.Second):
+		t.Fatal("callback was not delivered in time")
+	}
+
+	require.Eventually(t, func() bool {
+		return retrieveCallbackState(t, asyncPort, "callback-request") == string(storage.CallbackDelivered)
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestFreeRunnerCallbackDeadLetter(t *testing.T) {
+	engine := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer engine.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	asyncPort := setupEnvironment(t, engine.URL)
+	t.Setenv("ASYNC_SERVICE_CALLBACK_MAX_ATTEMPTS", "1")
+	runner := startRunner(t, asyncPort)
+	defer runner.Stop()
+
+	registerAsync(t, asyncPort, "dead-letter-request", map[string]string{
+		handlers.AsyncServiceCallbackURLHeaderName: receiver.URL,
+	})
+
+	// the response can still be retrieved after the callback failed
+	require.Eventually(t, func() bool {
+		return retrieveCallbackState(t, asyncPort, "dead-letter-request") == string(storage.CallbackDeadLetter)
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func registerAsync(t *testing.T, asyncPort, seqID string, headers map[string]string) {
+	registerReq, err := http.NewRequest(http.MethodGet,
+		fmt.Sprintf("http://localhost:%s/items", asyncPort), nil)
+	require.NoError(t, err)
+	registerReq.Header.Set(utils.HeaderLunarRequestID, seqID)
+	for key, value := range headers {
+		registerReq.Header.Set(key, value)
+	}
+
+	registerResp, err := http.DefaultClient.Do(registerReq)
+	require.NoError(t, err)
+	require.NoError(t, registerResp.Body.Close())
+	require.Equal(t, http.StatusAccepted, registerResp.StatusCode)
+}
+
+func retrieveCallbackState(t *testing.T, asyncPort, seqID string) string {
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s%s?%s=%s",
+		asyncPort, handlers.RetrievePath, handlers.QueryParamSeqID, seqID))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.Header.Get(handlers.AsyncServiceCallbackStateHeaderName)
+}
+
+func setupEnvironment(t *testing.T, engineURL string) string {
+	parsedEngineURL, err := url.Parse(engineURL)
+	require.NoError(t, err)
+
+	asyncPort := freePort(t)
+	t.Setenv("BIND_PORT", parsedEngineURL.Port())
+	t.Setenv("ASYNC_SERVICE_PORT", asyncPort)
+	t.Setenv("ASYNC_SERVICE_IDLE_SEC", "1")
+	t.Setenv("ASYNC_SERVICE_STORAGE_DIR", t.TempDir())
+	return asyncPort
+}
+
+func startRunner(t *testing.T, asyncPort string) AsyncServiceI {
+	runner, err := NewRunner()
+	require.NoError(t, err)
+
+	go func() {
+		if err := runner.Run(); err != nil {
+			t.Errorf("runner failed: %v", err)
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", "localhost:"+asyncPort)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+	return runner
+}
+
+func waitForResponse(t *testing.T, asyncPort, seqID string) (int, string) {
+	retrieveURL := fmt.Sprintf("http://localhost:%s%s?%s=%s",
+		asyncPort, handlers.RetrievePath, handlers.QueryParamSeqID, seqID)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(retrieveURL)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				return resp.StatusCode, string(body)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("response for %s was not completed in time", seqID)
+	return 0, ""
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	stream_types "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	requestsFolder  = "requests"
+	responsesFolder = "responses"
+	recordFileExt   = ".json"
+	tempFileExt     = ".tmp"
+
+	dirPermissions  = 0o750
+	filePermissions = 0o600
+)
+
+type CallbackState string
+
+const (
+	CallbackPending    CallbackState = "pending"
+	CallbackDelivered  CallbackState = "delivered"
+	CallbackDeadLetter CallbackState = "dead_letter"
+)
+
+// Callback is the webhook the completed response is delivered to
+type Callback struct {
+	URL           string        `json:"url"`
+	Secret        string        `json:"secret,omitempty"`
+	State         CallbackState `json:"state,omitempty"`
+	Attempts      int           `json:"attempts"`
+	NextAttemptAt time.Time     `json:"next_attempt_at"`
+	LastError     string        `json:"last_error,omitempty"`
+}
+
+// RequestRecord is a registered request which has not completed yet
+type RequestRecord struct {
+	Request      *stream_types.OnRequest `json:"request"`
+	Callback     *Callback               `json:"callback,omitempty"`
+	RegisteredAt time.Time               `json:"registered_at"`
+	Attempts     int                     `json:"attempts"`
+}
+
+// ResponseRecord is a completed response waiting to be retrieved
+type ResponseRecord struct {
+	Response    *stream_types.OnResponse `json:"response"`
+	Callback    *Callback                `json:"callback,omitempty"`
+	CompletedAt time.Time                `json:"completed_at"`
+	RetrievedAt *time.Time               `json:"retrieved_at,omitempty"`
+}
+
+// LocalStore keeps requests and responses on the local disk, one file per record.
+// Files are written atomically (write to a temp file and rename), so a crash
+// never leaves a partially written record behind.
+// All records are also kept in memory, and loaded back from disk on startup.
+type LocalStore struct {
+	mutex     sync.RWMutex
+	dir       string
+	requests  map[string]*RequestRecord
+	responses map[string]*ResponseRecord
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	store := &LocalStore{
+		dir:       dir,
+		requests:  make(map[string]*RequestRecord),
+		responses: make(map[string]*ResponseRecord),
+	}
+
+	for _, folder := range []string{requestsFolder, responsesFolder} {
+		if err := os.MkdirAll(filepath.Join(dir, folder), dirPermissions); err != nil {
+			return nil, fmt.Errorf("failed to create storage folder %s: %w", folder, err)
+		}
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	log.Info().Msgf("Async storage loaded from %s: %d pending requests, %d responses",
+		dir, len(store.requests), len(store.responses))
+	return store, nil
+}
+
+// StoreRequest registers a new request, or updates an existing one.
+// The callback is optional, and is kept for the response once the request completes.
+func (s *LocalStore) StoreRequest(request *stream_types.OnRequest, callback *Callback) error {
+	if request == nil || request.ID == "" {
+		return fmt.Errorf("request must have an ID")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, found := s.requests[request.ID]
+	if !found {
+		record = &RequestRecord{RegisteredAt: context_manager.Get().GetClock().Now()}
+	}
+	updated := *record
+	updated.Request = request
+	if callback != nil {
+		updated.Callback = callback
+	}
+
+	if err := s.writeRecord(requestsFolder, request.ID, &updated); err != nil {
+		return err
+	}
+	s.requests[request.ID] = &updated
+	return nil
+}
+
+// IncrementAttempts records a failed attempt to complete the request
+func (s *LocalStore) IncrementAttempts(requestID string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, found := s.requests[requestID]
+	if !found {
+		return 0, fmt.Errorf("request %s not found", requestID)
+	}
+
+	updated := *record
+	updated.Attempts++
+	if err := s.writeRecord(requestsFolder, requestID, &updated); err != nil {
+		return 0, err
+	}
+	s.requests[requestID] = &updated
+	return updated.Attempts, nil
+}
+
+// GetRequest returns a copy of the pending request record
+func (s *LocalStore) GetRequest(requestID string) (RequestRecord, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	record, found := s.requests[requestID]
+	if !found {
+		return RequestRecord{}, false
+	}
+	return *record, true
+}
+
+// PendingRequests returns the pending requests, oldest registration first
+func (s *LocalStore) PendingRequests() []RequestRecord {
+	s.mutex.RLock()
+	records := make([]RequestRecord, 0, len(s.requests))
+	for _, record := range s.requests {
+		records = append(records, *record)
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].RegisteredAt.Before(records[j].RegisteredAt)
+	})
+	return records
+}
+
+// StoreResponse stores the response and removes the request it completes
+func (s *LocalStore) StoreResponse(response *stream_types.OnResponse) error {
+	if response == nil || response.ID == "" {
+		return fmt.Errorf("response must have an ID")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := context_manager.Get().GetClock().Now()
+	record := &ResponseRecord{
+		Response:    response,
+		CompletedAt: now,
+	}
+	if request, found := s.requests[response.ID]; found && request.Callback != nil {
+		callback := *request.Callback
+		callback.State = CallbackPending
+		callback.NextAttemptAt = now
+		record.Callback = &callback
+	}
+	// The response is written first, so a crash in between only leaves a
+	// request which is dropped on the next load
+	if err := s.writeRecord(responsesFolder, response.ID, record); err != nil {
+		return err
+	}
+	s.responses[response.ID] = record
+
+	if _, found := s.requests[response.ID]; found {
+		delete(s.requests, response.ID)
+		return s.removeRecord(requestsFolder, response.ID)
+	}
+	return nil
+}
+
+// GetResponse returns a copy of the completed response record
+func (s *LocalStore) GetResponse(requestID string) (ResponseRecord, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	record, found := s.responses[requestID]
+	if !found {
+		return ResponseRecord{}, false
+	}
+	return *record, true
+}
+
+// MarkRetrieved sets the first retrieval time of the response
+func (s *LocalStore) MarkRetrieved(requestID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, found := s.responses[requestID]
+	if !found {
+		return fmt.Errorf("response %s not found", requestID)
+	}
+	if record.RetrievedAt != nil {
+		return nil
+	}
+
+	retrievedAt := context_manager.Get().GetClock().Now()
+	updated := *record
+	updated.RetrievedAt = &retrievedAt
+	if err := s.writeRecord(responsesFolder, requestID, &updated); err != nil {
+		return err
+	}
+	s.responses[requestID] = &updated
+	return nil
+}
+
+// DueCallbacks returns the completed responses with a pending callback which is due for delivery
+func (s *LocalStore) DueCallbacks() []ResponseRecord {
+	now := context_manager.Get().GetClock().Now()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var records []ResponseRecord
+	for _, record := range s.responses {
+		if record.Callback == nil || record.Callback.State != CallbackPending {
+			continue
+		}
+		if record.Callback.NextAttemptAt.After(now) {
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records
+}
+
+// UpdateCallback stores the delivery state of the response callback
+func (s *LocalStore) UpdateCallback(requestID string, callback Callback) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, found := s.responses[requestID]
+	if !found {
+		return fmt.Errorf("response %s not found", requestID)
+	}
+
+	updated := *record
+	updated.Callback = &callback
+	if err := s.writeRecord(responsesFolder, requestID, &updated); err != nil {
+		return err
+	}
+	s.responses[requestID] = &updated
+	return nil
+}
+
+// RemoveExpiredResponses removes responses which were not retrieved within completedTTL,
+// and responses which were retrieved more than retrievedTTL ago. Returns the removed count.
+// Responses with a callback which is still being delivered are kept.
+func (s *LocalStore) RemoveExpiredResponses(completedTTL, retrievedTTL time.Duration) int {
+	now := context_manager.Get().GetClock().Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := 0
+	for requestID, record := range s.responses {
+		if record.Callback != nil && record.Callback.State == CallbackPending {
+			continue
+		}
+		expired := record.RetrievedAt == nil && now.Sub(record.CompletedAt) > completedTTL
+		if record.RetrievedAt != nil {
+			expired = now.Sub(*record.RetrievedAt) > retrievedTTL
+		}
+		if !expired {
+			continue
+		}
+
+		if err := s.removeRecord(responsesFolder, requestID); err != nil {
+			log.Warn().Err(err).Msgf("Failed to remove expired response %s", requestID)
+			continue
+		}
+		delete(s.responses, requestID)
+		removed++
+	}
+	return removed
+}
+
+func (s *LocalStore) load() error {
+	if err := loadFolder(filepath.Join(s.dir, responsesFolder), func(data []byte) error {
+		record := &ResponseRecord{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+		if record.Response == nil || record.Response.ID == "" {
+			return fmt.Errorf("response record has no ID")
+		}
+		s.responses[record.Response.ID] = record
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return loadFolder(filepath.Join(s.dir, requestsFolder), func(data []byte) error {
+		record := &RequestRecord{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+		if record.Request == nil || record.Request.ID == "" {
+			return fmt.Errorf("request record has no ID")
+		}
+		if _, completed := s.responses[record.Request.ID]; completed {
+			if err := s.removeRecord(requestsFolder, record.Request.ID); err != nil {
+				log.Warn().Err(err).Msgf("Failed to remove completed request %s", record.Request.ID)
+			}
+			return nil
+		}
+		s.requests[record.Request.ID] = record
+		return nil
+	})
+}
+
+func (s *LocalStore) writeRecord(folder, recordID string, record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record %s: %w", recordID, err)
+	}
+
+	recordPath := s.recordPath(folder, recordID)
+	tempFile, err := os.CreateTemp(filepath.Dir(recordPath), "*"+tempFileExt)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for record %s: %w", recordID, err)
+	}
+	defer func() {
+		// no-op after a successful rename
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	if _, err = tempFile.Write(data); err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write record %s: %w", recordID, err)
+	}
+
+	if err := os.Chmod(tempFile.Name(), filePermissions); err != nil {
+		return fmt.Errorf("failed to set permissions of record %s: %w", recordID, err)
+	}
+	if err := os.Rename(tempFile.Name(), recordPath); err != nil {
+		return fmt.Errorf("failed to store record %s: %w", recordID, err)
+	}
+	return nil
+}
+
+func (s *LocalStore) removeRecord(folder, recordID string) error {
+	err := os.Remove(s.recordPath(folder, recordID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove record %s: %w", recordID, err)
+	}
+	return nil
+}
+
+// recordPath encodes the ID, so it is always a valid file name
+func (s *LocalStore) recordPath(folder, recordID string) string {
+	fileName := base64.RawURLEncoding.EncodeToString([]byte(recordID)) + recordFileExt
+	return filepath.Join(s.dir, folder, fileName)
+}
+
+func loadFolder(folder string, loadRecord func([]byte) error) error {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return fmt.Errorf("failed to read storage folder %s: %w", folder, err)
+	}
+
+	for _, entry := range entries {
+		filePath := filepath.Join(folder, entry.Name())
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), tempFileExt) {
+			// leftover of an interrupted write
+			_ = os.Remove(filePath)
+			continue
+		}
+		if !strings.HasSuffix(entry.Name(), recordFileExt) {
+			continue
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read record %s: %w", filePath, err)
+		}
+		if err := loadRecord(data); err != nil {
+			log.Warn().Err(err).Msgf("Skipping invalid async record %s", filePath)
+		}
+	}
+	return nil
+}
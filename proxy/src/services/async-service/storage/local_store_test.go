@@ -0,0 +1,150 @@
+package storage
+
+import (
+	stream_types "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.StoreRequest(newRequest("req-1", "/first"), nil))
+	require.NoError(t, store.StoreRequest(newRequest("req-2", "/second"), nil))
+	attempts, err := store.IncrementAttempts("req-2")
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts)
+
+	require.NoError(t, store.StoreResponse(&stream_types.OnResponse{
+		ID:     "req-1",
+		Status: 201,
+		Body:   `{"created":true}`,
+	}))
+	require.NoError(t, store.MarkRetrieved("req-1"))
+
+	reopened, err := NewLocalStore(dir)
+	require.NoError(t, err)
+
+	_, found := reopened.GetRequest("req-1")
+	require.False(t, found)
+
+	pending := reopened.PendingRequests()
+	require.Len(t, pending, 1)
+	require.Equal(t, "req-2", pending[0].Request.ID)
+	require.Equal(t, "/second", pending[0].Request.Path)
+	require.Equal(t, 1, pending[0].Attempts)
+
+	response, found := reopened.GetResponse("req-1")
+	require.True(t, found)
+	require.Equal(t, 201, response.Response.Status)
+	require.Equal(t, `{"created":true}`, response.Response.Body)
+	require.NotNil(t, response.RetrievedAt)
+}
+
+func TestLocalStoreLoadSkipsInvalidRecords(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreRequest(newRequest("../escape/attempt", "/path"), nil))
+
+	requestsDir := filepath.Join(dir, requestsFolder)
+	require.NoError(t, os.WriteFile(filepath.Join(requestsDir, "broken.json"), []byte("{"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(requestsDir, "partial.tmp"), []byte("{"), 0o600))
+
+	// A request completed right before a crash, without its file being removed
+	completed := newRequest("req-done", "/done")
+	require.NoError(t, store.StoreRequest(completed, nil))
+	require.NoError(t, store.writeRecord(responsesFolder, "req-done",
+		&ResponseRecord{Response: &stream_types.OnResponse{ID: "req-done", Status: 200}}))
+
+	reopened, err := NewLocalStore(dir)
+	require.NoError(t, err)
+
+	pending := reopened.PendingRequests()
+	require.Len(t, pending, 1)
+	require.Equal(t, "../escape/attempt", pending[0].Request.ID)
+	_, found := reopened.GetResponse("req-done")
+	require.True(t, found)
+
+	_, err = os.Stat(filepath.Join(requestsDir, "partial.tmp"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestLocalStoreRemoveExpiredResponses(t *testing.T) {
+	clock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, requestID := range []string{"retrieved", "not-retrieved"} {
+		require.NoError(t, store.StoreRequest(newRequest(requestID, "/path"), nil))
+		require.NoError(t, store.StoreResponse(&stream_types.OnResponse{ID: requestID, Status: 200}))
+	}
+	require.NoError(t, store.MarkRetrieved("retrieved"))
+
+	clock.AdvanceTime(2 * time.Minute)
+	require.Equal(t, 1, store.RemoveExpiredResponses(10*time.Minute, time.Minute))
+	_, found := store.GetResponse("retrieved")
+	require.False(t, found)
+
+	clock.AdvanceTime(10 * time.Minute)
+	require.Equal(t, 1, store.RemoveExpiredResponses(10*time.Minute, time.Minute))
+	_, found = store.GetResponse("not-retrieved")
+	require.False(t, found)
+}
+
+func TestLocalStoreCallbackState(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	require.NoError(t, err)
+
+	callback := &Callback{URL: "https://hooks.example.com/done", Secret: "s3cr3t"}
+	require.NoError(t, store.StoreRequest(newRequest("with-callback", "/path"), callback))
+	require.NoError(t, store.StoreRequest(newRequest("without-callback", "/path"), nil))
+	require.Empty(t, store.DueCallbacks())
+
+	for _, requestID := range []string{"with-callback", "without-callback"} {
+		require.NoError(t, store.StoreResponse(&stream_types.OnResponse{ID: requestID, Status: 200}))
+	}
+
+	due := store.DueCallbacks()
+	require.Len(t, due, 1)
+	require.Equal(t, "with-callback", due[0].Response.ID)
+	require.Equal(t, CallbackPending, due[0].Callback.State)
+	require.Equal(t, "s3cr3t", due[0].Callback.Secret)
+
+	// pending callbacks are not expired
+	require.Equal(t, 1, store.RemoveExpiredResponses(0, 0))
+
+	retry := *due[0].Callback
+	retry.Attempts = 1
+	retry.NextAttemptAt = time.Now().Add(time.Hour)
+	require.NoError(t, store.UpdateCallback("with-callback", retry))
+	require.Empty(t, store.DueCallbacks())
+
+	reopened, err := NewLocalStore(dir)
+	require.NoError(t, err)
+	response, found := reopened.GetResponse("with-callback")
+	require.True(t, found)
+	require.Equal(t, 1, response.Callback.Attempts)
+	require.Equal(t, CallbackPending, response.Callback.State)
+}
+
+func newRequest(requestID, path string) *stream_types.OnRequest {
+	return &stream_types.OnRequest{
+		ID:         requestID,
+		SequenceID: requestID,
+		Method:     "POST",
+		Path:       path,
+		Headers:    map[string]string{"X-Lunar-Host": "api.example.com"},
+		Body:       `{"key":"value"}`,
+	}
+}
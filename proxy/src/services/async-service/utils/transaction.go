@@ -86,6 +86,9 @@ func MakeRequest(req *stream_types.OnRequest) (*stream_types.OnResponse, error)
 		body = bytes.NewBuffer([]byte(req.Body))
 	}
 	req.URL = fmt.Sprintf("http://localhost:%s%s", config.GetEngineBindPort(), req.Path)
+	if req.Query != "" {
+		req.URL += "?" + req.Query
+	}
 	request, err := http.NewRequest(req.Method, req.URL, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
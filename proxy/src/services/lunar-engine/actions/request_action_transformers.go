@@ -14,6 +14,7 @@ const (
 	ResponseBodyActionName        = "response_body"
 	WithResponseBodyActionName    = "with_response_body"
 	IsInternalActionName          = "is_internal"
+	DropConnectionActionName      = "drop_connection"
 
 	ModifyHeadersActionName      = "modify_headers"
 	ModifyRequestActionName      = "modify_request"
@@ -25,6 +26,9 @@ const (
 	RequestQueryParamsActionName = "request_query_params"
 
 	RequestRunResultName = "request_run_result"
+
+	ConsumerTagActionName      = "consumer_tag"
+	ClearConsumerTagActionName = "clear_consumer_tag"
 )
 
 // EarlyResponseAction
@@ -35,6 +39,9 @@ func (a *EarlyResponseAction) ReqToSpoeActions() action.Actions {
 	actions.SetVar(action.ScopeTransaction, StatusCodeActionName, a.Status)
 	actions.SetVar(action.ScopeTransaction, ResponseBodyActionName, []byte(a.Body))
 	actions.SetVar(action.ScopeTransaction, ResponseHeadersActionName, utils.DumpHeaders(a.Headers))
+	if a.DropConnection {
+		actions.SetVar(action.ScopeTransaction, DropConnectionActionName, true)
+	}
 	return actions
 }
 
@@ -79,6 +79,24 @@ func TestEarlyResponseActionTransformerSetsHeadersAsString(t *testing.T) {
 	assert.Condition(t, testutils.EndsWith(res, "\n"))
 }
 
+func TestEarlyResponseActionTransformerSetsDropConnection(t *testing.T) {
+	t.Parallel()
+	lunarAction := EarlyResponseAction{Status: 502}
+	isDropConnection := func(spoeAction action.Action) bool {
+		return spoeAction.Name == DropConnectionActionName
+	}
+	assert.False(t, lo.ContainsBy(lunarAction.ReqToSpoeActions(), isDropConnection))
+
+	lunarAction.DropConnection = true
+	dropSetVarAction, err := getSetVarActionByName(
+		lunarAction.ReqToSpoeActions(),
+		DropConnectionActionName,
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, dropSetVarAction.Value)
+}
+
 func TestEarlyResponseActionTransformerSetsStatus(t *testing.T) {
 	t.Parallel()
 	action := EarlyResponseAction{
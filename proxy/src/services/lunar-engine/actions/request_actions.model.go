@@ -22,11 +22,13 @@ type ReqLunarAction interface {
 
 // This action will return the supplied status, body and headers as a response
 // to the calling client, without ever reaching to the actual API provider.
+// With DropConnection, the client connection is dropped instead of responding.
 type EarlyResponseAction struct {
-	Status     int
-	Body       string
-	Headers    map[string]string
-	IsInternal bool
+	Status         int
+	Body           string
+	Headers        map[string]string
+	IsInternal     bool
+	DropConnection bool
 }
 
 // This action will change the original API request before it is directed to the
@@ -0,0 +1,103 @@
+// openapi generates OpenAPI documents out of HAR files and the discovery state.
+//
+// Usage:
+//
+//	openapi [-host api.com] [-out dir] [-discovery state.json] [file.har ...]
+//
+// The documents are printed as JSON, or written to <out>/<host>.json when out is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lunar/engine/formats/openapi"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+)
+
+const outputFileMode = 0o644
+
+func main() {
+	host := flag.String("host", "", "generate the document of this host only")
+	outDir := flag.String("out", "", "write a <host>.json document per host into this directory")
+	discoveryLocation := flag.String("discovery", "", "discovery state file to declare endpoints from")
+	splitThreshold := flag.Int("split-threshold", openapi.DefaultMaxSplitThreshold,
+		"distinct values of a path segment above which it becomes a path parameter")
+	flag.Parse()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	if err := run(*host, *outDir, *discoveryLocation, *splitThreshold, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(host, outDir, discoveryLocation string, splitThreshold int, harFiles []string) error {
+	generator := openapi.NewGenerator(splitThreshold)
+	if discoveryLocation != "" {
+		data, err := os.ReadFile(discoveryLocation)
+		if err != nil {
+			return fmt.Errorf("failed to read discovery state: %w", err)
+		}
+		output := sharedDiscovery.Output{}
+		if err = json.Unmarshal(data, &output); err != nil {
+			return fmt.Errorf("failed to parse discovery state: %w", err)
+		}
+		generator.ObserveDiscovery(output)
+	}
+	for _, harFile := range harFiles {
+		if err := observeHARFile(generator, harFile); err != nil {
+			return err
+		}
+	}
+
+	documents := generator.Documents()
+	if host != "" {
+		document, found := documents[host]
+		if !found {
+			return fmt.Errorf("no traffic was observed to %s", host)
+		}
+		documents = map[string]*openapi.Document{host: document}
+	}
+
+	if outDir == "" {
+		var output any = documents
+		if host != "" {
+			output = documents[host]
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	for documentHost, document := range documents {
+		data, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode the document of %s: %w", documentHost, err)
+		}
+		location := filepath.Join(outDir, documentHost+".json")
+		if err = os.WriteFile(location, data, outputFileMode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", location, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", location)
+	}
+	return nil
+}
+
+func observeHARFile(generator *openapi.Generator, location string) error {
+	file, err := os.Open(location)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", location, err)
+	}
+	defer file.Close()
+	observed, err := generator.ObserveHAR(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", location, err)
+	}
+	fmt.Fprintf(os.Stderr, "Observed %d entries from %s\n", observed, location)
+	return nil
+}
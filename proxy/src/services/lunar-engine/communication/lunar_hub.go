@@ -273,6 +273,8 @@ func (hub *HubCommunication) startDiscoveryWorker() {
 					continue
 				}
 				output.CreatedAt = sharedActions.TimestampToStringFromTime(hub.nextReportTime)
+				// The hub gets the cumulative aggregation, the windows are queried locally
+				output.Windows = nil
 				message := network.DiscoveryMessage{
 					Event: network.WebSocketEventDiscovery,
 					Data:  output,
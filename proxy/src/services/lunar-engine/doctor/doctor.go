@@ -4,6 +4,7 @@ package doctor
 
 import (
 	"lunar/engine/config"
+	"lunar/engine/metrics"
 	"lunar/engine/utils/obfuscation"
 	"lunar/toolkit-core/clock"
 	context_manager "lunar/toolkit-core/context-manager"
@@ -23,6 +24,7 @@ type Doctor struct {
 	getTxnPoliciesAccessor            func() *config.TxnPoliciesAccessor
 	getLoadedStreamsConfigF           func() *network.ConfigurationData
 	getLastSuccessfulHubCommunication TimestampAccessF
+	getSLOStatuses                    func() []metrics.SLOStatus
 	hasher                            obfuscation.MD5Hasher // TODO: move somewhere more generic
 }
 
@@ -71,6 +73,14 @@ func (dr *Doctor) WithPolicies(getTxnPoliciesAccessor func() *config.TxnPolicies
 	return dr
 }
 
+// WithSLOs reports the error budgets and burn rates of the SLOs of the gateway config
+func (dr *Doctor) WithSLOs(getSLOStatuses func() []metrics.SLOStatus) *Doctor {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+	dr.getSLOStatuses = getSLOStatuses
+	return dr
+}
+
 func (dr *Doctor) Run() Report {
 	dr.mutex.Lock()
 	defer dr.mutex.Unlock()
@@ -89,7 +99,15 @@ func (dr *Doctor) Run() Report {
 		ActivePolicies:      dr.getActivePolicies(),
 		LoadedStreamsConfig: dr.getLoadedStreamsConfig(),
 		Hub:                 getHubReport(dr.getLastSuccessfulHubCommunication),
+		SLOs:                dr.getSLOs(),
+	}
+}
+
+func (dr *Doctor) getSLOs() []metrics.SLOStatus {
+	if dr.getSLOStatuses == nil {
+		return nil
 	}
+	return dr.getSLOStatuses()
 }
 
 func (dr *Doctor) getClusterReport() *ClusterReport {
@@ -1,6 +1,9 @@
 package doctor
 
-import "time"
+import (
+	"lunar/engine/metrics"
+	"time"
+)
 
 type ClusterReport struct {
 	Peers []string `json:"peers"`
@@ -53,4 +56,5 @@ type Report struct {
 	ActivePolicies      *ActivePolicies      `json:"active_policies,omitempty"`
 	LoadedStreamsConfig *LoadedStreamsConfig `json:"loaded_streams_config,omitempty"`
 	Hub                 HubReport            `json:"hub"`
+	SLOs                []metrics.SLOStatus  `json:"slos,omitempty"`
 }
@@ -0,0 +1,30 @@
+package openapi
+
+import (
+	sharedDiscovery "lunar/shared-model/discovery"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+)
+
+// ObserveDiscovery observes the endpoints of the discovery state.
+// Their URLs are already normalized, so they are declared as URL templates.
+func (g *Generator) ObserveDiscovery(output sharedDiscovery.Output) {
+	for key, endpoint := range output.Endpoints {
+		method, url, found := strings.Cut(key, sharedDiscovery.EndpointDelimiter)
+		if !found {
+			continue
+		}
+		if err := g.DeclareEndpoint(url); err != nil {
+			log.Trace().Err(err).Msgf("Skipping discovered endpoint %s", url)
+			continue
+		}
+		g.Observe(Observation{
+			Method:      method,
+			URL:         url,
+			StatusCodes: lo.Keys(endpoint.StatusCodes),
+			Count:       endpoint.Count,
+		})
+	}
+}
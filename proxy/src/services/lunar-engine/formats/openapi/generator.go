@@ -0,0 +1,375 @@
+package openapi
+
+import (
+	"lunar/toolkit-core/urltree"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMaxSplitThreshold is the number of distinct values of a path segment
+	// above which the segment is assumed to be a path parameter
+	DefaultMaxSplitThreshold = 50
+	// maxBodySamples bounds the bodies parsed per endpoint and status code
+	maxBodySamples = 20
+	// maxObservedEndpoints bounds the raw URLs kept before normalization
+	maxObservedEndpoints = 100000
+
+	jsonContentType = "application/json"
+	defaultScheme   = "https"
+)
+
+type emptyStruct = struct{}
+
+// Observation is a transaction seen on the wire, or an endpoint seen by discovery
+type Observation struct {
+	Method string
+	// URL is the full URL, or host and path without a scheme
+	URL                 string
+	StatusCodes         []int
+	RequestContentType  string
+	RequestBody         string
+	ResponseContentType string
+	ResponseBody        string
+	// Count is the number of calls of the observation, one when not set
+	Count int
+}
+
+// Generator builds an OpenAPI document per host out of observed transactions.
+// URLs are normalized with the assumed path params of the URL tree, so high cardinality
+// path segments become path parameters.
+type Generator struct {
+	tree      *urltree.URLTree[emptyStruct]
+	endpoints map[rawEndpoint]*endpointObservations
+	schemes   map[string]string
+}
+
+type rawEndpoint struct {
+	method string
+	url    string
+}
+
+type endpointObservations struct {
+	count     int
+	requests  map[string]*bodyObservations
+	responses map[int]map[string]*bodyObservations
+}
+
+type bodyObservations struct {
+	schema  *Schema
+	samples int
+}
+
+func NewGenerator(maxSplitThreshold int) *Generator {
+	return &Generator{
+		tree:      urltree.NewURLTree[emptyStruct](true, maxSplitThreshold),
+		endpoints: map[rawEndpoint]*endpointObservations{},
+		schemes:   map[string]string{},
+	}
+}
+
+// DeclareEndpoint declares a known URL template, e.g. api.com/users/{id}
+func (g *Generator) DeclareEndpoint(url string) error {
+	return g.tree.InsertDeclaredURL(url, &emptyStruct{})
+}
+
+func (g *Generator) Observe(observation Observation) {
+	scheme, url := splitScheme(observation.URL)
+	if url == "" || observation.Method == "" {
+		return
+	}
+	if _, err := g.tree.InsertWithConvergenceIndication(url, &emptyStruct{}); err != nil {
+		log.Trace().Err(err).Msgf("Skipping %s in OpenAPI generation", url)
+		return
+	}
+	if scheme != "" {
+		g.schemes[hostOf(url)] = scheme
+	}
+
+	key := rawEndpoint{method: strings.ToUpper(observation.Method), url: url}
+	endpoint, found := g.endpoints[key]
+	if !found {
+		if len(g.endpoints) >= maxObservedEndpoints {
+			return
+		}
+		endpoint = &endpointObservations{
+			requests:  map[string]*bodyObservations{},
+			responses: map[int]map[string]*bodyObservations{},
+		}
+		g.endpoints[key] = endpoint
+	}
+
+	count := max(observation.Count, 1)
+	endpoint.count += count
+	if observation.RequestBody != "" {
+		observeBody(endpoint.requests, observation.RequestContentType, observation.RequestBody)
+	}
+	for _, statusCode := range observation.StatusCodes {
+		bodies, found := endpoint.responses[statusCode]
+		if !found {
+			bodies = map[string]*bodyObservations{}
+			endpoint.responses[statusCode] = bodies
+		}
+		if observation.ResponseBody != "" {
+			observeBody(bodies, observation.ResponseContentType, observation.ResponseBody)
+		}
+	}
+}
+
+// Documents returns the OpenAPI document of every observed host
+func (g *Generator) Documents() map[string]*Document {
+	documents := map[string]*Document{}
+	operations := map[rawEndpoint]*endpointObservations{}
+	pathParamValues := map[string]map[string][]string{}
+
+	for key, endpoint := range g.endpoints {
+		lookup := g.tree.Lookup(key.url)
+		normalizedURL := key.url
+		if lookup.Match && lookup.NormalizedURL != "" {
+			normalizedURL = lookup.NormalizedURL
+		}
+		normalizedKey := rawEndpoint{method: key.method, url: normalizedURL}
+		operations[normalizedKey] = mergeEndpointObservations(operations[normalizedKey], endpoint)
+
+		if _, found := pathParamValues[normalizedURL]; !found {
+			pathParamValues[normalizedURL] = map[string][]string{}
+		}
+		for name, value := range lookup.PathParams {
+			if !isTemplateSegment(value) {
+				pathParamValues[normalizedURL][name] = append(pathParamValues[normalizedURL][name], value)
+			}
+		}
+	}
+
+	for key, endpoint := range operations {
+		host := hostOf(key.url)
+		document, found := documents[host]
+		if !found {
+			document = g.newDocument(host)
+			documents[host] = document
+		}
+		path := pathOf(key.url)
+		pathItem, found := document.Paths[path]
+		if !found {
+			pathItem = PathItem{}
+			document.Paths[path] = pathItem
+		}
+		pathItem[strings.ToLower(key.method)] = buildOperation(
+			key.method, path, endpoint, pathParamValues[key.url])
+	}
+	return documents
+}
+
+func (g *Generator) newDocument(host string) *Document {
+	scheme := g.schemes[host]
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+	return &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       host,
+			Description: "Generated by Lunar from the observed traffic to " + host,
+			Version:     "discovered",
+		},
+		Servers: []Server{{URL: scheme + "://" + host}},
+		Paths:   map[string]PathItem{},
+	}
+}
+
+func buildOperation(
+	method, path string,
+	endpoint *endpointObservations,
+	pathParamValues map[string][]string,
+) *Operation {
+	operation := &Operation{
+		OperationID:   operationID(method, path),
+		Responses:     map[string]*Response{},
+		ObservedCount: endpoint.count,
+	}
+
+	for _, name := range pathParamNames(path) {
+		values := pathParamValues[name]
+		parameter := Parameter{
+			Name:     name,
+			In:       ParameterInPath,
+			Required: true,
+			Schema:   pathParamSchema(values),
+		}
+		if len(values) > 0 {
+			parameter.Example = values[0]
+		}
+		operation.Parameters = append(operation.Parameters, parameter)
+	}
+
+	if len(endpoint.requests) > 0 {
+		operation.RequestBody = &RequestBody{Content: buildContent(endpoint.requests)}
+	}
+	for statusCode, bodies := range endpoint.responses {
+		description := http.StatusText(statusCode)
+		if description == "" {
+			description = "Observed status " + strconv.Itoa(statusCode)
+		}
+		operation.Responses[strconv.Itoa(statusCode)] = &Response{
+			Description: description,
+			Content:     buildContent(bodies),
+		}
+	}
+	if len(operation.Responses) == 0 {
+		operation.Responses["default"] = &Response{Description: "No response was observed"}
+	}
+	return operation
+}
+
+func buildContent(bodies map[string]*bodyObservations) map[string]MediaType {
+	if len(bodies) == 0 {
+		return nil
+	}
+	content := make(map[string]MediaType, len(bodies))
+	for contentType, body := range bodies {
+		content[contentType] = MediaType{Schema: body.schema}
+	}
+	return content
+}
+
+func observeBody(bodies map[string]*bodyObservations, contentType, body string) {
+	mediaType := normalizeContentType(contentType, body)
+	observed, found := bodies[mediaType]
+	if !found {
+		observed = &bodyObservations{}
+		bodies[mediaType] = observed
+	}
+	if observed.samples >= maxBodySamples {
+		return
+	}
+	observed.samples++
+	if !isJSONMediaType(mediaType) {
+		return
+	}
+	var value any
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return
+	}
+	observed.schema = MergeSchemas(observed.schema, InferSchema(value))
+}
+
+func mergeEndpointObservations(
+	merged *endpointObservations,
+	endpoint *endpointObservations,
+) *endpointObservations {
+	if merged == nil {
+		merged = &endpointObservations{
+			requests:  map[string]*bodyObservations{},
+			responses: map[int]map[string]*bodyObservations{},
+		}
+	}
+	merged.count += endpoint.count
+	mergeBodies(merged.requests, endpoint.requests)
+	for statusCode, bodies := range endpoint.responses {
+		if _, found := merged.responses[statusCode]; !found {
+			merged.responses[statusCode] = map[string]*bodyObservations{}
+		}
+		mergeBodies(merged.responses[statusCode], bodies)
+	}
+	return merged
+}
+
+func mergeBodies(merged, bodies map[string]*bodyObservations) {
+	for contentType, body := range bodies {
+		existing, found := merged[contentType]
+		if !found {
+			existing = &bodyObservations{}
+			merged[contentType] = existing
+		}
+		existing.schema = MergeSchemas(existing.schema, body.schema)
+		existing.samples += body.samples
+	}
+}
+
+func pathParamSchema(values []string) *Schema {
+	if len(values) == 0 {
+		return &Schema{Type: TypeString}
+	}
+	allIntegers, allUUIDs := true, true
+	for _, value := range values {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			allIntegers = false
+		}
+		if !uuidRegexp.MatchString(value) {
+			allUUIDs = false
+		}
+	}
+	switch {
+	case allIntegers:
+		return &Schema{Type: TypeInteger}
+	case allUUIDs:
+		return &Schema{Type: TypeString, Format: "uuid"}
+	default:
+		return &Schema{Type: TypeString}
+	}
+}
+
+func pathParamNames(path string) []string {
+	names := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := urltree.TryExtractPathParameter(segment); ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isTemplateSegment(value string) bool {
+	_, ok := urltree.TryExtractPathParameter(value)
+	return ok
+}
+
+func operationID(method, path string) string {
+	replacer := strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_", ".", "_")
+	return strings.ToLower(method) + strings.TrimRight(replacer.Replace(path), "_")
+}
+
+func normalizeContentType(contentType, body string) string {
+	if contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			return mediaType
+		}
+	}
+	if json.Valid([]byte(body)) {
+		return jsonContentType
+	}
+	return "application/octet-stream"
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json")
+}
+
+// splitScheme returns the scheme and the host and path of the URL, without query
+func splitScheme(rawURL string) (string, string) {
+	scheme := ""
+	if index := strings.Index(rawURL, "://"); index >= 0 {
+		scheme = rawURL[:index]
+		rawURL = rawURL[index+3:]
+	}
+	if index := strings.IndexAny(rawURL, "?#"); index >= 0 {
+		rawURL = rawURL[:index]
+	}
+	return scheme, strings.TrimRight(rawURL, "/")
+}
+
+func hostOf(url string) string {
+	host, _, _ := strings.Cut(url, "/")
+	return host
+}
+
+func pathOf(url string) string {
+	_, path, _ := strings.Cut(url, "/")
+	return "/" + path
+}
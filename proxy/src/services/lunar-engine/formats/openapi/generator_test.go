@@ -0,0 +1,141 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"lunar/engine/formats/har"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func harEntry(method, url string, status int, requestBody, responseBody string) har.Entry {
+	entry := har.Entry{
+		Request: har.Request{Method: method, URL: url},
+		Response: har.Response{
+			Status:  status,
+			Content: har.Content{MimeType: "application/json; charset=utf-8", Text: responseBody},
+		},
+	}
+	if requestBody != "" {
+		entry.Request.PostData = &har.PostData{MimeType: "application/json", Text: requestBody}
+	}
+	return entry
+}
+
+func TestGeneratorBuildsDocumentPerHost(t *testing.T) {
+	generator := NewGenerator(2)
+	for userID := range 5 {
+		generator.ObserveHAREntry(harEntry("GET",
+			fmt.Sprintf("https://api.example.com/users/%d?verbose=true", 100+userID), 200, "",
+			fmt.Sprintf(`{"id":%d,"name":"user","tags":["a"],"score":1.5}`, 100+userID)))
+	}
+	generator.ObserveHAREntry(harEntry("GET", "https://api.example.com/users/7", 404, "",
+		`{"error":"not found"}`))
+	generator.ObserveHAREntry(harEntry("POST", "https://api.example.com/users", 201,
+		`{"name":"new","email":null}`, `{"id":8}`))
+	health := harEntry("GET", "http://other.example.org/health", 200, "", "ok")
+	health.Response.Content.MimeType = "text/plain"
+	generator.ObserveHAREntry(health)
+
+	documents := generator.Documents()
+	require.Len(t, documents, 2)
+
+	document := documents["api.example.com"]
+	require.NotNil(t, document)
+	require.Equal(t, Version, document.OpenAPI)
+	require.Equal(t, []Server{{URL: "https://api.example.com"}}, document.Servers)
+
+	getUser := document.Paths["/users/{_param_1}"]["get"]
+	require.NotNil(t, getUser, "paths: %v", document.Paths)
+	require.Equal(t, 6, getUser.ObservedCount)
+	require.Len(t, getUser.Parameters, 1)
+	require.Equal(t, ParameterInPath, getUser.Parameters[0].In)
+	require.Equal(t, TypeInteger, getUser.Parameters[0].Schema.Type)
+
+	okSchema := getUser.Responses["200"].Content["application/json"].Schema
+	require.Equal(t, TypeObject, okSchema.Type)
+	require.Equal(t, TypeInteger, okSchema.Properties["id"].Type)
+	require.Equal(t, TypeNumber, okSchema.Properties["score"].Type)
+	require.Equal(t, TypeString, okSchema.Properties["tags"].Items.Type)
+	require.Equal(t, []string{"id", "name", "score", "tags"}, okSchema.Required)
+	require.Equal(t, TypeString,
+		getUser.Responses["404"].Content["application/json"].Schema.Properties["error"].Type)
+
+	createUser := document.Paths["/users"]["post"]
+	require.NotNil(t, createUser)
+	requestSchema := createUser.RequestBody.Content["application/json"].Schema
+	require.True(t, requestSchema.Properties["email"].Nullable)
+	require.Contains(t, createUser.Responses, "201")
+
+	other := documents["other.example.org"]
+	require.Equal(t, []Server{{URL: "http://other.example.org"}}, other.Servers)
+	healthContent := other.Paths["/health"]["get"].Responses["200"].Content
+	require.Contains(t, healthContent, "text/plain")
+	require.Nil(t, healthContent["text/plain"].Schema)
+}
+
+func TestObserveHARReadsDocumentsAndLines(t *testing.T) {
+	entry := harEntry("GET", "https://api.example.com/items", 200, "",
+		base64.StdEncoding.EncodeToString([]byte(`[{"id":"3f2b8c1e-4b7a-4c1d-9a8e-2f6d5c4b3a21"}]`)))
+	entry.Response.Content.Encoding = "base64"
+
+	document, err := json.Marshal(har.HAR{Log: har.Log{Entries: []har.Entry{entry}}})
+	require.NoError(t, err)
+	line, err := json.Marshal(entry)
+	require.NoError(t, err)
+
+	generator := NewGenerator(DefaultMaxSplitThreshold)
+	input := string(document) + "\n" + string(line) + "\n" + string(line) + "\n"
+	observed, err := generator.ObserveHAR(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Equal(t, 3, observed)
+
+	items := generator.Documents()["api.example.com"].Paths["/items"]["get"]
+	require.Equal(t, 3, items.ObservedCount)
+	schema := items.Responses["200"].Content["application/json"].Schema
+	require.Equal(t, TypeArray, schema.Type)
+	require.Equal(t, "uuid", schema.Items.Properties["id"].Format)
+
+	_, err = generator.ObserveHAR(strings.NewReader(`{"log": `))
+	require.Error(t, err)
+}
+
+func TestObserveDiscoveryDeclaresTemplates(t *testing.T) {
+	generator := NewGenerator(DefaultMaxSplitThreshold)
+	generator.ObserveDiscovery(sharedDiscovery.Output{
+		Endpoints: map[string]sharedDiscovery.EndpointOutput{
+			"GET:::api.example.com/orders/{order_id}": {
+				Count:       12,
+				StatusCodes: map[int]int{200: 10, 500: 2},
+			},
+		},
+	})
+	generator.ObserveHAREntry(harEntry("GET", "https://api.example.com/orders/ab12", 200, "",
+		`{"total":10}`))
+
+	orders := generator.Documents()["api.example.com"].Paths["/orders/{order_id}"]["get"]
+	require.NotNil(t, orders)
+	require.Equal(t, 13, orders.ObservedCount)
+	require.Equal(t, "order_id", orders.Parameters[0].Name)
+	require.Equal(t, "ab12", orders.Parameters[0].Example)
+	require.Contains(t, orders.Responses, "500")
+	require.Equal(t, TypeInteger,
+		orders.Responses["200"].Content["application/json"].Schema.Properties["total"].Type)
+}
+
+func TestMergeSchemas(t *testing.T) {
+	merged := MergeSchemas(
+		InferSchema(map[string]any{"a": 1.0, "b": "x", "c": nil}),
+		InferSchema(map[string]any{"a": 1.5, "c": true}),
+	)
+	require.Equal(t, TypeNumber, merged.Properties["a"].Type)
+	require.Equal(t, TypeString, merged.Properties["b"].Type)
+	require.Equal(t, &Schema{Type: TypeBoolean, Nullable: true}, merged.Properties["c"])
+	require.Equal(t, []string{"a", "c"}, merged.Required)
+
+	require.Equal(t, &Schema{}, MergeSchemas(InferSchema("x"), InferSchema(1.0)))
+}
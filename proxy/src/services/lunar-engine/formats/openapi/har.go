@@ -0,0 +1,83 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"lunar/engine/formats/har"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+// ObserveHAR observes the entries of a HAR document, or of HAR entries written one per line
+// as done by the HAR collector through the file exporter. It returns the number of entries observed.
+func (g *Generator) ObserveHAR(reader io.Reader) (int, error) {
+	decoder := json.NewDecoder(reader)
+	observed := 0
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return observed, nil
+		}
+		if err != nil {
+			return observed, fmt.Errorf("failed to decode HAR after %d entries: %w", observed, err)
+		}
+
+		var document har.HAR
+		if err = json.Unmarshal(raw, &document); err == nil && document.Log.Entries != nil {
+			for _, entry := range document.Log.Entries {
+				g.ObserveHAREntry(entry)
+				observed++
+			}
+			continue
+		}
+
+		var entry har.Entry
+		if err = json.Unmarshal(raw, &entry); err != nil || entry.Request.URL == "" {
+			log.Trace().Err(err).Msg("Skipping a value which is not a HAR entry")
+			continue
+		}
+		g.ObserveHAREntry(entry)
+		observed++
+	}
+}
+
+func (g *Generator) ObserveHAREntry(entry har.Entry) {
+	observation := Observation{
+		Method:              entry.Request.Method,
+		URL:                 entry.Request.URL,
+		ResponseContentType: entry.Response.Content.MimeType,
+	}
+	if entry.Response.Status > 0 {
+		observation.StatusCodes = []int{entry.Response.Status}
+	}
+	if entry.Request.PostData != nil {
+		observation.RequestContentType = entry.Request.PostData.MimeType
+		observation.RequestBody = entry.Request.PostData.Text
+	}
+
+	responseBody, err := decodeHARBody(entry.Response.Content.Text, entry.Response.Content.Encoding)
+	if err != nil {
+		log.Trace().Err(err).Msgf("Skipping the response body of %s", entry.Request.URL)
+	}
+	observation.ResponseBody = responseBody
+	if strings.TrimSpace(observation.RequestBody) == "" {
+		observation.RequestBody = ""
+	}
+	g.Observe(observation)
+}
+
+func decodeHARBody(text, encoding string) (string, error) {
+	if encoding != "base64" {
+		return text, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64 body: %w", err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,135 @@
+package openapi
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	// maxSchemaDepth bounds the nesting of inferred schemas, deeper values get an empty schema
+	maxSchemaDepth = 32
+	// maxInferredItems bounds the array items which are inspected for the items schema
+	maxInferredItems = 50
+)
+
+var uuidRegexp = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// InferSchema returns the schema of a decoded JSON value
+func InferSchema(value any) *Schema {
+	return inferSchema(value, 0)
+}
+
+func inferSchema(value any, depth int) *Schema {
+	if depth > maxSchemaDepth {
+		return &Schema{}
+	}
+	switch typed := value.(type) {
+	case nil:
+		return &Schema{Nullable: true}
+	case bool:
+		return &Schema{Type: TypeBoolean}
+	case float64:
+		if typed == math.Trunc(typed) && !math.IsInf(typed, 0) {
+			return &Schema{Type: TypeInteger}
+		}
+		return &Schema{Type: TypeNumber}
+	case string:
+		return &Schema{Type: TypeString, Format: inferStringFormat(typed)}
+	case []any:
+		var items *Schema
+		for _, item := range typed[:min(len(typed), maxInferredItems)] {
+			items = MergeSchemas(items, inferSchema(item, depth+1))
+		}
+		if items == nil {
+			items = &Schema{}
+		}
+		return &Schema{Type: TypeArray, Items: items}
+	case map[string]any:
+		schema := &Schema{
+			Type:       TypeObject,
+			Properties: make(map[string]*Schema, len(typed)),
+			Required:   make([]string, 0, len(typed)),
+		}
+		for key, property := range typed {
+			schema.Properties[key] = inferSchema(property, depth+1)
+			schema.Required = append(schema.Required, key)
+		}
+		slices.Sort(schema.Required)
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+func inferStringFormat(value string) string {
+	if uuidRegexp.MatchString(value) {
+		return "uuid"
+	}
+	if _, err := time.Parse(time.RFC3339, value); err == nil {
+		return "date-time"
+	}
+	return ""
+}
+
+// MergeSchemas returns a schema accepting the values of both schemas.
+// Object properties are merged, and only the properties required by both stay required.
+// Schemas of different types merge into an empty schema, which accepts any value.
+func MergeSchemas(schemaA, schemaB *Schema) *Schema {
+	if schemaA == nil {
+		return schemaB
+	}
+	if schemaB == nil {
+		return schemaA
+	}
+
+	nullable := schemaA.Nullable || schemaB.Nullable
+	switch {
+	case schemaA.Type == "" && schemaA.isNullOnly():
+		merged := *schemaB
+		merged.Nullable = true
+		return &merged
+	case schemaB.Type == "" && schemaB.isNullOnly():
+		merged := *schemaA
+		merged.Nullable = true
+		return &merged
+	case isNumeric(schemaA.Type) && isNumeric(schemaB.Type) && schemaA.Type != schemaB.Type:
+		return &Schema{Type: TypeNumber, Nullable: nullable}
+	case schemaA.Type != schemaB.Type:
+		return &Schema{}
+	}
+
+	merged := &Schema{Type: schemaA.Type, Nullable: nullable}
+	if schemaA.Format == schemaB.Format {
+		merged.Format = schemaA.Format
+	}
+	switch merged.Type {
+	case TypeArray:
+		merged.Items = MergeSchemas(schemaA.Items, schemaB.Items)
+	case TypeObject:
+		merged.Properties = make(map[string]*Schema, len(schemaA.Properties))
+		for key, property := range schemaA.Properties {
+			merged.Properties[key] = property
+		}
+		for key, property := range schemaB.Properties {
+			merged.Properties[key] = MergeSchemas(merged.Properties[key], property)
+		}
+		merged.Required = []string{}
+		for _, key := range schemaA.Required {
+			if slices.Contains(schemaB.Required, key) {
+				merged.Required = append(merged.Required, key)
+			}
+		}
+	}
+	return merged
+}
+
+func (s *Schema) isNullOnly() bool {
+	return s.Nullable && s.Properties == nil && s.Items == nil
+}
+
+func isNumeric(schemaType string) bool {
+	return schemaType == TypeInteger || schemaType == TypeNumber
+}
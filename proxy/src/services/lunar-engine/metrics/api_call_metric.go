@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -61,13 +62,26 @@ func (m *apiCallCountMetricManager) collectMetrics(observer metric.Int64Observer
 		log.Error().Err(err).Msg("Failed to read and parse JSON file")
 		return err
 	}
+	// label sets overflowed by the cardinality limits are summed into a single observation
+	counts := map[attribute.Distinct]int64{}
+	labelSets := map[attribute.Distinct][]attribute.KeyValue{}
 	for consumer, endpointMap := range data.NewConsumerData {
 		for endpoint, endpointAgg := range endpointMap {
 			for statusCode, count := range endpointAgg.StatusCodes {
 				labels := m.labelManager.GetAttributesFromDiscoveryEndpoint(endpoint, consumer, statusCode)
-				observer.Observe(int64(count), metric.WithAttributes(labels...))
+				labels, recorded := m.labelManager.LimitCardinality(string(APICallCountMetric), labels)
+				if !recorded {
+					continue
+				}
+				labelSet := attribute.NewSet(labels...)
+				key := labelSet.Equivalent()
+				counts[key] += int64(count)
+				labelSets[key] = labels
 			}
 		}
 	}
+	for key, count := range counts {
+		observer.Observe(count, metric.WithAttributes(labelSets[key]...))
+	}
 	return nil
 }
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// OverflowLabelValue replaces the label values of label sets above the cardinality limit
+	OverflowLabelValue = "__other__"
+	// DefaultMaxLabelSets is the number of distinct label sets kept per metric when not configured
+	DefaultMaxLabelSets = 10000
+
+	CardinalityLimitedMetric Metric = "metric_cardinality_limited"
+
+	cardinalityOutcomeOverflowed = "overflowed"
+	cardinalityOutcomeDropped    = "dropped"
+	limitedMetricLabel           = "metric"
+	outcomeLabel                 = "outcome"
+
+	// minOverflowLabelSets is the least headroom kept above the limit for the overflow label sets
+	minOverflowLabelSets = 10
+)
+
+// boundedLabels have few values, so they are kept when the other label values are overflowed
+var boundedLabels = map[attribute.Key]struct{}{
+	"gateway_id": {},
+	FlowName:     {},
+	ProcessorKey: {},
+	HTTPMethod:   {},
+	StatusCode:   {},
+}
+
+var globalCardinalityGuard = newCardinalityGuard()
+
+// cardinalityGuard bounds the distinct label sets recorded per metric.
+// Label sets above the limit have their unbounded label values replaced with __other__,
+// and are dropped once the overflow label sets exceed the headroom above the limit too.
+type cardinalityGuard struct {
+	mu           sync.Mutex
+	maxLabelSets int
+	limits       map[string]int
+	labelSets    map[string]map[attribute.Distinct]struct{}
+	limitedCount metric.Int64Counter
+}
+
+func newCardinalityGuard() *cardinalityGuard {
+	return &cardinalityGuard{
+		maxLabelSets: DefaultMaxLabelSets,
+		limits:       map[string]int{},
+		labelSets:    map[string]map[attribute.Distinct]struct{}{},
+	}
+}
+
+// configure sets the limits of the metrics config and creates the self metric
+func (g *cardinalityGuard) configure(limits *CardinalityLimits, meter metric.Meter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.maxLabelSets = DefaultMaxLabelSets
+	g.limits = map[string]int{}
+	if limits != nil {
+		if limits.MaxLabelSets != 0 {
+			g.maxLabelSets = limits.MaxLabelSets
+		}
+		for metricName, limit := range limits.Metrics {
+			g.limits[metricName] = limit
+		}
+	}
+
+	if g.limitedCount != nil || meter == nil {
+		return
+	}
+	counter, err := meter.Int64Counter(
+		MetricPrefix+string(CardinalityLimitedMetric),
+		metric.WithDescription(
+			"Number of observations overflowed into __other__ or dropped by the metric cardinality limits"),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to create %v metric", CardinalityLimitedMetric)
+		return
+	}
+	g.limitedCount = counter
+}
+
+// limit returns the attributes to record the metric with,
+// and false when the label set is dropped and the value should not be recorded
+func (g *cardinalityGuard) limit(
+	metricName string,
+	attributes []attribute.KeyValue,
+) ([]attribute.KeyValue, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	maxLabelSets := g.maxLabelSets
+	if limit, found := g.limits[metricName]; found {
+		maxLabelSets = limit
+	}
+	if maxLabelSets < 0 {
+		return attributes, true
+	}
+
+	labelSets, found := g.labelSets[metricName]
+	if !found {
+		labelSets = map[attribute.Distinct]struct{}{}
+		g.labelSets[metricName] = labelSets
+	}
+	// NewSet sorts the attributes it is given, so the caller's attributes are copied
+	labelSet := attribute.NewSet(slices.Clone(attributes)...)
+	if _, found := labelSets[labelSet.Equivalent()]; found {
+		return attributes, true
+	}
+	if len(labelSets) < maxLabelSets {
+		labelSets[labelSet.Equivalent()] = struct{}{}
+		return attributes, true
+	}
+
+	overflowed := overflowAttributes(attributes)
+	overflowSet := attribute.NewSet(slices.Clone(overflowed)...)
+	if _, found := labelSets[overflowSet.Equivalent()]; !found {
+		if len(labelSets) >= maxLabelSets+max(maxLabelSets/10, minOverflowLabelSets) {
+			g.recordLimited(metricName, cardinalityOutcomeDropped)
+			return nil, false
+		}
+		labelSets[overflowSet.Equivalent()] = struct{}{}
+	}
+	g.recordLimited(metricName, cardinalityOutcomeOverflowed)
+	return overflowed, true
+}
+
+func (g *cardinalityGuard) recordLimited(metricName, outcome string) {
+	if g.limitedCount == nil {
+		return
+	}
+	g.limitedCount.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String(limitedMetricLabel, metricName),
+		attribute.String(outcomeLabel, outcome),
+	))
+}
+
+func overflowAttributes(attributes []attribute.KeyValue) []attribute.KeyValue {
+	overflowed := make([]attribute.KeyValue, 0, len(attributes))
+	for _, attr := range attributes {
+		if _, bounded := boundedLabels[attr.Key]; bounded {
+			overflowed = append(overflowed, attr)
+			continue
+		}
+		overflowed = append(overflowed, attribute.String(string(attr.Key), OverflowLabelValue))
+	}
+	return overflowed
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func hostAttributes(host string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(Host, host),
+		attribute.String(StatusCode, "200"),
+		attribute.String("gateway_id", "gw"),
+	}
+}
+
+func TestCardinalityGuardOverflowsAboveLimit(t *testing.T) {
+	guard := newCardinalityGuard()
+	guard.configure(&CardinalityLimits{MaxLabelSets: 2}, nil)
+
+	for index := range 2 {
+		attributes, recorded := guard.limit("api_call_count", hostAttributes(strconv.Itoa(index)))
+		require.True(t, recorded)
+		require.Equal(t, hostAttributes(strconv.Itoa(index)), attributes)
+	}
+
+	attributes, recorded := guard.limit("api_call_count", hostAttributes("0"))
+	require.True(t, recorded)
+	require.Equal(t, hostAttributes("0"), attributes)
+
+	attributes, recorded = guard.limit("api_call_count", hostAttributes("new"))
+	require.True(t, recorded)
+	require.Equal(t, hostAttributes(OverflowLabelValue), attributes)
+
+	// other metrics have their own label sets
+	attributes, recorded = guard.limit("transaction_duration", hostAttributes("new"))
+	require.True(t, recorded)
+	require.Equal(t, hostAttributes("new"), attributes)
+}
+
+func TestCardinalityGuardDropsAboveOverflowHeadroom(t *testing.T) {
+	guard := newCardinalityGuard()
+	guard.configure(&CardinalityLimits{Metrics: map[string]int{"custom": 1}}, nil)
+
+	_, recorded := guard.limit("custom", hostAttributes("a"))
+	require.True(t, recorded)
+
+	// every status code makes another overflow label set, until the headroom is used
+	for index := range minOverflowLabelSets {
+		attributes := []attribute.KeyValue{
+			attribute.String(Host, "b"),
+			attribute.String(StatusCode, strconv.Itoa(index)),
+		}
+		limited, recorded := guard.limit("custom", attributes)
+		require.True(t, recorded)
+		require.Equal(t, OverflowLabelValue, limited[0].Value.AsString())
+	}
+
+	_, recorded = guard.limit("custom", []attribute.KeyValue{
+		attribute.String(Host, "c"),
+		attribute.String(StatusCode, "999"),
+	})
+	require.False(t, recorded)
+
+	// known overflow label sets are still recorded
+	_, recorded = guard.limit("custom", []attribute.KeyValue{
+		attribute.String(Host, "d"),
+		attribute.String(StatusCode, "0"),
+	})
+	require.True(t, recorded)
+}
+
+func TestCardinalityGuardNegativeLimitDisables(t *testing.T) {
+	guard := newCardinalityGuard()
+	guard.configure(&CardinalityLimits{MaxLabelSets: -1}, nil)
+
+	for index := range 100 {
+		attributes, recorded := guard.limit("api_call_count", hostAttributes(strconv.Itoa(index)))
+		require.True(t, recorded)
+		require.Equal(t, hostAttributes(strconv.Itoa(index)), attributes)
+	}
+}
+
+func TestProcessorMetricsLimitedPerMetricName(t *testing.T) {
+	const hitMetric, missMetric = "lunar_filter_processor_hit_count", "lunar_filter_processor_miss_count"
+	globalCardinalityGuard.configure(&CardinalityLimits{Metrics: map[string]int{hitMetric: 1}}, nil)
+	t.Cleanup(func() {
+		globalCardinalityGuard = newCardinalityGuard()
+	})
+
+	labelManager := NewLabelManager([]string{FlowName, ProcessorKey})
+	accountAttributes := func(account string) []attribute.KeyValue {
+		attributes := labelManager.GetProcessorMetricsAttributes(
+			&mockAPICallMetricsProvider{}, "flow", "filter")
+		return append(attributes, attribute.String("account", account))
+	}
+
+	attributes, recorded := labelManager.LimitCardinality(hitMetric, accountAttributes("a"))
+	require.True(t, recorded)
+	require.Equal(t, accountAttributes("a"), attributes)
+
+	// the limit of the hit metric does not apply to the miss metric of the same processor
+	attributes, recorded = labelManager.LimitCardinality(missMetric, accountAttributes("b"))
+	require.True(t, recorded)
+	require.Equal(t, accountAttributes("b"), attributes)
+
+	attributes, recorded = labelManager.LimitCardinality(hitMetric, accountAttributes("b"))
+	require.True(t, recorded)
+	require.Equal(t, OverflowLabelValue, attributes[len(attributes)-1].Value.AsString())
+}
@@ -82,6 +82,15 @@ func (l *LabelManager) GetProcessorMetricsAttributes(
 	return attributes
 }
 
+// LimitCardinality returns the attributes to record the metric with, under the cardinality limits
+// of metrics.yaml. It returns false when the label set is dropped and the value should not be recorded.
+func (l *LabelManager) LimitCardinality(
+	metricName string,
+	attributes []attribute.KeyValue,
+) ([]attribute.KeyValue, bool) {
+	return globalCardinalityGuard.limit(metricName, attributes)
+}
+
 func (l *LabelManager) GetProcessorMetricsFullAttributes(
 	provider APICallMetricsProviderI,
 	flowName, processorKey string,
@@ -31,6 +31,7 @@ type MetricManager struct {
 	apiCallMetricMng              *apiCallCountMetricManager
 	transactionMetricsManager     *transactionMetricsManager
 	remainingConnectionsMetricMng *remainingConnectionsMetricManager
+	sloTracker                    *SLOTracker
 	providerData                  *metricsProviderData
 
 	metricManagerActive bool
@@ -47,6 +48,7 @@ func NewMetricManager() (*MetricManager, error) {
 		return &MetricManager{}, err
 	}
 
+	globalCardinalityGuard.configure(config.CardinalityLimits, meter)
 	labeledEndpointMng := NewLabeledEndpointManager(config.LabeledEndpoints)
 	mng := &MetricManager{
 		config:        config,
@@ -68,7 +70,13 @@ func NewMetricManager() (*MetricManager, error) {
 		return mng, fmt.Errorf("failed to initialize remaining connections metric: %w", err)
 	}
 
-	mng.transactionMetricsManager, err = newTransactionMetricsManager(meter, config, mng.labelManager)
+	mng.sloTracker = NewSLOTracker(loadSLOs())
+	if err := mng.sloTracker.registerMetrics(meter); err != nil {
+		return mng, fmt.Errorf("failed to initialize SLO metrics: %w", err)
+	}
+
+	mng.transactionMetricsManager, err = newTransactionMetricsManager(
+		meter, config, mng.labelManager, mng.sloTracker)
 	if err != nil {
 		return mng, fmt.Errorf("failed to initialize transaction metrics: %w", err)
 	}
@@ -106,6 +114,8 @@ func (m *MetricManager) ReloadMetricsConfig() error {
 		return nil
 	}
 
+	globalCardinalityGuard.configure(config.CardinalityLimits, m.meter)
+
 	if !slices.Equal(config.GeneralMetrics.LabelValue, m.config.GeneralMetrics.LabelValue) {
 		log.Info().Msg("Reloading labels")
 		m.labelManager.SetLabels(config.GeneralMetrics.LabelValue)
@@ -160,6 +170,21 @@ func (m *MetricManager) UpdateMetricsProviderForFlow(provider FlowMetricsProvide
 	m.providerData.UpdateFlowDataProvider(provider)
 }
 
+// SetSLOFlows sets the filter URLs of every flow, to match the flows and the endpoints of the SLOs
+func (m *MetricManager) SetSLOFlows(flowURLs map[string][]string) {
+	m.sloTracker.SetFlows(flowURLs)
+}
+
+// IsFlowBurningSLO tells whether an SLO flagging the flow burns its error budget too fast
+func (m *MetricManager) IsFlowBurningSLO(flowName string) bool {
+	return m.sloTracker.IsFlowBurning(flowName)
+}
+
+// GetSLOStatuses returns the error budgets and burn rates of the SLOs of the gateway config
+func (m *MetricManager) GetSLOStatuses() []SLOStatus {
+	return m.sloTracker.GetStatuses()
+}
+
 // initializeObservableMetrics initializes the metrics by parsing
 func (m *MetricManager) initializeObservableMetrics(metrics []MetricValue) (
 	[]metric.Observable,
@@ -12,8 +12,17 @@ type GeneralMetrics struct {
 	MetricValue []MetricValue `yaml:"metric_value"`
 }
 
+// CardinalityLimits bounds the distinct label sets recorded per metric
+type CardinalityLimits struct {
+	// MaxLabelSets is the limit of the metrics not listed in Metrics,
+	// DefaultMaxLabelSets when not set and unlimited when negative
+	MaxLabelSets int            `yaml:"max_label_sets,omitempty"`
+	Metrics      map[string]int `yaml:"metrics,omitempty"`
+}
+
 type Config struct {
-	GeneralMetrics   GeneralMetrics `yaml:"general_metrics"`
-	SystemMetrics    []MetricValue  `yaml:"system_metrics"`
-	LabeledEndpoints []string       `yaml:"labeled_endpoints"`
+	GeneralMetrics    GeneralMetrics     `yaml:"general_metrics"`
+	SystemMetrics     []MetricValue      `yaml:"system_metrics"`
+	LabeledEndpoints  []string           `yaml:"labeled_endpoints"`
+	CardinalityLimits *CardinalityLimits `yaml:"cardinality_limits,omitempty"`
 }
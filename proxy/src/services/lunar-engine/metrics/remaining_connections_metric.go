@@ -10,7 +10,7 @@ import (
 	"go.opentelemetry.io/otel/metric"
 )
 
-const haproxySocketPath = "/var/run/haproxy/haproxy.sock"
+const HAProxySocketPath = "/var/run/haproxy/haproxy.sock"
 
 type remainingConnectionsMetricManager struct {
 	haproxy    *haproxy.Stats
@@ -51,7 +51,7 @@ func (m *remainingConnectionsMetricManager) remainingConnectionsCallback(
 }
 
 func (m *remainingConnectionsMetricManager) init(meter metric.Meter) error {
-	haproxyClient, err := haproxy.NewHAProxyStatsClient(haproxySocketPath)
+	haproxyClient, err := haproxy.NewHAProxyStatsClient(HAProxySocketPath)
 	if err != nil {
 		return fmt.Errorf("failed to create HAProxy stats client: %w", err)
 	}
@@ -0,0 +1,461 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/urltree"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	SLOTypeAvailability = "availability"
+	SLOTypeLatency      = "latency"
+
+	SLOComplianceMetric           Metric = "slo_compliance"
+	SLOErrorBudgetRemainingMetric Metric = "slo_error_budget_remaining"
+	SLOBurnRateMetric             Metric = "slo_burn_rate"
+	SLOAlertMetric                Metric = "slo_alert"
+
+	sloLabel      = "slo"
+	windowLabel   = "window"
+	severityLabel = "severity"
+
+	defaultSLOWindow = 7 * 24 * time.Hour
+	maxSLOWindow     = 30 * 24 * time.Hour
+	// sloSampleInterval is the least time between the kept samples of an SLO
+	sloSampleInterval = time.Minute
+)
+
+// burnRateAlert fires while both its windows burn the error budget at its threshold rate at least.
+// The thresholds spend 2% of a 30 days budget in an hour, and 5% of it in 6 hours.
+type burnRateAlert struct {
+	Severity    string
+	LongWindow  time.Duration
+	ShortWindow time.Duration
+	Threshold   float64
+}
+
+var burnRateAlerts = []burnRateAlert{
+	{Severity: "page", LongWindow: time.Hour, ShortWindow: 5 * time.Minute, Threshold: 14.4},
+	{Severity: "ticket", LongWindow: 6 * time.Hour, ShortWindow: 30 * time.Minute, Threshold: 6},
+}
+
+// SLOStatus is the state of an SLO over its rolling window
+type SLOStatus struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Target float64 `json:"target"`
+	Window string  `json:"window"`
+	Total  float64 `json:"total"`
+	Good   float64 `json:"good"`
+	// Compliance is the share of good calls in the window, 1 without calls
+	Compliance float64 `json:"compliance"`
+	// ErrorBudgetRemaining is the share of the error budget left, negative once overspent
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	// BurnRates by window, the rate the error budget is spent at relative to the target
+	BurnRates map[string]float64 `json:"burn_rates"`
+	// Alerts are the severities of the burn rate alerts firing
+	Alerts []string `json:"alerts,omitempty"`
+	Flows  []string `json:"flows,omitempty"`
+}
+
+type sloSample struct {
+	at    time.Time
+	total float64
+	good  float64
+}
+
+type trackedSLO struct {
+	config          environment.SLO
+	window          time.Duration
+	endpointTree    *urltree.URLTree[emptyStruct]
+	labeledEndpoint *regexp.Regexp
+	samples         []sloSample
+	flows           []string
+}
+
+type emptyStruct struct{}
+
+// SLOTracker computes the error budgets and burn rates of the SLOs of the gateway config,
+// out of the cumulative counts of the discovery state sampled over time.
+type SLOTracker struct {
+	mu           sync.RWMutex
+	slos         []*trackedSLO
+	flowTrees    map[string]*urltree.URLTree[emptyStruct]
+	statuses     []SLOStatus
+	burningFlows map[string]bool
+	registration metric.Registration
+}
+
+func NewSLOTracker(slos []environment.SLO) *SLOTracker {
+	tracker := &SLOTracker{
+		flowTrees:    map[string]*urltree.URLTree[emptyStruct]{},
+		burningFlows: map[string]bool{},
+	}
+	for _, slo := range slos {
+		tracked, err := newTrackedSLO(slo)
+		if err != nil {
+			log.Error().Err(err).Msgf("Skipping SLO %s", slo.Name)
+			continue
+		}
+		tracker.slos = append(tracker.slos, tracked)
+	}
+	return tracker
+}
+
+func newTrackedSLO(slo environment.SLO) (*trackedSLO, error) {
+	if slo.Name == "" {
+		return nil, fmt.Errorf("missing SLO name")
+	}
+	if slo.Target <= 0 || slo.Target >= 1 {
+		return nil, fmt.Errorf("target must be between 0 and 1, got %v", slo.Target)
+	}
+	switch slo.Type {
+	case SLOTypeAvailability:
+	case SLOTypeLatency:
+		if slo.LatencyThresholdMs <= 0 {
+			return nil, fmt.Errorf("latency SLO requires a positive latency_threshold_ms")
+		}
+	default:
+		return nil, fmt.Errorf("unknown SLO type %q", slo.Type)
+	}
+
+	tracked := &trackedSLO{config: slo, window: defaultSLOWindow}
+	if slo.Window != "" {
+		window, err := parseSLOWindow(slo.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window: %w", err)
+		}
+		if window <= 0 || window > maxSLOWindow {
+			return nil, fmt.Errorf("window must be positive and at most %v", maxSLOWindow)
+		}
+		tracked.window = window
+	}
+
+	selectors := 0
+	if slo.Flow != "" {
+		selectors++
+		tracked.flows = []string{slo.Flow}
+	}
+	if slo.Endpoint != "" {
+		selectors++
+		tracked.endpointTree = urltree.NewURLTree[emptyStruct](false, 0)
+		if err := tracked.endpointTree.Insert(slo.Endpoint, &emptyStruct{}); err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+	}
+	if slo.LabeledEndpoint != "" {
+		selectors++
+		pattern, err := regexp.Compile(convertPatternToRegex(slo.LabeledEndpoint))
+		if err != nil {
+			return nil, fmt.Errorf("invalid labeled endpoint: %w", err)
+		}
+		tracked.labeledEndpoint = pattern
+	}
+	if selectors != 1 {
+		return nil, fmt.Errorf("exactly one of flow, endpoint or labeled_endpoint must be set")
+	}
+	return tracked, nil
+}
+
+// HasSLOs tells whether any valid SLO is tracked
+func (t *SLOTracker) HasSLOs() bool {
+	return t != nil && len(t.slos) > 0
+}
+
+// SetFlows sets the URLs of the filters of every flow, to select the transactions of flow SLOs
+// and to find the flows flagged by endpoint SLOs
+func (t *SLOTracker) SetFlows(flowURLs map[string][]string) {
+	if !t.HasSLOs() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.flowTrees = make(map[string]*urltree.URLTree[emptyStruct], len(flowURLs))
+	for flowName, urls := range flowURLs {
+		tree := urltree.NewURLTree[emptyStruct](false, 0)
+		for _, url := range urls {
+			if err := tree.Insert(url, &emptyStruct{}); err != nil {
+				log.Debug().Err(err).Msgf("Skipping URL %s of flow %s for SLOs", url, flowName)
+			}
+		}
+		t.flowTrees[flowName] = tree
+	}
+
+	for _, slo := range t.slos {
+		if slo.config.Flow != "" {
+			continue
+		}
+		slo.flows = nil
+		for flowName, urls := range flowURLs {
+			if slices.ContainsFunc(urls, slo.matchesURL) {
+				slo.flows = append(slo.flows, flowName)
+			}
+		}
+		slices.Sort(slo.flows)
+	}
+}
+
+// Update samples the cumulative counts of the endpoints and recomputes the SLO statuses
+func (t *SLOTracker) Update(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg,
+	now time.Time,
+) {
+	if !t.HasSLOs() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]SLOStatus, 0, len(t.slos))
+	burningFlows := map[string]bool{}
+	for _, slo := range t.slos {
+		total, good := 0.0, 0.0
+		for endpoint, agg := range endpoints {
+			if !t.matches(slo, endpoint) {
+				continue
+			}
+			endpointTotal, endpointGood := slo.count(agg)
+			total += endpointTotal
+			good += endpointGood
+		}
+		slo.addSample(sloSample{at: now, total: total, good: good})
+
+		status := slo.status(now)
+		if slo.config.FlagFlows && len(status.Alerts) > 0 {
+			for _, flowName := range slo.flows {
+				burningFlows[flowName] = true
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	t.statuses = statuses
+	t.burningFlows = burningFlows
+}
+
+// GetStatuses returns the SLO statuses of the last update
+func (t *SLOTracker) GetStatuses() []SLOStatus {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.statuses)
+}
+
+// IsFlowBurning tells whether an SLO flagging the flow burns its error budget too fast
+func (t *SLOTracker) IsFlowBurning(flowName string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.burningFlows[flowName]
+}
+
+func (t *SLOTracker) registerMetrics(meter metric.Meter) error {
+	if !t.HasSLOs() {
+		return nil
+	}
+	compliance, err := meter.Float64ObservableGauge(MetricPrefix+string(SLOComplianceMetric),
+		metric.WithDescription("Share of good calls over the SLO window"))
+	if err != nil {
+		return err
+	}
+	budget, err := meter.Float64ObservableGauge(MetricPrefix+string(SLOErrorBudgetRemainingMetric),
+		metric.WithDescription("Share of the SLO error budget left over its window"))
+	if err != nil {
+		return err
+	}
+	burnRate, err := meter.Float64ObservableGauge(MetricPrefix+string(SLOBurnRateMetric),
+		metric.WithDescription("Rate the SLO error budget is spent at, by window"))
+	if err != nil {
+		return err
+	}
+	alert, err := meter.Int64ObservableGauge(MetricPrefix+string(SLOAlertMetric),
+		metric.WithDescription("Whether the SLO burn rate alert of the severity is firing"))
+	if err != nil {
+		return err
+	}
+
+	t.registration, err = meter.RegisterCallback(
+		func(_ context.Context, observer metric.Observer) error {
+			for _, status := range t.GetStatuses() {
+				sloAttribute := attribute.String(sloLabel, status.Name)
+				observer.ObserveFloat64(compliance, status.Compliance,
+					metric.WithAttributes(appendGatewayIDAttribute(sloAttribute)...))
+				observer.ObserveFloat64(budget, status.ErrorBudgetRemaining,
+					metric.WithAttributes(appendGatewayIDAttribute(sloAttribute)...))
+				for window, rate := range status.BurnRates {
+					observer.ObserveFloat64(burnRate, rate, metric.WithAttributes(
+						appendGatewayIDAttribute(sloAttribute, attribute.String(windowLabel, window))...))
+				}
+				for _, burnAlert := range burnRateAlerts {
+					firing := int64(0)
+					if slices.Contains(status.Alerts, burnAlert.Severity) {
+						firing = 1
+					}
+					observer.ObserveInt64(alert, firing, metric.WithAttributes(
+						appendGatewayIDAttribute(sloAttribute,
+							attribute.String(severityLabel, burnAlert.Severity))...))
+				}
+			}
+			return nil
+		},
+		compliance, budget, burnRate, alert,
+	)
+	return err
+}
+
+func (t *SLOTracker) matches(slo *trackedSLO, endpoint sharedDiscovery.Endpoint) bool {
+	if slo.config.Method != "" && !strings.EqualFold(slo.config.Method, endpoint.Method) {
+		return false
+	}
+	if slo.config.Flow != "" {
+		tree, found := t.flowTrees[slo.config.Flow]
+		return found && tree.Lookup(endpoint.URL).Match
+	}
+	return slo.matchesURL(endpoint.URL)
+}
+
+func (s *trackedSLO) matchesURL(url string) bool {
+	switch {
+	case s.endpointTree != nil:
+		return s.endpointTree.Lookup(url).Match
+	case s.labeledEndpoint != nil:
+		return s.labeledEndpoint.MatchString(url)
+	}
+	return false
+}
+
+// count returns the calls of the endpoint, and the good ones among them
+func (s *trackedSLO) count(agg sharedDiscovery.EndpointAgg) (float64, float64) {
+	if s.config.Type == SLOTypeLatency {
+		if agg.DurationSketch == nil {
+			return 0, 0
+		}
+		return float64(agg.DurationSketch.Count),
+			float64(agg.DurationSketch.CountAtMost(s.config.LatencyThresholdMs))
+	}
+	total, good := 0.0, 0.0
+	for statusCode, count := range agg.StatusCodes {
+		total += float64(count)
+		if statusCode < 500 {
+			good += float64(count)
+		}
+	}
+	return total, good
+}
+
+func (s *trackedSLO) addSample(sample sloSample) {
+	if len(s.samples) > 0 && sample.total < s.samples[len(s.samples)-1].total {
+		// the discovery state was reset, the counts before it cannot be compared
+		s.samples = nil
+	}
+	if len(s.samples) >= 2 && sample.at.Sub(s.samples[len(s.samples)-2].at) < sloSampleInterval {
+		s.samples[len(s.samples)-1] = sample
+	} else {
+		s.samples = append(s.samples, sample)
+	}
+
+	// keep the last sample before the window start, to compute the deltas over the whole window
+	windowStart := sample.at.Add(-s.window)
+	drop := 0
+	for drop+1 < len(s.samples) && !s.samples[drop+1].at.After(windowStart) {
+		drop++
+	}
+	s.samples = s.samples[drop:]
+}
+
+// delta returns the calls and the good calls in the window before the last sample,
+// since the first sample when the window is longer than the samples
+func (s *trackedSLO) delta(window time.Duration) (float64, float64) {
+	if len(s.samples) < 2 {
+		return 0, 0
+	}
+	last := s.samples[len(s.samples)-1]
+	windowStart := last.at.Add(-window)
+	start := s.samples[0]
+	for _, sample := range s.samples {
+		if sample.at.After(windowStart) {
+			break
+		}
+		start = sample
+	}
+	return last.total - start.total, last.good - start.good
+}
+
+func (s *trackedSLO) burnRate(window time.Duration) float64 {
+	total, good := s.delta(window)
+	if total <= 0 {
+		return 0
+	}
+	return ((total - good) / total) / (1 - s.config.Target)
+}
+
+func (s *trackedSLO) status(now time.Time) SLOStatus {
+	total, good := s.delta(s.window)
+	status := SLOStatus{
+		Name:                 s.config.Name,
+		Type:                 s.config.Type,
+		Target:               s.config.Target,
+		Window:               s.window.String(),
+		Total:                total,
+		Good:                 good,
+		Compliance:           1,
+		ErrorBudgetRemaining: 1,
+		BurnRates:            map[string]float64{},
+		Flows:                s.flows,
+	}
+	if total > 0 {
+		status.Compliance = good / total
+		status.ErrorBudgetRemaining = 1 - ((total-good)/total)/(1-s.config.Target)
+	}
+
+	for _, burnAlert := range burnRateAlerts {
+		longRate := s.burnRate(burnAlert.LongWindow)
+		shortRate := s.burnRate(burnAlert.ShortWindow)
+		status.BurnRates[burnAlert.LongWindow.String()] = longRate
+		status.BurnRates[burnAlert.ShortWindow.String()] = shortRate
+		if longRate >= burnAlert.Threshold && shortRate >= burnAlert.Threshold {
+			status.Alerts = append(status.Alerts, burnAlert.Severity)
+		}
+	}
+	log.Trace().Msgf("SLO %s at %v: %+v", s.config.Name, now, status)
+	return status
+}
+
+// parseSLOWindow parses a Go duration, or a number of days such as 7d
+func parseSLOWindow(raw string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(raw, "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// loadSLOs returns the SLOs declared in the gateway config
+func loadSLOs() []environment.SLO {
+	gatewayConfig, err := environment.LoadGatewayConfig()
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to load gateway config, no SLOs are tracked")
+		return nil
+	}
+	return gatewayConfig.SLOs
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"lunar/engine/utils/environment"
+	"testing"
+	"time"
+
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sloTestStart    = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sloTestEndpoint = sharedDiscovery.Endpoint{Method: "GET", URL: "api.com/users/{id}"}
+)
+
+func availabilityAgg(ok, failed int) sharedDiscovery.EndpointAgg {
+	return sharedDiscovery.EndpointAgg{
+		Count: sharedDiscovery.Count(ok + failed),
+		StatusCodes: map[int]sharedDiscovery.Count{
+			200: sharedDiscovery.Count(ok),
+			503: sharedDiscovery.Count(failed),
+		},
+	}
+}
+
+func updateSLOTracker(tracker *SLOTracker, at time.Duration, agg sharedDiscovery.EndpointAgg) {
+	tracker.Update(map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg{
+		sloTestEndpoint:                          agg,
+		{Method: "GET", URL: "other.com/health"}: availabilityAgg(1000, 1000),
+	}, sloTestStart.Add(at))
+}
+
+func TestSLOTrackerAvailabilityErrorBudget(t *testing.T) {
+	tracker := NewSLOTracker([]environment.SLO{{
+		Name:     "users-availability",
+		Type:     SLOTypeAvailability,
+		Target:   0.99,
+		Window:   "1d",
+		Endpoint: "api.com/users/{id}",
+	}})
+	require.True(t, tracker.HasSLOs())
+
+	updateSLOTracker(tracker, 0, availabilityAgg(0, 0))
+	status := tracker.GetStatuses()[0]
+	require.Equal(t, 1.0, status.Compliance)
+	require.Equal(t, 1.0, status.ErrorBudgetRemaining)
+
+	updateSLOTracker(tracker, 12*time.Hour, availabilityAgg(995, 5))
+	status = tracker.GetStatuses()[0]
+	require.Equal(t, 1000.0, status.Total)
+	require.Equal(t, 995.0, status.Good)
+	require.InDelta(t, 0.995, status.Compliance, 1e-9)
+	require.InDelta(t, 0.5, status.ErrorBudgetRemaining, 1e-9)
+	require.Empty(t, status.Alerts)
+
+	// the calls before the window are not counted anymore
+	updateSLOTracker(tracker, 37*time.Hour, availabilityAgg(1995, 5))
+	status = tracker.GetStatuses()[0]
+	require.Equal(t, 1000.0, status.Total)
+	require.Equal(t, 1.0, status.Compliance)
+}
+
+func TestSLOTrackerLatency(t *testing.T) {
+	tracker := NewSLOTracker([]environment.SLO{{
+		Name:               "users-latency",
+		Type:               SLOTypeLatency,
+		Target:             0.9,
+		LatencyThresholdMs: 100,
+		LabeledEndpoint:    "api.com/users/{user}",
+	}})
+
+	updateSLOTracker(tracker, 0, sharedDiscovery.EndpointAgg{DurationSketch: sharedDiscovery.NewSketch()})
+	durations := []float64{}
+	for range 80 {
+		durations = append(durations, 50)
+	}
+	for range 20 {
+		durations = append(durations, 500)
+	}
+	updateSLOTracker(tracker, time.Minute,
+		sharedDiscovery.EndpointAgg{DurationSketch: sharedDiscovery.NewSketch(durations...)})
+
+	status := tracker.GetStatuses()[0]
+	require.Equal(t, 100.0, status.Total)
+	require.Equal(t, 80.0, status.Good)
+	require.InDelta(t, -1.0, status.ErrorBudgetRemaining, 1e-9)
+}
+
+func TestSLOTrackerBurnRateAlertsFlagFlows(t *testing.T) {
+	tracker := NewSLOTracker([]environment.SLO{
+		{
+			Name:      "flow-availability",
+			Type:      SLOTypeAvailability,
+			Target:    0.99,
+			Flow:      "users-flow",
+			FlagFlows: true,
+		},
+		{
+			Name:      "endpoint-availability",
+			Type:      SLOTypeAvailability,
+			Target:    0.99,
+			Endpoint:  "api.com/users/{id}",
+			Method:    "GET",
+			FlagFlows: true,
+		},
+	})
+	tracker.SetFlows(map[string][]string{
+		"users-flow": {"api.com/users/{id}"},
+		"all-flow":   {"api.com/*"},
+		"other-flow": {"other.com/health"},
+	})
+
+	updateSLOTracker(tracker, 0, availabilityAgg(1000, 0))
+	updateSLOTracker(tracker, time.Hour, availabilityAgg(1980, 10))
+	require.Empty(t, tracker.GetStatuses()[0].Alerts)
+	require.False(t, tracker.IsFlowBurning("users-flow"))
+
+	// 20% errors in the last 5 minutes and 1 hour burn the budget 20 times too fast
+	updateSLOTracker(tracker, 2*time.Hour-5*time.Minute, availabilityAgg(2620, 170))
+	updateSLOTracker(tracker, 2*time.Hour, availabilityAgg(2780, 210))
+
+	statuses := tracker.GetStatuses()
+	require.Len(t, statuses, 2)
+	for _, status := range statuses {
+		require.Equal(t, []string{"page", "ticket"}, status.Alerts)
+		require.InDelta(t, 20, status.BurnRates["1h0m0s"], 1e-9)
+		require.InDelta(t, 20, status.BurnRates["5m0s"], 1e-9)
+	}
+	require.Equal(t, []string{"users-flow"}, statuses[0].Flows)
+	require.Equal(t, []string{"users-flow"}, statuses[1].Flows)
+	require.True(t, tracker.IsFlowBurning("users-flow"))
+	require.False(t, tracker.IsFlowBurning("other-flow"))
+
+	// once the errors stop, the short windows recover first
+	updateSLOTracker(tracker, 2*time.Hour+40*time.Minute, availabilityAgg(8780, 210))
+	require.Empty(t, tracker.GetStatuses()[0].Alerts)
+	require.False(t, tracker.IsFlowBurning("users-flow"))
+}
+
+func TestSLOTrackerResetsSamplesWhenCountsDecrease(t *testing.T) {
+	tracker := NewSLOTracker([]environment.SLO{{
+		Name:     "users-availability",
+		Type:     SLOTypeAvailability,
+		Target:   0.99,
+		Endpoint: "api.com/users/{id}",
+	}})
+
+	updateSLOTracker(tracker, 0, availabilityAgg(0, 0))
+	updateSLOTracker(tracker, time.Hour, availabilityAgg(500, 500))
+	require.Equal(t, 1000.0, tracker.GetStatuses()[0].Total)
+
+	// the discovery state was reset, the previous counts are dropped
+	updateSLOTracker(tracker, 2*time.Hour, availabilityAgg(10, 0))
+	updateSLOTracker(tracker, 3*time.Hour, availabilityAgg(110, 0))
+	status := tracker.GetStatuses()[0]
+	require.Equal(t, 100.0, status.Total)
+	require.Equal(t, 1.0, status.Compliance)
+}
+
+func TestSLOTrackerSkipsInvalidSLOs(t *testing.T) {
+	tracker := NewSLOTracker([]environment.SLO{
+		{Name: "no-target", Type: SLOTypeAvailability, Endpoint: "api.com/users"},
+		{Name: "no-threshold", Type: SLOTypeLatency, Target: 0.9, Endpoint: "api.com/users"},
+		{Name: "no-selector", Type: SLOTypeAvailability, Target: 0.9},
+		{Name: "long-window", Type: SLOTypeAvailability, Target: 0.9, Flow: "f", Window: "31d"},
+		{Name: "bad-window", Type: SLOTypeAvailability, Target: 0.9, Flow: "f", Window: "weekly"},
+		{Name: "unknown-type", Type: "throughput", Target: 0.9, Flow: "f"},
+	})
+	require.False(t, tracker.HasSLOs())
+	require.False(t, tracker.IsFlowBurning("f"))
+	require.Empty(t, tracker.GetStatuses())
+}
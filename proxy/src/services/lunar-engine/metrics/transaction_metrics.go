@@ -19,16 +19,19 @@ type transactionMetricsManager struct {
 	metricsTimer    *time.Ticker
 	labelManager    *LabelManager
 	discoveryParser *discoveryStateParser
+	sloTracker      *SLOTracker
 }
 
 func newTransactionMetricsManager(
 	meter metric.Meter,
 	metricConfig *Config,
 	labelManager *LabelManager,
+	sloTracker *SLOTracker,
 ) (*transactionMetricsManager, error) {
 	mng := &transactionMetricsManager{
 		mu:                       sync.Mutex{},
 		labelManager:             labelManager,
+		sloTracker:               sloTracker,
 		transactionMetricObjects: make(map[string]metric.Float64Histogram),
 	}
 
@@ -37,8 +40,8 @@ func newTransactionMetricsManager(
 		return nil, fmt.Errorf("failed to initialize transaction metrics: %w", err)
 	}
 
-	if len(mng.transactionMetricObjects) == 0 {
-		log.Info().Msg("No transaction metrics to initialize")
+	if len(mng.transactionMetricObjects) == 0 && !sloTracker.HasSLOs() {
+		log.Info().Msg("No transaction metrics or SLOs to initialize")
 		return mng, nil
 	}
 
@@ -93,6 +96,10 @@ func (m *transactionMetricsManager) publishMetricValue(
 	attributes []attribute.KeyValue,
 ) {
 	if metricObj, exists := m.transactionMetricObjects[string(metricName)]; exists {
+		attributes, recorded := m.labelManager.LimitCardinality(string(metricName), attributes)
+		if !recorded {
+			return
+		}
 		ctx := context.Background()
 		metricObj.Record(ctx, float64(value), metric.WithAttributes(attributes...))
 	}
@@ -107,6 +114,8 @@ func (m *transactionMetricsManager) collectMetrics() {
 		log.Error().Err(err).Msg("Failed to read and parse JSON file")
 		return
 	}
+	m.sloTracker.Update(data.NewEndpointData, time.Now())
+
 	for consumer, endpointMap := range data.NewConsumerData {
 		for endpoint, endpointAgg := range endpointMap {
 			for statusCode := range endpointAgg.StatusCodes {
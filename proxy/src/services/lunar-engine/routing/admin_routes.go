@@ -7,15 +7,26 @@ import (
 	"io"
 	"lunar/engine/config"
 	"lunar/engine/doctor"
+	"lunar/engine/formats/openapi"
+	decisionlog "lunar/engine/streams/decision-log"
+	"lunar/engine/streams/migration"
+	faultinjection "lunar/engine/streams/processors/fault-injection"
+	"lunar/engine/utils/environment"
 	"lunar/engine/utils/writers"
+	shared_discovery "lunar/shared-model/discovery"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 const (
 	managedKey string = "LUNAR_MANAGED"
+	// defaultDiscoverWindowRange is the range of a windows query without from
+	defaultDiscoverWindowRange = time.Hour
 )
 
 var (
@@ -196,6 +207,123 @@ func HandleValidatePolicies() func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+// HandleMigratePolicies translates the policies file into flows and quotas,
+// which are written to the migration directory and checked by the flows validation
+func HandleMigratePolicies() func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodPost:
+			policies, err := config.GetPoliciesConfig()
+			if err != nil {
+				handleError(writer,
+					fmt.Sprintf("Failed to read policies: %v", err),
+					http.StatusUnprocessableEntity, err)
+				return
+			}
+
+			outputDir := environment.GetPoliciesMigrationDirectory()
+			result := migration.Convert(policies)
+			if err = result.Write(outputDir); err != nil {
+				handleError(writer,
+					fmt.Sprintf("Failed to write migrated policies: %v", err),
+					http.StatusInternalServerError, err)
+				return
+			}
+			if err = migration.Validate(outputDir); err != nil {
+				handleError(writer,
+					fmt.Sprintf("Migrated policies in %s failed validation", outputDir),
+					http.StatusUnprocessableEntity, err)
+				return
+			}
+
+			writer.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(writer).Encode(map[string]any{
+				"msg":          fmt.Sprintf("✅ Successfully migrated policies to %s", outputDir),
+				"untranslated": result.Report(),
+			}); err != nil {
+				log.Error().Err(err).Stack().Msg("Failed encoding response")
+			}
+		default:
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+type faultInjectionSwitch struct {
+	Flow      string `json:"flow"`
+	Processor string `json:"processor"`
+	Fault     string `json:"fault"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// HandleFaultInjection lists the FaultInjection processors on GET,
+// and turns a processor, one of its faults, or all processors on or off on PUT
+func HandleFaultInjection() func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writer.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(writer).Encode(faultinjection.GetStates()); err != nil {
+				log.Error().Err(err).Stack().Msg("Failed encoding response")
+			}
+		case http.MethodPut:
+			var request faultInjectionSwitch
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				handleError(writer, "Failed to parse fault injection request",
+					http.StatusBadRequest, err)
+				return
+			}
+			err := faultinjection.SetEnabled(request.Flow, request.Processor,
+				request.Fault, request.Enabled)
+			if err != nil {
+				handleError(writer, "Failed to switch fault injection",
+					http.StatusNotFound, err)
+				return
+			}
+			SuccessResponse(writer, fmt.Sprintf("✅ Fault injection switched %s", onOff(request.Enabled)))
+		default:
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleDecisionLog returns the recent decision record of the request_id query param
+func HandleDecisionLog(decisionLog *decisionlog.DecisionLog) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+			return
+		}
+		if decisionLog == nil {
+			handleError(writer, "Decision log is disabled", http.StatusNotFound, nil)
+			return
+		}
+		requestID := req.URL.Query().Get("request_id")
+		if requestID == "" {
+			handleError(writer, "Missing request_id query param", http.StatusBadRequest, nil)
+			return
+		}
+		record, found := decisionLog.Get(requestID)
+		if !found {
+			handleError(writer, fmt.Sprintf("No recent decision record for %s", requestID),
+				http.StatusNotFound, nil)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		if _, err := writer.Write(record); err != nil {
+			log.Error().Err(err).Stack().Msg("Failed writing decision record")
+		}
+	}
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
 func HandleJSONFileRead(location string) func(
 	http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, req *http.Request) {
@@ -215,6 +343,152 @@ func HandleJSONFileRead(location string) func(
 	}
 }
 
+// HandleDiscover serves the discovery state. Given a time range in from and to (RFC3339)
+// and optionally a window resolution (e.g. 1m), it serves the windows of the range instead.
+func HandleDiscover(location string) func(http.ResponseWriter, *http.Request) {
+	readFile := HandleJSONFileRead(location)
+	return func(writer http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if req.Method != http.MethodGet ||
+			(!query.Has("from") && !query.Has("to") && !query.Has("resolution")) {
+			readFile(writer, req)
+			return
+		}
+
+		now := time.Now()
+		to, err := parseQueryTime(query.Get("to"), now)
+		if err != nil {
+			handleError(writer, "Invalid to query param", http.StatusBadRequest, err)
+			return
+		}
+		from, err := parseQueryTime(query.Get("from"), to.Add(-defaultDiscoverWindowRange))
+		if err != nil {
+			handleError(writer, "Invalid from query param", http.StatusBadRequest, err)
+			return
+		}
+		if !from.Before(to) {
+			handleError(writer, "from must be before to", http.StatusBadRequest, nil)
+			return
+		}
+		var resolution time.Duration
+		if raw := query.Get("resolution"); raw != "" {
+			if resolution, err = time.ParseDuration(raw); err != nil {
+				handleError(writer, "Invalid resolution query param", http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		data, err := readJSONFile(location)
+		if err != nil {
+			handleError(writer,
+				fmt.Sprintf("Failed to read %s: %v", location, err),
+				http.StatusUnprocessableEntity, err)
+			return
+		}
+		output := shared_discovery.Output{}
+		if err = json.Unmarshal(data, &output); err != nil {
+			handleError(writer, "Failed to parse discovery state",
+				http.StatusUnprocessableEntity, err)
+			return
+		}
+		windows, err := output.QueryWindows(from, to, now, resolution)
+		if err != nil {
+			handleError(writer, "Failed to query discovery windows", http.StatusNotFound, err)
+			return
+		}
+		windowsData, err := json.Marshal(windows)
+		if err != nil {
+			handleError(writer, "Failed to encode discovery windows",
+				http.StatusInternalServerError, err)
+			return
+		}
+		handleJSONResponse(writer, windowsData)
+	}
+}
+
+func parseQueryTime(raw string, defaultTime time.Time) (time.Time, error) {
+	if raw == "" {
+		return defaultTime, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// HandleOpenAPI serves the OpenAPI documents generated from the discovery state and from
+// the HAR files written by file exporters. Given the host query param, it serves its document only.
+func HandleOpenAPI(discoveryLocation string) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		generator := openapi.NewGenerator(openapi.DefaultMaxSplitThreshold)
+		if data, err := readJSONFile(discoveryLocation); err == nil {
+			output := shared_discovery.Output{}
+			if err = json.Unmarshal(data, &output); err != nil {
+				log.Warn().Err(err).Msg("Failed to parse discovery state for OpenAPI generation")
+			} else {
+				generator.ObserveDiscovery(output)
+			}
+		}
+		for _, location := range harFileLocations() {
+			observeHARFile(generator, location)
+		}
+
+		documents := generator.Documents()
+		var response any = documents
+		if host := req.URL.Query().Get("host"); host != "" {
+			document, found := documents[host]
+			if !found {
+				handleError(writer, fmt.Sprintf("No traffic was discovered to %s", host),
+					http.StatusNotFound, nil)
+				return
+			}
+			response = document
+		}
+		writeJSON(writer, response)
+	}
+}
+
+// harFileLocations returns the files of the file exporters in the gateway config
+func harFileLocations() []string {
+	gatewayConfig, err := environment.LoadGatewayConfig()
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to load gateway config, skipping HAR files")
+		return nil
+	}
+	locations := []string{}
+	for _, exporter := range gatewayConfig.Exporters {
+		if exporter.FileDir == "" || exporter.FileName == "" {
+			continue
+		}
+		location := filepath.Join(exporter.FileDir, exporter.FileName)
+		if !slices.Contains(locations, location) {
+			locations = append(locations, location)
+		}
+	}
+	slices.Sort(locations)
+	return locations
+}
+
+// observeHARFile observes the HAR entries of the file, a partially written file
+// still contributes the entries which were read before the error.
+//
+//nolint:gosec // G304: location is taken from the gateway config, not from HTTP input
+func observeHARFile(generator *openapi.Generator, location string) {
+	file, err := os.Open(location)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to open HAR file %s", location)
+		return
+	}
+	defer file.Close()
+	observed, err := generator.ObserveHAR(file)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to read HAR file %s", location)
+	}
+	log.Debug().Msgf("Observed %d HAR entries from %s", observed, location)
+}
+
 func HandleHandshake() func(
 	http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, req *http.Request) {
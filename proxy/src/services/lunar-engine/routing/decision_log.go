@@ -0,0 +1,37 @@
+package routing
+
+import (
+	decisionlog "lunar/engine/streams/decision-log"
+	"lunar/engine/utils/environment"
+	"lunar/engine/utils/writers"
+	context_manager "lunar/toolkit-core/context-manager"
+
+	"github.com/rs/zerolog/log"
+)
+
+// loadDecisionLog creates the decision log of the gateway config, nil when it is disabled
+func loadDecisionLog(writer writers.Writer) *decisionlog.DecisionLog {
+	gatewayConfig, err := environment.LoadGatewayConfig()
+	if err != nil {
+		log.Debug().Err(err).Msg("Gateway config not loaded, decision log is disabled")
+		return nil
+	}
+	decisionLogConfig := gatewayConfig.DecisionLog
+	if decisionLogConfig == nil || !decisionLogConfig.Enabled {
+		return nil
+	}
+
+	sampleRatio := 1.0
+	if decisionLogConfig.SampleRatio != nil {
+		sampleRatio = *decisionLogConfig.SampleRatio
+	}
+	log.Info().Msgf("Decision log is enabled, exporter: %q, sample ratio: %v",
+		decisionLogConfig.ExporterID, sampleRatio)
+
+	return decisionlog.New(decisionlog.Config{
+		ExporterID:         decisionLogConfig.ExporterID,
+		SampleRatio:        sampleRatio,
+		RedactFields:       decisionLogConfig.RedactFields,
+		RecentTransactions: decisionLogConfig.RecentTransactions,
+	}, writer, context_manager.Get().GetClock())
+}
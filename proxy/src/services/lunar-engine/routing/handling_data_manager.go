@@ -13,8 +13,10 @@ import (
 	"lunar/engine/streams"
 	stream_config "lunar/engine/streams/config"
 	configstate "lunar/engine/streams/config-state"
+	decisionlog "lunar/engine/streams/decision-log"
 	internal_types "lunar/engine/streams/internal-types"
 	lunar_context "lunar/engine/streams/lunar-context"
+	faultinjection "lunar/engine/streams/processors/fault-injection"
 	stream_types "lunar/engine/streams/types"
 	"lunar/engine/streams/validation"
 	"lunar/engine/utils"
@@ -48,6 +50,7 @@ type PoliciesData struct {
 type StreamsData struct {
 	stream        *streams.Stream
 	flowValidator *validation.Validator
+	decisionLog   *decisionlog.DecisionLog
 }
 
 type HandlingDataManager struct {
@@ -94,6 +97,7 @@ func (rd *HandlingDataManager) Setup(telemetryWriter *logging.LunarLogger) error
 		rd.isStreamsEnabled = true
 
 		rd.doctor.WithStreams(rd.GetLoadedStreamsConfig)
+		rd.decisionLog = loadDecisionLog(rd.writer)
 		err := rd.initializeStreams()
 		if err != nil {
 			return err
@@ -104,6 +108,8 @@ func (rd *HandlingDataManager) Setup(telemetryWriter *logging.LunarLogger) error
 			return fmt.Errorf("failed to initialize metric manager: %w", err)
 		}
 		rd.metricManager.UpdateMetricsProviderForFlow(rd.stream)
+		rd.trackSLOs()
+		rd.doctor.WithSLOs(rd.metricManager.GetSLOStatuses)
 		return nil
 	}
 	rd.doctor.WithPolicies(rd.GetTxnPoliciesAccessor)
@@ -176,6 +182,18 @@ func (rd *HandlingDataManager) SetHandleRoutes(mux *http.ServeMux) {
 			"/configuration",
 			rd.handleConfiguration(),
 		)
+		mux.HandleFunc(
+			"/fault_injection",
+			HandleFaultInjection(),
+		)
+		mux.HandleFunc(
+			"/decision_log",
+			HandleDecisionLog(rd.decisionLog),
+		)
+		mux.HandleFunc(
+			"/path_params_suggestions",
+			rd.handlePathParamsSuggestions(),
+		)
 	} else {
 		mux.HandleFunc(
 			"/apply_policies",
@@ -185,6 +203,10 @@ func (rd *HandlingDataManager) SetHandleRoutes(mux *http.ServeMux) {
 			"/validate_policies",
 			HandleValidatePolicies(),
 		)
+		mux.HandleFunc(
+			"/migrate_policies",
+			HandleMigratePolicies(),
+		)
 		mux.HandleFunc(
 			"/revert_to_diagnosis_free",
 			HandleRevertToDiagnosisFree(rd.configBuildResult.Accessor, rd.writer),
@@ -200,7 +222,11 @@ func (rd *HandlingDataManager) SetHandleRoutes(mux *http.ServeMux) {
 	)
 	mux.HandleFunc(
 		"/discover",
-		HandleJSONFileRead(environment.GetDiscoveryStateLocation()),
+		HandleDiscover(environment.GetDiscoveryStateLocation()),
+	)
+	mux.HandleFunc(
+		"/openapi",
+		HandleOpenAPI(environment.GetDiscoveryStateLocation()),
 	)
 
 	mux.HandleFunc(
@@ -215,7 +241,10 @@ func (rd *HandlingDataManager) SetHandleRoutes(mux *http.ServeMux) {
 }
 
 func (rd *HandlingDataManager) initializeOtel() {
-	rd.shutdown = otel.InitProvider(lunarEngine)
+	rd.shutdown = otel.InitProvider(lunarEngine, otel.ProviderConfig{
+		Traces:  loadTraceConfig(),
+		Metrics: environment.LoadMetricsExporterConfig(),
+	})
 	go otel.ServeMetrics()
 	rd.areMetricsInitialized = true
 }
@@ -241,7 +270,9 @@ func (rd *HandlingDataManager) initializeStreams() (err error) {
 		return fmt.Errorf("failed to create stream: %w", err)
 	}
 	rd.stream = stream
-	rd.stream.WithHub(rd.lunarHub)
+	rd.stream.WithHub(rd.lunarHub).WithDecisionLog(rd.decisionLog)
+	// the processors of the reloaded flows register their fault injection switches again
+	faultinjection.ResetSwitches()
 	if err = rd.stream.Initialize(); err != nil {
 		return fmt.Errorf("failed to initialize streams: %w", err)
 	}
@@ -655,5 +686,12 @@ func (rd *HandlingDataManager) reloadFlows() error {
 	}
 
 	rd.metricManager.UpdateMetricsProviderForFlow(rd.stream)
+	rd.trackSLOs()
 	return nil
 }
+
+// trackSLOs matches the SLOs with the loaded flows, and flags the flows of burning SLOs
+func (rd *HandlingDataManager) trackSLOs() {
+	rd.metricManager.SetSLOFlows(rd.stream.GetFlowURLs())
+	rd.stream.WithSLOStatus(rd.metricManager.IsFlowBurningSLO)
+}
@@ -2,18 +2,23 @@ package routing
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"lunar/engine/actions"
 	"lunar/engine/config"
 	lunar_messages "lunar/engine/messages"
+	lunar_metrics "lunar/engine/metrics"
 	"lunar/engine/runner"
 	stream_config "lunar/engine/streams/config"
 	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
 	stream_types "lunar/engine/streams/types"
 	"lunar/engine/utils"
+	"lunar/engine/utils/saturation"
 	context_manager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/otel"
 	"reflect"
+	"time"
 
 	"github.com/negasus/haproxy-spoe-go/action"
 	"github.com/negasus/haproxy-spoe-go/message"
@@ -40,9 +45,9 @@ func Handler(data *HandlingDataManager) MessageHandler {
 	handlerInner := func(req *request.Request) {
 		var actions action.Actions
 		if requestMessage, err := getMessageByType(requestType, req.Messages); err == nil {
-			_, span := otel.Tracer(ctxMng.GetContext(), "routing#lunarOnRequestMessage")
+			ctx, span := otel.Tracer(ctxMng.GetContext(), "routing#lunarOnRequestMessage")
 			defer span.End()
-			actions, err = processRequest(requestMessage, data)
+			actions, err = processRequest(ctx, requestMessage, data)
 			if ctxMng.GetContext().Err() != nil {
 				actions = getShutdownActions()
 			} else if err != nil {
@@ -52,9 +57,9 @@ func Handler(data *HandlingDataManager) MessageHandler {
 		}
 
 		if responseMessage, err := getMessageByType(responseType, req.Messages); err == nil {
-			_, span := otel.Tracer(ctxMng.GetContext(), "routing#lunarOnResponseMessage")
+			ctx, span := otel.Tracer(ctxMng.GetContext(), "routing#lunarOnResponseMessage")
 			defer span.End()
-			actions, err = processResponse(responseMessage, data)
+			actions, err = processResponse(ctx, responseMessage, data)
 			if err != nil {
 				log.Error().Err(err).Msg("Error processing response")
 				return
@@ -105,6 +110,29 @@ func getSPOEReqActions(
 	return prioritizedAction.ReqToSpoeActions()
 }
 
+// getSPOEConsumerTagActions passes the consumer tag to HAProxy when the flows replaced
+// the one sent by the caller (e.g. with a verified identity) or removed it,
+// so the transaction is accounted to the consumer the flows settled on
+func getSPOEConsumerTagActions(
+	incomingTag string,
+	incomingFound bool,
+	request public_types.TransactionI,
+) action.Actions {
+	spoeActions := action.Actions{}
+	if request == nil {
+		return spoeActions
+	}
+
+	consumerTag, found := request.GetHeader(lunar_metrics.HeaderConsumerTag)
+	switch {
+	case found && consumerTag != "" && (!incomingFound || consumerTag != incomingTag):
+		spoeActions.SetVar(action.ScopeTransaction, actions.ConsumerTagActionName, consumerTag)
+	case !found && incomingFound:
+		spoeActions.SetVar(action.ScopeTransaction, actions.ClearConsumerTagActionName, true)
+	}
+	return spoeActions
+}
+
 func getShutdownActions() action.Actions {
 	generateResp := action.Actions{}
 	generateResp.SetVar(action.ScopeTransaction, actions.ReturnEarlyResponseActionName, true)
@@ -133,11 +161,16 @@ func getSPOERespActions(
 	return prioritizedAction.RespToSpoeActions()
 }
 
-func processRequest(msg *message.Message, data *HandlingDataManager) (action.Actions, error) {
+func processRequest(
+	ctx context.Context,
+	msg *message.Message,
+	data *HandlingDataManager,
+) (action.Actions, error) {
 	var err error
 	var actions action.Actions
 	args := readRequestArgs(msg)
 	log.Trace().Msgf("On request args: %+v\n", args)
+	defer observeProcessingLatency(args.ID, args.Time)
 	if data.IsStreamsEnabled() {
 		apiStream := stream_types.NewRequestAPIStream(args, sharedState)
 		if args.IsFullRequest() {
@@ -146,11 +179,15 @@ func processRequest(msg *message.Message, data *HandlingDataManager) (action.Act
 
 		data.GetMetricManager().UpdateMetricsProviderForAPICall(apiStream)
 
+		// the flows update the request headers, so keep the tag sent by the caller
+		incomingTag, incomingTagFound := args.Headers[lunar_metrics.HeaderConsumerTag]
 		flowActions := &stream_config.StreamActions{
 			Request: &stream_config.RequestStream{},
 		}
-		if err = runner.RunFlow(data.stream, apiStream, flowActions); err == nil {
+		if err = runner.RunFlow(ctx, data.stream, apiStream, flowActions); err == nil {
 			actions = getSPOEReqActions(args, flowActions.Request.Actions)
+			actions = append(actions, getSPOEConsumerTagActions(
+				incomingTag, incomingTagFound, apiStream.GetRequest())...)
 		}
 		data.GetMetricManager().UpdateMetricsProviderForFlow(data.stream)
 	} else {
@@ -171,11 +208,16 @@ func processRequest(msg *message.Message, data *HandlingDataManager) (action.Act
 	return actions, err
 }
 
-func processResponse(msg *message.Message, data *HandlingDataManager) (action.Actions, error) {
+func processResponse(
+	ctx context.Context,
+	msg *message.Message,
+	data *HandlingDataManager,
+) (action.Actions, error) {
 	var actions action.Actions
 	var err error
 	args := readResponseArgs(msg)
 	log.Trace().Msgf("On response args: %+v\n", args)
+	defer observeProcessingLatency(args.ID, args.Time)
 
 	if data.IsStreamsEnabled() {
 		apiStream := stream_types.NewResponseAPIStream(args, sharedState)
@@ -188,7 +230,7 @@ func processResponse(msg *message.Message, data *HandlingDataManager) (action.Ac
 		flowActions := &stream_config.StreamActions{
 			Response: &stream_config.ResponseStream{},
 		}
-		if err = runner.RunFlow(data.stream, apiStream, flowActions); err == nil {
+		if err = runner.RunFlow(ctx, data.stream, apiStream, flowActions); err == nil {
 			actions = getSPOERespActions(args, flowActions.Response.Actions)
 		}
 		data.GetMetricManager().UpdateMetricsProviderForFlow(data.stream)
@@ -228,6 +270,13 @@ func extractArg[T any](key string, arg *kv.KV) T {
 	return res
 }
 
+// observeProcessingLatency feeds the saturation signal with the time the engine
+// handled the message since it was read, measured by the context clock
+func observeProcessingLatency(transactionID string, start time.Time) {
+	saturation.ObserveProcessingLatency(
+		transactionID, context_manager.Get().GetClock().Since(start))
+}
+
 func readRequestArgs(msg *message.Message) lunar_messages.OnRequest {
 	onRequest := lunar_messages.OnRequest{LunarName: msg.Name} //nolint:exhaustruct
 	onRequest.ID = extractArg[string]("id", msg.KV)
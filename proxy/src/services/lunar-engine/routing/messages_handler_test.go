@@ -6,10 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
 	"lunar/engine/metrics"
 	"lunar/engine/streams"
 	stream_config "lunar/engine/streams/config"
+	stream_types "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
+	"lunar/engine/utils/saturation"
 	context_manager "lunar/toolkit-core/context-manager"
 	"net"
 	"net/http"
@@ -20,7 +24,9 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
+	"github.com/negasus/haproxy-spoe-go/action"
 	"github.com/negasus/haproxy-spoe-go/message"
 	"github.com/negasus/haproxy-spoe-go/payload/kv"
 	"github.com/negasus/haproxy-spoe-go/request"
@@ -90,6 +96,44 @@ func TestCustomResponseReturnWhenContextIsClose(t *testing.T) {
 	require.Equal(t, getShutdownActions(), req.Actions)
 }
 
+func TestGetSPOEConsumerTagActions(t *testing.T) {
+	newRequest := func(headers map[string]string) *stream_types.OnRequest {
+		return stream_types.NewRequest(lunar_messages.OnRequest{
+			Method:  "GET",
+			URL:     "api.example.com/orders",
+			Headers: headers,
+		}).(*stream_types.OnRequest)
+	}
+
+	// verified identity replaces the tag sent by the caller
+	spoeActions := getSPOEConsumerTagActions("spoofed", true, newRequest(map[string]string{
+		metrics.HeaderConsumerTag: "acme",
+	}))
+	require.Equal(t, action.Actions{
+		action.NewSetVar(action.ScopeTransaction, actions.ConsumerTagActionName, "acme"),
+	}, spoeActions)
+
+	// verified identity without a tag sent by the caller
+	spoeActions = getSPOEConsumerTagActions("", false, newRequest(map[string]string{
+		metrics.HeaderConsumerTag: "acme",
+	}))
+	require.Equal(t, action.Actions{
+		action.NewSetVar(action.ScopeTransaction, actions.ConsumerTagActionName, "acme"),
+	}, spoeActions)
+
+	// rejected caller, the tag it sent is removed
+	spoeActions = getSPOEConsumerTagActions("spoofed", true, newRequest(map[string]string{}))
+	require.Equal(t, action.Actions{
+		action.NewSetVar(action.ScopeTransaction, actions.ClearConsumerTagActionName, true),
+	}, spoeActions)
+
+	// tag left as sent by the caller
+	spoeActions = getSPOEConsumerTagActions("acme", true, newRequest(map[string]string{
+		metrics.HeaderConsumerTag: "acme",
+	}))
+	require.Empty(t, spoeActions)
+}
+
 func TestConfigurationOps(t *testing.T) {
 	handlingDataManager := newTestHandlingDataManager(t)
 
@@ -372,3 +416,24 @@ func startTestHaproxyEndpoints() (stop func()) {
 		managedListener.Close()
 	}
 }
+
+func TestObserveProcessingLatencyExcludesProcessorWaits(t *testing.T) {
+	saturation.Reset()
+	t.Cleanup(saturation.Reset)
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+
+	start := mockClock.Now()
+	// e.g. a retry cooldown of the transaction
+	mockClock.AdvanceTime(time.Second)
+	saturation.AddWait("txn-1", time.Second)
+	mockClock.AdvanceTime(20 * time.Millisecond)
+	observeProcessingLatency("txn-1", start)
+	require.Equal(t, 20*time.Millisecond, saturation.ProcessingLatency())
+
+	// the waits of a transaction are not carried to the next message
+	start = mockClock.Now()
+	mockClock.AdvanceTime(20 * time.Millisecond)
+	observeProcessingLatency("txn-1", start)
+	require.Equal(t, 20*time.Millisecond, saturation.ProcessingLatency())
+}
@@ -0,0 +1,101 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	pathparamsresource "lunar/engine/streams/resources/path_params"
+	"lunar/engine/utils/environment"
+	shared_discovery "lunar/shared-model/discovery"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+type acceptPathParamsRequest struct {
+	// URLs are the templates to accept, all the current suggestions when empty
+	URLs []string `json:"urls"`
+}
+
+type acceptPathParamsResponse struct {
+	Accepted []string `json:"accepted"`
+}
+
+// handlePathParamsSuggestions serves the path param templates suggested from the discovery state
+// on GET, and accepts them into the path params resources on POST, reloading the flows after.
+func (rd *HandlingDataManager) handlePathParamsSuggestions() func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			suggestions, err := suggestPathParams()
+			if err != nil {
+				handleError(writer, "Failed to suggest path params",
+					http.StatusUnprocessableEntity, err)
+				return
+			}
+			writeJSON(writer, suggestions)
+		case http.MethodPost:
+			if !rd.handlingLock.TryLock() {
+				handleError(writer, "Failed to accept path params", http.StatusIMUsed,
+					fmt.Errorf("already handling another configuration request"))
+				return
+			}
+			defer rd.handlingLock.Unlock()
+
+			request := acceptPathParamsRequest{}
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+				handleError(writer, "Failed to decode incoming data", http.StatusBadRequest, err)
+				return
+			}
+			if len(request.URLs) == 0 {
+				suggestions, err := suggestPathParams()
+				if err != nil {
+					handleError(writer, "Failed to suggest path params",
+						http.StatusUnprocessableEntity, err)
+					return
+				}
+				for _, suggestion := range suggestions {
+					request.URLs = append(request.URLs, suggestion.URL)
+				}
+			}
+
+			accepted, err := pathparamsresource.AcceptPathParams(request.URLs)
+			if err != nil {
+				handleError(writer, "Failed to accept path params", http.StatusBadRequest, err)
+				return
+			}
+			if len(accepted) > 0 {
+				if err = rd.reloadFlows(); err != nil {
+					handleError(writer, fmt.Sprintf("%v", err), http.StatusBadRequest, err)
+					return
+				}
+			}
+			log.Info().Msgf("Accepted path params: %v", accepted)
+			writeJSON(writer, acceptPathParamsResponse{Accepted: accepted})
+		default:
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func suggestPathParams() ([]pathparamsresource.PathParamSuggestion, error) {
+	data, err := readJSONFile(environment.GetDiscoveryStateLocation())
+	if err != nil {
+		return nil, err
+	}
+	output := shared_discovery.Output{}
+	if err = json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse discovery state: %w", err)
+	}
+	declared := pathparamsresource.NewPathParams().GetPathParams()
+	return pathparamsresource.SuggestPathParams(output, declared), nil
+}
+
+func writeJSON(writer http.ResponseWriter, data any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(writer).Encode(data); err != nil {
+		log.Error().Err(err).Stack().Msg("Failed encoding response")
+	}
+}
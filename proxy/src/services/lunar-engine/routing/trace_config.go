@@ -0,0 +1,56 @@
+package routing
+
+import (
+	stream_types "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/otel"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// loadTraceConfig reads the trace exporter of the gateway config for the spans of the engine
+func loadTraceConfig() *otel.TraceConfig {
+	gatewayConfig, err := environment.LoadGatewayConfig()
+	if err != nil {
+		log.Debug().Err(err).Msg("Gateway config not loaded, using the default trace config")
+		return nil
+	}
+	return buildTraceConfig(gatewayConfig.TraceExporter)
+}
+
+func buildTraceConfig(exporter environment.TraceExporter) *otel.TraceConfig {
+	traceConfig := &otel.TraceConfig{
+		Protocol: exporter.Protocol,
+		Headers:  exporter.Headers,
+		TLS:      exporter.TLS.ToTLSConfig(),
+	}
+	if exporter.ExportEngineTraces {
+		traceConfig.Endpoint = exporter.TracesEndpoint
+	}
+
+	sampling := exporter.Sampling
+	if sampling == nil {
+		return traceConfig
+	}
+	traceConfig.SampleRatio = sampling.Ratio
+	traceConfig.FlowSampleRatios = sampling.Flows
+
+	if sampling.TailSampling != nil {
+		tailSampling := sampling.TailSampling
+		traceConfig.TailSampling = &otel.TailSamplingConfig{
+			Enabled:          tailSampling.Enabled,
+			DecisionWait:     time.Duration(tailSampling.DecisionWaitSec) * time.Second,
+			MaxTraces:        tailSampling.MaxTraces,
+			LatencyThreshold: time.Duration(tailSampling.LatencyThresholdMs) * time.Millisecond,
+			// retried, rate limited and throttled transactions are kept along with the errors
+			KeepAttributes: map[attribute.Key][]string{
+				stream_types.TraceAttributeRetryAttempt:   nil,
+				stream_types.TraceAttributeRateLimited:    {"true"},
+				stream_types.TraceAttributeResponseStatus: {"429"},
+			},
+		}
+	}
+	return traceConfig
+}
@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"context"
 	"lunar/engine/streams"
 	streamconfig "lunar/engine/streams/config"
 
@@ -10,11 +11,12 @@ import (
 )
 
 func RunFlow(
+	ctx context.Context,
 	stream *streams.Stream,
 	apiStream publictypes.APIStreamI,
 	actions *streamconfig.StreamActions,
 ) error {
-	err := stream.ExecuteFlow(apiStream, actions)
+	err := stream.ExecuteFlow(ctx, apiStream, actions)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to execute %v flow %v",
 			apiStream.GetType(),
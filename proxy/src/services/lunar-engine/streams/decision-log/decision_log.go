@@ -0,0 +1,256 @@
+package decisionlog
+
+import (
+	"encoding/json"
+	"io"
+	streamconfig "lunar/engine/streams/config"
+	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/utils"
+	"lunar/toolkit-core/clock"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRecentTransactions = 1000
+	maxPendingTransactions    = 10000
+	// pendingTransactionTTL bounds the wait for the response of a transaction
+	pendingTransactionTTL = 5 * time.Minute
+	sweepInterval         = time.Second
+
+	redactedValue = "[REDACTED]"
+)
+
+type Config struct {
+	// ExporterID prefixes the exported records, which are only kept in memory when not set
+	ExporterID string
+	// SampleRatio is the ratio of the exported records, the recent records are all kept
+	SampleRatio float64
+	// RedactFields are the record fields and step attributes which values are redacted
+	RedactFields       []string
+	RecentTransactions int
+}
+
+// DecisionLog writes one record per transaction, through the exporter,
+// and keeps the recent records to be queried by request ID.
+// A nil DecisionLog is disabled.
+type DecisionLog struct {
+	config       Config
+	writer       io.Writer
+	clock        clock.Clock
+	random       func() float64
+	redactFields map[string]struct{}
+
+	mu          sync.Mutex
+	pending     map[string]*Transaction
+	lastSweep   time.Time
+	recent      []recentRecord
+	recentIndex map[string]int
+	nextRecent  int
+}
+
+type recentRecord struct {
+	requestID string
+	data      []byte
+}
+
+func New(config Config, writer io.Writer, clock clock.Clock) *DecisionLog {
+	if config.RecentTransactions <= 0 {
+		config.RecentTransactions = defaultRecentTransactions
+	}
+	redactFields := make(map[string]struct{}, len(config.RedactFields))
+	for _, field := range config.RedactFields {
+		redactFields[field] = struct{}{}
+	}
+	return &DecisionLog{
+		config:       config,
+		writer:       writer,
+		clock:        clock,
+		random:       rand.Float64,
+		redactFields: redactFields,
+		pending:      make(map[string]*Transaction),
+		recent:       make([]recentRecord, config.RecentTransactions),
+		recentIndex:  make(map[string]int, config.RecentTransactions),
+	}
+}
+
+// Begin returns the transaction of the API stream, started by its request when already handled
+func (l *DecisionLog) Begin(apiStream publictypes.APIStreamI) *Transaction {
+	if l == nil {
+		return nil
+	}
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	expired := l.sweepPending(now)
+	transaction, found := l.pending[apiStream.GetID()]
+	if !found && len(l.pending) < maxPendingTransactions {
+		transaction = &Transaction{
+			record: &Record{
+				RequestID: apiStream.GetID(),
+				Timestamp: now,
+				Flows:     []string{},
+				Steps:     []Step{},
+			},
+			sampled:   l.random() < l.config.SampleRatio,
+			createdAt: now,
+		}
+		if request := apiStream.GetRequest(); !utils.IsInterfaceNil(request) {
+			transaction.record.Method = request.GetMethod()
+			transaction.record.URL = request.GetURL()
+		}
+		l.pending[apiStream.GetID()] = transaction
+	}
+	l.mu.Unlock()
+
+	for _, expiredTransaction := range expired {
+		l.complete(expiredTransaction)
+	}
+	return transaction
+}
+
+// Finish records the actions of the executed flows. The transaction is complete
+// after its response, or after its request when it was answered early.
+func (l *DecisionLog) Finish(
+	transaction *Transaction,
+	apiStream publictypes.APIStreamI,
+	flowActions *streamconfig.StreamActions,
+) {
+	if l == nil || transaction == nil {
+		return
+	}
+
+	if apiStream.GetActionsType().IsRequestType() {
+		var isEarlyReturn bool
+		if flowActions != nil && flowActions.Request != nil {
+			isEarlyReturn = transaction.setRequestActions(flowActions.Request.Actions)
+		}
+		if !isEarlyReturn {
+			return
+		}
+	} else {
+		if flowActions != nil && flowActions.Response != nil {
+			transaction.setResponseActions(flowActions.Response.Actions)
+		}
+		if response := apiStream.GetResponse(); !utils.IsInterfaceNil(response) &&
+			transaction.record.StatusCode == 0 {
+			transaction.record.StatusCode = response.GetStatus()
+		}
+	}
+	l.Abort(transaction.record.RequestID)
+}
+
+// Abort completes the transaction when it is still pending
+func (l *DecisionLog) Abort(requestID string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	transaction, found := l.pending[requestID]
+	delete(l.pending, requestID)
+	l.mu.Unlock()
+
+	if found {
+		l.complete(transaction)
+	}
+}
+
+// Get returns the recent record of the request
+func (l *DecisionLog) Get(requestID string) ([]byte, bool) {
+	if l == nil {
+		return nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, found := l.recentIndex[requestID]
+	if !found {
+		return nil, false
+	}
+	return l.recent[index].data, true
+}
+
+func (l *DecisionLog) complete(transaction *Transaction) {
+	data, err := l.marshal(transaction.record)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to marshal decision record of %s", transaction.record.RequestID)
+		return
+	}
+
+	l.mu.Lock()
+	if evicted := l.recent[l.nextRecent]; evicted.requestID != "" {
+		delete(l.recentIndex, evicted.requestID)
+	}
+	l.recent[l.nextRecent] = recentRecord{requestID: transaction.record.RequestID, data: data}
+	l.recentIndex[transaction.record.RequestID] = l.nextRecent
+	l.nextRecent = (l.nextRecent + 1) % len(l.recent)
+	l.mu.Unlock()
+
+	if transaction.sampled {
+		l.export(data)
+	}
+}
+
+func (l *DecisionLog) export(data []byte) {
+	if l.config.ExporterID == "" || utils.IsInterfaceNil(l.writer) {
+		return
+	}
+	message := make([]byte, 0, len(l.config.ExporterID)+1+len(data))
+	message = append(message, l.config.ExporterID...)
+	message = append(message, ' ')
+	message = append(message, data...)
+	if _, err := l.writer.Write(message); err != nil {
+		log.Debug().Err(err).Msg("Failed to export decision record")
+	}
+}
+
+func (l *DecisionLog) marshal(record *Record) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil || len(l.redactFields) == 0 {
+		return data, err
+	}
+
+	var fields map[string]any
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	l.redact(fields)
+	return json.Marshal(fields)
+}
+
+func (l *DecisionLog) redact(value any) {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, nested := range typed {
+			if _, found := l.redactFields[key]; found {
+				typed[key] = redactedValue
+				continue
+			}
+			l.redact(nested)
+		}
+	case []any:
+		for _, nested := range typed {
+			l.redact(nested)
+		}
+	}
+}
+
+// sweepPending removes the transactions pending for too long, at most once per sweep interval
+func (l *DecisionLog) sweepPending(now time.Time) []*Transaction {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return nil
+	}
+	l.lastSweep = now
+
+	var expired []*Transaction
+	for requestID, transaction := range l.pending {
+		if now.Sub(transaction.createdAt) >= pendingTransactionTTL {
+			transaction.record.Incomplete = true
+			expired = append(expired, transaction)
+			delete(l.pending, requestID)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,200 @@
+package decisionlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	streamconfig "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var sharedState = lunar_context.NewMemoryState[[]byte]()
+
+func newTestDecisionLog(config Config) (*DecisionLog, *bytes.Buffer, *clock.MockClock) {
+	writer := &bytes.Buffer{}
+	mockClock := clock.NewMockClock()
+	return New(config, writer, mockClock), writer, mockClock
+}
+
+func requestStream(requestID string) publictypes.APIStreamI {
+	return streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:     requestID,
+		Method: "POST",
+		Scheme: "https",
+		URL:    "api.example.com/v1/chat",
+	}, sharedState)
+}
+
+func responseStream(requestID string, status int) publictypes.APIStreamI {
+	return streamtypes.NewResponseAPIStream(lunar_messages.OnResponse{
+		ID:     requestID,
+		Method: "POST",
+		URL:    "api.example.com/v1/chat",
+		Status: status,
+	}, sharedState)
+}
+
+func getRecord(t *testing.T, decisionLog *DecisionLog, requestID string) Record {
+	data, found := decisionLog.Get(requestID)
+	require.True(t, found, "record of %s not found", requestID)
+	var record Record
+	require.NoError(t, json.Unmarshal(data, &record))
+	return record
+}
+
+func TestDecisionLogRecordsRequestAndResponse(t *testing.T) {
+	decisionLog, writer, _ := newTestDecisionLog(Config{ExporterID: "decisions", SampleRatio: 1})
+
+	request := requestStream("req-1")
+	transaction := decisionLog.Begin(request)
+	transaction.MatchFlows("limit-flow")
+	transaction.AddStep("limit-flow", request, "Limiter", streamtypes.ProcessorIO{
+		Name: "below_limit",
+		TraceAttributes: []attribute.KeyValue{
+			attribute.String(streamtypes.TraceAttributeQuotaID, "chat-quota"),
+		},
+	}, nil)
+	decisionLog.Finish(transaction, request, &streamconfig.StreamActions{
+		Request: &streamconfig.RequestStream{},
+	})
+
+	_, found := decisionLog.Get("req-1")
+	require.False(t, found, "transaction should be pending until its response")
+
+	response := responseStream("req-1", 503)
+	transaction = decisionLog.Begin(response)
+	transaction.MatchFlows("limit-flow")
+	transaction.AddStep("limit-flow", response, "Retry", streamtypes.ProcessorIO{
+		Name: "retry",
+		TraceAttributes: []attribute.KeyValue{
+			attribute.Int(streamtypes.TraceAttributeRetryAttempt, 1),
+		},
+	}, nil)
+	decisionLog.Finish(transaction, response, &streamconfig.StreamActions{
+		Response: &streamconfig.ResponseStream{
+			Actions: []actions.RespLunarAction{&actions.RetryRequestAction{}},
+		},
+	})
+
+	record := getRecord(t, decisionLog, "req-1")
+	require.Equal(t, []string{"limit-flow"}, record.Flows)
+	require.Len(t, record.Steps, 2)
+	require.Equal(t, "below_limit", record.Steps[0].Condition)
+	require.Equal(t, "chat-quota", record.Steps[0].Attributes[streamtypes.TraceAttributeQuotaID])
+	require.Equal(t, directionRequest, record.Steps[0].Direction)
+	require.Equal(t, directionResponse, record.Steps[1].Direction)
+	require.Equal(t, "NoOpAction", record.RequestAction)
+	require.Equal(t, "RetryRequestAction", record.Action)
+	require.Equal(t, 503, record.StatusCode)
+	require.Equal(t, "POST", record.Method)
+
+	exported := writer.String()
+	require.True(t, strings.HasPrefix(exported, "decisions {"), exported)
+	require.Contains(t, exported, `"request_id":"req-1"`)
+}
+
+func TestDecisionLogCompletesEarlyResponses(t *testing.T) {
+	decisionLog, _, _ := newTestDecisionLog(Config{SampleRatio: 1})
+
+	request := requestStream("req-429")
+	transaction := decisionLog.Begin(request)
+	transaction.AddStep("limit-flow", request, "Limiter", streamtypes.ProcessorIO{
+		Name: "above_limit",
+	}, nil)
+	decisionLog.Finish(transaction, request, &streamconfig.StreamActions{
+		Request: &streamconfig.RequestStream{
+			Actions: []actions.ReqLunarAction{&actions.EarlyResponseAction{Status: 429}},
+		},
+	})
+
+	record := getRecord(t, decisionLog, "req-429")
+	require.Equal(t, "EarlyResponseAction", record.Action)
+	require.Equal(t, 429, record.StatusCode)
+	require.Equal(t, "above_limit", record.Steps[0].Condition)
+}
+
+func TestDecisionLogSamplesExports(t *testing.T) {
+	decisionLog, writer, _ := newTestDecisionLog(Config{ExporterID: "decisions", SampleRatio: 0})
+
+	decisionLog.Begin(requestStream("req-1"))
+	decisionLog.Abort("req-1")
+
+	require.Empty(t, writer.String(), "unsampled records should not be exported")
+	_, found := decisionLog.Get("req-1")
+	require.True(t, found, "unsampled records should still be queryable")
+}
+
+func TestDecisionLogRedactsFields(t *testing.T) {
+	decisionLog, writer, _ := newTestDecisionLog(Config{
+		ExporterID:   "decisions",
+		SampleRatio:  1,
+		RedactFields: []string{"url", streamtypes.TraceAttributeQuotaID},
+	})
+
+	request := requestStream("req-1")
+	transaction := decisionLog.Begin(request)
+	transaction.AddStep("limit-flow", request, "Limiter", streamtypes.ProcessorIO{
+		TraceAttributes: []attribute.KeyValue{
+			attribute.String(streamtypes.TraceAttributeQuotaID, "tenant-a"),
+		},
+	}, nil)
+	decisionLog.Abort("req-1")
+
+	record := getRecord(t, decisionLog, "req-1")
+	require.Equal(t, redactedValue, record.URL)
+	require.Equal(t, redactedValue, record.Steps[0].Attributes[streamtypes.TraceAttributeQuotaID])
+	require.NotContains(t, writer.String(), "tenant-a")
+	require.NotContains(t, writer.String(), "api.example.com")
+}
+
+func TestDecisionLogKeepsRecentTransactions(t *testing.T) {
+	decisionLog, _, _ := newTestDecisionLog(Config{RecentTransactions: 2})
+
+	for index := range 3 {
+		requestID := fmt.Sprintf("req-%d", index)
+		decisionLog.Begin(requestStream(requestID))
+		decisionLog.Abort(requestID)
+	}
+
+	_, found := decisionLog.Get("req-0")
+	require.False(t, found, "oldest record should be evicted")
+	getRecord(t, decisionLog, "req-1")
+	getRecord(t, decisionLog, "req-2")
+}
+
+func TestDecisionLogCompletesExpiredTransactions(t *testing.T) {
+	decisionLog, _, mockClock := newTestDecisionLog(Config{})
+
+	decisionLog.Begin(requestStream("req-lost"))
+	mockClock.AdvanceTime(pendingTransactionTTL + time.Second)
+	decisionLog.Begin(requestStream("req-next"))
+
+	record := getRecord(t, decisionLog, "req-lost")
+	require.True(t, record.Incomplete)
+}
+
+func TestDisabledDecisionLog(t *testing.T) {
+	var decisionLog *DecisionLog
+
+	request := requestStream("req-1")
+	transaction := decisionLog.Begin(request)
+	require.Nil(t, transaction)
+	transaction.MatchFlows("flow")
+	transaction.AddStep("flow", request, "Limiter", streamtypes.ProcessorIO{}, nil)
+	decisionLog.Finish(transaction, request, nil)
+	decisionLog.Abort("req-1")
+
+	_, found := decisionLog.Get("req-1")
+	require.False(t, found)
+}
@@ -0,0 +1,133 @@
+package decisionlog
+
+import (
+	"lunar/engine/actions"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"reflect"
+	"slices"
+	"time"
+)
+
+const (
+	directionRequest  = "request"
+	directionResponse = "response"
+)
+
+// Record explains what the flows did with a transaction
+type Record struct {
+	RequestID string    `json:"request_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	// Flows are the user flows matched by the filter tree
+	Flows          []string `json:"flows"`
+	Steps          []Step   `json:"steps"`
+	RequestAction  string   `json:"request_action,omitempty"`
+	ResponseAction string   `json:"response_action,omitempty"`
+	// Action is the final action type, the response action unless it did nothing
+	Action     string `json:"action"`
+	StatusCode int    `json:"status_code,omitempty"`
+	// Incomplete is set when the response of the transaction was never handled
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Step is a processor execution, with the condition it chose
+type Step struct {
+	Flow      string `json:"flow"`
+	Direction string `json:"direction"`
+	Processor string `json:"processor"`
+	Condition string `json:"condition,omitempty"`
+	// Attributes are the trace attributes of the execution, e.g. quota, queue wait and retry attempt
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Failure    bool           `json:"failure,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Transaction collects the decisions taken on a transaction across its request and response.
+// A nil transaction records nothing, which is the case when the decision log is disabled.
+type Transaction struct {
+	record    *Record
+	sampled   bool
+	createdAt time.Time
+}
+
+// MatchFlows records the user flows matched for the transaction
+func (t *Transaction) MatchFlows(flowNames ...string) {
+	if t == nil {
+		return
+	}
+	for _, flowName := range flowNames {
+		if !slices.Contains(t.record.Flows, flowName) {
+			t.record.Flows = append(t.record.Flows, flowName)
+		}
+	}
+}
+
+// AddStep records the execution of a processor
+func (t *Transaction) AddStep(
+	flowName string,
+	apiStream publictypes.APIStreamI,
+	processorKey string,
+	procIO streamtypes.ProcessorIO,
+	err error,
+) {
+	if t == nil {
+		return
+	}
+	step := Step{
+		Flow:      flowName,
+		Direction: directionResponse,
+		Processor: processorKey,
+		Condition: procIO.Name,
+		Failure:   procIO.Failure,
+	}
+	if apiStream.GetType().IsRequestType() {
+		step.Direction = directionRequest
+	}
+	if len(procIO.TraceAttributes) > 0 {
+		step.Attributes = make(map[string]any, len(procIO.TraceAttributes))
+		for _, attr := range procIO.TraceAttributes {
+			step.Attributes[string(attr.Key)] = attr.Value.AsInterface()
+		}
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	t.record.Steps = append(t.record.Steps, step)
+}
+
+func (t *Transaction) setRequestActions(requestActions []actions.ReqLunarAction) (isEarlyReturn bool) {
+	var prioritized actions.ReqLunarAction = &actions.NoOpAction{}
+	for _, action := range requestActions {
+		prioritized = prioritized.ReqPrioritize(action)
+	}
+	t.record.RequestAction = actionName(prioritized)
+	t.record.Action = t.record.RequestAction
+	if earlyResponse, ok := prioritized.(*actions.EarlyResponseAction); ok {
+		t.record.StatusCode = earlyResponse.Status
+	}
+	return prioritized.IsEarlyReturnType()
+}
+
+func (t *Transaction) setResponseActions(responseActions []actions.RespLunarAction) {
+	var prioritized actions.RespLunarAction = &actions.NoOpAction{}
+	for _, action := range responseActions {
+		prioritized = prioritized.RespPrioritize(action)
+	}
+	t.record.ResponseAction = actionName(prioritized)
+	if _, isNoOp := prioritized.(*actions.NoOpAction); !isNoOp || t.record.Action == "" {
+		t.record.Action = t.record.ResponseAction
+	}
+	if modifyResponse, ok := prioritized.(*actions.ModifyResponseAction); ok && modifyResponse.Status != 0 {
+		t.record.StatusCode = modifyResponse.Status
+	}
+}
+
+func actionName(action any) string {
+	actionType := reflect.TypeOf(action)
+	if actionType.Kind() == reflect.Pointer {
+		actionType = actionType.Elem()
+	}
+	return actionType.Name()
+}
@@ -14,6 +14,7 @@ type FilterResult struct {
 	UserFlow        FlowResult
 	SystemFlowStart FlowResult
 	SystemFlowEnd   FlowResult
+	PathParams      map[string]string
 }
 
 func (f *FilterResult) Extend(other internaltypes.FilterTreeResultI) {
@@ -55,6 +56,11 @@ func (f *FilterResult) GetSystemFlowEnd() ([]internaltypes.FlowI, bool) {
 	return f.SystemFlowEnd.Flow, f.SystemFlowEnd.FlowValid
 }
 
+// GetPathParams returns the path params of the matched filter URL
+func (f *FilterResult) GetPathParams() map[string]string {
+	return f.PathParams
+}
+
 func (f *FilterResult) IsEmpty() bool {
 	return !f.UserFlow.FlowValid && !f.SystemFlowStart.FlowValid && !f.SystemFlowEnd.FlowValid
 }
@@ -52,6 +52,7 @@ func (f *FilterTree) GetFlow(
 		}
 	}
 
+	flows.PathParams = lookupResult.PathParams
 	return flows, found
 }
 
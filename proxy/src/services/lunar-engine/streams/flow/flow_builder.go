@@ -19,6 +19,7 @@ type flowBuilder struct {
 	nodeBuilder        *graphNodeBuilder
 	processorManager   *processors.ProcessorManager
 	resourceManagement *resources.ResourceManagement
+	builtFlows         []*Flow
 }
 
 // newFlowBuilder creates a new instance of a flow builder.
@@ -61,7 +62,7 @@ func (fb *flowBuilder) build() error {
 			return fmt.Errorf("failed to build flow %s: %w", flowName, err)
 		}
 	}
-	return nil
+	return validateLastRequestStepsAcrossFlows(fb.builtFlows)
 }
 
 // buildFlow builds a flow based on the provided FlowRepresentation.
@@ -96,6 +97,7 @@ func (fb *flowBuilder) buildFlow(flowRep internaltypes.FlowRepI) error {
 	}
 
 	configstate.Get().AddFlow(flow)
+	fb.builtFlows = append(fb.builtFlows, flow)
 
 	return nil
 }
@@ -861,6 +861,69 @@ func TestGetEdges(t *testing.T) {
 	require.Equal(t, "condition1", requestEdges[0].GetCondition())
 }
 
+type lastRequestStepProcessor struct {
+	testProcessors.MockProcessor
+}
+
+func (p *lastRequestStepProcessor) GetRequirement() *streamTypes.ProcessorRequirement {
+	return &streamTypes.ProcessorRequirement{IsLastRequestStep: true}
+}
+
+func TestValidateLastRequestSteps(t *testing.T) {
+	flowGraph := newTestFlow(t, 2)
+	addProcessors(t, flowGraph.request, "processor", 2)
+
+	lastStep := flowGraph.request.nodes["processor1"]
+	lastStep.processor = &lastRequestStepProcessor{}
+	lastStep.edges = append(lastStep.edges, &ConnectionEdge{})
+	require.NoError(t, validateLastRequestSteps(flowGraph.request))
+
+	lastStep.edges = append(lastStep.edges, &ConnectionEdge{node: flowGraph.request.nodes["processor2"]})
+	require.EqualError(t, validateLastRequestSteps(flowGraph.request),
+		"processor 'processor1' must be the last step of the request flow, but is followed by 'processor2'")
+}
+
+type requestModifierProcessor struct {
+	testProcessors.MockProcessor
+}
+
+func (p *requestModifierProcessor) GetRequirement() *streamTypes.ProcessorRequirement {
+	return &streamTypes.ProcessorRequirement{IsRequestModifier: true}
+}
+
+func TestValidateLastRequestStepsAcrossFlows(t *testing.T) {
+	newFilteredFlow := func(name string, filter *stream_config.Filter, processor streamTypes.ProcessorI) *Flow {
+		flowGraph := newTestFlow(t, 1)
+		flowGraph.flowRep = &stream_config.FlowRepresentation{Name: name, Filter: filter}
+		addProcessors(t, flowGraph.request, "processor", 1)
+		flowGraph.request.nodes["processor1"].processor = processor
+		return flowGraph
+	}
+
+	signingFilter := &stream_config.Filter{URLs: []string{"api.com/orders/*"}}
+	signing := newFilteredFlow("signing", signingFilter, &lastRequestStepProcessor{})
+	otherURL := newFilteredFlow("other-url",
+		&stream_config.Filter{URLs: []string{"api.com/users/*"}},
+		&requestModifierProcessor{})
+	otherMethod := newFilteredFlow("other-method",
+		&stream_config.Filter{URLs: []string{"api.com/orders/{id}"}, Methods: []string{"DELETE"}},
+		&requestModifierProcessor{})
+	readOnly := newFilteredFlow("read-only",
+		&stream_config.Filter{URLs: []string{"api.com/orders/{id}"}},
+		&testProcessors.MockProcessor{})
+	require.NoError(t, validateLastRequestStepsAcrossFlows([]*Flow{signing, otherURL, readOnly}))
+
+	signingFilter.Methods = []string{"GET", "POST"}
+	require.NoError(t, validateLastRequestStepsAcrossFlows([]*Flow{signing, otherMethod}))
+
+	modifying := newFilteredFlow("modifying",
+		&stream_config.Filter{URLs: []string{"api.com/orders/{id}"}},
+		&requestModifierProcessor{})
+	require.EqualError(t, validateLastRequestStepsAcrossFlows([]*Flow{signing, otherURL, modifying}),
+		"processor 'processor1' of flow 'signing' must be the last step of the request flow, "+
+			"but flow 'modifying' matches the same requests and modifies them with 'processor1'")
+}
+
 func testEdges(
 	t *testing.T,
 	edges []internal_types.ConnectionEdgeI,
@@ -2,6 +2,11 @@ package streamflow
 
 import (
 	"fmt"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/urltree"
+	"slices"
+	"sort"
 
 	"github.com/rs/zerolog/log"
 )
@@ -16,6 +21,9 @@ func validateFlow(flowGraph *Flow) error {
 	if err := validateDirection(flowGraph.request); err != nil {
 		return fmt.Errorf("request direction: %w", err)
 	}
+	if err := validateLastRequestSteps(flowGraph.request); err != nil {
+		return fmt.Errorf("request direction: %w", err)
+	}
 	if err := validateDirection(flowGraph.response); err != nil {
 		return fmt.Errorf("response direction: %w", err)
 	}
@@ -62,6 +70,109 @@ func validateEdges(nodes map[string]*FlowGraphNode) error {
 	return nil
 }
 
+// validateLastRequestSteps checks that processors which must run last are not followed by another processor.
+func validateLastRequestSteps(flow *FlowDirection) error {
+	for processorName, node := range flow.nodes {
+		if node.processor == nil {
+			continue
+		}
+		requirement := node.processor.GetRequirement()
+		if requirement == nil || !requirement.IsLastRequestStep {
+			continue
+		}
+		for _, edge := range node.edges {
+			if edge.node != nil {
+				return fmt.Errorf("processor '%s' must be the last step of the request flow, "+
+					"but is followed by '%s'", processorName, edge.node.processorKey)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLastRequestStepsAcrossFlows checks that a flow with a processor which must run last
+// in the request flow does not match the requests of another flow modifying them,
+// since the order of the flows matching a request does not keep that processor last.
+func validateLastRequestStepsAcrossFlows(flows []*Flow) error {
+	for _, lastStepFlow := range flows {
+		lastStep := findRequestProcessor(lastStepFlow.request, func(
+			requirement *streamtypes.ProcessorRequirement,
+		) bool {
+			return requirement.IsLastRequestStep
+		})
+		if lastStep == "" {
+			continue
+		}
+
+		for _, flow := range flows {
+			if flow == lastStepFlow || !filtersOverlap(lastStepFlow.GetFilter(), flow.GetFilter()) {
+				continue
+			}
+			modifier := findRequestProcessor(flow.request, func(
+				requirement *streamtypes.ProcessorRequirement,
+			) bool {
+				return requirement.IsRequestModifier
+			})
+			if modifier != "" {
+				return fmt.Errorf("processor '%s' of flow '%s' must be the last step of the request flow, "+
+					"but flow '%s' matches the same requests and modifies them with '%s'",
+					lastStep, lastStepFlow.GetName(), flow.GetName(), modifier)
+			}
+		}
+	}
+	return nil
+}
+
+// findRequestProcessor returns the key of the first processor of the flow direction,
+// in key order, whose requirement matches
+func findRequestProcessor(
+	flow *FlowDirection,
+	match func(*streamtypes.ProcessorRequirement) bool,
+) string {
+	processorKeys := make([]string, 0, len(flow.nodes))
+	for processorKey := range flow.nodes {
+		processorKeys = append(processorKeys, processorKey)
+	}
+	sort.Strings(processorKeys)
+
+	for _, processorKey := range processorKeys {
+		processor := flow.nodes[processorKey].processor
+		if processor == nil {
+			continue
+		}
+		if requirement := processor.GetRequirement(); requirement != nil && match(requirement) {
+			return processorKey
+		}
+	}
+	return ""
+}
+
+// filtersOverlap checks whether a request can match both filters by its URL and method
+func filtersOverlap(first, second publictypes.FilterI) bool {
+	methodsOverlap := false
+	for _, method := range first.GetSupportedMethods() {
+		if slices.Contains(second.GetSupportedMethods(), method) {
+			methodsOverlap = true
+			break
+		}
+	}
+	if !methodsOverlap {
+		return false
+	}
+
+	if first.IsAnyURLAccepted() || second.IsAnyURLAccepted() {
+		return true
+	}
+	for _, firstURL := range first.GetURLs() {
+		for _, secondURL := range second.GetURLs() {
+			if urltree.URLsOverlap(firstURL, secondURL) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // validateUnconnectedProcessors checks if any processors in the flow graph are unconnected.
 func validateUnconnectedProcessors(flow *FlowDirection) error {
 	connectedProcessors := make(map[string]bool)
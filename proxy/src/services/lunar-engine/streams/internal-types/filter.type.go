@@ -15,6 +15,7 @@ type FilterTreeResultI interface {
 	GetUserFlow() ([]FlowI, bool)
 	GetSystemFlowStart() ([]FlowI, bool)
 	GetSystemFlowEnd() ([]FlowI, bool)
+	GetPathParams() map[string]string
 }
 
 type FlowFilterI interface {
@@ -2,11 +2,13 @@ package lunarcontext
 
 import (
 	publictypes "lunar/engine/streams/public-types"
+	"sync"
 )
 
 var _ publictypes.LunarContextI = &lunarContext{}
 
 type lunarContext struct {
+	mu                   sync.RWMutex
 	globalContext        publictypes.ContextI
 	transactionalContext publictypes.ContextI
 	flowContext          publictypes.ContextI
@@ -26,28 +28,38 @@ func (c *lunarContext) GetGlobalContext() publictypes.ContextI {
 
 // GetFlowContext returns the flow context
 func (c *lunarContext) GetFlowContext() publictypes.ContextI {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.flowContext
 }
 
 // SetFlowContext sets the flow context
 func (c *lunarContext) SetFlowContext(flowContext publictypes.ContextI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.flowContext = flowContext
 }
 
 // InitiateTransactionalContext initiates a new transactional context
 func (c *lunarContext) InitiateTransactionalContext() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.transactionalContext = NewContext()
 }
 
 // DestroyTransactionalContext destroys the transactional context
 func (c *lunarContext) DestroyTransactionalContext() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.transactionalContext = nil
 }
 
 // GetTransactionalContext returns the transactional context
 func (c *lunarContext) GetTransactionalContext() publictypes.ContextI {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.transactionalContext == nil {
-		c.InitiateTransactionalContext()
+		c.transactionalContext = NewContext()
 	}
 	return c.transactionalContext
 }
@@ -200,6 +200,32 @@ func (p *memoryState[T]) AtomicWindowResetIn(
 	return timeRemaining, timeRemaining <= 0, nil
 }
 
+func (p *memoryState[T]) AtomicWindowCount(
+	key string,
+	windowSize time.Duration,
+) (int64, bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	windowStartKey := p.buildKey(key, windowStartKeySuffix)
+	counterKey := p.buildKey(key, counterKeySuffix)
+
+	currentTime := p.clock.Now().UTC()
+	if currentTime.Sub(p.atomicGetWindow(windowStartKey)) >= windowSize {
+		return 0, true, nil
+	}
+	if !p.contextMemory.Exists(counterKey) {
+		return 0, false, nil
+	}
+
+	counterRaw, _ := p.Get(counterKey)
+	currentCounter, converted := any(counterRaw).(int64)
+	if !converted {
+		return 0, false, fmt.Errorf("value for key %s is not an int64", key)
+	}
+	return currentCounter, false, nil
+}
+
 func (p *memoryState[T]) GetQuotaCounter(key string) (int64, error) {
 	var counterRaw interface{}
 	counterRaw, _ = p.Get(key)
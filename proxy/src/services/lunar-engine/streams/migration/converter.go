@@ -0,0 +1,538 @@
+package migration
+
+import (
+	"fmt"
+	"lunar/engine/utils"
+	"lunar/engine/utils/environment"
+	sharedConfig "lunar/shared-model/config"
+	"math"
+	"regexp"
+	"strings"
+
+	pathparamsresource "lunar/engine/streams/resources/path_params"
+	quotaresource "lunar/engine/streams/resources/quota"
+)
+
+const (
+	flowNamePrefix = "migrated_"
+	globalScope    = "global"
+	anyURL         = "*"
+
+	fileExporterTag  = "file"
+	cloudExporterTag = "cloud"
+
+	defaultThrottlingStatusCode = 429
+	throttlingResponseBody      = "Too Many Requests"
+)
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+type converter struct {
+	result *Result
+	// exporterIDs maps the legacy exporter names to the IDs of the gateway config exporters
+	exporterIDs map[sharedConfig.ExporterType]string
+}
+
+// policyScope is a set of policies applied on the same traffic
+type policyScope struct {
+	name      string
+	url       string
+	method    string
+	remedies  []sharedConfig.Remedy
+	diagnosis []sharedConfig.Diagnosis
+}
+
+// remedies of a scope grouped by the processors they translate into
+type scopeRemedies struct {
+	caching    []sharedConfig.Remedy
+	throttling []sharedConfig.Remedy
+	queue      []sharedConfig.Remedy
+	retry      []sharedConfig.Remedy
+}
+
+// Convert translates the legacy policies into flows, quotas and a gateway config.
+// Policies without an equivalent in flows are listed in the report of the result.
+func Convert(policies *sharedConfig.PoliciesConfig) *Result {
+	conv := &converter{
+		result: &Result{
+			flows:         map[string]*flowFile{},
+			quotas:        map[string]*quotaFile{},
+			pathParams:    &pathParamsFile{},
+			gatewayConfig: &gatewayConfig{Exporters: map[string]environment.Exporter{}},
+		},
+		exporterIDs: map[sharedConfig.ExporterType]string{},
+	}
+
+	conv.convertExporters(&policies.Exporters)
+	conv.convertScope(&policyScope{
+		name:      globalScope,
+		url:       anyURL,
+		remedies:  policies.Global.Remedies,
+		diagnosis: policies.Global.Diagnosis,
+	})
+	for _, endpoint := range policies.Endpoints {
+		conv.convertScope(&policyScope{
+			name:      fmt.Sprintf("%s %s", endpoint.Method, endpoint.URL),
+			url:       endpoint.URL,
+			method:    endpoint.Method,
+			remedies:  endpoint.Remedies,
+			diagnosis: endpoint.Diagnosis,
+		})
+	}
+	for accountID := range policies.Accounts {
+		conv.report(globalScope, string(accountID),
+			"accounts are not translated, define their credentials on the relevant flow processors")
+	}
+
+	return conv.result
+}
+
+func (c *converter) convertExporters(exporters *sharedConfig.Exporters) {
+	if exporters.File != nil {
+		c.exporterIDs[sharedConfig.ExporterFile] = sharedConfig.ExporterNameFile
+		c.result.gatewayConfig.Exporters[fileExporterTag] = environment.Exporter{
+			ExporterID: sharedConfig.ExporterNameFile,
+			FileDir:    exporters.File.FileDir,
+			FileName:   exporters.File.FileName,
+		}
+	}
+
+	if exporters.S3 != nil {
+		c.exporterIDs[sharedConfig.ExporterS3] = sharedConfig.ExporterNameS3
+		c.result.gatewayConfig.Exporters[cloudExporterTag] = environment.Exporter{
+			ExporterID: sharedConfig.ExporterNameS3,
+			Type:       sharedConfig.ExporterNameS3,
+			BucketName: exporters.S3.BucketName,
+			Region:     exporters.S3.Region,
+		}
+	}
+
+	if exporters.S3Minio != nil {
+		if exporters.S3 != nil {
+			c.report(globalScope, sharedConfig.ExporterNameS3Minio,
+				"only one cloud exporter is supported, the s3 exporter was kept")
+		} else {
+			c.exporterIDs[sharedConfig.ExporterS3Minio] = sharedConfig.ExporterNameS3Minio
+			c.result.gatewayConfig.Exporters[cloudExporterTag] = environment.Exporter{
+				ExporterID: sharedConfig.ExporterNameS3Minio,
+				Type:       sharedConfig.ExporterNameS3,
+				BucketName: exporters.S3Minio.BucketName,
+				Endpoint:   exporters.S3Minio.URL,
+			}
+		}
+	}
+
+	if exporters.Prometheus != nil {
+		c.report(globalScope, sharedConfig.ExporterNamePrometheus,
+			"the prometheus exporter is not part of the flows configuration and was not translated")
+	}
+}
+
+func (c *converter) convertScope(scope *policyScope) {
+	remedies := c.groupRemedies(scope)
+	flowName := flowNamePrefix + identifier(scope.name)
+	flowFilter := scope.filter()
+	builder := newFlowBuilder(flowName, flowFilter)
+
+	cachingKeys := make([][]string, len(remedies.caching))
+	for index, remedy := range remedies.caching {
+		cachingKeys[index] = c.cachingKeyParts(scope, remedy)
+		c.addReadCache(builder, cachingKeys[index])
+	}
+	for index, remedy := range remedies.throttling {
+		c.addLimiter(builder, scope, remedy, fmt.Sprintf("%s_limit_%d", flowName, index+1))
+	}
+	for index, remedy := range remedies.queue {
+		c.addQueue(builder, scope, remedy, fmt.Sprintf("%s_queue_%d", flowName, index+1))
+	}
+	for _, remedy := range remedies.retry {
+		c.addRetry(builder, remedy)
+	}
+	for index, remedy := range remedies.caching {
+		c.addWriteCache(builder, remedy, cachingKeys[index])
+	}
+	for _, diagnosis := range scope.diagnosis {
+		c.convertDiagnosis(builder, scope, diagnosis)
+	}
+
+	if builder.isEmpty() {
+		return
+	}
+	c.result.flows[flowName] = builder.build()
+	if strings.Contains(scope.url, "{") {
+		c.result.pathParams.PathParams = append(c.result.pathParams.PathParams,
+			&pathparamsresource.PathParam{URL: scope.url})
+	}
+}
+
+func (c *converter) groupRemedies(scope *policyScope) *scopeRemedies {
+	remedies := &scopeRemedies{}
+	for _, remedy := range scope.remedies {
+		if !remedy.Enabled {
+			c.report(scope.name, remedy.Name, "the remedy is disabled and was skipped")
+			continue
+		}
+
+		switch remedy.Type() {
+		case sharedConfig.RemedyCaching:
+			remedies.caching = append(remedies.caching, remedy)
+		case sharedConfig.RemedyStrategyBasedThrottling:
+			remedies.throttling = append(remedies.throttling, remedy)
+		case sharedConfig.RemedyStrategyBasedQueue:
+			remedies.queue = append(remedies.queue, remedy)
+		case sharedConfig.RemedyRetry:
+			remedies.retry = append(remedies.retry, remedy)
+		case sharedConfig.RemedyResponseBasedThrottling,
+			sharedConfig.RemedyConcurrencyBasedThrottling,
+			sharedConfig.RemedyAccountOrchestration,
+			sharedConfig.RemedyFixedResponse,
+			sharedConfig.RemedyAuth:
+			c.report(scope.name, remedy.Name,
+				fmt.Sprintf("%s remedies have no flows translation", remedyTypeName(remedy.Type())))
+		case sharedConfig.RemedyUndefined:
+			c.report(scope.name, remedy.Name, "the remedy type could not be determined")
+		}
+	}
+	return remedies
+}
+
+func (c *converter) addReadCache(builder *flowBuilder, cachingKeyParts []string) {
+	readKey := builder.addProcessor("ReadCache", param("caching_key_parts", cachingKeyParts))
+	builder.request.then(readKey, "cache_miss")
+	builder.response.connect(processorEndpoint(readKey, "cache_hit"), streamEndpoint(streamEnd))
+}
+
+func (c *converter) addWriteCache(builder *flowBuilder, remedy sharedConfig.Remedy, cachingKeyParts []string) {
+	config := remedy.Config.Caching
+	params := []*parameterSpec{
+		param("caching_key_parts", cachingKeyParts),
+		param("ttl_seconds", roundUp(float64(config.TTLSeconds))),
+	}
+	if config.MaxRecordSizeBytes > 0 {
+		params = append(params, param("record_max_size_bytes", config.MaxRecordSizeBytes))
+	}
+	if config.MaxCacheSizeMegabytes > 0 {
+		params = append(params, param("max_cache_size_mb", roundUp(float64(config.MaxCacheSizeMegabytes))))
+	}
+	builder.response.then(builder.addProcessor("WriteCache", params...))
+}
+
+// cachingKeyParts keys the cache by the request path and the configured path params,
+// which the flows address by their position in the path
+func (c *converter) cachingKeyParts(scope *policyScope, remedy sharedConfig.Remedy) []string {
+	keyParts := []string{"$.request.path"}
+	segments := pathSegments(scope.url)
+	for _, payloadPath := range remedy.Config.Caching.RequestPayloadPaths {
+		if payloadPath.PayloadType != sharedConfig.RequestPathParamPayload {
+			c.report(scope.name, remedy.Name,
+				fmt.Sprintf("caching by %s payload is not supported", payloadPath.PayloadType))
+			continue
+		}
+		index := indexOf(segments, "{"+payloadPath.Path+"}")
+		if index < 0 {
+			c.report(scope.name, remedy.Name,
+				fmt.Sprintf("path param %s is not part of the endpoint URL", payloadPath.Path))
+			continue
+		}
+		keyParts = append(keyParts, fmt.Sprintf("$.request.path_segments[%d]", index))
+	}
+	return keyParts
+}
+
+func (c *converter) addLimiter(
+	builder *flowBuilder,
+	scope *policyScope,
+	remedy sharedConfig.Remedy,
+	quotaID string,
+) {
+	config := remedy.Config.StrategyBasedThrottling
+	c.addQuota(scope, quotaID, config.AllowedRequestCount, config.WindowSizeInSeconds)
+	if config.GroupQuotaAllocation != nil {
+		c.addGroupAllocation(scope, remedy, quotaID, config.GroupQuotaAllocation)
+	}
+	if config.SpilloverConfig.Enabled {
+		c.report(scope.name, remedy.Name,
+			"spillover requires a monthly quota and was not translated")
+	}
+
+	limiterKey := builder.addProcessor("Limiter", param("quota_id", quotaID))
+	builder.request.then(limiterKey, "below_limit")
+	c.addBlockingResponse(builder, processorEndpoint(limiterKey, "above_limit"), config.ResponseStatusCode)
+}
+
+func (c *converter) addGroupAllocation(
+	scope *policyScope,
+	remedy sharedConfig.Remedy,
+	quotaID string,
+	allocation *sharedConfig.GroupQuotaAllocation,
+) {
+	quotas := c.quotaFile(scope)
+	for _, group := range allocation.Groups {
+		percentage := int64(group.AllocationPercentage)
+		if float64(percentage) != group.AllocationPercentage {
+			c.report(scope.name, remedy.Name, fmt.Sprintf(
+				"allocation of group %s was rounded down to %d%%", group.GroupHeaderValue, percentage))
+		}
+		quotas.InternalLimits = append(quotas.InternalLimits, &childQuotaSpec{
+			quotaSpec: quotaSpec{
+				ID: fmt.Sprintf("%s_%s", quotaID, identifier(group.GroupHeaderValue)),
+				Filter: &filter{
+					URL:     scope.url,
+					Headers: []*headerFilter{{Key: allocation.GroupBy.HeaderName, Value: group.GroupHeaderValue}},
+				},
+				Strategy: &strategySpec{AllocationPercentage: percentage},
+			},
+			ParentID: quotaID,
+		})
+	}
+	if allocation.Default != "" {
+		c.report(scope.name, remedy.Name, fmt.Sprintf(
+			"the %s default group behavior was not translated, requests outside the groups use quota %s",
+			allocation.Default, quotaID))
+	}
+}
+
+func (c *converter) addQueue(
+	builder *flowBuilder,
+	scope *policyScope,
+	remedy sharedConfig.Remedy,
+	quotaID string,
+) {
+	config := remedy.Config.StrategyBasedQueue
+	c.addQuota(scope, quotaID, config.AllowedRequestCount, config.WindowSizeInSeconds)
+
+	params := []*parameterSpec{
+		param("quota_id", quotaID),
+		param("ttl_seconds", roundUp(float64(config.TTLSeconds))),
+		param("queue_size", config.QueueSize),
+	}
+	if config.Prioritization != nil {
+		groups := map[string]int64{}
+		for group, prioritization := range config.Prioritization.Groups {
+			groups[group] = int64(prioritization.Priority)
+		}
+		params = append(params,
+			param("priority_group_by_header", config.Prioritization.GroupBy.HeaderName),
+			param("priority_groups", groups))
+	}
+
+	queueKey := builder.addProcessor("Queue", params...)
+	builder.request.then(queueKey, "allowed")
+	c.addBlockingResponse(builder, processorEndpoint(queueKey, "blocked"), config.ResponseStatusCode)
+}
+
+// addBlockingResponse answers the requests coming from the given output without sending them
+func (c *converter) addBlockingResponse(builder *flowBuilder, from *endpoint, statusCode int) {
+	if statusCode == 0 {
+		statusCode = defaultThrottlingStatusCode
+	}
+	responseKey := builder.addProcessor("GenerateResponse",
+		param("status", statusCode),
+		param("body", throttlingResponseBody),
+		param("Content-Type", "text/plain"))
+	builder.request.connect(from, processorEndpoint(responseKey, ""))
+	builder.response.connect(processorEndpoint(responseKey, ""), streamEndpoint(streamEnd))
+}
+
+// addRetry retries the responses matching the retry conditions,
+// the other responses continue through the flow
+func (c *converter) addRetry(builder *flowBuilder, remedy sharedConfig.Remedy) {
+	config := remedy.Config.Retry
+	statusCodes := make([]string, 0, len(config.Conditions.StatusCode))
+	for _, statusRange := range config.Conditions.StatusCode {
+		if statusRange.From == statusRange.To {
+			statusCodes = append(statusCodes, fmt.Sprint(statusRange.From))
+		} else {
+			statusCodes = append(statusCodes, fmt.Sprintf("%d-%d", statusRange.From, statusRange.To))
+		}
+	}
+
+	params := []*parameterSpec{
+		param("attempts", config.Attempts),
+		param("cooldown_between_attempts_seconds", config.InitialCooldownSeconds),
+	}
+	if config.CooldownMultiplier > 0 {
+		params = append(params, param("cooldown_multiplier", config.CooldownMultiplier))
+	}
+
+	filterKey := builder.addProcessor("Filter", param("status_code", statusCodes))
+	retryKey := builder.addProcessor("Retry", params...)
+	builder.response.then(filterKey, "miss")
+	builder.response.connect(processorEndpoint(filterKey, "hit"), processorEndpoint(retryKey, ""))
+	builder.response.connect(processorEndpoint(retryKey, "retry"), streamEndpoint(streamEnd))
+	builder.response.continueFrom(processorEndpoint(retryKey, "failed"))
+}
+
+func (c *converter) convertDiagnosis(
+	builder *flowBuilder,
+	scope *policyScope,
+	diagnosis sharedConfig.Diagnosis,
+) {
+	if !diagnosis.Enabled {
+		c.report(scope.name, diagnosis.Name, "the diagnosis is disabled and was skipped")
+		return
+	}
+
+	switch diagnosis.Type() {
+	case sharedConfig.DiagnosisHARExporter:
+		c.addHARCollector(builder, scope, diagnosis)
+	case sharedConfig.DiagnosisMetricsCollector:
+		c.report(scope.name, diagnosis.Name,
+			"metrics collector diagnosis has no flows translation, use the UserDefinedMetrics processor")
+	case sharedConfig.DiagnosisVoid:
+		// void diagnosis does nothing, there is nothing to translate
+	case sharedConfig.DiagnosisUndefined:
+		c.report(scope.name, diagnosis.Name, "the diagnosis type could not be determined")
+	}
+}
+
+func (c *converter) addHARCollector(
+	builder *flowBuilder,
+	scope *policyScope,
+	diagnosis sharedConfig.Diagnosis,
+) {
+	config := diagnosis.Config.HARExporter
+	exporterID, found := c.exporterIDs[diagnosis.ExporterType()]
+	if !found {
+		exporterID = diagnosis.Export
+		c.report(scope.name, diagnosis.Name, fmt.Sprintf(
+			"exporter %s is not defined, HAR transactions will be written to the default file exporter",
+			diagnosis.Export))
+	}
+
+	params := []*parameterSpec{
+		param("exporter_id", exporterID),
+		param("obfuscate_enabled", config.Obfuscate.Enabled),
+	}
+	if config.TransactionMaxSize > 0 {
+		params = append(params, param("transaction_max_size_bytes", config.TransactionMaxSize))
+	}
+	if exclusions := c.obfuscationExclusions(scope, diagnosis); len(exclusions) > 0 {
+		params = append(params, param("obfuscate_exclusions", exclusions))
+	}
+	builder.response.then(builder.addProcessor("HARCollector", params...))
+}
+
+// obfuscationExclusions translates the exclusions into the JSON paths used by HARCollector
+func (c *converter) obfuscationExclusions(scope *policyScope, diagnosis sharedConfig.Diagnosis) []string {
+	exclusions := diagnosis.Config.HARExporter.Obfuscate.Exclusions
+	paths := []string{}
+	for _, name := range exclusions.QueryParams {
+		paths = append(paths, "$.request.query_param."+name)
+	}
+	segments := pathSegments(scope.url)
+	for _, name := range exclusions.PathParams {
+		index := indexOf(segments, "{"+name+"}")
+		if index < 0 {
+			c.report(scope.name, diagnosis.Name,
+				fmt.Sprintf("path param %s is not part of the endpoint URL", name))
+			continue
+		}
+		paths = append(paths, fmt.Sprintf("$.request.path_segments[%d]", index))
+	}
+	for _, name := range exclusions.RequestHeaders {
+		paths = append(paths, fmt.Sprintf(`$.request.headers["%s"]`, name))
+	}
+	for _, name := range exclusions.ResponseHeaders {
+		paths = append(paths, fmt.Sprintf(`$.response.headers["%s"]`, name))
+	}
+	for _, bodyPath := range exclusions.RequestBodyPaths {
+		paths = append(paths, "$.request.body"+relativeJSONPath(bodyPath))
+	}
+	for _, bodyPath := range exclusions.ResponseBodyPaths {
+		paths = append(paths, "$.response.body"+relativeJSONPath(bodyPath))
+	}
+	return paths
+}
+
+func (c *converter) addQuota(scope *policyScope, quotaID string, maxRequests int64, windowSeconds int) {
+	quotas := c.quotaFile(scope)
+	quotas.Quotas = append(quotas.Quotas, &quotaSpec{
+		ID:     quotaID,
+		Filter: scope.filter(),
+		Strategy: &strategySpec{
+			FixedWindow: &quotaresource.QuotaLimit{
+				Max:          maxRequests,
+				Interval:     int64(windowSeconds),
+				IntervalUnit: "second",
+			},
+		},
+	})
+}
+
+// quotaFile returns the quota file of the scope host, the flows validation
+// expects the quotas of each host to be kept in a single file
+func (c *converter) quotaFile(scope *policyScope) *quotaFile {
+	host := utils.ExtractHost(scope.url)
+	if host == anyURL {
+		host = "all_hosts"
+	}
+	fileName := flowNamePrefix + identifier(host)
+	if c.result.quotas[fileName] == nil {
+		c.result.quotas[fileName] = &quotaFile{}
+	}
+	return c.result.quotas[fileName]
+}
+
+func (c *converter) report(scope, policy, reason string) {
+	c.result.report = append(c.result.report, ReportEntry{Scope: scope, Policy: policy, Reason: reason})
+}
+
+func (s *policyScope) filter() *filter {
+	scopeFilter := &filter{URL: s.url}
+	if s.method != "" {
+		scopeFilter.Method = []string{strings.ToUpper(s.method)}
+	}
+	return scopeFilter
+}
+
+func remedyTypeName(remedyType sharedConfig.RemedyType) string {
+	switch remedyType { //nolint:exhaustive
+	case sharedConfig.RemedyResponseBasedThrottling:
+		return "response_based_throttling"
+	case sharedConfig.RemedyConcurrencyBasedThrottling:
+		return "concurrency_based_throttling"
+	case sharedConfig.RemedyAccountOrchestration:
+		return "account_orchestration"
+	case sharedConfig.RemedyFixedResponse:
+		return "fixed_response"
+	case sharedConfig.RemedyAuth:
+		return "authentication"
+	}
+	return "undefined"
+}
+
+// pathSegments splits the URL path the same way the flows split the request path
+func pathSegments(url string) []string {
+	_, path, found := strings.Cut(url, "/")
+	if !found {
+		return []string{""}
+	}
+	return strings.Split("/"+path, "/")
+}
+
+func indexOf(values []string, value string) int {
+	for index, current := range values {
+		if current == value {
+			return index
+		}
+	}
+	return -1
+}
+
+// relativeJSONPath turns "$.user.name" and "user.name" into ".user.name"
+func relativeJSONPath(path string) string {
+	path = strings.TrimPrefix(path, "$")
+	if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+		path = "." + path
+	}
+	return path
+}
+
+func identifier(value string) string {
+	return strings.Trim(nonIdentifierChars.ReplaceAllString(strings.ToLower(value), "_"), "_")
+}
+
+func roundUp(value float64) int {
+	return int(math.Ceil(value))
+}
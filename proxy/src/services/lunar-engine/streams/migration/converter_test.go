@@ -0,0 +1,213 @@
+package migration
+
+import (
+	"lunar/engine/utils/environment"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sharedConfig "lunar/shared-model/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const testPolicies = `
+global:
+  remedies: []
+  diagnosis:
+    - enabled: true
+      name: global HAR
+      config:
+        har_exporter:
+          transaction_max_size: 2048
+          obfuscate:
+            enabled: true
+            exclusions:
+              request_headers: [Authorization]
+      export: file
+endpoints:
+  - url: api.example.com/items/{id}
+    method: GET
+    remedies:
+      - enabled: true
+        name: cache items
+        config:
+          caching:
+            request_payload_paths:
+              - payload_type: path_params
+                path: id
+            ttl_seconds: 30
+            max_record_size_bytes: 1024
+            max_cache_size_megabytes: 0.5
+      - enabled: true
+        name: retry errors
+        config:
+          retry:
+            attempts: 3
+            initial_cooldown_seconds: 1
+            cooldown_multiplier: 2
+            conditions:
+              status_code:
+                - from: 500
+                  to: 504
+                - from: 429
+                  to: 429
+  - url: api.example.com/orders
+    method: POST
+    remedies:
+      - enabled: true
+        name: limit orders
+        config:
+          strategy_based_throttling:
+            allowed_request_count: 100
+            window_size_in_seconds: 60
+            response_status_code: 429
+            group_quota_allocation:
+              group_by:
+                header_name: x-tenant
+              groups:
+                - group_header_value: acme
+                  allocation_percentage: 25
+              default: allow
+      - enabled: true
+        name: fixed
+        config:
+          fixed_response:
+            status_code: 418
+      - enabled: false
+        name: disabled cache
+        config:
+          caching:
+            ttl_seconds: 10
+  - url: other.example.com/search
+    method: GET
+    remedies:
+      - enabled: true
+        name: queue search
+        config:
+          strategy_based_queue:
+            allowed_request_count: 10
+            window_size_in_seconds: 1
+            response_status_code: 503
+            ttl_seconds: 5
+            queue_size: 50
+            prioritization:
+              group_by:
+                header_name: x-lunar-consumer-tag
+              groups:
+                production:
+                  priority: 1
+                staging:
+                  priority: 2
+exporters:
+  file:
+    file_dir: /var/log/lunar-proxy
+    file_name: output.log
+  prometheus:
+    bucket_boundaries: [0.1, 1]
+`
+
+func TestMain(m *testing.M) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	processorsFolder := filepath.Join(filepath.Dir(currentDir), "processors", "registry")
+	prevVal := environment.SetProcessorsDirectory(processorsFolder)
+
+	code := m.Run()
+
+	environment.SetProcessorsDirectory(prevVal)
+	os.Exit(code)
+}
+
+func TestConvertPassesFlowsValidation(t *testing.T) {
+	t.Setenv(environment.LuaRetryRequestTimeoutSecEnvVar, "30")
+	result := Convert(loadTestPolicies(t))
+
+	root := t.TempDir()
+	require.NoError(t, result.Write(root))
+	require.NoError(t, Validate(root))
+
+	require.FileExists(t, filepath.Join(root, ReportFileName))
+	require.FileExists(t, environment.GetCustomGatewayConfigPath(root))
+	require.FileExists(t, filepath.Join(environment.GetCustomPathParamsDirectory(root), pathParamsFileName))
+	require.FileExists(t, filepath.Join(environment.GetCustomQuotasDirectory(root), "migrated_api_example_com.yaml"))
+	require.FileExists(t, filepath.Join(environment.GetCustomQuotasDirectory(root), "migrated_other_example_com.yaml"))
+	// the path params generated by the validation stay under the validated root
+	require.FileExists(t, filepath.Join(root, "policies.yaml"))
+	require.NoFileExists(t, "policies.yaml")
+}
+
+func TestConvertProcessors(t *testing.T) {
+	result := Convert(loadTestPolicies(t))
+	require.Len(t, result.flows, 4)
+
+	items := result.flows["migrated_get_api_example_com_items_id"]
+	require.NotNil(t, items)
+	require.Equal(t, []string{"GET"}, items.Filter.Method)
+	require.Equal(t, []string{"$.request.path", "$.request.path_segments[2]"},
+		paramValue(t, items, "ReadCache", "caching_key_parts"))
+	require.Equal(t, 1, paramValue(t, items, "WriteCache", "max_cache_size_mb"))
+	require.Equal(t, []string{"500-504", "429"}, paramValue(t, items, "Filter", "status_code"))
+	require.Equal(t, 3, paramValue(t, items, "Retry", "attempts"))
+
+	orders := result.flows["migrated_post_api_example_com_orders"]
+	require.Equal(t, "migrated_post_api_example_com_orders_limit_1", paramValue(t, orders, "Limiter", "quota_id"))
+	require.Equal(t, 429, paramValue(t, orders, "GenerateResponse", "status"))
+
+	quotas := result.quotas["migrated_api_example_com"]
+	require.Len(t, quotas.Quotas, 1)
+	require.Equal(t, int64(100), quotas.Quotas[0].Strategy.FixedWindow.Max)
+	require.Len(t, quotas.InternalLimits, 1)
+	require.Equal(t, int64(25), quotas.InternalLimits[0].Strategy.AllocationPercentage)
+	require.Equal(t, "x-tenant", quotas.InternalLimits[0].Filter.Headers[0].Key)
+
+	search := result.flows["migrated_get_other_example_com_search"]
+	require.Equal(t, map[string]int64{"production": 1, "staging": 2},
+		paramValue(t, search, "Queue", "priority_groups"))
+	require.Equal(t, 503, paramValue(t, search, "GenerateResponse", "status"))
+
+	global := result.flows["migrated_global"]
+	require.Equal(t, "*", global.Filter.URL)
+	require.Equal(t, "file", paramValue(t, global, "HARCollector", "exporter_id"))
+	require.Equal(t, []string{`$.request.headers["Authorization"]`},
+		paramValue(t, global, "HARCollector", "obfuscate_exclusions"))
+}
+
+func TestConvertReport(t *testing.T) {
+	result := Convert(loadTestPolicies(t))
+
+	reported := map[string]string{}
+	for _, entry := range result.Report() {
+		reported[entry.Policy] = entry.Scope
+	}
+	require.Equal(t, map[string]string{
+		"fixed":          "POST api.example.com/orders",
+		"disabled cache": "POST api.example.com/orders",
+		"limit orders":   "POST api.example.com/orders",
+		"prometheus":     "global",
+	}, reported)
+}
+
+func loadTestPolicies(t *testing.T) *sharedConfig.PoliciesConfig {
+	policies := &sharedConfig.PoliciesConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(testPolicies), policies))
+	return policies
+}
+
+func paramValue(t *testing.T, flow *flowFile, processor, key string) any {
+	for _, spec := range flow.Processors {
+		if spec.Processor != processor {
+			continue
+		}
+		for _, parameter := range spec.Parameters {
+			if parameter.Key == key {
+				return parameter.Value
+			}
+		}
+	}
+	require.Failf(t, "parameter not found", "%s.%s", processor, key)
+	return nil
+}
@@ -0,0 +1,108 @@
+package migration
+
+import (
+	"fmt"
+)
+
+const (
+	globalStreamName = "globalStream"
+	streamStart      = "start"
+	streamEnd        = "end"
+)
+
+// flowBuilder places processors one after the other on the request and on the response
+type flowBuilder struct {
+	flow     *flowFile
+	request  *chain
+	response *chain
+}
+
+// chain holds the connections of one side of the flow
+type chain struct {
+	connections []*connection
+	// open holds the outputs which are waiting to be connected to the next processor
+	open []*endpoint
+}
+
+func newFlowBuilder(name string, flowFilter *filter) *flowBuilder {
+	return &flowBuilder{
+		flow: &flowFile{
+			Name:       name,
+			Filter:     flowFilter,
+			Processors: map[string]*processorSpec{},
+		},
+		request:  newChain(),
+		response: newChain(),
+	}
+}
+
+// addProcessor adds the processor to the flow and returns its key
+func (b *flowBuilder) addProcessor(processor string, params ...*parameterSpec) string {
+	key := fmt.Sprintf("%s_%s", processor, b.flow.Name)
+	for index := 2; b.flow.Processors[key] != nil; index++ {
+		key = fmt.Sprintf("%s%d_%s", processor, index, b.flow.Name)
+	}
+	b.flow.Processors[key] = &processorSpec{Processor: processor, Parameters: params}
+	return key
+}
+
+func (b *flowBuilder) isEmpty() bool {
+	return len(b.flow.Processors) == 0
+}
+
+// build connects the open outputs of both sides to the end of the global stream
+func (b *flowBuilder) build() *flowFile {
+	b.flow.Flow.Request = b.request.end()
+	b.flow.Flow.Response = b.response.end()
+	return b.flow
+}
+
+func newChain() *chain {
+	return &chain{open: []*endpoint{streamEndpoint(streamStart)}}
+}
+
+// then connects the open outputs to the processor.
+// The chain continues from the given conditions of the processor, or from its single output.
+func (c *chain) then(key string, conditions ...string) {
+	c.connectOpen(processorEndpoint(key, ""))
+	c.open = nil
+	if len(conditions) == 0 {
+		c.open = append(c.open, processorEndpoint(key, ""))
+	}
+	for _, condition := range conditions {
+		c.open = append(c.open, processorEndpoint(key, condition))
+	}
+}
+
+// continueFrom adds an output to the ones waiting for the next processor
+func (c *chain) continueFrom(from *endpoint) {
+	c.open = append(c.open, from)
+}
+
+func (c *chain) connect(from, to *endpoint) {
+	c.connections = append(c.connections, &connection{From: from, To: to})
+}
+
+func (c *chain) connectOpen(to *endpoint) {
+	for _, from := range c.open {
+		c.connect(from, to)
+	}
+}
+
+func (c *chain) end() []*connection {
+	c.connectOpen(streamEndpoint(streamEnd))
+	c.open = nil
+	return c.connections
+}
+
+func streamEndpoint(at string) *endpoint {
+	return &endpoint{Stream: &streamRef{Name: globalStreamName, At: at}}
+}
+
+func processorEndpoint(key, condition string) *endpoint {
+	return &endpoint{Processor: &processorRef{Name: key, Condition: condition}}
+}
+
+func param(key string, value any) *parameterSpec {
+	return &parameterSpec{Key: key, Value: value}
+}
@@ -0,0 +1,109 @@
+package migration
+
+import (
+	pathparamsresource "lunar/engine/streams/resources/path_params"
+	quotaresource "lunar/engine/streams/resources/quota"
+	"lunar/engine/utils/environment"
+)
+
+// The flow and quota types below mirror the YAML read by the streams engine.
+// The engine types carry runtime state and parsed parameters,
+// so they can't be marshaled back into a loadable file.
+
+type flowFile struct {
+	Name       string                    `yaml:"name"`
+	Filter     *filter                   `yaml:"filter"`
+	Processors map[string]*processorSpec `yaml:"processors"`
+	Flow       flowConnections           `yaml:"flow"`
+}
+
+type filter struct {
+	URL     string          `yaml:"url"`
+	Method  []string        `yaml:"method,omitempty"`
+	Headers []*headerFilter `yaml:"headers,omitempty"`
+}
+
+type headerFilter struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+type processorSpec struct {
+	Processor  string           `yaml:"processor"`
+	Parameters []*parameterSpec `yaml:"parameters,omitempty"`
+}
+
+type parameterSpec struct {
+	Key   string `yaml:"key"`
+	Value any    `yaml:"value"`
+}
+
+type flowConnections struct {
+	Request  []*connection `yaml:"request"`
+	Response []*connection `yaml:"response"`
+}
+
+type connection struct {
+	From *endpoint `yaml:"from"`
+	To   *endpoint `yaml:"to"`
+}
+
+type endpoint struct {
+	Stream    *streamRef    `yaml:"stream,omitempty"`
+	Processor *processorRef `yaml:"processor,omitempty"`
+}
+
+type streamRef struct {
+	Name string `yaml:"name"`
+	At   string `yaml:"at"`
+}
+
+type processorRef struct {
+	Name      string `yaml:"name"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
+type quotaFile struct {
+	Quotas         []*quotaSpec      `yaml:"quotas"`
+	InternalLimits []*childQuotaSpec `yaml:"internal_limits,omitempty"`
+}
+
+type quotaSpec struct {
+	ID       string        `yaml:"id"`
+	Filter   *filter       `yaml:"filter"`
+	Strategy *strategySpec `yaml:"strategy"`
+}
+
+type strategySpec struct {
+	FixedWindow          *quotaresource.QuotaLimit `yaml:"fixed_window,omitempty"`
+	AllocationPercentage int64                     `yaml:"allocation_percentage,omitempty"`
+}
+
+type childQuotaSpec struct {
+	quotaSpec `yaml:",inline"`
+	ParentID  string `yaml:"parent_id"`
+}
+
+type gatewayConfig struct {
+	Exporters map[string]environment.Exporter `yaml:"exporters,omitempty"`
+}
+
+type pathParamsFile = pathparamsresource.PathParamsRaw
+
+// ReportEntry describes a part of the policies which was not translated,
+// or was translated with a different behavior
+type ReportEntry struct {
+	// Scope is the endpoint of the policy, e.g. "GET api.example.com/orders", or "global"
+	Scope  string `yaml:"scope"            json:"scope"`
+	Policy string `yaml:"policy,omitempty" json:"policy,omitempty"`
+	Reason string `yaml:"reason"           json:"reason"`
+}
+
+// Result holds the files generated from the policies, keyed by their file name
+type Result struct {
+	flows         map[string]*flowFile
+	quotas        map[string]*quotaFile
+	pathParams    *pathParamsFile
+	gatewayConfig *gatewayConfig
+	report        []ReportEntry
+}
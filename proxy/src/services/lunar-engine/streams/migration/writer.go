@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"fmt"
+	"lunar/engine/streams/validation"
+	"lunar/engine/utils/environment"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ReportFileName     = "migration_report.yaml"
+	pathParamsFileName = "path_params.yaml"
+)
+
+type reportFile struct {
+	Untranslated []ReportEntry `yaml:"untranslated"`
+}
+
+// Report lists the policies which were not translated
+func (r *Result) Report() []ReportEntry {
+	return r.report
+}
+
+// Write stores the generated configuration in the layout of the gateway config root:
+// flows/, quotas/, path_params/ and gateway_config.yaml, along with the migration report
+func (r *Result) Write(root string) error {
+	for name, flow := range r.flows {
+		if err := writeYAML(environment.GetCustomFlowsDirectory(root), name+".yaml", flow); err != nil {
+			return err
+		}
+	}
+
+	for name, quotas := range r.quotas {
+		if err := writeYAML(environment.GetCustomQuotasDirectory(root), name+".yaml", quotas); err != nil {
+			return err
+		}
+	}
+
+	if len(r.pathParams.PathParams) > 0 {
+		err := writeYAML(environment.GetCustomPathParamsDirectory(root), pathParamsFileName, r.pathParams)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(r.gatewayConfig.Exporters) > 0 {
+		gatewayConfigPath := environment.GetCustomGatewayConfigPath(root)
+		err := writeYAML(filepath.Dir(gatewayConfigPath), filepath.Base(gatewayConfigPath), r.gatewayConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeYAML(root, ReportFileName, &reportFile{Untranslated: r.report})
+}
+
+// Validate runs the flows validation on the configuration written to root
+func Validate(root string) error {
+	if err := validation.NewValidator().WithValidationDir(root).Validate(); err != nil {
+		return fmt.Errorf("migrated configuration is invalid: %w", err)
+	}
+	return nil
+}
+
+func writeYAML(dir, fileName string, data any) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	content, err := yaml.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", fileName, err)
+	}
+
+	filePath := filepath.Join(dir, fileName)
+	if err := os.WriteFile(filePath, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filePath, err)
+	}
+	log.Debug().Msgf("Migration file %s written", filePath)
+	return nil
+}
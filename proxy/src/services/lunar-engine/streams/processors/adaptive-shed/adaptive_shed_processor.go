@@ -0,0 +1,329 @@
+package adaptiveshed
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/saturation"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/haproxy"
+	"lunar/toolkit-core/otel"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	minRemainingConnectionsParam = "min_remaining_connections"
+	maxProcessingLatencyMsParam  = "max_processing_latency_ms"
+	maxQueueDepthParam           = "max_queue_depth"
+	recoveryMarginPercentParam   = "recovery_margin_percent"
+	evaluationIntervalMsParam    = "evaluation_interval_ms"
+	minShedDurationSecParam      = "min_shed_duration_sec"
+	priorityGroupByHeaderParam   = "priority_group_by_header"
+	priorityGroupsParam          = "priority_groups"
+	priorityHeaderParam          = "priority_header"
+	defaultPriorityParam         = "default_priority"
+	statusParam                  = "status"
+	bodyParam                    = "body"
+	retryAfterSecParam           = "retry_after_sec"
+
+	defaultRecoveryMarginPercent = 20
+	defaultEvaluationInterval    = time.Second
+	defaultMinShedDuration       = 5 * time.Second
+	defaultStatus                = 503
+	defaultRetryAfterSec         = 1
+	defaultBody                  = `{"error": "the gateway is overloaded, please retry later"}`
+
+	shedConditionName     = "shed"
+	admittedConditionName = "admitted"
+
+	shedCountMetric = "lunar_adaptive_shed_processor_shed_count"
+)
+
+type adaptiveShedProcessor struct {
+	name                  string
+	shedder               *shedder
+	priorityGroupByHeader string
+	priorityGroups        map[string]int64
+	priorityHeader        string
+	defaultPriority       int64
+	status                int
+	body                  string
+	retryAfterSec         int
+
+	haproxyStats *haproxy.Stats
+	metaData     *streamtypes.ProcessorMetaData
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &adaptiveShedProcessor{
+		name:           metaData.Name,
+		metaData:       metaData,
+		priorityGroups: make(map[string]int64),
+		labelManager:   lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *adaptiveShedProcessor) GetName() string {
+	return p.name
+}
+
+func (p *adaptiveShedProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{}
+}
+
+func (p *adaptiveShedProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != public_types.StreamTypeRequest {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	priority := p.extractPriority(apiStream.GetRequest())
+	if !p.shedder.shouldShed(priority, context_manager.Get().GetClock().Now()) {
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeRequest,
+			ReqAction: &actions.NoOpAction{},
+			Name:      admittedConditionName,
+		}, nil
+	}
+
+	log.Trace().Msgf("%s: shedding request %s with priority %d", p.name, apiStream.GetID(), priority)
+	p.updateMetrics(flowName, apiStream, priority)
+	return streamtypes.ProcessorIO{
+		Type: public_types.StreamTypeResponse,
+		ReqAction: &actions.EarlyResponseAction{
+			Status: p.status,
+			Body:   p.body,
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+				"Retry-After":  strconv.Itoa(p.retryAfterSec),
+			},
+		},
+		Name: shedConditionName,
+	}, nil
+}
+
+func (p *adaptiveShedProcessor) init() error {
+	limits := thresholds{}
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		minRemainingConnectionsParam,
+		&limits.minRemainingConnections); err != nil {
+		log.Trace().Msgf("%s not defined for %v", minRemainingConnectionsParam, p.name)
+	}
+
+	var maxLatencyMs int
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		maxProcessingLatencyMsParam,
+		&maxLatencyMs); err != nil {
+		log.Trace().Msgf("%s not defined for %v", maxProcessingLatencyMsParam, p.name)
+	}
+	limits.maxProcessingLatency = time.Duration(maxLatencyMs) * time.Millisecond
+
+	if err := utils.ExtractInt64Param(p.metaData.Parameters,
+		maxQueueDepthParam,
+		&limits.maxQueueDepth); err != nil {
+		log.Trace().Msgf("%s not defined for %v", maxQueueDepthParam, p.name)
+	}
+
+	if limits.minRemainingConnections <= 0 && limits.maxProcessingLatency <= 0 && limits.maxQueueDepth <= 0 {
+		return fmt.Errorf("%s: one of %s, %s or %s is required", p.name,
+			minRemainingConnectionsParam, maxProcessingLatencyMsParam, maxQueueDepthParam)
+	}
+
+	recoveryMarginPercent := defaultRecoveryMarginPercent
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		recoveryMarginPercentParam,
+		&recoveryMarginPercent); err != nil {
+		log.Trace().Msgf("%s not defined for %v", recoveryMarginPercentParam, p.name)
+	}
+	if recoveryMarginPercent < 0 || recoveryMarginPercent >= 100 {
+		return fmt.Errorf("%s must be between 0 and 99", recoveryMarginPercentParam)
+	}
+	limits.recoveryMargin = float64(recoveryMarginPercent) / 100
+
+	interval := defaultEvaluationInterval
+	var intervalMs int
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		evaluationIntervalMsParam,
+		&intervalMs); err == nil && intervalMs > 0 {
+		interval = time.Duration(intervalMs) * time.Millisecond
+	}
+
+	minHold := defaultMinShedDuration
+	if err := utils.ExtractDurationInSecParam(p.metaData.Parameters,
+		minShedDurationSecParam,
+		&minHold); err != nil {
+		log.Trace().Msgf("%s not defined for %v", minShedDurationSecParam, p.name)
+	}
+
+	p.priorityGroupByHeader = lunar_metrics.HeaderConsumerTag
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		priorityGroupByHeaderParam,
+		&p.priorityGroupByHeader); err != nil {
+		log.Trace().Msgf("%s not defined for %v", priorityGroupByHeaderParam, p.name)
+	}
+
+	if err := utils.ExtractMapOfInt64Param(p.metaData.Parameters,
+		priorityGroupsParam,
+		p.priorityGroups); err != nil {
+		log.Trace().Msgf("%s not defined for %v", priorityGroupsParam, p.name)
+	}
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		priorityHeaderParam,
+		&p.priorityHeader); err != nil {
+		log.Trace().Msgf("%s not defined for %v", priorityHeaderParam, p.name)
+	}
+
+	// traffic outside the priority groups has the lowest priority by default
+	priorities := make([]int64, 0, len(p.priorityGroups)+1)
+	for _, priority := range p.priorityGroups {
+		priorities = append(priorities, priority)
+		p.defaultPriority = max(p.defaultPriority, priority+1)
+	}
+	if err := utils.ExtractInt64Param(p.metaData.Parameters,
+		defaultPriorityParam,
+		&p.defaultPriority); err != nil {
+		log.Trace().Msgf("%s not defined for %v", defaultPriorityParam, p.name)
+	}
+	priorities = append(priorities, p.defaultPriority)
+
+	p.status = defaultStatus
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		statusParam,
+		&p.status); err != nil {
+		log.Trace().Msgf("%s not defined for %v", statusParam, p.name)
+	}
+
+	p.body = defaultBody
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		bodyParam,
+		&p.body); err != nil {
+		log.Trace().Msgf("%s not defined for %v", bodyParam, p.name)
+	}
+
+	p.retryAfterSec = defaultRetryAfterSec
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		retryAfterSecParam,
+		&p.retryAfterSec); err != nil {
+		log.Trace().Msgf("%s not defined for %v", retryAfterSecParam, p.name)
+	}
+
+	if limits.minRemainingConnections > 0 {
+		stats, err := haproxy.NewHAProxyStatsClient(lunar_metrics.HAProxySocketPath)
+		if err != nil {
+			return fmt.Errorf("%s: failed to create HAProxy stats client: %w", p.name, err)
+		}
+		p.haproxyStats = stats
+	}
+
+	p.shedder = newShedder(limits, interval, minHold, priorities, p.readSignals)
+	return nil
+}
+
+// readSignals samples the gateway load, it runs once per evaluation interval
+func (p *adaptiveShedProcessor) readSignals() signals {
+	sample := signals{
+		processingLatency: saturation.ProcessingLatency(),
+		queueDepth:        saturation.QueueDepth(),
+	}
+	if p.haproxyStats == nil {
+		return sample
+	}
+
+	remaining, err := p.haproxyStats.QueryRemainingConnections()
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s: failed to query remaining connections", p.name)
+		return sample
+	}
+	sample.remainingConnections = remaining
+	sample.hasConnections = true
+	return sample
+}
+
+// extractPriority reads the numeric priority header, then the priority group of the request.
+// Lower numbers are higher priorities.
+func (p *adaptiveShedProcessor) extractPriority(request public_types.TransactionI) int64 {
+	if request == nil {
+		return p.defaultPriority
+	}
+
+	if p.priorityHeader != "" {
+		if raw, found := request.GetHeader(p.priorityHeader); found {
+			if priority, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				return priority
+			}
+		}
+	}
+
+	if group, found := request.GetHeader(p.priorityGroupByHeader); found {
+		if priority, found := p.priorityGroups[group]; found {
+			return priority
+		}
+	}
+	return p.defaultPriority
+}
+
+func (p *adaptiveShedProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(shedCountMetric,
+		metric.WithDescription(fmt.Sprintf("Requests shed by %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize shed count metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *adaptiveShedProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	priority int64,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes, attribute.Int64("priority", priority))
+	attributes, recorded := p.labelManager.LimitCardinality(shedCountMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
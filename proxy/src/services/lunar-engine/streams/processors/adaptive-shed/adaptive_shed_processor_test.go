@@ -0,0 +1,128 @@
+package adaptiveshed
+
+import (
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/utils/saturation"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	context_manager "lunar/toolkit-core/context-manager"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShedderShedsLowestPrioritiesFirst(t *testing.T) {
+	sample := signals{queueDepth: 150}
+	shed := newShedder(
+		thresholds{maxQueueDepth: 100, recoveryMargin: 0.2},
+		time.Second, 5*time.Second,
+		[]int64{1, 2, 3},
+		func() signals { return sample },
+	)
+	now := time.Now()
+
+	// first evaluation: the lowest priority is shed
+	require.True(t, shed.shouldShed(3, now))
+	require.False(t, shed.shouldShed(2, now))
+
+	// still saturated on the next interval: one more level
+	now = now.Add(time.Second)
+	require.True(t, shed.shouldShed(2, now))
+	require.False(t, shed.shouldShed(1, now))
+	require.Equal(t, 2, shed.getLevel())
+
+	// under the threshold but within the recovery margin: the level holds
+	sample = signals{queueDepth: 90}
+	now = now.Add(10 * time.Second)
+	require.True(t, shed.shouldShed(2, now))
+
+	// recovered: one level is restored, the next one only after the min hold
+	sample = signals{queueDepth: 10}
+	now = now.Add(time.Second)
+	require.False(t, shed.shouldShed(2, now))
+	require.True(t, shed.shouldShed(3, now))
+
+	now = now.Add(time.Second)
+	require.True(t, shed.shouldShed(3, now))
+
+	now = now.Add(5 * time.Second)
+	require.False(t, shed.shouldShed(3, now))
+	require.Equal(t, 0, shed.getLevel())
+}
+
+func TestShedderIgnoresMissingConnections(t *testing.T) {
+	sample := signals{hasConnections: false}
+	shed := newShedder(
+		thresholds{minRemainingConnections: 100, recoveryMargin: 0.2},
+		time.Second, time.Second,
+		[]int64{0},
+		func() signals { return sample },
+	)
+	require.False(t, shed.shouldShed(0, time.Now()))
+
+	sample = signals{hasConnections: true, remainingConnections: 20}
+	require.True(t, shed.shouldShed(0, time.Now().Add(time.Second)))
+}
+
+func TestAdaptiveShedProcessor(t *testing.T) {
+	saturation.Reset()
+	t.Cleanup(saturation.Reset)
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("AdaptiveShed", map[string]any{
+		maxQueueDepthParam:  10,
+		priorityGroupsParam: map[string]any{"production": 1, "staging": 2},
+		priorityHeaderParam: "x-priority",
+		retryAfterSecParam:  3,
+	}))
+	require.NoError(t, err)
+
+	procIO, err := proc.Execute("shed-flow", newRequestStream(map[string]string{}))
+	require.NoError(t, err)
+	require.Equal(t, admittedConditionName, procIO.Name)
+
+	saturation.AddQueued(50)
+	mockClock.AdvanceTime(time.Second)
+
+	// traffic outside the groups is the first to go
+	procIO, err = proc.Execute("shed-flow", newRequestStream(map[string]string{}))
+	require.NoError(t, err)
+	require.Equal(t, shedConditionName, procIO.Name)
+	require.Equal(t, &actions.EarlyResponseAction{
+		Status: defaultStatus,
+		Body:   defaultBody,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"Retry-After":  "3",
+		},
+	}, procIO.ReqAction)
+
+	procIO, err = proc.Execute("shed-flow", newRequestStream(map[string]string{
+		lunar_metrics.HeaderConsumerTag: "staging",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, admittedConditionName, procIO.Name)
+
+	// the priority header takes precedence over the group
+	procIO, err = proc.Execute("shed-flow", newRequestStream(map[string]string{
+		lunar_metrics.HeaderConsumerTag: "production",
+		"x-priority":                    "7",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, shedConditionName, procIO.Name)
+}
+
+func TestAdaptiveShedRequiresAThreshold(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("AdaptiveShed", map[string]any{
+		priorityGroupsParam: map[string]any{"production": 1},
+	}))
+	require.Error(t, err)
+}
+
+func newRequestStream(headers map[string]string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStream("https://api.example.com/items", headers, map[string]string{}, "", "")
+}
@@ -0,0 +1,138 @@
+package adaptiveshed
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// signals is a sample of the gateway load
+type signals struct {
+	remainingConnections int
+	// hasConnections is false when HAProxy could not be queried
+	hasConnections    bool
+	processingLatency time.Duration
+	queueDepth        int64
+}
+
+// thresholds mark the gateway as saturated, a zero value disables the signal
+type thresholds struct {
+	minRemainingConnections int
+	maxProcessingLatency    time.Duration
+	maxQueueDepth           int64
+	// recoveryMargin is the fraction by which every signal must be back under its threshold
+	// before the shedding is reduced, so the level doesn't flap around the threshold
+	recoveryMargin float64
+}
+
+func (t *thresholds) isSaturated(s signals) bool {
+	return (t.minRemainingConnections > 0 && s.hasConnections &&
+		s.remainingConnections < t.minRemainingConnections) ||
+		(t.maxProcessingLatency > 0 && s.processingLatency > t.maxProcessingLatency) ||
+		(t.maxQueueDepth > 0 && s.queueDepth > t.maxQueueDepth)
+}
+
+func (t *thresholds) isRecovered(s signals) bool {
+	if t.minRemainingConnections > 0 && s.hasConnections &&
+		float64(s.remainingConnections) < float64(t.minRemainingConnections)*(1+t.recoveryMargin) {
+		return false
+	}
+	if t.maxProcessingLatency > 0 &&
+		float64(s.processingLatency) > float64(t.maxProcessingLatency)*(1-t.recoveryMargin) {
+		return false
+	}
+	if t.maxQueueDepth > 0 &&
+		float64(s.queueDepth) > float64(t.maxQueueDepth)*(1-t.recoveryMargin) {
+		return false
+	}
+	return true
+}
+
+// shedder raises the shed level by one priority every evaluation while the gateway is saturated,
+// and lowers it by one once the gateway has recovered and the level was held for minHold.
+// At level N, the N lowest priorities are shed.
+type shedder struct {
+	thresholds
+	interval    time.Duration
+	minHold     time.Duration
+	readSignals func() signals
+	// prioritiesDesc holds the known priorities, from the lowest priority (highest number)
+	prioritiesDesc []int64
+
+	mu             sync.Mutex
+	level          int
+	lastEvaluation time.Time
+	lastChange     time.Time
+}
+
+func newShedder(
+	limits thresholds,
+	interval, minHold time.Duration,
+	priorities []int64,
+	readSignals func() signals,
+) *shedder {
+	unique := map[int64]struct{}{}
+	prioritiesDesc := []int64{}
+	for _, priority := range priorities {
+		if _, found := unique[priority]; !found {
+			unique[priority] = struct{}{}
+			prioritiesDesc = append(prioritiesDesc, priority)
+		}
+	}
+	sort.Slice(prioritiesDesc, func(i, j int) bool { return prioritiesDesc[i] > prioritiesDesc[j] })
+
+	return &shedder{
+		thresholds:     limits,
+		interval:       interval,
+		minHold:        minHold,
+		readSignals:    readSignals,
+		prioritiesDesc: prioritiesDesc,
+	}
+}
+
+// shouldShed evaluates the load when the interval has passed,
+// and tells whether a request of the given priority is shed at the current level
+func (s *shedder) shouldShed(priority int64, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastEvaluation) >= s.interval {
+		s.lastEvaluation = now
+		s.evaluate(now)
+	}
+
+	if s.level == 0 {
+		return false
+	}
+	return priority >= s.prioritiesDesc[s.level-1]
+}
+
+func (s *shedder) evaluate(now time.Time) {
+	sample := s.readSignals()
+	switch {
+	case s.isSaturated(sample):
+		if s.level < len(s.prioritiesDesc) {
+			s.level++
+			s.lastChange = now
+			log.Warn().Msgf("Gateway saturated (%+v), shedding priorities >= %d",
+				sample, s.prioritiesDesc[s.level-1])
+		}
+	case s.level > 0 && s.isRecovered(sample) && now.Sub(s.lastChange) >= s.minHold:
+		s.level--
+		s.lastChange = now
+		if s.level == 0 {
+			log.Info().Msgf("Gateway recovered (%+v), shedding stopped", sample)
+		} else {
+			log.Info().Msgf("Gateway recovering (%+v), shedding priorities >= %d",
+				sample, s.prioritiesDesc[s.level-1])
+		}
+	}
+}
+
+func (s *shedder) getLevel() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.level
+}
@@ -4,29 +4,100 @@ package processorasyncqueue
 
 import (
 	"fmt"
+	"lunar/engine/actions"
+	"lunar/engine/streams/processors/utils"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
 )
 
-type asyncQueueProcessor struct{}
+const (
+	quotaIDParam               = "quota_id"
+	priorityGroupByHeaderParam = "priority_group_by_header"
+	priorityGroupsParam        = "priority_groups"
+)
+
+// asyncQueueProcessor holds the requests sent by the community async service while the quota is exhausted.
+// A request over the quota is answered with the retry state, so the async service keeps it
+// on its local store and sends it again on its next round. Requests are sent again oldest first,
+// priority groups are not supported. Requests which did not go through the async service are passed as is.
+type asyncQueueProcessor struct {
+	name     string
+	quotaID  string
+	metaData *streamtypes.ProcessorMetaData
+}
 
 func newProcessor(
-	_ *streamtypes.ProcessorMetaData,
+	metaData *streamtypes.ProcessorMetaData,
 ) (streamtypes.ProcessorI, error) {
-	return &asyncQueueProcessor{},
-		fmt.Errorf("async queue processor is not available in the free version")
+	processor := &asyncQueueProcessor{
+		name:     metaData.Name,
+		metaData: metaData,
+	}
+
+	if err := utils.ExtractStrParam(metaData.Parameters, quotaIDParam, &processor.quotaID); err != nil {
+		return nil, err
+	}
+	if _, err := metaData.Resources.GetQuota(processor.quotaID, ""); err != nil {
+		return nil, fmt.Errorf("quota %s not found for processor %s: %w", processor.quotaID, metaData.Name, err)
+	}
+
+	priorityGroups := map[string]string{}
+	_ = utils.ExtractMapOfStringParam(metaData.Parameters, priorityGroupsParam, priorityGroups)
+	if len(priorityGroups) > 0 {
+		log.Warn().Msgf("%s: %s and %s are not supported in the free version, requests are retried oldest first",
+			metaData.Name, priorityGroupsParam, priorityGroupByHeaderParam)
+	}
+
+	return processor, nil
 }
 
 func (p *asyncQueueProcessor) GetName() string {
-	return ""
+	return p.name
 }
 
 func (p *asyncQueueProcessor) Execute(
 	_ string,
 	apiStream publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != publictypes.StreamTypeRequest {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	attempt, isAsync := utils.GetAsyncAttempt(apiStream)
+	if !isAsync {
+		return streamtypes.ProcessorIO{Type: publictypes.StreamTypeRequest}, nil
+	}
+
+	quota, err := p.metaData.Resources.GetQuota(p.quotaID, apiStream.GetID())
+	if err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+	if err = quota.Inc(apiStream); err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+	isAllowed, err := quota.Allowed(apiStream)
+	if err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+	if isAllowed {
+		return streamtypes.ProcessorIO{Type: publictypes.StreamTypeRequest}, nil
+	}
+
+	log.Trace().Msgf("%s: quota %s exhausted on attempt %d, asking the async service to retry",
+		p.name, p.quotaID, attempt)
+	// The request is not sent to the provider, its slot is released for the next ones
+	p.metaData.Resources.OnRequestDrop(apiStream)
 	return streamtypes.ProcessorIO{
-		Type: apiStream.GetType(),
+		Type: publictypes.StreamTypeRequest,
+		ShortCircuit: &streamtypes.ShortCircuit{
+			ReqAction: &actions.EarlyResponseAction{
+				Status:  http.StatusAccepted,
+				Headers: map[string]string{utils.AsyncStateHeaderName: utils.AsyncStateRetry},
+			},
+		},
 	}, nil
 }
 
@@ -0,0 +1,85 @@
+//go:build !pro
+
+package processorasyncqueue
+
+import (
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	stream_config "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/streams/resources"
+	quota_resource "lunar/engine/streams/resources/quota"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncQueueAsksTheAsyncServiceToRetryOverQuota(t *testing.T) {
+	resourceMng, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceMng, err = resourceMng.WithQuotaData([]*quota_resource.QuotaResourceData{{
+		Quotas: []*quota_resource.QuotaConfig{{
+			ID: "async-quota",
+			Filter: &stream_config.Filter{
+				Name: "async-quota",
+				URLs: []string{"api.example.com/*"},
+			},
+			Strategy: &quota_resource.StrategyConfig{
+				FixedWindow: &quota_resource.FixedWindowConfig{
+					QuotaLimit: quota_resource.QuotaLimit{Max: 1, Interval: 1, IntervalUnit: "minute"},
+				},
+			},
+		}},
+	}})
+	require.NoError(t, err)
+
+	proc, err := newProcessor(&streamtypes.ProcessorMetaData{
+		Name:  "async-queue",
+		Clock: context_manager.Get().GetClock(),
+		Parameters: map[string]streamtypes.ProcessorParam{
+			quotaIDParam: {
+				Name:  quotaIDParam,
+				Value: public_types.NewParamValue("async-quota"),
+			},
+		},
+		Resources: resourceMng,
+	})
+	require.NoError(t, err)
+
+	procIO, err := proc.Execute("flow", newAsyncRequestStream("first", "1"))
+	require.NoError(t, err)
+	require.Nil(t, procIO.ShortCircuit)
+
+	procIO, err = proc.Execute("flow", newAsyncRequestStream("second", "1"))
+	require.NoError(t, err)
+	require.NotNil(t, procIO.ShortCircuit)
+	require.Equal(t, &actions.EarlyResponseAction{
+		Status:  http.StatusAccepted,
+		Headers: map[string]string{utils.AsyncStateHeaderName: utils.AsyncStateRetry},
+	}, procIO.ShortCircuit.ReqAction)
+
+	// requests which did not go through the async service are not held
+	procIO, err = proc.Execute("flow", newAsyncRequestStream("direct", ""))
+	require.NoError(t, err)
+	require.Nil(t, procIO.ShortCircuit)
+}
+
+func newAsyncRequestStream(requestID, attempt string) public_types.APIStreamI {
+	headers := map[string]string{}
+	if attempt != "" {
+		headers[strings.ToLower(utils.AsyncAttemptHeaderName)] = attempt
+	}
+	return streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:         requestID,
+		SequenceID: requestID,
+		Method:     http.MethodGet,
+		URL:        "api.example.com/items",
+		Headers:    headers,
+	}, lunar_context.NewMemoryState[[]byte]())
+}
@@ -4,32 +4,77 @@ package processorretry
 
 import (
 	"fmt"
+	"lunar/engine/actions"
+	"lunar/engine/streams/processors/utils"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
 )
 
-type asyncRetryProcessor struct{}
+const attemptsParam = "attempts"
+
+// asyncRetryProcessor asks the community async service to send a failed request again.
+// The async service keeps the request on its local store, and sends it again on its next round
+// when the response carries the retry state. Requests which did not go through the async service
+// are passed as is.
+type asyncRetryProcessor struct {
+	name     string
+	attempts int
+}
 
 func newProcessor(
-	_ *streamtypes.ProcessorMetaData,
+	metaData *streamtypes.ProcessorMetaData,
 ) (streamtypes.ProcessorI, error) {
-	return &asyncRetryProcessor{},
-		fmt.Errorf("async retry processor is not available in the free version")
+	processor := &asyncRetryProcessor{name: metaData.Name}
+	if err := utils.ExtractIntParam(metaData.Parameters, attemptsParam, &processor.attempts); err != nil {
+		return nil, err
+	}
+	if processor.attempts < 1 {
+		return nil, fmt.Errorf("attempts should be greater than 0")
+	}
+	return processor, nil
 }
 
 func (p *asyncRetryProcessor) GetName() string {
-	return ""
+	return p.name
 }
 
 func (p *asyncRetryProcessor) Execute(
 	_ string,
 	apiStream publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != publictypes.StreamTypeResponse {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	attempt, isAsync := utils.GetAsyncAttempt(apiStream)
+	if !isAsync || !isFailedResponse(apiStream.GetResponse().GetStatus()) {
+		return streamtypes.ProcessorIO{Type: publictypes.StreamTypeResponse}, nil
+	}
+
+	if attempt >= p.attempts {
+		log.Trace().Msgf("%s: request failed after %d attempts, will not retry", p.name, attempt)
+		return streamtypes.ProcessorIO{Type: publictypes.StreamTypeResponse}, nil
+	}
+
+	log.Trace().Msgf("%s: request failed on attempt %d, asking the async service to retry", p.name, attempt)
 	return streamtypes.ProcessorIO{
-		Type: apiStream.GetType(),
+		Type: publictypes.StreamTypeResponse,
+		RespAction: &actions.ModifyResponseAction{
+			Status:       http.StatusAccepted,
+			HeadersToSet: map[string]string{utils.AsyncStateHeaderName: utils.AsyncStateRetry},
+		},
 	}, nil
 }
 
 func (p *asyncRetryProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{}
 }
+
+// isFailedResponse returns true for the responses worth retrying later:
+// server errors and rate limited requests
+func isFailedResponse(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
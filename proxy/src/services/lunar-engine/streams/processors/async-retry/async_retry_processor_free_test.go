@@ -0,0 +1,59 @@
+//go:build !pro
+
+package processorretry
+
+import (
+	"lunar/engine/actions"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncRetryAsksTheAsyncServiceToRetry(t *testing.T) {
+	proc, err := newProcessor(&streamtypes.ProcessorMetaData{
+		Name: "async-retry",
+		Parameters: map[string]streamtypes.ProcessorParam{
+			attemptsParam: {
+				Name:  attemptsParam,
+				Value: public_types.NewParamValue(3),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	procIO, err := proc.Execute("flow", newAsyncResponseStream("1", http.StatusServiceUnavailable))
+	require.NoError(t, err)
+	require.Equal(t, &actions.ModifyResponseAction{
+		Status:       http.StatusAccepted,
+		HeadersToSet: map[string]string{utils.AsyncStateHeaderName: utils.AsyncStateRetry},
+	}, procIO.RespAction)
+
+	// the last attempt returns the failed response
+	procIO, err = proc.Execute("flow", newAsyncResponseStream("3", http.StatusServiceUnavailable))
+	require.NoError(t, err)
+	require.Nil(t, procIO.RespAction)
+
+	procIO, err = proc.Execute("flow", newAsyncResponseStream("1", http.StatusOK))
+	require.NoError(t, err)
+	require.Nil(t, procIO.RespAction)
+
+	// requests which did not go through the async service are not retried
+	procIO, err = proc.Execute("flow", newAsyncResponseStream("", http.StatusServiceUnavailable))
+	require.NoError(t, err)
+	require.Nil(t, procIO.RespAction)
+}
+
+func newAsyncResponseStream(attempt string, status int) public_types.APIStreamI {
+	headers := map[string]string{}
+	if attempt != "" {
+		headers[strings.ToLower(utils.AsyncAttemptHeaderName)] = attempt
+	}
+	return test_utils.NewMockAPIStreamFull(public_types.StreamTypeResponse, http.MethodGet,
+		"https://api.example.com/items", headers, nil, "", "", status)
+}
@@ -0,0 +1,66 @@
+package consumeridentity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const sha256Prefix = "sha256:"
+
+// apiKeysFile is the local key file. Keys are never stored in clear text, only their SHA-256 hash:
+//
+//	keys:
+//	  - hash: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	    consumer: acme
+//	    attributes:
+//	      plan: gold
+type apiKeysFile struct {
+	Keys []apiKeyEntry `yaml:"keys"`
+}
+
+type apiKeyEntry struct {
+	Hash       string            `yaml:"hash"`
+	Consumer   string            `yaml:"consumer"`
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// apiKeyStore maps the hex encoded SHA-256 hash of each API key to its consumer
+type apiKeyStore map[string]apiKeyEntry
+
+func loadAPIKeys(keysPath string) (apiKeyStore, error) {
+	// The path is taken from the processor configuration, not from API calls
+	//nolint:gosec
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file %s: %w", keysPath, err)
+	}
+
+	var keysFile apiKeysFile
+	if err := yaml.Unmarshal(data, &keysFile); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file %s: %w", keysPath, err)
+	}
+
+	store := make(apiKeyStore, len(keysFile.Keys))
+	for i, entry := range keysFile.Keys {
+		hash := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(entry.Hash), sha256Prefix))
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("entry %d in %s: hash must be a hex encoded SHA-256 digest", i, keysPath)
+		}
+		if entry.Consumer == "" {
+			return nil, fmt.Errorf("entry %d in %s: consumer is required", i, keysPath)
+		}
+		store[hash] = entry
+	}
+	return store, nil
+}
+
+func (s apiKeyStore) lookup(apiKey string) (apiKeyEntry, bool) {
+	digest := sha256.Sum256([]byte(apiKey))
+	entry, found := s[hex.EncodeToString(digest[:])]
+	return entry, found
+}
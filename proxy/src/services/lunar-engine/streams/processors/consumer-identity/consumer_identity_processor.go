@@ -0,0 +1,448 @@
+package consumeridentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/otel"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	jwtHeaderParam          = "jwt_header"
+	jwtSecretParam          = "jwt_secret"
+	jwtPublicKeyFileParam   = "jwt_public_key_file"
+	jwksFileParam           = "jwks_file"
+	jwtAlgorithmsParam      = "jwt_algorithms"
+	jwtIssuerParam          = "jwt_issuer"
+	jwtAudienceParam        = "jwt_audience"
+	clockSkewSecParam       = "clock_skew_sec"
+	consumerTagClaimParam   = "consumer_tag_claim"
+	attributeClaimsParam    = "attribute_claims"
+	apiKeyHeaderParam       = "api_key_header"
+	apiKeysFileParam        = "api_keys_file"
+	defaultJWTHeader        = "authorization"
+	defaultAPIKeyHeader     = "x-api-key"
+	defaultConsumerTagClaim = "sub"
+	defaultClockSkewSec     = 60
+	bearerPrefix            = "bearer "
+
+	verifiedConditionName = "verified"
+	rejectedConditionName = "rejected"
+
+	// ConsumerTagContextKey holds the verified consumer tag of the transaction
+	ConsumerTagContextKey = "consumer_tag"
+	// ConsumerAttributesContextKey holds the map[string]string of verified consumer attributes
+	ConsumerAttributesContextKey = "consumer_attributes"
+	// RejectionReasonContextKey holds the reason the caller was rejected
+	RejectionReasonContextKey = "consumer_identity_rejection"
+
+	rejectedCountMetric = "lunar_consumer_identity_rejected_count"
+
+	reasonMissingCredentials = "missing_credentials"
+	reasonInvalidToken       = "invalid_token"
+	reasonMissingClaim       = "missing_consumer_claim"
+	reasonUnknownAPIKey      = "unknown_api_key"
+)
+
+// identity is the verified consumer of a transaction
+type identity struct {
+	consumerTag string
+	attributes  map[string]string
+}
+
+type consumerIdentityProcessor struct {
+	name             string
+	jwtHeader        string
+	jwtVerifier      *jwtVerifier
+	consumerTagClaim string
+	attributeClaims  map[string]string
+	apiKeyHeader     string
+	apiKeys          apiKeyStore
+	metaData         *streamtypes.ProcessorMetaData
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &consumerIdentityProcessor{
+		name:             metaData.Name,
+		metaData:         metaData,
+		jwtHeader:        defaultJWTHeader,
+		apiKeyHeader:     defaultAPIKeyHeader,
+		consumerTagClaim: defaultConsumerTagClaim,
+		attributeClaims:  make(map[string]string),
+		labelManager:     lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *consumerIdentityProcessor) GetName() string {
+	return p.name
+}
+
+func (p *consumerIdentityProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired:    false,
+		IsRequestModifier: true,
+	}
+}
+
+func (p *consumerIdentityProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != public_types.StreamTypeRequest {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	request := apiStream.GetRequest()
+	if request == nil {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("request is missing for %s", p.name)
+	}
+
+	consumer, reason, err := p.identify(request)
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s: rejected %s %s (%s)",
+			p.name, apiStream.GetMethod(), apiStream.GetURL(), reason)
+		p.setContext(apiStream, RejectionReasonContextKey, reason)
+		p.updateMetrics(flowName, apiStream, reason)
+
+		// The tag sent by the caller is not trusted, so it is removed and the
+		// transaction is not accounted to the consumer it claims to be
+		if headers := request.GetHeaders(); headers != nil {
+			delete(headers, lunar_metrics.HeaderConsumerTag)
+		}
+
+		return streamtypes.ProcessorIO{
+			Type:       apiStream.GetType(),
+			ReqAction:  &actions.NoOpAction{},
+			RespAction: &actions.NoOpAction{},
+			Name:       rejectedConditionName,
+		}, nil
+	}
+
+	log.Trace().Msgf("%s: verified consumer %s", p.name, consumer.consumerTag)
+	p.setContext(apiStream, ConsumerTagContextKey, consumer.consumerTag)
+	p.setContext(apiStream, ConsumerAttributesContextKey, consumer.attributes)
+
+	// The verified tag replaces whatever the caller sent, so quotas, metrics
+	// and queue priorities down the flow group by the verified consumer
+	if headers := request.GetHeaders(); headers != nil {
+		headers[lunar_metrics.HeaderConsumerTag] = consumer.consumerTag
+	}
+
+	return streamtypes.ProcessorIO{
+		Type: apiStream.GetType(),
+		ReqAction: &actions.ModifyHeadersAction{
+			HeadersToSet: map[string]string{lunar_metrics.HeaderConsumerTag: consumer.consumerTag},
+		},
+		RespAction: &actions.NoOpAction{},
+		Name:       verifiedConditionName,
+	}, nil
+}
+
+// identify verifies the credentials of the request.
+// A bearer token is verified first, when JWT verification is configured.
+func (p *consumerIdentityProcessor) identify(request public_types.TransactionI) (*identity, string, error) {
+	if p.jwtVerifier != nil {
+		if token, found := p.extractToken(request); found {
+			return p.identifyByToken(token)
+		}
+	}
+
+	if p.apiKeys != nil {
+		if apiKey, found := request.GetHeader(p.apiKeyHeader); found && apiKey != "" {
+			entry, found := p.apiKeys.lookup(apiKey)
+			if !found {
+				return nil, reasonUnknownAPIKey, errors.New("API key is not recognized")
+			}
+			return &identity{consumerTag: entry.Consumer, attributes: entry.Attributes}, "", nil
+		}
+	}
+
+	return nil, reasonMissingCredentials, errors.New("no credentials found")
+}
+
+func (p *consumerIdentityProcessor) extractToken(request public_types.TransactionI) (string, bool) {
+	value, found := request.GetHeader(p.jwtHeader)
+	if !found {
+		return "", false
+	}
+	if len(value) >= len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		value = value[len(bearerPrefix):]
+	}
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
+
+func (p *consumerIdentityProcessor) identifyByToken(token string) (*identity, string, error) {
+	claims, err := p.jwtVerifier.verify(token, context_manager.Get().GetClock().Now())
+	if err != nil {
+		return nil, reasonInvalidToken, err
+	}
+
+	consumerTag, found := claimValue(claims, p.consumerTagClaim)
+	if !found || consumerTag == "" {
+		return nil, reasonMissingClaim, fmt.Errorf("claim %s is missing", p.consumerTagClaim)
+	}
+
+	attributes := make(map[string]string, len(p.attributeClaims))
+	for attributeName, claimPath := range p.attributeClaims {
+		if value, found := claimValue(claims, claimPath); found {
+			attributes[attributeName] = value
+		}
+	}
+	return &identity{consumerTag: consumerTag, attributes: attributes}, "", nil
+}
+
+func (p *consumerIdentityProcessor) setContext(apiStream public_types.APIStreamI, key string, value any) {
+	lunarContext := apiStream.GetContext()
+	if lunarContext == nil {
+		return
+	}
+	if err := lunarContext.GetTransactionalContext().Set(key, value); err != nil {
+		log.Trace().Err(err).Msgf("%s: failed to store %s in context", p.name, key)
+	}
+}
+
+func (p *consumerIdentityProcessor) init() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jwtHeaderParam,
+		&p.jwtHeader); err != nil || p.jwtHeader == "" {
+		p.jwtHeader = defaultJWTHeader
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		apiKeyHeaderParam,
+		&p.apiKeyHeader); err != nil || p.apiKeyHeader == "" {
+		p.apiKeyHeader = defaultAPIKeyHeader
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		consumerTagClaimParam,
+		&p.consumerTagClaim); err != nil || p.consumerTagClaim == "" {
+		p.consumerTagClaim = defaultConsumerTagClaim
+	}
+	if err := utils.ExtractMapOfStringParam(p.metaData.Parameters,
+		attributeClaimsParam,
+		p.attributeClaims); err != nil {
+		log.Trace().Msgf("%s not defined for %s", attributeClaimsParam, p.name)
+	}
+
+	if err := p.initJWTVerifier(); err != nil {
+		return err
+	}
+
+	var apiKeysFile string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		apiKeysFileParam,
+		&apiKeysFile); err != nil {
+		log.Trace().Msgf("%s not defined for %s", apiKeysFileParam, p.name)
+	}
+	if apiKeysFile != "" {
+		apiKeys, err := loadAPIKeys(resolveKeyPath(apiKeysFile))
+		if err != nil {
+			return err
+		}
+		p.apiKeys = apiKeys
+	}
+
+	if p.jwtVerifier == nil && p.apiKeys == nil {
+		return fmt.Errorf("one of %s, %s, %s or %s must be defined for %s",
+			jwtSecretParam, jwtPublicKeyFileParam, jwksFileParam, apiKeysFileParam, p.name)
+	}
+	return nil
+}
+
+func (p *consumerIdentityProcessor) initJWTVerifier() error {
+	var secret, publicKeyFile, jwksFile string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jwtSecretParam,
+		&secret); err != nil {
+		log.Trace().Msgf("%s not defined for %s", jwtSecretParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jwtPublicKeyFileParam,
+		&publicKeyFile); err != nil {
+		log.Trace().Msgf("%s not defined for %s", jwtPublicKeyFileParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jwksFileParam,
+		&jwksFile); err != nil {
+		log.Trace().Msgf("%s not defined for %s", jwksFileParam, p.name)
+	}
+
+	var keys []verificationKey
+	if secret != "" {
+		keys = append(keys, verificationKey{key: []byte(secret)})
+	}
+	if publicKeyFile != "" {
+		publicKeys, err := loadPublicKeys(resolveKeyPath(publicKeyFile))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, publicKeys...)
+	}
+	if jwksFile != "" {
+		jwksKeys, err := loadJWKS(resolveKeyPath(jwksFile))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, jwksKeys...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	verifier := &jwtVerifier{
+		keys:       keys,
+		algorithms: make(map[string]struct{}),
+		clockSkew:  defaultClockSkewSec * time.Second,
+	}
+
+	var algorithms []string
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		jwtAlgorithmsParam,
+		&algorithms); err != nil || len(algorithms) == 0 {
+		// only the algorithms which match the configured keys are accepted
+		for _, key := range keys {
+			if key.alg != "" {
+				algorithms = append(algorithms, key.alg)
+				continue
+			}
+			algorithms = append(algorithms, algorithmsForKey(key.key)...)
+		}
+	}
+	for _, algorithm := range algorithms {
+		if !isSupportedAlgorithm(algorithm) {
+			return fmt.Errorf("unsupported JWT algorithm %s for %s", algorithm, p.name)
+		}
+		verifier.algorithms[algorithm] = struct{}{}
+	}
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jwtIssuerParam,
+		&verifier.issuer); err != nil {
+		log.Trace().Msgf("%s not defined for %s", jwtIssuerParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jwtAudienceParam,
+		&verifier.audience); err != nil {
+		log.Trace().Msgf("%s not defined for %s", jwtAudienceParam, p.name)
+	}
+
+	var clockSkewSec int
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		clockSkewSecParam,
+		&clockSkewSec); err == nil && clockSkewSec >= 0 {
+		verifier.clockSkew = time.Duration(clockSkewSec) * time.Second
+	}
+
+	p.jwtVerifier = verifier
+	return nil
+}
+
+func (p *consumerIdentityProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(rejectedCountMetric,
+		metric.WithDescription(fmt.Sprintf("Rejected callers count for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize rejected count metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *consumerIdentityProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	reason string,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes, attribute.String("reason", reason))
+	attributes, recorded := p.labelManager.LimitCardinality(rejectedCountMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
+
+// claimValue returns the claim in the given dot separated path (e.g. org.id) as a string
+func claimValue(claims map[string]any, claimPath string) (string, bool) {
+	var value any = claims
+	for _, part := range strings.Split(claimPath, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[part]; !ok {
+			return "", false
+		}
+	}
+
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, true
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(typedValue), true
+	case []any:
+		items := make([]string, 0, len(typedValue))
+		for _, item := range typedValue {
+			if str, ok := item.(string); ok {
+				items = append(items, str)
+			}
+		}
+		return strings.Join(items, ","), true
+	}
+	return "", false
+}
+
+// resolveKeyPath resolves relative paths against the keys folder of the config directory
+func resolveKeyPath(keyPath string) string {
+	if filepath.IsAbs(keyPath) {
+		return keyPath
+	}
+	return filepath.Join(environment.GetCustomKeysDirectory(environment.GetConfigRootDirectory()), keyPath)
+}
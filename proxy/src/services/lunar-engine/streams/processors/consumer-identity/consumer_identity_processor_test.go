@@ -0,0 +1,279 @@
+package consumeridentity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "top-secret"
+
+func TestConsumerIdentityHMACToken(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		jwtSecretParam:       testSecret,
+		jwtIssuerParam:       "https://auth.example.com",
+		attributeClaimsParam: map[string]string{"plan": "tier", "org": "org.id"},
+	})
+
+	token := signHMAC(t, map[string]any{"alg": "HS256", "typ": "JWT"}, map[string]any{
+		"sub":  "acme",
+		"iss":  "https://auth.example.com",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"tier": "gold",
+		"org":  map[string]any{"id": 42},
+	})
+
+	stream := newRequestStream(map[string]string{
+		"authorization":                 "Bearer " + token,
+		lunar_metrics.HeaderConsumerTag: "spoofed",
+	})
+	procIO, err := proc.Execute("identity-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, verifiedConditionName, procIO.Name)
+	require.Equal(t, &actions.ModifyHeadersAction{
+		HeadersToSet: map[string]string{lunar_metrics.HeaderConsumerTag: "acme"},
+	}, procIO.ReqAction)
+
+	consumerTag, _ := stream.GetHeader(lunar_metrics.HeaderConsumerTag)
+	require.Equal(t, "acme", consumerTag)
+
+	consumer, _, err := proc.(*consumerIdentityProcessor).identify(stream.GetRequest())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"plan": "gold", "org": "42"}, consumer.attributes)
+}
+
+func TestConsumerIdentityRejectsInvalidTokens(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		jwtSecretParam:   testSecret,
+		jwtAudienceParam: "orders",
+	})
+
+	validClaims := map[string]any{"sub": "acme", "aud": []any{"orders"}}
+	tokens := map[string]string{
+		"valid": signHMAC(t, map[string]any{"alg": "HS256"}, validClaims),
+		"expired": signHMAC(t, map[string]any{"alg": "HS256"}, map[string]any{
+			"sub": "acme", "aud": "orders", "exp": time.Now().Add(-time.Hour).Unix(),
+		}),
+		"wrong audience": signHMAC(t, map[string]any{"alg": "HS256"}, map[string]any{
+			"sub": "acme", "aud": "billing",
+		}),
+		"missing subject": signHMAC(t, map[string]any{"alg": "HS256"}, map[string]any{"aud": "orders"}),
+		"unsigned": encodeSegment(t, map[string]any{"alg": "none"}) + "." +
+			encodeSegment(t, validClaims) + ".",
+		"tampered": signHMAC(t, map[string]any{"alg": "HS256"}, validClaims)[:20] + "x.y.z",
+	}
+
+	for name, token := range tokens {
+		procIO, err := proc.Execute("identity-test", newRequestStream(map[string]string{
+			"authorization": "Bearer " + token,
+		}))
+		require.NoError(t, err, name)
+
+		expected := rejectedConditionName
+		if name == "valid" {
+			expected = verifiedConditionName
+		}
+		require.Equal(t, expected, procIO.Name, name)
+	}
+
+	procIO, err := proc.Execute("identity-test", newRequestStream(map[string]string{}))
+	require.NoError(t, err)
+	require.Equal(t, rejectedConditionName, procIO.Name)
+	require.IsType(t, &actions.NoOpAction{}, procIO.ReqAction)
+}
+
+func TestConsumerIdentityRejectedRemovesCallerTag(t *testing.T) {
+	proc := createProcessor(t, map[string]any{jwtSecretParam: testSecret})
+
+	stream := newRequestStream(map[string]string{
+		"authorization":                 "Bearer not-a-token",
+		lunar_metrics.HeaderConsumerTag: "spoofed",
+	})
+	procIO, err := proc.Execute("identity-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, rejectedConditionName, procIO.Name)
+
+	_, found := stream.GetRequest().GetHeader(lunar_metrics.HeaderConsumerTag)
+	require.False(t, found, "the unverified tag of the caller must be removed")
+}
+
+func TestConsumerIdentityRSAPublicKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}), 0o600))
+
+	proc := createProcessor(t, map[string]any{jwtPublicKeyFileParam: keyFile})
+
+	signingInput := encodeSegment(t, map[string]any{"alg": "RS256"}) + "." +
+		encodeSegment(t, map[string]any{"sub": "acme"})
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	procIO, err := proc.Execute("identity-test", newRequestStream(map[string]string{
+		"authorization": "Bearer " + token,
+	}))
+	require.NoError(t, err)
+	require.Equal(t, verifiedConditionName, procIO.Name)
+
+	// an HMAC token signed with the public key must not pass as RS256
+	forged := signWithSecret(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "acme"}, publicKeyDER)
+	procIO, err = proc.Execute("identity-test", newRequestStream(map[string]string{
+		"authorization": "Bearer " + forged,
+	}))
+	require.NoError(t, err)
+	require.Equal(t, rejectedConditionName, procIO.Name)
+}
+
+func TestConsumerIdentityJWKS(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := privateKey.PublicKey.Bytes()
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC",
+		"kid": "key-1",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(publicKey[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(publicKey[33:]),
+	}}})
+	require.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, jwks, 0o600))
+
+	proc := createProcessor(t, map[string]any{jwksFileParam: jwksFile})
+
+	signES256 := func(kid string) string {
+		signingInput := encodeSegment(t, map[string]any{"alg": "ES256", "kid": kid}) + "." +
+			encodeSegment(t, map[string]any{"sub": "acme"})
+		digest := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		require.NoError(t, err)
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	procIO, err := proc.Execute("identity-test", newRequestStream(map[string]string{
+		"authorization": "Bearer " + signES256("key-1"),
+	}))
+	require.NoError(t, err)
+	require.Equal(t, verifiedConditionName, procIO.Name)
+
+	procIO, err = proc.Execute("identity-test", newRequestStream(map[string]string{
+		"authorization": "Bearer " + signES256("unknown-key"),
+	}))
+	require.NoError(t, err)
+	require.Equal(t, rejectedConditionName, procIO.Name)
+}
+
+func TestConsumerIdentityAPIKeys(t *testing.T) {
+	digest := sha256.Sum256([]byte("key-123"))
+	keysFile := filepath.Join(t.TempDir(), "api_keys.yaml")
+	require.NoError(t, os.WriteFile(keysFile, []byte(fmt.Sprintf(`
+keys:
+  - hash: sha256:%s
+    consumer: acme
+    attributes:
+      plan: gold
+`, hex.EncodeToString(digest[:]))), 0o600))
+
+	proc := createProcessor(t, map[string]any{apiKeysFileParam: keysFile})
+
+	stream := newRequestStream(map[string]string{"x-api-key": "key-123"})
+	procIO, err := proc.Execute("identity-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, verifiedConditionName, procIO.Name)
+	consumerTag, _ := stream.GetHeader(lunar_metrics.HeaderConsumerTag)
+	require.Equal(t, "acme", consumerTag)
+
+	consumer, _, err := proc.(*consumerIdentityProcessor).identify(stream.GetRequest())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"plan": "gold"}, consumer.attributes)
+
+	_, reason, err := proc.(*consumerIdentityProcessor).identify(
+		newRequestStream(map[string]string{"x-api-key": "key-456"}).GetRequest())
+	require.Error(t, err)
+	require.Equal(t, reasonUnknownAPIKey, reason)
+}
+
+func TestConsumerIdentityInvalidConfig(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("ConsumerIdentity", map[string]any{}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("ConsumerIdentity", map[string]any{
+		jwtSecretParam:     testSecret,
+		jwtAlgorithmsParam: []string{"none"},
+	}))
+	require.Error(t, err)
+
+	keysFile := filepath.Join(t.TempDir(), "api_keys.yaml")
+	require.NoError(t, os.WriteFile(keysFile, []byte("keys:\n  - hash: plain-text\n    consumer: acme\n"), 0o600))
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("ConsumerIdentity", map[string]any{
+		apiKeysFileParam: keysFile,
+	}))
+	require.Error(t, err)
+}
+
+func signHMAC(t *testing.T, header, claims map[string]any) string {
+	return signWithSecret(t, header, claims, []byte(testSecret))
+}
+
+func signWithSecret(t *testing.T, header, claims map[string]any, secret []byte) string {
+	signingInput := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeSegment(t *testing.T, value map[string]any) string {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newRequestStream(headers map[string]string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStream(
+		"https://api.example.com/orders",
+		headers,
+		map[string]string{},
+		"",
+		"",
+	)
+}
+
+func createProcessor(t *testing.T, params map[string]any) streamtypes.ProcessorI {
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("ConsumerIdentity", params))
+	require.NoError(t, err)
+	return proc
+}
@@ -0,0 +1,392 @@
+package consumeridentity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	familyHMAC  = "HS"
+	familyRSA   = "RS"
+	familyECDSA = "ES"
+)
+
+var (
+	errMalformedToken   = errors.New("malformed token")
+	errInvalidSignature = errors.New("invalid signature")
+	errTokenExpired     = errors.New("token expired")
+	errTokenNotYetValid = errors.New("token not valid yet")
+)
+
+// verificationKey is a key which JWT signatures are verified with.
+// The key is []byte for HMAC, *rsa.PublicKey for RSA and *ecdsa.PublicKey for ECDSA.
+type verificationKey struct {
+	kid string
+	alg string
+	key any
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtVerifier struct {
+	keys       []verificationKey
+	algorithms map[string]struct{}
+	issuer     string
+	audience   string
+	clockSkew  time.Duration
+}
+
+// verify checks the token signature and registered claims, and returns the token claims
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedToken, err)
+	}
+	if _, allowed := v.algorithms[header.Alg]; !allowed {
+		return nil, fmt.Errorf("algorithm %q is not allowed", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedToken, err)
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	if !v.verifySignature(header, signingInput, signature) {
+		return nil, errInvalidSignature
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedToken, err)
+	}
+	if err := v.validateClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *jwtVerifier) verifySignature(header jwtHeader, signingInput, signature []byte) bool {
+	for _, key := range v.keys {
+		if header.Kid != "" && key.kid != "" && header.Kid != key.kid {
+			continue
+		}
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verifyWithKey(header.Alg, key.key, signingInput, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *jwtVerifier) validateClaims(claims map[string]any, now time.Time) error {
+	if exp, found := numericClaim(claims, "exp"); found && now.After(exp.Add(v.clockSkew)) {
+		return errTokenExpired
+	}
+	if nbf, found := numericClaim(claims, "nbf"); found && now.Add(v.clockSkew).Before(nbf) {
+		return errTokenNotYetValid
+	}
+
+	if v.issuer != "" {
+		if issuer, _ := claims["iss"].(string); issuer != v.issuer {
+			return fmt.Errorf("unexpected issuer %q", issuer)
+		}
+	}
+
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return fmt.Errorf("token is not intended for audience %q", v.audience)
+	}
+	return nil
+}
+
+func verifyWithKey(alg string, key any, signingInput, signature []byte) bool {
+	if !isSupportedAlgorithm(alg) {
+		return false
+	}
+	hash := hashByBits[alg[2:]]
+
+	switch alg[:2] {
+	case familyHMAC:
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signingInput)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case familyRSA:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(publicKey, hash, digest(hash, signingInput), signature) == nil
+	case familyECDSA:
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != curveByAlg[alg] {
+			return false
+		}
+		// ECDSA signatures are the fixed size concatenation of r and s
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(publicKey, digest(hash, signingInput), r, s)
+	}
+	return false
+}
+
+var hashByBits = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+var curveByAlg = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+func isSupportedAlgorithm(alg string) bool {
+	if len(alg) != 5 {
+		return false
+	}
+	if _, found := hashByBits[alg[2:]]; !found {
+		return false
+	}
+	switch alg[:2] {
+	case familyHMAC, familyRSA, familyECDSA:
+		return true
+	}
+	return false
+}
+
+// algorithmsForKey returns the algorithms which can be verified with the key type
+func algorithmsForKey(key any) []string {
+	switch typedKey := key.(type) {
+	case []byte:
+		return []string{"HS256", "HS384", "HS512"}
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512"}
+	case *ecdsa.PublicKey:
+		for alg, curve := range curveByAlg {
+			if typedKey.Curve == curve {
+				return []string{alg}
+			}
+		}
+	}
+	return nil
+}
+
+func digest(hash crypto.Hash, data []byte) []byte {
+	hasher := hash.New()
+	hasher.Write(data)
+	return hasher.Sum(nil)
+}
+
+func decodeSegment(segment string, target any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+func hasAudience(claim any, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []any:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadPublicKeys reads the RSA and ECDSA public keys (or certificates) of a PEM file
+func loadPublicKeys(keyPath string) ([]verificationKey, error) {
+	// The path is taken from the processor configuration, not from API calls
+	//nolint:gosec
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file %s: %w", keyPath, err)
+	}
+
+	var keys []verificationKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var publicKey any
+		switch block.Type {
+		case "PUBLIC KEY":
+			publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var certificate *x509.Certificate
+			if certificate, err = x509.ParseCertificate(block.Bytes); err == nil {
+				publicKey = certificate.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s in %s: %w", block.Type, keyPath, err)
+		}
+
+		switch publicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, verificationKey{key: publicKey})
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T in %s", publicKey, keyPath)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", keyPath)
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJWKS reads the signing keys of a JSON Web Key Set file
+func loadJWKS(jwksPath string) ([]verificationKey, error) {
+	// The path is taken from the processor configuration, not from API calls
+	//nolint:gosec
+	data, err := os.ReadFile(jwksPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file %s: %w", jwksPath, err)
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file %s: %w", jwksPath, err)
+	}
+
+	keys := make([]verificationKey, 0, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in %s: %w", jwk.Kid, jwksPath, err)
+		}
+		keys = append(keys, verificationKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", jwksPath)
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		publicExponent := new(big.Int).SetBytes(exponent)
+		if len(modulus) == 0 || !publicExponent.IsInt64() || publicExponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(publicExponent.Int64()),
+		}, nil
+	case "EC":
+		curve, found := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}[jwk.Crv]
+		if !found {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("invalid EC key coordinates")
+		}
+		// uncompressed point encoding: 0x04 || x || y
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid symmetric key")
+		}
+		return secret, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
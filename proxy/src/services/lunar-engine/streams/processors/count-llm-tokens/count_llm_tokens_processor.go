@@ -175,6 +175,10 @@ func (p *countLLMTokensProcessor) updateMetrics(
 	if p.encoding != "" {
 		attributes = append(attributes, attribute.String("encoding", p.encoding))
 	}
+	attributes, recorded := p.labelManager.LimitCardinality(tokenCountMetric, attributes)
+	if !recorded {
+		return
+	}
 
 	p.metricObject.Add(context.Background(), tokenCount, metric.WithAttributes(attributes...))
 
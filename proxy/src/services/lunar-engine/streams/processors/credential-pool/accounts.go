@@ -0,0 +1,135 @@
+package credentialpool
+
+import (
+	"encoding/json"
+	"fmt"
+	"lunar/engine/streams/processors/utils"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accountHeadersKey = "headers"
+	accountBodyKey    = "body"
+	accountWeightKey  = "weight"
+	accountQuotaIDKey = "quota_id"
+)
+
+// account is one set of provider credentials in the pool
+type account struct {
+	index   int
+	name    string
+	headers map[string]string
+	// body holds JSON body fields, keyed by a dotted path
+	body    map[string]any
+	weight  int
+	quotaID string
+}
+
+// parseAccounts reads the accounts parameter, e.g.
+//
+//	account-a:
+//	  headers: {Authorization: "Bearer $ACCOUNT_A_KEY"}
+//	  weight: 2
+//	  quota_id: account-a-quota
+//	account-b:
+//	  body: {api_key: "$ACCOUNT_B_KEY"}
+func parseAccounts(raw map[string]any) ([]*account, error) {
+	accounts := make([]*account, 0, len(raw))
+	for name, rawAccount := range raw {
+		definition, isMap := rawAccount.(map[string]any)
+		if !isMap {
+			return nil, fmt.Errorf("account %s must be a map", name)
+		}
+
+		acc := &account{name: name, headers: map[string]string{}, body: map[string]any{}, weight: 1}
+		for key, value := range definition {
+			switch key {
+			case accountHeadersKey:
+				headers, isMap := value.(map[string]any)
+				if !isMap {
+					return nil, fmt.Errorf("%s of account %s must be a map", key, name)
+				}
+				for header, headerValue := range headers {
+					acc.headers[strings.ToLower(header)] = utils.ResolveEnvValue(fmt.Sprint(headerValue))
+				}
+			case accountBodyKey:
+				fields, isMap := value.(map[string]any)
+				if !isMap {
+					return nil, fmt.Errorf("%s of account %s must be a map", key, name)
+				}
+				for field, fieldValue := range fields {
+					if str, isString := fieldValue.(string); isString {
+						fieldValue = utils.ResolveEnvValue(str)
+					}
+					acc.body[field] = fieldValue
+				}
+			case accountWeightKey:
+				weight, isInt := value.(int)
+				if !isInt || weight <= 0 {
+					return nil, fmt.Errorf("%s of account %s must be a positive number", key, name)
+				}
+				acc.weight = weight
+			case accountQuotaIDKey:
+				acc.quotaID = fmt.Sprint(value)
+			default:
+				return nil, fmt.Errorf("unknown field %s in account %s", key, name)
+			}
+		}
+
+		if len(acc.headers) == 0 && len(acc.body) == 0 {
+			return nil, fmt.Errorf("account %s has no headers or body credentials", name)
+		}
+		accounts = append(accounts, acc)
+	}
+
+	// map order is random, the pool order should not be
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].name < accounts[j].name })
+	for index, acc := range accounts {
+		acc.index = index
+	}
+	return accounts, nil
+}
+
+// setBodyFields returns the JSON object body with the account body fields set
+func (a *account) setBodyFields(body string) (map[string]any, error) {
+	document := map[string]any{}
+	if strings.TrimSpace(body) != "" {
+		if err := json.Unmarshal([]byte(body), &document); err != nil {
+			return nil, fmt.Errorf("request body is not a JSON object: %w", err)
+		}
+	}
+
+	for path, value := range a.body {
+		parts := strings.Split(path, ".")
+		current := document
+		for _, part := range parts[:len(parts)-1] {
+			next, isMap := current[part].(map[string]any)
+			if !isMap {
+				next = map[string]any{}
+				current[part] = next
+			}
+			current = next
+		}
+		current[parts[len(parts)-1]] = value
+	}
+	return document, nil
+}
+
+// parseRetryAfter reads a Retry-After value given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,392 @@
+package credentialpool
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/otel"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	accountsParam       = "accounts"
+	strategyParam       = "strategy"
+	cooldownSecParam    = "cooldown_sec"
+	usageWindowSecParam = "usage_window_sec"
+	defaultCooldown     = 60 * time.Second
+	defaultUsageWindow  = 60 * time.Second
+	retryAfterHeader    = "retry-after"
+
+	selectedConditionName  = "selected"
+	exhaustedConditionName = "exhausted"
+	// untrackedConditionName is taken by responses to requests the pool did not pick an account for
+	untrackedConditionName = "untracked"
+
+	// AccountContextKey holds the name of the account used for the request
+	AccountContextKey    = "credential_pool_account"
+	sharedStateKeyPrefix = "credential_pool::"
+	// pendingAccountTTL bounds how long the account of a request is kept while waiting for its response
+	pendingAccountTTL = 5 * time.Minute
+
+	requestsMetric = "lunar_credential_pool_requests_count"
+
+	resultSelected  = "selected"
+	resultThrottled = "throttled"
+	resultExhausted = "exhausted"
+)
+
+type credentialPoolProcessor struct {
+	name     string
+	pool     *pool
+	cooldown time.Duration
+	metaData *streamtypes.ProcessorMetaData
+	pending  sync.Map // request ID -> account name, until the response arrives
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &credentialPoolProcessor{
+		name:         metaData.Name,
+		metaData:     metaData,
+		labelManager: lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *credentialPoolProcessor) GetName() string {
+	return p.name
+}
+
+func (p *credentialPoolProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired:    true,
+		IsRequestModifier: true,
+	}
+}
+
+func (p *credentialPoolProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		return p.onRequest(flowName, apiStream)
+	case public_types.StreamTypeResponse:
+		return p.onResponse(flowName, apiStream), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *credentialPoolProcessor) onRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	acc := p.selectAccount(apiStream)
+	if acc == nil {
+		log.Debug().Msgf("%s: no account is available for %s", p.name, apiStream.GetURL())
+		p.updateMetrics(flowName, apiStream, "", resultExhausted)
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeRequest,
+			ReqAction: &actions.NoOpAction{},
+			Name:      exhaustedConditionName,
+		}, nil
+	}
+
+	action, err := p.applyAccount(acc, apiStream)
+	if err != nil {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("%s: failed to use account %s: %w", p.name, acc.name, err)
+	}
+
+	p.pool.markUsed(acc)
+	p.trackPending(apiStream.GetID(), acc.name)
+	if lunarContext := apiStream.GetContext(); lunarContext != nil {
+		if err := lunarContext.GetTransactionalContext().Set(AccountContextKey, acc.name); err != nil {
+			log.Trace().Err(err).Msgf("%s: failed to set %s", p.name, AccountContextKey)
+		}
+	}
+	p.updateMetrics(flowName, apiStream, acc.name, resultSelected)
+
+	return streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		ReqAction: action,
+		Name:      selectedConditionName,
+	}, nil
+}
+
+func (p *credentialPoolProcessor) onResponse(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	procIO := streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: &actions.NoOpAction{},
+		Name:       untrackedConditionName,
+	}
+
+	value, found := p.pending.LoadAndDelete(apiStream.GetID())
+	if !found {
+		return procIO
+	}
+	procIO.Name = selectedConditionName
+
+	acc := p.pool.find(value.(string))
+	response := apiStream.GetResponse()
+	if acc == nil || response == nil || response.GetStatus() != http.StatusTooManyRequests {
+		return procIO
+	}
+
+	cooldown := p.cooldown
+	if retryAfter, found := response.GetHeader(retryAfterHeader); found {
+		if duration, valid := parseRetryAfter(retryAfter, p.pool.clock.Now()); valid {
+			cooldown = duration
+		}
+	}
+	log.Debug().Msgf("%s: account %s was throttled, cooling down for %s", p.name, acc.name, cooldown)
+	p.pool.coolDown(acc, cooldown)
+	p.updateMetrics(flowName, apiStream, acc.name, resultThrottled)
+	return procIO
+}
+
+// selectAccount picks an available account whose quota allows the request.
+// Only the picked account counts the request in its quota.
+func (p *credentialPoolProcessor) selectAccount(apiStream public_types.APIStreamI) *account {
+	candidates := p.pool.available()
+	for len(candidates) > 0 {
+		acc := p.pool.pick(candidates)
+		if p.isAllowedByQuota(acc, apiStream) {
+			return acc
+		}
+
+		remaining := candidates[:0:0]
+		for _, candidate := range candidates {
+			if candidate != acc {
+				remaining = append(remaining, candidate)
+			}
+		}
+		candidates = remaining
+	}
+	return nil
+}
+
+// isAllowedByQuota checks the account quota, which is usually a child of the provider quota
+// so the provider limit still applies to the whole pool, and counts the request in it
+// when the request fits
+func (p *credentialPoolProcessor) isAllowedByQuota(acc *account, apiStream public_types.APIStreamI) bool {
+	if acc.quotaID == "" {
+		return true
+	}
+
+	quota, err := p.metaData.Resources.GetQuota(acc.quotaID, "")
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s: quota of account %s is not available", p.name, acc.name)
+		return true
+	}
+
+	available, err := quota.Available(apiStream)
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s: failed to check quota %s", p.name, acc.quotaID)
+		return true
+	}
+	if !available {
+		log.Debug().Msgf("%s: quota of account %s is exhausted", p.name, acc.name)
+		p.pool.markExhausted(acc, quota.ResetIn())
+		return false
+	}
+
+	if err := quota.Inc(apiStream); err != nil {
+		log.Warn().Err(err).Msgf("%s: failed to count request in quota %s", p.name, acc.quotaID)
+		return true
+	}
+	allowed, err := quota.Allowed(apiStream)
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s: failed to check quota %s", p.name, acc.quotaID)
+		return true
+	}
+	if !allowed {
+		// the quota was used up by a concurrent request since it was checked
+		log.Debug().Msgf("%s: quota of account %s is exhausted", p.name, acc.name)
+		p.pool.markExhausted(acc, quota.ResetIn())
+		return false
+	}
+
+	// registered, so the quota is released if the request is dropped later in the flow
+	if _, err := p.metaData.Resources.GetQuota(acc.quotaID, apiStream.GetID()); err != nil {
+		log.Trace().Err(err).Msgf("%s: failed to register quota %s", p.name, acc.quotaID)
+	}
+	return true
+}
+
+func (p *credentialPoolProcessor) applyAccount(
+	acc *account,
+	apiStream public_types.APIStreamI,
+) (actions.ReqLunarAction, error) {
+	request := apiStream.GetRequest()
+	if request == nil {
+		return nil, fmt.Errorf("request is not available")
+	}
+
+	headers := request.GetHeaders()
+	headersToSet := make(map[string]string, len(acc.headers))
+	for name, value := range acc.headers {
+		headersToSet[name] = value
+		if headers != nil {
+			headers[name] = value
+		}
+	}
+	if len(acc.body) == 0 {
+		return &actions.ModifyHeadersAction{HeadersToSet: headersToSet}, nil
+	}
+
+	onRequest, isOnRequest := request.(*streamtypes.OnRequest)
+	if !isOnRequest {
+		return nil, fmt.Errorf("failed to cast request to OnRequest")
+	}
+	bodyMap, err := acc.setBodyFields(onRequest.GetBody())
+	if err != nil {
+		return nil, err
+	}
+	onRequest.BodyMap = bodyMap
+	onRequest.UpdateBodyFromBodyMap()
+
+	return &actions.ModifyRequestAction{
+		HeadersToSet: onRequest.GetHeaders(),
+		Host:         onRequest.GetHost(),
+		Path:         onRequest.GetPath(),
+		QueryParams:  onRequest.GetQuery(),
+		Body:         onRequest.GetBody(),
+	}, nil
+}
+
+func (p *credentialPoolProcessor) trackPending(requestID, accountName string) {
+	p.pending.Store(requestID, accountName)
+	// drop the entry if the response never arrives
+	time.AfterFunc(pendingAccountTTL, func() {
+		p.pending.CompareAndDelete(requestID, accountName)
+	})
+}
+
+func (p *credentialPoolProcessor) init() error {
+	rawAccounts := map[string]any{}
+	if err := utils.ExtractMapOfAnyParam(p.metaData.Parameters,
+		accountsParam,
+		rawAccounts); err != nil || len(rawAccounts) == 0 {
+		return fmt.Errorf("%s is required for %s", accountsParam, p.name)
+	}
+	accounts, err := parseAccounts(rawAccounts)
+	if err != nil {
+		return fmt.Errorf("invalid %s for %s: %w", accountsParam, p.name, err)
+	}
+	for _, acc := range accounts {
+		if acc.quotaID == "" {
+			continue
+		}
+		if p.metaData.Resources == nil {
+			return fmt.Errorf("quota %s of account %s is not available for %s", acc.quotaID, acc.name, p.name)
+		}
+		if _, err := p.metaData.Resources.GetQuota(acc.quotaID, ""); err != nil {
+			return fmt.Errorf("quota %s of account %s not found for %s: %w", acc.quotaID, acc.name, p.name, err)
+		}
+	}
+
+	strategy := strategyRoundRobin
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		strategyParam,
+		&strategy); err != nil || strategy == "" {
+		strategy = strategyRoundRobin
+	}
+	switch strategy {
+	case strategyRoundRobin, strategyLeastUsed, strategyWeighted:
+	default:
+		return fmt.Errorf("%s must be %s, %s or %s for %s",
+			strategyParam, strategyRoundRobin, strategyLeastUsed, strategyWeighted, p.name)
+	}
+
+	p.cooldown = p.extractDuration(cooldownSecParam, defaultCooldown)
+	usageWindow := p.extractDuration(usageWindowSecParam, defaultUsageWindow)
+	if usageWindow <= 0 {
+		usageWindow = defaultUsageWindow
+	}
+
+	clock := context_manager.Get().GetClock()
+	p.pool = newPool(p.name, strategy, accounts, usageWindow, clock,
+		lunar_context.NewSharedState[int64]().WithClock(clock))
+	return nil
+}
+
+func (p *credentialPoolProcessor) extractDuration(
+	paramName string,
+	defaultValue time.Duration,
+) time.Duration {
+	var seconds int
+	if err := utils.ExtractIntParam(p.metaData.Parameters, paramName, &seconds); err != nil || seconds < 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (p *credentialPoolProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(requestsMetric,
+		metric.WithDescription(fmt.Sprintf("Requests per account of %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize requests metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *credentialPoolProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	accountName, result string,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes,
+		attribute.String("account", accountName),
+		attribute.String("result", result))
+	attributes, recorded := p.labelManager.LimitCardinality(requestsMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
@@ -0,0 +1,272 @@
+package credentialpool
+
+import (
+	"encoding/json"
+	"fmt"
+	"lunar/engine/actions"
+	"net/http"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuota struct {
+	allowed bool
+	checks  int
+	count   int
+}
+
+func (q *fakeQuota) Allowed(public_types.APIStreamI) (bool, error) { return q.allowed, nil }
+func (q *fakeQuota) Available(public_types.APIStreamI) (bool, error) {
+	q.checks++
+	return q.allowed, nil
+}
+func (q *fakeQuota) Dec(public_types.APIStreamI) error { return nil }
+func (q *fakeQuota) Inc(public_types.APIStreamI) error {
+	q.count++
+	return nil
+}
+func (q *fakeQuota) ResetIn() time.Duration { return time.Minute }
+func (q *fakeQuota) GetParentID() string    { return "provider-quota" }
+
+type fakeResources struct {
+	quotas map[string]*fakeQuota
+}
+
+func (r *fakeResources) GetQuota(quotaID, _ string) (public_types.QuotaResourceI, error) {
+	quota, found := r.quotas[quotaID]
+	if !found {
+		return nil, fmt.Errorf("quota resource with ID %s not found", quotaID)
+	}
+	return quota, nil
+}
+func (r *fakeResources) OnRequestDrop(public_types.APIStreamI)    {}
+func (r *fakeResources) OnResponseFinish(public_types.APIStreamI) {}
+
+func TestCredentialPoolRoundRobin(t *testing.T) {
+	proc := createProcessor(t, nil, map[string]any{
+		accountsParam: threeAccounts(),
+	})
+
+	for _, expected := range []string{"key-a", "key-b", "key-c", "key-a"} {
+		require.Equal(t, expected, selectedKey(t, proc))
+	}
+}
+
+func TestCredentialPoolWeighted(t *testing.T) {
+	proc := createProcessor(t, nil, map[string]any{
+		strategyParam: strategyWeighted,
+		accountsParam: map[string]any{
+			"account-a": map[string]any{"headers": map[string]any{"x-api-key": "key-a"}, "weight": 2},
+			"account-b": map[string]any{"headers": map[string]any{"x-api-key": "key-b"}},
+		},
+	})
+
+	picks := map[string]int{}
+	for _, expected := range []string{"key-a", "key-b", "key-a", "key-a", "key-b", "key-a"} {
+		key := selectedKey(t, proc)
+		require.Equal(t, expected, key)
+		picks[key]++
+	}
+	require.Equal(t, map[string]int{"key-a": 4, "key-b": 2}, picks)
+}
+
+func TestCredentialPoolCooldownOnTooManyRequests(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+
+	proc := createProcessor(t, nil, map[string]any{
+		strategyParam:    strategyLeastUsed,
+		cooldownSecParam: 10,
+		accountsParam:    threeAccounts(),
+	})
+
+	// a response to a request the pool did not see is passed without cooling any account down
+	procIO := executeResponse(t, proc, http.StatusTooManyRequests, map[string]string{"retry-after": "30"})
+	require.Equal(t, untrackedConditionName, procIO.Name)
+
+	require.Equal(t, "key-a", selectedKey(t, proc))
+	procIO = executeResponse(t, proc, http.StatusTooManyRequests, map[string]string{"retry-after": "30"})
+	require.Equal(t, selectedConditionName, procIO.Name)
+
+	// account-a cools down for the Retry-After period
+	require.Equal(t, "key-b", selectedKey(t, proc))
+	require.Equal(t, "key-c", selectedKey(t, proc))
+	executeResponse(t, proc, http.StatusTooManyRequests, map[string]string{})
+	require.Equal(t, "key-b", selectedKey(t, proc))
+	require.Equal(t, "key-b", selectedKey(t, proc))
+
+	// without Retry-After the configured cooldown applies
+	mockClock.AdvanceTime(11 * time.Second)
+	require.Equal(t, "key-c", selectedKey(t, proc))
+
+	mockClock.AdvanceTime(20 * time.Second)
+	require.Equal(t, "key-a", selectedKey(t, proc))
+}
+
+func TestCredentialPoolSkipsExhaustedQuota(t *testing.T) {
+	resources := &fakeResources{quotas: map[string]*fakeQuota{
+		"quota-a": {allowed: false},
+		"quota-b": {allowed: true},
+	}}
+	proc := createProcessor(t, resources, map[string]any{
+		accountsParam: map[string]any{
+			"account-a": map[string]any{"headers": map[string]any{"x-api-key": "key-a"}, "quota_id": "quota-a"},
+			"account-b": map[string]any{"headers": map[string]any{"x-api-key": "key-b"}, "quota_id": "quota-b"},
+		},
+	})
+
+	require.Equal(t, "key-b", selectedKey(t, proc))
+	require.Equal(t, "key-b", selectedKey(t, proc))
+	// the exhausted account isn't tried again until its quota resets,
+	// and the request is counted only in the quota of the selected account
+	require.Equal(t, 1, resources.quotas["quota-a"].checks)
+	require.Equal(t, 0, resources.quotas["quota-a"].count)
+	require.Equal(t, 2, resources.quotas["quota-b"].count)
+
+	resources.quotas["quota-b"].allowed = false
+	stream := newRequestStream(`{}`)
+	procIO, err := proc.Execute("pool-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, exhaustedConditionName, procIO.Name)
+	require.IsType(t, &actions.NoOpAction{}, procIO.ReqAction)
+}
+
+func TestCredentialPoolInjectsBodyTokens(t *testing.T) {
+	t.Setenv("POOL_TEST_TOKEN", "body-token")
+	proc := createProcessor(t, nil, map[string]any{
+		accountsParam: map[string]any{
+			"account-a": map[string]any{"body": map[string]any{
+				"api_key":     "$POOL_TEST_TOKEN",
+				"auth.tenant": "acme",
+			}},
+		},
+	})
+
+	stream := newRequestStream(`{"query":"status"}`)
+	procIO, err := proc.Execute("pool-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, selectedConditionName, procIO.Name)
+	require.IsType(t, &actions.ModifyRequestAction{}, procIO.ReqAction)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(procIO.ReqAction.(*actions.ModifyRequestAction).Body), &body))
+	require.Equal(t, map[string]any{
+		"query":   "status",
+		"api_key": "body-token",
+		"auth":    map[string]any{"tenant": "acme"},
+	}, body)
+	require.Equal(t, procIO.ReqAction.(*actions.ModifyRequestAction).Body, stream.GetRequest().GetBody())
+}
+
+func TestCredentialPoolInvalidConfig(t *testing.T) {
+	for _, params := range []map[string]any{
+		{},
+		{accountsParam: map[string]any{"account-a": map[string]any{}}},
+		{accountsParam: map[string]any{"account-a": map[string]any{"token": "key-a"}}},
+		{accountsParam: map[string]any{
+			"account-a": map[string]any{"headers": map[string]any{"x-api-key": "key-a"}, "weight": 0},
+		}},
+		{accountsParam: threeAccounts(), strategyParam: "random"},
+		{accountsParam: map[string]any{
+			"account-a": map[string]any{"headers": map[string]any{"x-api-key": "key-a"}, "quota_id": "missing"},
+		}},
+	} {
+		metaData := test_utils.NewProcessorMetaData("CredentialPool", params)
+		metaData.Resources = &fakeResources{}
+		_, err := NewProcessor(metaData)
+		require.Error(t, err, params)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	duration, valid := parseRetryAfter("120", now)
+	require.True(t, valid)
+	require.Equal(t, 2*time.Minute, duration)
+
+	duration, valid = parseRetryAfter("Mon, 01 Jan 2024 12:00:45 GMT", now)
+	require.True(t, valid)
+	require.Equal(t, 45*time.Second, duration)
+
+	_, valid = parseRetryAfter("soon", now)
+	require.False(t, valid)
+}
+
+func threeAccounts() map[string]any {
+	accounts := map[string]any{}
+	for _, name := range []string{"a", "b", "c"} {
+		accounts["account-"+name] = map[string]any{
+			"headers": map[string]any{"X-API-Key": "key-" + name},
+		}
+	}
+	return accounts
+}
+
+func selectedKey(t *testing.T, proc streamtypes.ProcessorI) string {
+	stream := newRequestStream("")
+	procIO, err := proc.Execute("pool-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, selectedConditionName, procIO.Name)
+
+	action, isModifyHeaders := procIO.ReqAction.(*actions.ModifyHeadersAction)
+	require.True(t, isModifyHeaders)
+	key, _ := stream.GetHeader("x-api-key")
+	require.Equal(t, action.HeadersToSet["x-api-key"], key)
+	return key
+}
+
+func executeResponse(
+	t *testing.T,
+	proc streamtypes.ProcessorI,
+	status int,
+	headers map[string]string,
+) streamtypes.ProcessorIO {
+	stream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeResponse,
+		"GET",
+		"https://api.example.com/orders",
+		map[string]string{},
+		headers,
+		"",
+		"",
+		status,
+	)
+	procIO, err := proc.Execute("pool-test", stream)
+	require.NoError(t, err)
+	return procIO
+}
+
+func createProcessor(
+	t *testing.T,
+	resources *fakeResources,
+	params map[string]any,
+) streamtypes.ProcessorI {
+	metaData := test_utils.NewProcessorMetaData("CredentialPool", params)
+	if resources != nil {
+		metaData.Resources = resources
+	}
+	proc, err := NewProcessor(metaData)
+	require.NoError(t, err)
+	return proc
+}
+
+func newRequestStream(body string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"POST",
+		"https://api.example.com/orders",
+		map[string]string{},
+		map[string]string{},
+		body,
+		"",
+		0,
+	)
+}
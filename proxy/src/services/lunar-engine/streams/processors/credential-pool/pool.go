@@ -0,0 +1,195 @@
+package credentialpool
+
+import (
+	"fmt"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/toolkit-core/clock"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	strategyRoundRobin = "round_robin"
+	strategyLeastUsed  = "least_used"
+	strategyWeighted   = "weighted"
+)
+
+// pool picks the account of each request. Cooldowns and usage counters are kept
+// in the shared state, so they apply to every gateway sharing it.
+type pool struct {
+	name        string
+	strategy    string
+	accounts    []*account
+	usageWindow time.Duration
+	clock       clock.Clock
+	state       public_types.SharedStateI[int64]
+
+	mutex sync.Mutex
+	// next is the round robin position
+	next int
+	// currentWeights holds the smooth weighted round robin state
+	currentWeights []int
+	// exhaustedUntil keeps accounts whose quota is used up out of the rotation until it resets
+	exhaustedUntil map[string]time.Time
+}
+
+func newPool(
+	name, strategy string,
+	accounts []*account,
+	usageWindow time.Duration,
+	clock clock.Clock,
+	state public_types.SharedStateI[int64],
+) *pool {
+	return &pool{
+		name:           name,
+		strategy:       strategy,
+		accounts:       accounts,
+		usageWindow:    usageWindow,
+		clock:          clock,
+		state:          state,
+		currentWeights: make([]int, len(accounts)),
+		exhaustedUntil: map[string]time.Time{},
+	}
+}
+
+// available returns the accounts which are neither cooling down nor exhausted
+func (p *pool) available() []*account {
+	now := p.clock.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	available := make([]*account, 0, len(p.accounts))
+	for _, acc := range p.accounts {
+		if until, found := p.exhaustedUntil[acc.name]; found {
+			if now.Before(until) {
+				continue
+			}
+			delete(p.exhaustedUntil, acc.name)
+		}
+		if p.isCoolingDown(acc, now) {
+			continue
+		}
+		available = append(available, acc)
+	}
+	return available
+}
+
+// pick chooses one of the given accounts according to the strategy
+func (p *pool) pick(candidates []*account) *account {
+	if len(candidates) == 0 {
+		return nil
+	}
+	switch p.strategy {
+	case strategyLeastUsed:
+		return p.pickLeastUsed(candidates)
+	case strategyWeighted:
+		return p.pickWeighted(candidates)
+	}
+	return p.pickRoundRobin(candidates)
+}
+
+func (p *pool) pickRoundRobin(candidates []*account) *account {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	picked := candidates[0]
+	for _, acc := range candidates {
+		if acc.index >= p.next {
+			picked = acc
+			break
+		}
+	}
+	p.next = (picked.index + 1) % len(p.accounts)
+	return picked
+}
+
+func (p *pool) pickLeastUsed(candidates []*account) *account {
+	usage := make(map[string]int64, len(candidates))
+	for _, acc := range candidates {
+		usage[acc.name] = p.usage(acc)
+	}
+	sorted := append([]*account{}, candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return usage[sorted[i].name] < usage[sorted[j].name]
+	})
+	return sorted[0]
+}
+
+// pickWeighted uses smooth weighted round robin, which spreads the picks of
+// heavier accounts evenly instead of sending them in bursts
+func (p *pool) pickWeighted(candidates []*account) *account {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var picked *account
+	totalWeight := 0
+	for _, acc := range candidates {
+		p.currentWeights[acc.index] += acc.weight
+		totalWeight += acc.weight
+		if picked == nil || p.currentWeights[acc.index] > p.currentWeights[picked.index] {
+			picked = acc
+		}
+	}
+	p.currentWeights[picked.index] -= totalWeight
+	return picked
+}
+
+// markUsed counts a request sent with the account
+func (p *pool) markUsed(acc *account) {
+	if _, _, err := p.state.AtomicIncWindow(p.usageKey(acc), 1, p.usageWindow, math.MaxInt64); err != nil {
+		log.Trace().Err(err).Msgf("%s: failed to count usage of account %s", p.name, acc.name)
+	}
+}
+
+func (p *pool) usage(acc *account) int64 {
+	// incrementing by zero reads the counter and starts a new window when it ended
+	count, _, err := p.state.AtomicIncWindow(p.usageKey(acc), 0, p.usageWindow, math.MaxInt64)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// markExhausted keeps the account out of the rotation until its quota resets
+func (p *pool) markExhausted(acc *account, resetIn time.Duration) {
+	if resetIn <= 0 {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.exhaustedUntil[acc.name] = p.clock.Now().Add(resetIn)
+}
+
+// coolDown keeps the account out of the rotation after the provider throttled it
+func (p *pool) coolDown(acc *account, duration time.Duration) {
+	until := p.clock.Now().Add(duration).UnixMilli()
+	if err := p.state.Set(p.cooldownKey(acc), until); err != nil {
+		log.Warn().Err(err).Msgf("%s: failed to store cooldown of account %s", p.name, acc.name)
+	}
+}
+
+func (p *pool) isCoolingDown(acc *account, now time.Time) bool {
+	until, err := p.state.Get(p.cooldownKey(acc))
+	return err == nil && now.UnixMilli() < until
+}
+
+func (p *pool) find(name string) *account {
+	for _, acc := range p.accounts {
+		if acc.name == name {
+			return acc
+		}
+	}
+	return nil
+}
+
+func (p *pool) usageKey(acc *account) string {
+	return fmt.Sprintf("%s%s::%s::usage", sharedStateKeyPrefix, p.name, acc.name)
+}
+
+func (p *pool) cooldownKey(acc *account) string {
+	return fmt.Sprintf("%s%s::%s::cooldown", sharedStateKeyPrefix, p.name, acc.name)
+}
@@ -0,0 +1,312 @@
+package faultinjection
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/saturation"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/otel"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	faultsParam  = "faults"
+	enabledParam = "enabled"
+
+	injectedConditionName    = "injected"
+	notInjectedConditionName = "not_injected"
+
+	retryAfterHeader = "Retry-After"
+
+	faultsInjectedMetric = "lunar_fault_injection_processor_faults_injected"
+)
+
+type faultInjectionProcessor struct {
+	name     string
+	faults   []*fault
+	switches *processorSwitch
+	metaData *streamtypes.ProcessorMetaData
+
+	randomMu sync.Mutex
+	random   *rand.Rand
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &faultInjectionProcessor{
+		name:         metaData.Name,
+		metaData:     metaData,
+		random:       rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+		labelManager: lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *faultInjectionProcessor) GetName() string {
+	return p.name
+}
+
+func (p *faultInjectionProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *faultInjectionProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		return p.onRequest(flowName, apiStream), nil
+	case public_types.StreamTypeResponse:
+		return p.onResponse(flowName, apiStream), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *faultInjectionProcessor) init() error {
+	rawFaults := make(map[string]any)
+	if err := utils.ExtractMapOfAnyParam(p.metaData.Parameters,
+		faultsParam,
+		rawFaults); err != nil {
+		log.Error().Err(err).Msgf("Missing %s parameter", faultsParam)
+		return err
+	}
+
+	faults, err := parseFaults(rawFaults)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+	if len(faults) == 0 {
+		return fmt.Errorf("%v cannot be empty", faultsParam)
+	}
+	p.faults = faults
+
+	enabled := true
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		enabledParam,
+		&enabled); err != nil {
+		log.Trace().Msgf("%s not defined for %v", enabledParam, p.name)
+	}
+	p.switches = newProcessorSwitch(enabled, faults)
+	// processors created to validate flows would replace the switches of the loaded ones
+	if !p.metaData.IsValidation {
+		switches.register(p.metaData.FlowName, p.name, p.switches)
+	}
+	return nil
+}
+
+// onRequest delays the request by the triggered latency faults,
+// then responds instead of the provider with the first triggered terminating fault
+func (p *faultInjectionProcessor) onRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	var delay time.Duration
+	for _, f := range p.faults {
+		if !f.isRequestFault() || !p.triggers(f, apiStream) {
+			continue
+		}
+
+		switch f.faultType {
+		case faultLatency:
+			delay += p.pickLatency(f)
+			p.updateMetrics(flowName, apiStream, f)
+			continue
+		case faultStatus, faultAbort, faultRateLimit:
+			p.sleep(apiStream, delay)
+			p.updateMetrics(flowName, apiStream, f)
+			return streamtypes.ProcessorIO{
+				Type:      public_types.StreamTypeResponse,
+				ReqAction: p.buildEarlyResponse(f),
+				Name:      injectedConditionName,
+			}
+		}
+	}
+
+	p.sleep(apiStream, delay)
+	name := notInjectedConditionName
+	if delay > 0 {
+		name = injectedConditionName
+	}
+	return streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		ReqAction: &actions.NoOpAction{},
+		Name:      name,
+	}
+}
+
+// onResponse corrupts or truncates the body of the provider response
+func (p *faultInjectionProcessor) onResponse(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	response := apiStream.GetResponse()
+	if response == nil {
+		return notInjectedResponse()
+	}
+
+	body := response.GetBody()
+	injected := false
+	for _, f := range p.faults {
+		if f.isRequestFault() || !p.triggers(f, apiStream) {
+			continue
+		}
+
+		switch f.faultType {
+		case faultCorruptBody:
+			p.randomMu.Lock()
+			body = corrupt(body, p.random)
+			p.randomMu.Unlock()
+		case faultTruncateBody:
+			body = f.truncate(body)
+		}
+		injected = true
+		p.updateMetrics(flowName, apiStream, f)
+	}
+
+	if !injected {
+		return notInjectedResponse()
+	}
+
+	headers := make(map[string]string, len(response.GetHeaders()))
+	for name, value := range response.GetHeaders() {
+		headers[name] = value
+	}
+	headers["content-length"] = strconv.Itoa(len(body))
+
+	return streamtypes.ProcessorIO{
+		Type: public_types.StreamTypeResponse,
+		RespAction: &actions.ModifyResponseAction{
+			HeadersToSet: headers,
+			Body:         body,
+			Status:       response.GetStatus(),
+		},
+		Name: injectedConditionName,
+	}
+}
+
+// triggers checks the switch and filters of the fault, then rolls its percentage
+func (p *faultInjectionProcessor) triggers(f *fault, apiStream public_types.APIStreamI) bool {
+	if !p.switches.isFaultEnabled(f.name) || !f.matches(apiStream.GetRequest()) {
+		return false
+	}
+	if f.percentage >= 100 {
+		return true
+	}
+
+	p.randomMu.Lock()
+	defer p.randomMu.Unlock()
+	return p.random.Float64()*100 < f.percentage
+}
+
+func (p *faultInjectionProcessor) pickLatency(f *fault) time.Duration {
+	p.randomMu.Lock()
+	defer p.randomMu.Unlock()
+	return f.pickLatency(p.random)
+}
+
+// sleep injects the latency, which is not counted as engine processing time
+func (p *faultInjectionProcessor) sleep(apiStream public_types.APIStreamI, delay time.Duration) {
+	if delay > 0 {
+		context_manager.Get().GetClock().Sleep(delay)
+		saturation.AddWait(apiStream.GetID(), delay)
+	}
+}
+
+// buildEarlyResponse builds the response of a terminating fault.
+// An abort drops the client connection, its status is only seen by the response flow.
+func (p *faultInjectionProcessor) buildEarlyResponse(f *fault) *actions.EarlyResponseAction {
+	action := &actions.EarlyResponseAction{
+		Status:  f.status,
+		Headers: map[string]string{},
+	}
+	switch f.faultType {
+	case faultAbort:
+		action.DropConnection = true
+	case faultRateLimit:
+		action.Body = f.body
+		action.Headers[retryAfterHeader] = strconv.Itoa(f.retryAfterSec)
+		action.Headers["Content-Type"] = "application/json"
+	default:
+		action.Body = f.body
+	}
+	return action
+}
+
+func notInjectedResponse() streamtypes.ProcessorIO {
+	return streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: &actions.NoOpAction{},
+		Name:       notInjectedConditionName,
+	}
+}
+
+func (p *faultInjectionProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(faultsInjectedMetric,
+		metric.WithDescription(fmt.Sprintf("Faults injected by %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize faults injected metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *faultInjectionProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	f *fault,
+) {
+	log.Debug().Msgf("%s: injecting %s fault %s", p.name, f.faultType, f.name)
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes,
+		attribute.String("fault", f.name),
+		attribute.String("fault_type", string(f.faultType)))
+	attributes, recorded := p.labelManager.LimitCardinality(faultsInjectedMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
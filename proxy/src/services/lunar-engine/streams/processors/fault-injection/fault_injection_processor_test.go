@@ -0,0 +1,229 @@
+package faultinjection
+
+import (
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultInjectionRateLimit(t *testing.T) {
+	proc := createProcessor(t, "rate-limit-test", map[string]any{
+		"throttled": map[string]any{
+			"type":            "rate_limit",
+			"retry_after_sec": 7,
+		},
+	})
+
+	procIO, err := proc.Execute("fault-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, injectedConditionName, procIO.Name)
+	require.Equal(t, public_types.StreamTypeResponse, procIO.Type)
+	require.Equal(t, &actions.EarlyResponseAction{
+		Status: 429,
+		Body:   defaultRateLimitMsg,
+		Headers: map[string]string{
+			retryAfterHeader: "7",
+			"Content-Type":   "application/json",
+		},
+	}, procIO.ReqAction)
+}
+
+func TestFaultInjectionAbort(t *testing.T) {
+	proc := createProcessor(t, "abort-test", map[string]any{
+		"dropped": map[string]any{"type": "abort"},
+	})
+
+	procIO, err := proc.Execute("fault-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, injectedConditionName, procIO.Name)
+	require.Equal(t, &actions.EarlyResponseAction{
+		Status:         502,
+		Headers:        map[string]string{},
+		DropConnection: true,
+	}, procIO.ReqAction)
+}
+
+func TestFaultInjectionFilters(t *testing.T) {
+	proc := createProcessor(t, "filters-test", map[string]any{
+		"staging-errors": map[string]any{
+			"type":          "status",
+			"status":        500,
+			"body":          "boom",
+			"consumer_tags": []any{"staging"},
+			"headers":       map[string]any{"x-chaos": ""},
+		},
+	})
+
+	procIO, err := proc.Execute("fault-flow", newRequestStream(map[string]string{
+		lunar_metrics.HeaderConsumerTag: "production",
+		"x-chaos":                       "1",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, notInjectedConditionName, procIO.Name)
+
+	procIO, err = proc.Execute("fault-flow", newRequestStream(map[string]string{
+		lunar_metrics.HeaderConsumerTag: "staging",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, notInjectedConditionName, procIO.Name)
+
+	procIO, err = proc.Execute("fault-flow", newRequestStream(map[string]string{
+		lunar_metrics.HeaderConsumerTag: "staging",
+		"x-chaos":                       "1",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, injectedConditionName, procIO.Name)
+	action, ok := procIO.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, 500, action.Status)
+	require.Equal(t, "boom", action.Body)
+}
+
+func TestFaultInjectionPercentage(t *testing.T) {
+	proc := createProcessor(t, "percentage-test", map[string]any{
+		"never": map[string]any{"type": "abort", "percentage": 0},
+	})
+	for i := 0; i < 20; i++ {
+		procIO, err := proc.Execute("fault-flow", newRequestStream(nil))
+		require.NoError(t, err)
+		require.Equal(t, notInjectedConditionName, procIO.Name)
+	}
+}
+
+func TestFaultInjectionLatency(t *testing.T) {
+	proc := createProcessor(t, "latency-test", map[string]any{
+		"slow": map[string]any{"type": "latency", "latency_ms": 20, "latency_max_ms": 30},
+	})
+
+	start := time.Now()
+	procIO, err := proc.Execute("fault-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	require.Equal(t, injectedConditionName, procIO.Name)
+	require.Equal(t, public_types.StreamTypeRequest, procIO.Type)
+	require.Equal(t, &actions.NoOpAction{}, procIO.ReqAction)
+}
+
+func TestFaultInjectionResponseBody(t *testing.T) {
+	proc := createProcessor(t, "body-test", map[string]any{
+		"cut": map[string]any{"type": "truncate_body", "truncate_bytes": 5},
+	})
+
+	stream := test_utils.NewMockAPIResponseStream(
+		"https://api.example.com/items",
+		map[string]string{"content-type": "application/json"},
+		`{"items": [1, 2, 3]}`,
+		200,
+	)
+	procIO, err := proc.Execute("fault-flow", stream)
+	require.NoError(t, err)
+	require.Equal(t, injectedConditionName, procIO.Name)
+	require.Equal(t, &actions.ModifyResponseAction{
+		HeadersToSet: map[string]string{"content-type": "application/json", "content-length": "5"},
+		Body:         `{"ite`,
+		Status:       200,
+	}, procIO.RespAction)
+}
+
+func TestFaultInjectionRuntimeSwitch(t *testing.T) {
+	proc := createProcessor(t, "switch-test", map[string]any{
+		"errors": map[string]any{"type": "status"},
+	})
+
+	require.NoError(t, SetEnabled("fault-flow", "switch-test", "", false))
+	procIO, err := proc.Execute("fault-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, notInjectedConditionName, procIO.Name)
+
+	require.NoError(t, SetEnabled("fault-flow", "switch-test", "", true))
+	require.NoError(t, SetEnabled("fault-flow", "switch-test", "errors", false))
+	procIO, err = proc.Execute("fault-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, notInjectedConditionName, procIO.Name)
+
+	require.NoError(t, SetEnabled("fault-flow", "switch-test", "errors", true))
+	procIO, err = proc.Execute("fault-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, injectedConditionName, procIO.Name)
+
+	require.Contains(t, GetStates(), FaultInjectionState{
+		Flow:      "fault-flow",
+		Processor: "switch-test",
+		Enabled:   true,
+		Faults:    map[string]bool{"errors": true},
+	})
+	require.Error(t, SetEnabled("fault-flow", "missing", "", true))
+	require.Error(t, SetEnabled("other-flow", "switch-test", "", true))
+	require.Error(t, SetEnabled("fault-flow", "switch-test", "missing", true))
+}
+
+func TestFaultInjectionSwitchesByFlow(t *testing.T) {
+	faults := map[string]any{"errors": map[string]any{"type": "status"}}
+	first := createFlowProcessor(t, "first-flow", "shared-key", faults, false)
+	second := createFlowProcessor(t, "second-flow", "shared-key", faults, false)
+	// a validation dry run creates the processor again, it must not take over its switch
+	createFlowProcessor(t, "first-flow", "shared-key", faults, true)
+
+	require.NoError(t, SetEnabled("first-flow", "shared-key", "", false))
+	procIO, err := first.Execute("first-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, notInjectedConditionName, procIO.Name)
+	procIO, err = second.Execute("second-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, injectedConditionName, procIO.Name)
+
+	// without a flow, the processor key is switched in every flow
+	require.NoError(t, SetEnabled("", "shared-key", "", false))
+	procIO, err = second.Execute("second-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, notInjectedConditionName, procIO.Name)
+
+	ResetSwitches()
+	require.Empty(t, GetStates())
+	require.Error(t, SetEnabled("first-flow", "shared-key", "", true))
+}
+
+func TestFaultInjectionInvalidFaults(t *testing.T) {
+	for _, faults := range []map[string]any{
+		{"unknown": map[string]any{"type": "meteor"}},
+		{"no-latency": map[string]any{"type": "latency"}},
+		{"bad-percentage": map[string]any{"type": "abort", "percentage": 150}},
+		{"bad-field": map[string]any{"type": "abort", "color": "red"}},
+	} {
+		metaData := test_utils.NewProcessorMetaData("invalid-test", map[string]any{faultsParam: faults})
+		_, err := NewProcessor(metaData)
+		require.Error(t, err, faults)
+	}
+}
+
+func newRequestStream(headers map[string]string) public_types.APIStreamI {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return test_utils.NewMockAPIStream("https://api.example.com/items", headers, map[string]string{}, "", "")
+}
+
+func createProcessor(t *testing.T, key string, faults map[string]any) streamtypes.ProcessorI {
+	return createFlowProcessor(t, "fault-flow", key, faults, false)
+}
+
+func createFlowProcessor(
+	t *testing.T,
+	flowName, key string,
+	faults map[string]any,
+	isValidation bool,
+) streamtypes.ProcessorI {
+	metaData := test_utils.NewProcessorMetaData(key, map[string]any{faultsParam: faults})
+	metaData.FlowName = flowName
+	metaData.IsValidation = isValidation
+	proc, err := NewProcessor(metaData)
+	require.NoError(t, err)
+	return proc
+}
@@ -0,0 +1,267 @@
+package faultinjection
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	lunar_metrics "lunar/engine/metrics"
+	public_types "lunar/engine/streams/public-types"
+)
+
+type faultType string
+
+const (
+	faultLatency      faultType = "latency"
+	faultStatus       faultType = "status"
+	faultAbort        faultType = "abort"
+	faultRateLimit    faultType = "rate_limit"
+	faultCorruptBody  faultType = "corrupt_body"
+	faultTruncateBody faultType = "truncate_body"
+
+	faultTypeKey          = "type"
+	faultPercentageKey    = "percentage"
+	faultLatencyMsKey     = "latency_ms"
+	faultLatencyMaxMsKey  = "latency_max_ms"
+	faultStatusKey        = "status"
+	faultBodyKey          = "body"
+	faultRetryAfterKey    = "retry_after_sec"
+	faultTruncateBytesKey = "truncate_bytes"
+	faultHeadersKey       = "headers"
+	faultConsumerTagsKey  = "consumer_tags"
+	faultEnabledKey       = "enabled"
+
+	defaultStatus       = 503
+	defaultAbortStatus  = 502
+	defaultRetryAfter   = 1
+	defaultRateLimitMsg = `{"error": {"type": "rate_limit_error", "message": "Rate limit exceeded"}}`
+)
+
+// fault is one misbehavior of the provider, e.g.
+//
+//	slow-provider:
+//	  type: latency
+//	  latency_ms: 200
+//	  latency_max_ms: 2000
+//	  percentage: 10
+//	throttled-staging:
+//	  type: rate_limit
+//	  retry_after_sec: 5
+//	  consumer_tags: [staging]
+type fault struct {
+	name       string
+	faultType  faultType
+	percentage float64
+
+	latency    time.Duration
+	latencyMax time.Duration
+
+	status        int
+	body          string
+	retryAfterSec int
+	truncateBytes int
+
+	// headers must all match the request, an empty value only requires the header to exist
+	headers      map[string]string
+	consumerTags map[string]struct{}
+
+	enabled bool
+}
+
+// isRequestFault tells whether the fault is applied before the provider is called
+func (f *fault) isRequestFault() bool {
+	return f.faultType != faultCorruptBody && f.faultType != faultTruncateBody
+}
+
+// matches checks the filters of the fault against the request
+func (f *fault) matches(request public_types.TransactionI) bool {
+	if len(f.consumerTags) == 0 && len(f.headers) == 0 {
+		return true
+	}
+	if request == nil {
+		return false
+	}
+
+	if len(f.consumerTags) > 0 {
+		consumerTag, _ := request.GetHeader(lunar_metrics.HeaderConsumerTag)
+		if _, found := f.consumerTags[consumerTag]; !found {
+			return false
+		}
+	}
+
+	for name, value := range f.headers {
+		if value == "" {
+			if !request.DoesHeaderExist(name) {
+				return false
+			}
+			continue
+		}
+		if !request.DoesHeaderValueMatch(name, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// pickLatency returns the fixed latency, or a random one up to latencyMax
+func (f *fault) pickLatency(random *rand.Rand) time.Duration {
+	if f.latencyMax <= f.latency {
+		return f.latency
+	}
+	return f.latency + time.Duration(random.Int63n(int64(f.latencyMax-f.latency)))
+}
+
+// corrupt replaces the bytes of the body in place, keeping its length
+func corrupt(body string, random *rand.Rand) string {
+	if body == "" {
+		return body
+	}
+	corrupted := []byte(body)
+	for index := 0; index < len(corrupted); index += 1 + random.Intn(8) {
+		corrupted[index] = byte('!' + random.Intn('~'-'!'))
+	}
+	return string(corrupted)
+}
+
+// truncate cuts the body at the configured size, or in half
+func (f *fault) truncate(body string) string {
+	size := len(body) / 2
+	if f.truncateBytes > 0 && f.truncateBytes < len(body) {
+		size = f.truncateBytes
+	}
+	return body[:size]
+}
+
+// parseFaults reads the faults parameter, sorted by name so faults apply in a stable order
+func parseFaults(raw map[string]any) ([]*fault, error) {
+	faults := make([]*fault, 0, len(raw))
+	for name, rawFault := range raw {
+		definition, isMap := rawFault.(map[string]any)
+		if !isMap {
+			return nil, fmt.Errorf("fault %s must be a map", name)
+		}
+		parsed, err := parseFault(name, definition)
+		if err != nil {
+			return nil, err
+		}
+		faults = append(faults, parsed)
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].name < faults[j].name })
+	return faults, nil
+}
+
+func parseFault(name string, definition map[string]any) (*fault, error) {
+	parsed := &fault{
+		name:          name,
+		percentage:    100,
+		retryAfterSec: defaultRetryAfter,
+		headers:       map[string]string{},
+		consumerTags:  map[string]struct{}{},
+		enabled:       true,
+	}
+
+	for key, value := range definition {
+		var err error
+		switch key {
+		case faultTypeKey:
+			parsed.faultType = faultType(fmt.Sprint(value))
+		case faultPercentageKey:
+			parsed.percentage, err = toFloat(value)
+			if err == nil && (parsed.percentage < 0 || parsed.percentage > 100) {
+				err = fmt.Errorf("must be between 0 and 100")
+			}
+		case faultLatencyMsKey:
+			parsed.latency, err = toMilliseconds(value)
+		case faultLatencyMaxMsKey:
+			parsed.latencyMax, err = toMilliseconds(value)
+		case faultStatusKey:
+			parsed.status, err = toInt(value)
+		case faultBodyKey:
+			parsed.body = fmt.Sprint(value)
+		case faultRetryAfterKey:
+			parsed.retryAfterSec, err = toInt(value)
+		case faultTruncateBytesKey:
+			parsed.truncateBytes, err = toInt(value)
+		case faultHeadersKey:
+			headers, isMap := value.(map[string]any)
+			if !isMap {
+				err = fmt.Errorf("must be a map")
+			}
+			for header, headerValue := range headers {
+				parsed.headers[strings.ToLower(header)] = fmt.Sprint(headerValue)
+			}
+		case faultConsumerTagsKey:
+			tags, isList := value.([]any)
+			if !isList {
+				err = fmt.Errorf("must be a list")
+			}
+			for _, tag := range tags {
+				parsed.consumerTags[fmt.Sprint(tag)] = struct{}{}
+			}
+		case faultEnabledKey:
+			enabled, isBool := value.(bool)
+			if !isBool {
+				err = fmt.Errorf("must be a boolean")
+			}
+			parsed.enabled = enabled
+		default:
+			err = fmt.Errorf("unknown field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s of fault %s: %w", key, name, err)
+		}
+	}
+
+	switch parsed.faultType {
+	case faultLatency:
+		if parsed.latency <= 0 && parsed.latencyMax <= 0 {
+			return nil, fmt.Errorf("fault %s requires %s or %s", name, faultLatencyMsKey, faultLatencyMaxMsKey)
+		}
+	case faultStatus:
+		if parsed.status == 0 {
+			parsed.status = defaultStatus
+		}
+	case faultAbort:
+		if parsed.status == 0 {
+			parsed.status = defaultAbortStatus
+		}
+	case faultRateLimit:
+		if parsed.status == 0 {
+			parsed.status = 429
+		}
+		if parsed.body == "" {
+			parsed.body = defaultRateLimitMsg
+		}
+	case faultCorruptBody, faultTruncateBody:
+	default:
+		return nil, fmt.Errorf("fault %s has unsupported type '%s'", name, parsed.faultType)
+	}
+	return parsed, nil
+}
+
+func toFloat(value any) (float64, error) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), nil
+	case int64:
+		return float64(typed), nil
+	case float64:
+		return typed, nil
+	}
+	return 0, fmt.Errorf("must be a number")
+}
+
+func toInt(value any) (int, error) {
+	number, err := toFloat(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("must be a positive number")
+	}
+	return int(number), nil
+}
+
+func toMilliseconds(value any) (time.Duration, error) {
+	number, err := toInt(value)
+	return time.Duration(number) * time.Millisecond, err
+}
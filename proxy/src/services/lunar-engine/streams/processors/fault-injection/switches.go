@@ -0,0 +1,148 @@
+package faultinjection
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// switches holds the runtime state of the FaultInjection processors by flow and processor key,
+// so faults can be turned on and off from the admin API without reloading the flows
+var switches = &switchBoard{processors: map[switchKey]*processorSwitch{}}
+
+// switchKey identifies a processor, since processor keys are only unique within a flow
+type switchKey struct {
+	flow      string
+	processor string
+}
+
+type switchBoard struct {
+	mu         sync.RWMutex
+	processors map[switchKey]*processorSwitch
+}
+
+type processorSwitch struct {
+	enabled atomic.Bool
+	faults  map[string]*atomic.Bool
+}
+
+// FaultInjectionState is the runtime state of one FaultInjection processor
+type FaultInjectionState struct {
+	Flow      string          `json:"flow"`
+	Processor string          `json:"processor"`
+	Enabled   bool            `json:"enabled"`
+	Faults    map[string]bool `json:"faults"`
+}
+
+func newProcessorSwitch(enabled bool, faults []*fault) *processorSwitch {
+	sw := &processorSwitch{faults: make(map[string]*atomic.Bool, len(faults))}
+	sw.enabled.Store(enabled)
+	for _, f := range faults {
+		faultSwitch := &atomic.Bool{}
+		faultSwitch.Store(f.enabled)
+		sw.faults[f.name] = faultSwitch
+	}
+	return sw
+}
+
+// register adds the switch of a processor. A processor loaded again
+// by a flows reload starts from its configured state.
+func (b *switchBoard) register(flowName, processorKey string, sw *processorSwitch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.processors[switchKey{flow: flowName, processor: processorKey}] = sw
+}
+
+func (b *switchBoard) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.processors = map[switchKey]*processorSwitch{}
+}
+
+func (sw *processorSwitch) isFaultEnabled(faultName string) bool {
+	return sw.enabled.Load() && sw.faults[faultName].Load()
+}
+
+// ResetSwitches removes the switches of the loaded processors, before the flows are reloaded
+func ResetSwitches() {
+	switches.reset()
+}
+
+// GetStates returns the state of every FaultInjection processor, sorted by flow and processor key
+func GetStates() []FaultInjectionState {
+	switches.mu.RLock()
+	defer switches.mu.RUnlock()
+
+	states := make([]FaultInjectionState, 0, len(switches.processors))
+	for key, sw := range switches.processors {
+		state := FaultInjectionState{
+			Flow:      key.flow,
+			Processor: key.processor,
+			Enabled:   sw.enabled.Load(),
+			Faults:    make(map[string]bool, len(sw.faults)),
+		}
+		for name, faultSwitch := range sw.faults {
+			state.Faults[name] = faultSwitch.Load()
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Flow != states[j].Flow {
+			return states[i].Flow < states[j].Flow
+		}
+		return states[i].Processor < states[j].Processor
+	})
+	return states
+}
+
+// SetEnabled turns a FaultInjection processor on or off.
+// With a fault name only that fault is switched. With an empty flow the processor
+// is switched in every flow, and with an empty processor key all processors are switched.
+func SetEnabled(flowName, processorKey, faultName string, enabled bool) error {
+	switches.mu.RLock()
+	defer switches.mu.RUnlock()
+
+	if processorKey == "" {
+		if faultName != "" {
+			return fmt.Errorf("a processor is required to switch fault %s", faultName)
+		}
+		for key, sw := range switches.processors {
+			if flowName == "" || key.flow == flowName {
+				sw.enabled.Store(enabled)
+			}
+		}
+		return nil
+	}
+
+	var matched []*processorSwitch
+	for key, sw := range switches.processors {
+		if key.processor == processorKey && (flowName == "" || key.flow == flowName) {
+			matched = append(matched, sw)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("FaultInjection processor %s not found", processorKey)
+	}
+
+	if faultName == "" {
+		for _, sw := range matched {
+			sw.enabled.Store(enabled)
+		}
+		return nil
+	}
+
+	var faultSwitches []*atomic.Bool
+	for _, sw := range matched {
+		if faultSwitch, found := sw.faults[faultName]; found {
+			faultSwitches = append(faultSwitches, faultSwitch)
+		}
+	}
+	if len(faultSwitches) == 0 {
+		return fmt.Errorf("fault %s not found in processor %s", faultName, processorKey)
+	}
+	for _, faultSwitch := range faultSwitches {
+		faultSwitch.Store(enabled)
+	}
+	return nil
+}
@@ -39,6 +39,7 @@ const (
 	StatusCodeRangeParam  = "status_code_range" // legacy parameter. Backward compatibility
 	ExpressionsParam      = "expressions"
 	SamplePercentageParam = "sample_percentage"
+	SLOBurningParam       = "slo_burning"
 
 	hitCountMetric  = "lunar_filter_processor_hit_count"
 	missCountMetric = "lunar_filter_processor_miss_count"
@@ -63,6 +64,7 @@ type filterProcessor struct {
 	body                      string
 	bodyRequired              bool
 	statusCodeParam           public_types.StatusCodeParam
+	sloBurning                *bool
 
 	urlTree *urltree.URLTree[string]
 
@@ -139,6 +141,8 @@ func (p *filterProcessor) Execute(
 
 	checkSamplePercentageCondition(conditions, apiStream, p.samplePercentage)
 
+	checkSLOBurningCondition(conditions, apiStream, p.sloBurning)
+
 	condition := HitConditionName
 	if conditions.Contains(MissConditionName) {
 		condition = MissConditionName
@@ -162,6 +166,7 @@ func (p *filterProcessor) init() error {
 	p.extractBodyParam()
 	p.extractStatusCodeParam()
 	p.extractExpressionsParam()
+	p.extractSLOBurningParam()
 
 	if err := p.extractSamplePercentageParam(); err != nil {
 		return err
@@ -196,7 +201,7 @@ func (p *filterProcessor) isFilterCriteriaDefined() bool {
 		p.body != "" || p.statusCodeParam.IsValid() || !p.expressions.IsEmpty() ||
 		p.numericHeaderKey != "" || p.numericHeaderComparisonOp != "" ||
 		!p.queryParams.IsEmpty() || !p.requestHeaders.IsEmpty() || !p.responseHeaders.IsEmpty() ||
-		p.samplePercentage > 0 || !p.pathParams.IsEmpty()
+		p.samplePercentage > 0 || !p.pathParams.IsEmpty() || p.sloBurning != nil
 }
 
 func (p *filterProcessor) extractBodyParam() {
@@ -245,6 +250,16 @@ func (p *filterProcessor) extractSamplePercentageParam() error {
 	return nil
 }
 
+func (p *filterProcessor) extractSLOBurningParam() {
+	if param, found := p.metaData.Parameters[SLOBurningParam]; !found || !param.Value.IsBool() {
+		log.Trace().Msgf("%v not defined for %v", SLOBurningParam, p.name)
+		return
+	}
+	var sloBurning bool
+	_ = utils.ExtractBoolParam(p.metaData.Parameters, SLOBurningParam, &sloBurning)
+	p.sloBurning = &sloBurning
+}
+
 func (p *filterProcessor) extractStatusCodeParam() {
 	_ = utils.ExtractStatusCodeParam(p.metaData.Parameters,
 		StatusCodeParam,
@@ -425,6 +440,10 @@ func (p *filterProcessor) updateMetrics(
 
 	updateMetricFunc := func(metricName string) {
 		if metricObj, ok := p.metricObjects[metricName]; ok {
+			attributes, recorded := p.labelManager.LimitCardinality(metricName, attributes)
+			if !recorded {
+				return
+			}
 			metricObj.Add(context.Background(), 1, metric.WithAttributes(attributes...))
 		}
 	}
@@ -716,6 +735,35 @@ func checkSamplePercentageCondition(
 	conditions.Add(MissConditionName)
 }
 
+func checkSLOBurningCondition(
+	conditions map_set.Set[string],
+	apiStream public_types.APIStreamI,
+	sloBurning *bool,
+) {
+	if sloBurning == nil {
+		return
+	}
+
+	burning := false
+	if lunarContext := apiStream.GetContext(); !lunar_utils.IsInterfaceNil(lunarContext) {
+		flowContext := lunarContext.GetFlowContext()
+		if !lunar_utils.IsInterfaceNil(flowContext) {
+			if value, err := flowContext.Get(public_types.SLOBurningContextKey); err == nil {
+				burning, _ = value.(bool)
+			}
+		}
+	}
+
+	if burning == *sloBurning {
+		log.Trace().Msgf("condition hit: SLO burning is %v for %s", burning, apiStream.GetName())
+		conditions.Add(HitConditionName)
+		return
+	}
+
+	log.Trace().Msgf("condition failed: SLO burning is %v for %s", burning, apiStream.GetName())
+	conditions.Add(MissConditionName)
+}
+
 func checkPathParamsCondition(
 	conditions map_set.Set[string],
 	apiStream public_types.APIStreamI,
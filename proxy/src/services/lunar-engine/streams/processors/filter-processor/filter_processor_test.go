@@ -3,6 +3,7 @@ package filterprocessor
 import (
 	"testing"
 
+	lunar_context "lunar/engine/streams/lunar-context"
 	public_types "lunar/engine/streams/public-types"
 	test_utils "lunar/engine/streams/test-utils"
 	streamtypes "lunar/engine/streams/types"
@@ -452,6 +453,51 @@ func TestFilterProcessor_MethodFilter(t *testing.T) {
 	})
 }
 
+func TestFilterProcessor_SLOBurningFilter(t *testing.T) {
+	newStream := func(burning *bool) public_types.APIStreamI {
+		stream := test_utils.NewMockAPIStream(
+			"http://example.com/api/test",
+			map[string]string{},
+			map[string]string{},
+			"",
+			"",
+		)
+		lunarContext := lunar_context.NewLunarContext(lunar_context.NewContext())
+		lunarContext.SetFlowContext(lunar_context.NewContext())
+		if burning != nil {
+			require.NoError(t, lunarContext.GetFlowContext().Set(public_types.SLOBurningContextKey, *burning))
+		}
+		stream.SetContext(lunarContext)
+		return stream
+	}
+	burning, notBurning := true, false
+
+	testCases := []struct {
+		name      string
+		param     bool
+		burning   *bool
+		condition string
+	}{
+		{"burning SLO matches (hit)", true, &burning, HitConditionName},
+		{"healthy SLO does not match (miss)", true, &notBurning, MissConditionName},
+		{"no SLO status counts as not burning (hit)", false, nil, HitConditionName},
+		{"burning SLO does not match not burning (miss)", false, &burning, MissConditionName},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			params := make(map[string]streamtypes.ProcessorParam)
+			params[SLOBurningParam] = streamtypes.ProcessorParam{
+				Name:  SLOBurningParam,
+				Value: public_types.NewParamValue(testCase.param),
+			}
+			proc := createFilterProcessor(t, params)
+			procIO, err := proc.Execute("filter-test", newStream(testCase.burning))
+			require.NoError(t, err)
+			require.Equal(t, testCase.condition, procIO.Name)
+		})
+	}
+}
+
 func TestFilterProcessor_BodyFilter(t *testing.T) {
 	t.Run("body matches expected content (hit)", func(t *testing.T) {
 		expectedBody := "HelloWorld"
@@ -29,6 +29,9 @@ type generateResponseProcessor struct {
 	header     map[string]string
 	metaData   *streamtypes.ProcessorMetaData
 
+	bodyTemplate    *responseTemplate
+	headerTemplates map[string]*responseTemplate
+
 	labelManager *lunar_metrics.LabelManager
 	metricObject metric.Float64Counter
 }
@@ -65,6 +68,10 @@ func NewProcessor(
 		log.Trace().Err(err).Msgf("headers not defined for %v", metaData.Name)
 	}
 
+	if err := proc.parseTemplates(); err != nil {
+		return nil, err
+	}
+
 	if err := proc.initializeMetrics(); err != nil {
 		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
 		proc.metaData.Metrics.Enabled = false
@@ -97,10 +104,11 @@ func (p *generateResponseProcessor) onRequest(
 	flowName string,
 	apiStream publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	body, headers := p.render(flowName, apiStream)
 	var action actions.ReqLunarAction = &actions.EarlyResponseAction{
 		Status:  p.statusCode,
-		Body:    p.body,
-		Headers: p.header,
+		Body:    body,
+		Headers: headers,
 	}
 
 	p.updateMetrics(flowName, apiStream)
@@ -112,6 +120,49 @@ func (p *generateResponseProcessor) onRequest(
 	}, nil
 }
 
+func (p *generateResponseProcessor) parseTemplates() error {
+	var err error
+	p.bodyTemplate, err = newResponseTemplate(bodyParam, p.body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	p.headerTemplates = make(map[string]*responseTemplate, len(p.header))
+	for name, value := range p.header {
+		p.headerTemplates[name], err = newResponseTemplate(name, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.name, err)
+		}
+	}
+	return nil
+}
+
+// render executes the body and header templates against the request.
+// A template which fails to render is sent as an empty value, never as its raw text.
+func (p *generateResponseProcessor) render(
+	flowName string,
+	apiStream publictypes.APIStreamI,
+) (string, map[string]string) {
+	data := newTemplateData(flowName, apiStream)
+
+	body, err := p.bodyTemplate.render(data)
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s: failed to render body template", p.name)
+		body = ""
+	}
+
+	headers := make(map[string]string, len(p.headerTemplates))
+	for name, tmpl := range p.headerTemplates {
+		value, err := tmpl.render(data)
+		if err != nil {
+			log.Debug().Err(err).Msgf("%s: failed to render %s header template", p.name, name)
+			value = ""
+		}
+		headers[name] = value
+	}
+	return body, headers
+}
+
 func (p *generateResponseProcessor) onResponse(
 	_ publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
@@ -150,6 +201,10 @@ func (p *generateResponseProcessor) updateMetrics(
 	}
 
 	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes, recorded := p.labelManager.LimitCardinality(metricName, attributes)
+	if !recorded {
+		return
+	}
 	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
 
 	log.Trace().Msgf("Metrics updated for %s", p.name)
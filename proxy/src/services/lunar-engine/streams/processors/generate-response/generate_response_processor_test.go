@@ -0,0 +1,131 @@
+package processorgenerateresponse
+
+import (
+	"lunar/engine/actions"
+	"testing"
+
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateResponseStatic(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		statusParam:    429,
+		bodyParam:      "Too many requests",
+		"Content-Type": "text/plain",
+	})
+
+	procIO, err := proc.Execute("static-flow", newRequestStream(nil))
+	require.NoError(t, err)
+	require.Equal(t, &actions.EarlyResponseAction{
+		Status:  429,
+		Body:    "Too many requests",
+		Headers: map[string]string{"Content-Type": "text/plain"},
+	}, procIO.ReqAction)
+}
+
+func TestGenerateResponseTemplates(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		statusParam: 429,
+		bodyParam: `{"error": {"message": "limit exceeded for {{ .Request.PathParam "id" }}` +
+			` ({{ jsonEscape (.Request.Header "x-tenant") }})", "plan": {{ json (index .Request.JSON "plan") }},` +
+			` "queue": {{ .Context "queue_position" | default 0 }}, "flow": "{{ .Flow }}"}}`,
+		"Retry-After":     `{{ .Context "quota_reset_in_sec" | default 60 }}`,
+		"X-Request-Query": `{{ .Request.QueryParam "page" }}`,
+	})
+
+	stream := newRequestStream(map[string]string{"x-tenant": `acme "inc"`})
+	stream.SetPathParams(map[string]string{"id": "42"})
+	stream.SetContext(lunar_context.NewLunarContext(lunar_context.NewContext()))
+	require.NoError(t, stream.GetContext().GetTransactionalContext().Set("quota_reset_in_sec", int64(17)))
+
+	procIO, err := proc.Execute("templated-flow", stream)
+	require.NoError(t, err)
+
+	action, ok := procIO.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, 429, action.Status)
+	require.JSONEq(t, `{"error": {"message": "limit exceeded for 42 (acme \"inc\")",`+
+		` "plan": "gold", "queue": 0, "flow": "templated-flow"}}`, action.Body)
+	require.Equal(t, map[string]string{
+		"Retry-After":     "17",
+		"X-Request-Query": "2",
+	}, action.Headers)
+}
+
+func TestGenerateResponseTemplateWithoutContext(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		bodyParam:     `{{ .Request.Method }} {{ .Request.Path }}`,
+		"Retry-After": `{{ .Context "quota_reset_in_sec" | default 60 }}`,
+	})
+
+	procIO, err := proc.Execute("no-context-flow", newRequestStream(nil))
+	require.NoError(t, err)
+
+	action, ok := procIO.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, "POST /orders", action.Body)
+	require.Equal(t, "60", action.Headers["Retry-After"])
+}
+
+func TestGenerateResponseInvalidTemplate(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("GenerateResponse", map[string]any{
+		bodyParam: `{{ .Request.Method`,
+	}))
+	require.Error(t, err)
+}
+
+func TestGenerateResponseUnknownTemplateField(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("GenerateResponse", map[string]any{
+		"X-Tenant": `{{ .Request.Tenant }}`,
+	}))
+	require.Error(t, err)
+}
+
+func TestGenerateResponseTemplateRenderFailure(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		bodyParam:     `{"plan": {{ index .Request.JSON "plan" }}}`,
+		"Retry-After": `{{ index .Request.JSON "retry" }}`,
+	})
+
+	stream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"POST",
+		"https://api.example.com/orders",
+		map[string]string{},
+		map[string]string{},
+		"not json",
+		"",
+		0,
+	)
+	procIO, err := proc.Execute("failing-flow", stream)
+	require.NoError(t, err)
+
+	action, ok := procIO.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Empty(t, action.Body)
+	require.Equal(t, "", action.Headers["Retry-After"])
+}
+
+func newRequestStream(headers map[string]string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"POST",
+		"https://api.example.com/orders?page=2",
+		headers,
+		map[string]string{},
+		`{"plan": "gold"}`,
+		"",
+		0,
+	)
+}
+
+func createProcessor(t *testing.T, params map[string]any) streamtypes.ProcessorI {
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("GenerateResponse", params))
+	require.NoError(t, err)
+	return proc
+}
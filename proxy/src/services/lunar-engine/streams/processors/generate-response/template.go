@@ -0,0 +1,207 @@
+package processorgenerateresponse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	publictypes "lunar/engine/streams/public-types"
+	context_manager "lunar/toolkit-core/context-manager"
+)
+
+const templateDelimiter = "{{"
+
+// responseTemplate renders a parameter value of the processor.
+// Values without template actions are returned as is.
+type responseTemplate struct {
+	raw    string
+	parsed *template.Template
+}
+
+// templateData is the root object available to the templates, e.g.
+//
+//	{"error": {"message": "Rate limit exceeded for {{ .Request.PathParam "id" }}"}}
+//	Retry-After: {{ .Context "quota_reset_in_sec" | default 60 }}
+type templateData struct {
+	Flow    string
+	Request *templateRequest
+
+	lunarContext publictypes.LunarContextI
+}
+
+// templateRequest exposes the incoming request to the templates
+type templateRequest struct {
+	Method string
+	URL    string
+	Host   string
+	Path   string
+	Query  string
+	Body   string
+
+	transaction publictypes.TransactionI
+	pathParams  map[string]string
+	jsonBody    any
+	jsonParsed  bool
+}
+
+var templateFuncs = template.FuncMap{
+	"json":       toJSON,
+	"jsonEscape": jsonEscape,
+	"now":        func() time.Time { return context_manager.Get().GetClock().Now() },
+	"unix":       func(t time.Time) int64 { return t.Unix() },
+	"httpDate":   func(t time.Time) string { return t.UTC().Format(http.TimeFormat) },
+	"default":    defaultValue,
+}
+
+func newResponseTemplate(name, raw string) (*responseTemplate, error) {
+	tmpl := &responseTemplate{raw: raw}
+	if !strings.Contains(raw, templateDelimiter) {
+		return tmpl, nil
+	}
+
+	parsed, err := template.New(name).
+		Funcs(templateFuncs).
+		Option("missingkey=zero").
+		Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", name, err)
+	}
+	tmpl.parsed = parsed
+	if err = tmpl.validate(); err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// validate renders the template against an empty request, to reject references
+// to unknown fields at load time. Other errors depend on the request and are left to runtime.
+func (t *responseTemplate) validate() error {
+	_, err := t.render(&templateData{Request: &templateRequest{}})
+	if err != nil && strings.Contains(err.Error(), "can't evaluate field") {
+		return err
+	}
+	return nil
+}
+
+func (t *responseTemplate) render(data *templateData) (string, error) {
+	if t.parsed == nil {
+		return t.raw, nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.parsed.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func newTemplateData(flowName string, apiStream publictypes.APIStreamI) *templateData {
+	data := &templateData{
+		Flow:         flowName,
+		lunarContext: apiStream.GetContext(),
+		Request:      &templateRequest{pathParams: apiStream.GetPathParams()},
+	}
+
+	request := apiStream.GetRequest()
+	if request == nil {
+		return data
+	}
+	data.Request.transaction = request
+	data.Request.Method = request.GetMethod()
+	data.Request.URL = request.GetURL()
+	data.Request.Host = request.GetHost()
+	data.Request.Path = request.GetPath()
+	data.Request.Query = request.GetQuery()
+	data.Request.Body = request.GetBody()
+	return data
+}
+
+// Context returns a value of the transactional context, e.g. the quota reset time set by a Limiter
+func (d *templateData) Context(key string) any {
+	if d.lunarContext == nil {
+		return nil
+	}
+	return contextValue(d.lunarContext.GetTransactionalContext(), key)
+}
+
+// FlowContext returns a value of the flow context
+func (d *templateData) FlowContext(key string) any {
+	if d.lunarContext == nil {
+		return nil
+	}
+	return contextValue(d.lunarContext.GetFlowContext(), key)
+}
+
+func (r *templateRequest) Header(name string) string {
+	if r.transaction == nil {
+		return ""
+	}
+	value, _ := r.transaction.GetHeader(name)
+	return value
+}
+
+func (r *templateRequest) QueryParam(name string) string {
+	if r.transaction == nil {
+		return ""
+	}
+	value, _ := r.transaction.GetQueryParam(name)
+	return value
+}
+
+func (r *templateRequest) PathParam(name string) string {
+	return r.pathParams[name]
+}
+
+// JSON returns the request body parsed as JSON, or nil if the body is not JSON
+func (r *templateRequest) JSON() any {
+	if !r.jsonParsed {
+		r.jsonParsed = true
+		if err := json.Unmarshal([]byte(r.Body), &r.jsonBody); err != nil {
+			r.jsonBody = nil
+		}
+	}
+	return r.jsonBody
+}
+
+func contextValue(ctx publictypes.ContextI, key string) any {
+	if ctx == nil {
+		return nil
+	}
+	value, err := ctx.Get(key)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+func toJSON(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// jsonEscape escapes the value to be placed inside a JSON string
+func jsonEscape(value any) (string, error) {
+	encoded, err := json.Marshal(fmt.Sprint(value))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded[1 : len(encoded)-1]), nil
+}
+
+// defaultValue returns fallback when value is empty, as in `{{ .Context "key" | default 60 }}`
+func defaultValue(fallback, value any) any {
+	if value == nil {
+		return fallback
+	}
+	if str, ok := value.(string); ok && str == "" {
+		return fallback
+	}
+	return value
+}
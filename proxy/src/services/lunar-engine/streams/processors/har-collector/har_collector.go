@@ -113,7 +113,7 @@ func (p *harCollectorProcessor) Execute(
 		ReqAction: &actions.NoOpAction{},
 	}
 
-	harEntry, err := p.generateHAREntry(apiStream)
+	harEntry, err := BuildHAREntry(apiStream, p.obfuscateEnabled, p.obfuscateExclusions)
 	if err != nil {
 		log.Trace().Err(err).Msg("Failed to generate HAR object")
 		noActionResp.Failure = true
@@ -215,6 +215,10 @@ func (p *harCollectorProcessor) updateMetrics(
 	dumpSize := p.getAggregatedDumpSize()
 
 	attr := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attr, recorded := p.labelManager.LimitCardinality(dumpSizeMetric, attr)
+	if !recorded {
+		return
+	}
 	p.metricObject.Add(context.Background(), dumpSize, metric.WithAttributes(attr...))
 	log.Trace().Msgf("Metrics updated for %s", p.name)
 }
@@ -276,9 +280,11 @@ func (p *harCollectorProcessor) ensureTransactionSize(harObject *har.Entry) erro
 	return nil
 }
 
-// generateHAREntry generates HAR entry object from the given API stream
-func (p *harCollectorProcessor) generateHAREntry(
+// BuildHAREntry generates HAR entry object from the given API stream
+func BuildHAREntry(
 	apiStream public_types.APIStreamI,
+	obfuscateEnabled bool,
+	obfuscateExclusions []string,
 ) (*har.Entry, error) {
 	request := apiStream.GetRequest()
 	response := apiStream.GetResponse()
@@ -296,7 +302,7 @@ func (p *harCollectorProcessor) generateHAREntry(
 		return nil, fmt.Errorf("parsed URL not found")
 	}
 
-	apiStreamObfuscator := newAPIStreamObfuscator(p.obfuscateEnabled, p.obfuscateExclusions, apiStream)
+	apiStreamObfuscator := newAPIStreamObfuscator(obfuscateEnabled, obfuscateExclusions, apiStream)
 
 	buildHARHeadersFunc := buildHARHeader(apiStreamObfuscator)
 	headersRequest := lo.MapToSlice(request.GetHeaders(), buildHARHeadersFunc)
@@ -7,10 +7,12 @@ import (
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
 	"lunar/toolkit-core/otel"
+	"math"
 
 	lunar_metrics "lunar/engine/metrics"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -21,6 +23,11 @@ const (
 
 	belowCountMetric = "lunar_limiter_processor_below_count"
 	aboveCountMetric = "lunar_limiter_processor_above_count"
+
+	// QuotaIDContextKey holds the ID of the quota checked by the limiter
+	QuotaIDContextKey = "quota_id"
+	// QuotaResetInSecContextKey holds the number of seconds until the checked quota resets
+	QuotaResetInSecContextKey = "quota_reset_in_sec"
 )
 
 type limiterProcessor struct {
@@ -97,14 +104,37 @@ func (p *limiterProcessor) Execute(
 		condition = belowQuotaConditionName
 	}
 
+	p.setContext(apiStream, quota)
 	p.updateMetrics(condition, flowName, apiStream)
 
 	return streamtypes.ProcessorIO{
 		Type: apiStream.GetType(),
 		Name: condition,
+		TraceAttributes: []attribute.KeyValue{
+			attribute.String(streamtypes.TraceAttributeQuotaID, p.quotaID),
+			attribute.String(streamtypes.TraceAttributeQuotaDecision, condition),
+			attribute.Bool(streamtypes.TraceAttributeRateLimited, !isAllowed),
+		},
 	}, nil
 }
 
+// setContext exposes the quota state to the following processors, e.g. for a Retry-After header
+func (p *limiterProcessor) setContext(apiStream publictypes.APIStreamI, quota publictypes.QuotaResourceI) {
+	lunarContext := apiStream.GetContext()
+	if lunarContext == nil {
+		return
+	}
+	resetInSec := int64(math.Ceil(quota.ResetIn().Seconds()))
+	for key, value := range map[string]any{
+		QuotaIDContextKey:         p.quotaID,
+		QuotaResetInSecContextKey: resetInSec,
+	} {
+		if err := lunarContext.GetTransactionalContext().Set(key, value); err != nil {
+			log.Trace().Err(err).Msgf("%s: failed to store %s in context", p.name, key)
+		}
+	}
+}
+
 func (p *limiterProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{}
 }
@@ -147,6 +177,10 @@ func (p *limiterProcessor) updateMetrics(
 
 	updateMetricFunc := func(metricName string) {
 		if metricObj, ok := p.metricObjects[metricName]; ok {
+			attributes, recorded := p.labelManager.LimitCardinality(metricName, attributes)
+			if !recorded {
+				return
+			}
 			metricObj.Add(context.Background(), 1, metric.WithAttributes(attributes...))
 		}
 	}
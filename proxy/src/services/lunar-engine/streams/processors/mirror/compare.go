@@ -0,0 +1,172 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	compareMatch          = "match"
+	compareStatusMismatch = "status_mismatch"
+	compareBodyMismatch   = "body_mismatch"
+
+	maxReportedDiffs = 10
+)
+
+// shadowResult is the shadow response, waiting to be compared to the primary response
+type shadowResult struct {
+	done   chan struct{}
+	status int
+	body   string
+	err    error
+}
+
+func newShadowResult() *shadowResult {
+	return &shadowResult{done: make(chan struct{})}
+}
+
+func (r *shadowResult) complete(status int, body string, err error) {
+	if r == nil {
+		return
+	}
+	r.status = status
+	r.body = body
+	r.err = err
+	close(r.done)
+}
+
+func (r *shadowResult) wait(timeout time.Duration) (int, string, error) {
+	select {
+	case <-r.done:
+		return r.status, r.body, r.err
+	case <-time.After(timeout):
+		return 0, "", fmt.Errorf("timed out waiting for the shadow response")
+	}
+}
+
+type comparison struct {
+	result        string
+	primaryStatus int
+	shadowStatus  int
+	diffs         []string
+}
+
+func (c comparison) String() string {
+	if c.result == compareStatusMismatch {
+		return fmt.Sprintf("status %d != %d", c.primaryStatus, c.shadowStatus)
+	}
+	return strings.Join(c.diffs, ", ")
+}
+
+// compareResponses compares the status and body of the primary and shadow responses.
+// JSON bodies are compared structurally, ignoring the given top level fields.
+func compareResponses(
+	primaryStatus int,
+	primaryBody string,
+	shadowStatus int,
+	shadowBody string,
+	ignoreFields map[string]struct{},
+) comparison {
+	result := comparison{
+		result:        compareMatch,
+		primaryStatus: primaryStatus,
+		shadowStatus:  shadowStatus,
+	}
+	if primaryStatus != shadowStatus {
+		result.result = compareStatusMismatch
+		return result
+	}
+
+	var primaryJSON, shadowJSON any
+	primaryErr := json.Unmarshal([]byte(primaryBody), &primaryJSON)
+	shadowErr := json.Unmarshal([]byte(shadowBody), &shadowJSON)
+	if primaryErr != nil || shadowErr != nil {
+		if primaryBody != shadowBody {
+			result.result = compareBodyMismatch
+			result.diffs = []string{"body differs"}
+		}
+		return result
+	}
+
+	removeIgnoredFields(primaryJSON, ignoreFields)
+	removeIgnoredFields(shadowJSON, ignoreFields)
+	diffJSON("$", primaryJSON, shadowJSON, &result.diffs)
+	if len(result.diffs) > 0 {
+		result.result = compareBodyMismatch
+	}
+	return result
+}
+
+func removeIgnoredFields(value any, ignoreFields map[string]struct{}) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+	for field := range ignoreFields {
+		delete(object, field)
+	}
+}
+
+// diffJSON collects the paths in which the two values differ
+func diffJSON(path string, primary, shadow any, diffs *[]string) {
+	if len(*diffs) >= maxReportedDiffs {
+		return
+	}
+
+	switch primaryValue := primary.(type) {
+	case map[string]any:
+		shadowValue, ok := shadow.(map[string]any)
+		if !ok {
+			*diffs = append(*diffs, path+": type differs")
+			return
+		}
+		keys := make([]string, 0, len(primaryValue)+len(shadowValue))
+		for key := range primaryValue {
+			keys = append(keys, key)
+		}
+		for key := range shadowValue {
+			if _, found := primaryValue[key]; !found {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			primaryItem, inPrimary := primaryValue[key]
+			shadowItem, inShadow := shadowValue[key]
+			switch {
+			case !inShadow:
+				*diffs = append(*diffs, path+"."+key+": missing in shadow")
+			case !inPrimary:
+				*diffs = append(*diffs, path+"."+key+": only in shadow")
+			default:
+				diffJSON(path+"."+key, primaryItem, shadowItem, diffs)
+			}
+			if len(*diffs) >= maxReportedDiffs {
+				return
+			}
+		}
+	case []any:
+		shadowValue, ok := shadow.([]any)
+		if !ok {
+			*diffs = append(*diffs, path+": type differs")
+			return
+		}
+		if len(primaryValue) != len(shadowValue) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: length %d != %d",
+				path, len(primaryValue), len(shadowValue)))
+			return
+		}
+		for i := range primaryValue {
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), primaryValue[i], shadowValue[i], diffs)
+		}
+	default:
+		if !reflect.DeepEqual(primary, shadow) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %v != %v", path, primary, shadow))
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/otel"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	targetURLParam             = "target_url"
+	hostParam                  = "host"
+	samplePercentageParam      = "sample_percentage"
+	maxConcurrentRequestsParam = "max_concurrent_requests"
+	timeoutMillisParam         = "timeout_ms"
+	headersToSetParam          = "headers_to_set"
+	headersToRemoveParam       = "headers_to_remove"
+	compareResponsesParam      = "compare_responses"
+	compareIgnoreFieldsParam   = "compare_ignore_fields"
+
+	defaultSamplePercentage      = 100
+	defaultMaxConcurrentRequests = 10
+	defaultTimeoutMillis         = 5000
+
+	// MirrorHeaderName marks shadow requests, so the target can tell them apart
+	MirrorHeaderName = "x-lunar-mirror"
+
+	mirrorRequestsMetric = "lunar_mirror_requests"
+	mirrorDurationMetric = "lunar_mirror_request_duration"
+	mirrorCompareMetric  = "lunar_mirror_comparisons"
+
+	resultSent    = "sent"
+	resultError   = "error"
+	resultDropped = "dropped"
+)
+
+// hopHeaders are not copied to the shadow request
+var hopHeaders = []string{"host", "content-length", "connection", "transfer-encoding", "keep-alive"}
+
+type mirrorProcessor struct {
+	name                  string
+	targetURL             *url.URL
+	host                  string
+	samplePercentage      float64
+	timeout               time.Duration
+	headersToSet          map[string]string
+	headersToRemove       []string
+	compareResponses      bool
+	compareIgnoreFields   map[string]struct{}
+	maxConcurrentRequests int
+	metaData              *streamtypes.ProcessorMetaData
+
+	client  *http.Client
+	slots   chan struct{}
+	pending sync.Map // request ID -> *shadowResult, only when comparing responses
+
+	labelManager    *lunar_metrics.LabelManager
+	requestsCounter metric.Int64Counter
+	durationMetric  metric.Float64Histogram
+	compareCounter  metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &mirrorProcessor{
+		name:                  metaData.Name,
+		metaData:              metaData,
+		samplePercentage:      defaultSamplePercentage,
+		maxConcurrentRequests: defaultMaxConcurrentRequests,
+		headersToSet:          make(map[string]string),
+		compareIgnoreFields:   make(map[string]struct{}),
+		labelManager:          lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	proc.client = &http.Client{
+		Timeout: proc.timeout,
+		// the shadow target response is observed as is
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	proc.slots = make(chan struct{}, proc.maxConcurrentRequests)
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *mirrorProcessor) GetName() string {
+	return p.name
+}
+
+func (p *mirrorProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *mirrorProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		p.mirrorRequest(flowName, apiStream)
+	case public_types.StreamTypeResponse:
+		if p.compareResponses {
+			p.comparePrimaryResponse(flowName, apiStream)
+		}
+	default:
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	// the primary call is never affected by the shadow request
+	return streamtypes.ProcessorIO{
+		Type:       apiStream.GetType(),
+		ReqAction:  &actions.NoOpAction{},
+		RespAction: &actions.NoOpAction{},
+		Name:       "",
+	}, nil
+}
+
+func (p *mirrorProcessor) mirrorRequest(flowName string, apiStream public_types.APIStreamI) {
+	request := apiStream.GetRequest()
+	if request == nil {
+		return
+	}
+
+	if p.samplePercentage < 100 && rand.Float64()*100 >= p.samplePercentage {
+		return
+	}
+	requestID := apiStream.GetID()
+
+	// attributes are taken now, as the stream is not used once the primary call moves on
+	attributes := p.metricAttributes(flowName, apiStream)
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		log.Trace().Msgf("%s: max concurrent shadow requests reached, dropping %s",
+			p.name, requestID)
+		p.recordRequest(attributes, resultDropped, 0, 0)
+		return
+	}
+
+	shadowRequest, err := p.buildShadowRequest(request)
+	if err != nil {
+		<-p.slots
+		log.Debug().Err(err).Msgf("%s: failed to build shadow request", p.name)
+		p.recordRequest(attributes, resultError, 0, 0)
+		return
+	}
+
+	var result *shadowResult
+	if p.compareResponses {
+		result = newShadowResult()
+		p.pending.Store(requestID, result)
+		// drop the result if the primary response never arrives
+		time.AfterFunc(2*p.timeout+time.Second, func() {
+			p.pending.CompareAndDelete(requestID, result)
+		})
+	}
+
+	go func() {
+		defer func() { <-p.slots }()
+		p.sendShadowRequest(shadowRequest, attributes, result)
+	}()
+}
+
+func (p *mirrorProcessor) sendShadowRequest(
+	shadowRequest *http.Request,
+	attributes []attribute.KeyValue,
+	result *shadowResult,
+) {
+	startTime := time.Now()
+	response, err := p.client.Do(shadowRequest)
+	duration := time.Since(startTime)
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s: shadow request to %s failed", p.name, shadowRequest.URL)
+		p.recordRequest(attributes, resultError, 0, duration)
+		result.complete(0, "", err)
+		return
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	p.recordRequest(attributes, resultSent, response.StatusCode, duration)
+	result.complete(response.StatusCode, string(body), err)
+
+	log.Trace().Msgf("%s: shadow request to %s returned %d in %s",
+		p.name, shadowRequest.URL, response.StatusCode, duration)
+}
+
+func (p *mirrorProcessor) comparePrimaryResponse(flowName string, apiStream public_types.APIStreamI) {
+	response := apiStream.GetResponse()
+	if response == nil {
+		return
+	}
+
+	value, found := p.pending.LoadAndDelete(apiStream.GetID())
+	if !found {
+		return
+	}
+	result := value.(*shadowResult)
+	primaryStatus := response.GetStatus()
+	primaryBody := response.GetBody()
+	attributes := p.metricAttributes(flowName, apiStream)
+	requestID := apiStream.GetID()
+
+	go func() {
+		status, body, err := result.wait(p.timeout + time.Second)
+		if err != nil {
+			log.Trace().Err(err).Msgf("%s: no shadow response to compare for %s", p.name, requestID)
+			return
+		}
+
+		comparison := compareResponses(primaryStatus, primaryBody, status, body, p.compareIgnoreFields)
+		if comparison.result != compareMatch {
+			log.Debug().Msgf("%s: shadow response for %s differs (%s): %s",
+				p.name, requestID, comparison.result, comparison)
+		}
+		p.recordComparison(attributes, comparison.result)
+	}()
+}
+
+func (p *mirrorProcessor) buildShadowRequest(request public_types.TransactionI) (*http.Request, error) {
+	shadowURL := *p.targetURL
+	shadowURL.Path = strings.TrimSuffix(p.targetURL.Path, "/") + request.GetPath()
+	shadowURL.RawQuery = request.GetQuery()
+
+	var body io.Reader
+	if requestBody := request.GetBody(); requestBody != "" {
+		body = strings.NewReader(requestBody)
+	}
+
+	shadowRequest, err := http.NewRequest(request.GetMethod(), shadowURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range request.GetHeaders() {
+		shadowRequest.Header.Set(name, value)
+	}
+	for _, name := range hopHeaders {
+		shadowRequest.Header.Del(name)
+	}
+	for _, name := range p.headersToRemove {
+		shadowRequest.Header.Del(name)
+	}
+	for name, value := range p.headersToSet {
+		shadowRequest.Header.Set(name, value)
+	}
+	shadowRequest.Header.Set(MirrorHeaderName, "true")
+
+	if p.host != "" {
+		shadowRequest.Host = p.host
+	}
+	return shadowRequest, nil
+}
+
+func (p *mirrorProcessor) init() error {
+	var targetURL string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		targetURLParam,
+		&targetURL); err != nil {
+		return err
+	}
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		return fmt.Errorf("invalid %s for %s: %w", targetURLParam, p.name, err)
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("%s for %s must be an absolute http(s) URL, got '%s'",
+			targetURLParam, p.name, targetURL)
+	}
+	p.targetURL = parsedURL
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		hostParam,
+		&p.host); err != nil {
+		log.Trace().Msgf("%s not defined for %s", hostParam, p.name)
+	}
+
+	if _, found := p.metaData.Parameters[samplePercentageParam]; found {
+		// the percentage may be configured as an integer or as a float
+		var samplePercentageInt int
+		_ = utils.ExtractFloat64Param(p.metaData.Parameters, samplePercentageParam, &p.samplePercentage)
+		_ = utils.ExtractIntParam(p.metaData.Parameters, samplePercentageParam, &samplePercentageInt)
+		if p.samplePercentage == 0 {
+			p.samplePercentage = float64(samplePercentageInt)
+		}
+	}
+	if p.samplePercentage < 0 || p.samplePercentage > 100 {
+		return fmt.Errorf("%s should be between 0 and 100 for %s", samplePercentageParam, p.name)
+	}
+
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		maxConcurrentRequestsParam,
+		&p.maxConcurrentRequests); err != nil || p.maxConcurrentRequests <= 0 {
+		p.maxConcurrentRequests = defaultMaxConcurrentRequests
+	}
+
+	timeoutMillis := defaultTimeoutMillis
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		timeoutMillisParam,
+		&timeoutMillis); err != nil || timeoutMillis <= 0 {
+		timeoutMillis = defaultTimeoutMillis
+	}
+	p.timeout = time.Duration(timeoutMillis) * time.Millisecond
+
+	if err := utils.ExtractMapOfStringParam(p.metaData.Parameters,
+		headersToSetParam,
+		p.headersToSet); err != nil {
+		log.Trace().Msgf("%s not defined for %s", headersToSetParam, p.name)
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		headersToRemoveParam,
+		&p.headersToRemove); err != nil {
+		log.Trace().Msgf("%s not defined for %s", headersToRemoveParam, p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		compareResponsesParam,
+		&p.compareResponses); err != nil {
+		log.Trace().Msgf("%s not defined for %s", compareResponsesParam, p.name)
+	}
+
+	var ignoreFields []string
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		compareIgnoreFieldsParam,
+		&ignoreFields); err != nil {
+		log.Trace().Msgf("%s not defined for %s", compareIgnoreFieldsParam, p.name)
+	}
+	for _, field := range ignoreFields {
+		p.compareIgnoreFields[field] = struct{}{}
+	}
+
+	return nil
+}
+
+func (p *mirrorProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	var err error
+	p.requestsCounter, err = meter.Int64Counter(mirrorRequestsMetric,
+		metric.WithDescription(fmt.Sprintf("Shadow requests count for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize shadow requests metric: %w", err)
+	}
+
+	p.durationMetric, err = meter.Float64Histogram(mirrorDurationMetric,
+		metric.WithDescription(fmt.Sprintf("Shadow requests duration for %s", p.name)),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize shadow duration metric: %w", err)
+	}
+
+	p.compareCounter, err = meter.Int64Counter(mirrorCompareMetric,
+		metric.WithDescription(fmt.Sprintf("Shadow and primary responses comparisons for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize comparison metric: %w", err)
+	}
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *mirrorProcessor) metricAttributes(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+) []attribute.KeyValue {
+	if !p.metaData.IsMetricsEnabled() {
+		return nil
+	}
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	return append(attributes, attribute.String("target", p.targetURL.Host))
+}
+
+func (p *mirrorProcessor) recordRequest(
+	attributes []attribute.KeyValue,
+	result string,
+	status int,
+	duration time.Duration,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	requestAttributes := append([]attribute.KeyValue{attribute.String("result", result)}, attributes...)
+	requestAttributes, recorded := p.labelManager.LimitCardinality(mirrorRequestsMetric,
+		requestAttributes)
+	if recorded {
+		p.requestsCounter.Add(context.Background(), 1, metric.WithAttributes(requestAttributes...))
+	}
+	if result == resultDropped {
+		return
+	}
+
+	durationAttributes := append([]attribute.KeyValue{attribute.Int("shadow_status_code", status)},
+		attributes...)
+	durationAttributes, recorded = p.labelManager.LimitCardinality(mirrorDurationMetric,
+		durationAttributes)
+	if !recorded {
+		return
+	}
+	p.durationMetric.Record(context.Background(), float64(duration.Milliseconds()),
+		metric.WithAttributes(durationAttributes...))
+}
+
+func (p *mirrorProcessor) recordComparison(attributes []attribute.KeyValue, result string) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+	compareAttributes := append([]attribute.KeyValue{attribute.String("result", result)}, attributes...)
+	compareAttributes, recorded := p.labelManager.LimitCardinality(mirrorCompareMetric,
+		compareAttributes)
+	if !recorded {
+		return
+	}
+	p.compareCounter.Add(context.Background(), 1, metric.WithAttributes(compareAttributes...))
+}
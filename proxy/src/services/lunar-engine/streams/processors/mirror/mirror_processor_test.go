@@ -0,0 +1,213 @@
+package mirror
+
+import (
+	"io"
+	"lunar/engine/actions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+type shadowCall struct {
+	method  string
+	path    string
+	query   string
+	host    string
+	headers http.Header
+	body    string
+}
+
+func TestMirrorRequest(t *testing.T) {
+	calls := make(chan shadowCall, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		calls <- shadowCall{
+			method:  req.Method,
+			path:    req.URL.Path,
+			query:   req.URL.RawQuery,
+			host:    req.Host,
+			headers: req.Header,
+			body:    string(body),
+		}
+	}))
+	defer shadow.Close()
+
+	proc := createMirrorProcessor(t, map[string]any{
+		targetURLParam:       shadow.URL + "/v2",
+		hostParam:            "v2.example.com",
+		headersToSetParam:    map[string]string{"x-env": "shadow"},
+		headersToRemoveParam: []string{"authorization"},
+	})
+
+	stream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"POST",
+		"https://example.com/users?limit=10",
+		map[string]string{"authorization": "Bearer token", "x-tenant": "acme"},
+		map[string]string{},
+		`{"name":"jane"}`,
+		"",
+		0,
+	)
+	procIO, err := proc.Execute("mirror-test", stream)
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, procIO.ReqAction)
+
+	select {
+	case call := <-calls:
+		require.Equal(t, "POST", call.method)
+		require.Equal(t, "/v2/users", call.path)
+		require.Equal(t, "limit=10", call.query)
+		require.Equal(t, "v2.example.com", call.host)
+		require.Equal(t, `{"name":"jane"}`, call.body)
+		require.Equal(t, "acme", call.headers.Get("x-tenant"))
+		require.Equal(t, "shadow", call.headers.Get("x-env"))
+		require.Equal(t, "true", call.headers.Get(MirrorHeaderName))
+		require.Empty(t, call.headers.Get("authorization"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow request was not sent")
+	}
+}
+
+func TestMirrorBoundsConcurrentRequests(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan struct{}, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	proc := createMirrorProcessor(t, map[string]any{
+		targetURLParam:             shadow.URL,
+		maxConcurrentRequestsParam: 1,
+	}).(*mirrorProcessor)
+
+	for range 3 {
+		_, err := proc.Execute("mirror-test", newRequestStream())
+		require.NoError(t, err)
+	}
+
+	<-received
+	require.Len(t, proc.slots, 1)
+	select {
+	case <-received:
+		t.Fatal("only a single shadow request should be in flight")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMirrorSampling(t *testing.T) {
+	proc := createMirrorProcessor(t, map[string]any{
+		targetURLParam:        "http://localhost:1",
+		samplePercentageParam: 0,
+	}).(*mirrorProcessor)
+
+	_, err := proc.Execute("mirror-test", newRequestStream())
+	require.NoError(t, err)
+	require.Empty(t, proc.slots)
+}
+
+func TestMirrorCompareResponses(t *testing.T) {
+	shadow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		_, _ = writer.Write([]byte(`{"id":2,"items":[1,2],"total":2}`))
+	}))
+	defer shadow.Close()
+
+	proc := createMirrorProcessor(t, map[string]any{
+		targetURLParam:           shadow.URL,
+		compareResponsesParam:    true,
+		compareIgnoreFieldsParam: []string{"id"},
+	}).(*mirrorProcessor)
+
+	_, err := proc.Execute("mirror-test", newRequestStream())
+	require.NoError(t, err)
+	value, found := proc.pending.Load("stream-id")
+	require.True(t, found)
+
+	status, body, err := value.(*shadowResult).wait(5 * time.Second)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+
+	result := compareResponses(http.StatusOK, `{"id":1,"items":[1,3],"total":2}`, status, body,
+		proc.compareIgnoreFields)
+	require.Equal(t, compareBodyMismatch, result.result)
+	require.Equal(t, []string{"$.items[1]: 3 != 2"}, result.diffs)
+
+	responseStream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeResponse,
+		"GET",
+		"https://example.com/items",
+		map[string]string{},
+		map[string]string{},
+		"",
+		`{"id":1,"items":[1,2],"total":2}`,
+		http.StatusOK,
+	)
+	procIO, err := proc.Execute("mirror-test", responseStream)
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, procIO.RespAction)
+	_, found = proc.pending.Load("stream-id")
+	require.False(t, found)
+}
+
+func TestCompareResponses(t *testing.T) {
+	ignore := map[string]struct{}{}
+
+	require.Equal(t, compareMatch,
+		compareResponses(200, `{"a":1,"b":[1,2]}`, 200, `{"b":[1,2],"a":1}`, ignore).result)
+	require.Equal(t, compareStatusMismatch,
+		compareResponses(200, `{}`, 500, `{}`, ignore).result)
+	require.Equal(t, compareMatch,
+		compareResponses(200, "plain text", 200, "plain text", ignore).result)
+	require.Equal(t, compareBodyMismatch,
+		compareResponses(200, "plain text", 200, "other text", ignore).result)
+
+	result := compareResponses(200, `{"a":1,"b":{"c":true}}`, 200, `{"b":{"c":"true"},"d":null}`, ignore)
+	require.Equal(t, compareBodyMismatch, result.result)
+	require.Equal(t, []string{
+		"$.a: missing in shadow",
+		"$.b.c: true != true",
+		"$.d: only in shadow",
+	}, result.diffs)
+}
+
+func TestMirrorInvalidConfig(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("Mirror", map[string]any{}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("Mirror", map[string]any{
+		targetURLParam: "shadow.example.com",
+	}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("Mirror", map[string]any{
+		targetURLParam:        "https://shadow.example.com",
+		samplePercentageParam: 150,
+	}))
+	require.Error(t, err)
+}
+
+func newRequestStream() public_types.APIStreamI {
+	return test_utils.NewMockAPIStream(
+		"https://example.com/items",
+		map[string]string{},
+		map[string]string{},
+		"",
+		"",
+	)
+}
+
+func createMirrorProcessor(t *testing.T, params map[string]any) streamtypes.ProcessorI {
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("Mirror", params))
+	require.NoError(t, err)
+	return proc
+}
@@ -14,6 +14,7 @@ type mockAPIStream struct {
 	streamType publictypes.StreamType
 	actionType publictypes.StreamType
 	context    publictypes.LunarContextI
+	pathParams map[string]string
 	request    publictypes.TransactionI
 	response   publictypes.TransactionI
 }
@@ -90,6 +91,14 @@ func (m *mockAPIStream) SetContext(context publictypes.LunarContextI) {
 	m.context = context
 }
 
+func (m *mockAPIStream) GetPathParams() map[string]string {
+	return m.pathParams
+}
+
+func (m *mockAPIStream) SetPathParams(pathParams map[string]string) {
+	m.pathParams = pathParams
+}
+
 func (m *mockAPIStream) GetID() string {
 	return ""
 }
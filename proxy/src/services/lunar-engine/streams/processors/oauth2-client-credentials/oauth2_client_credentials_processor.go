@@ -0,0 +1,334 @@
+package oauth2clientcredentials
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/saturation"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/otel"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	tokenURLParam                = "token_url"
+	clientIDParam                = "client_id"
+	clientSecretParam            = "client_secret"
+	scopesParam                  = "scopes"
+	audienceParam                = "audience"
+	authMethodParam              = "auth_method"
+	refreshBeforeExpirySecParam  = "refresh_before_expiry_sec"
+	defaultExpiresInSecParam     = "default_expires_in_sec"
+	tokenRequestTimeoutSecParam  = "token_request_timeout_sec"
+	retryOnUnauthorizedParam     = "retry_on_unauthorized"
+	defaultRefreshBeforeExpiry   = 60 * time.Second
+	defaultExpiresIn             = time.Hour
+	defaultTokenRequestTimeout   = 10 * time.Second
+	authorizationHeader          = "authorization"
+	retryAttemptHeader           = "x-lunar-retry-attempt"
+	bearerPrefix                 = "Bearer "
+	sharedStateKeyPrefix         = "oauth2_client_credentials::"
+	tokenRequestTimeoutLeaseSlop = 5 * time.Second
+
+	tokenMetric = "lunar_oauth2_client_credentials_count"
+
+	resultInjected    = "injected"
+	resultUnavailable = "token_unavailable"
+	resultRetried     = "unauthorized_retry"
+)
+
+type oauth2ClientCredentialsProcessor struct {
+	name                string
+	tokens              *tokenManager
+	retryOnUnauthorized bool
+	metaData            *streamtypes.ProcessorMetaData
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &oauth2ClientCredentialsProcessor{
+		name:                metaData.Name,
+		metaData:            metaData,
+		retryOnUnauthorized: true,
+		labelManager:        lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *oauth2ClientCredentialsProcessor) GetName() string {
+	return p.name
+}
+
+func (p *oauth2ClientCredentialsProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	// the request is captured, so it can be sent again with a new token
+	return &streamtypes.ProcessorRequirement{
+		IsReqCaptureRequired: true,
+		IsBodyRequired:       true,
+		IsRequestModifier:    true,
+	}
+}
+
+func (p *oauth2ClientCredentialsProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		return p.onRequest(flowName, apiStream), nil
+	case public_types.StreamTypeResponse:
+		return p.onResponse(flowName, apiStream), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *oauth2ClientCredentialsProcessor) onRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	noOp := streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		ReqAction: &actions.NoOpAction{},
+		Name:      "",
+	}
+
+	request := apiStream.GetRequest()
+	if request == nil {
+		return noOp
+	}
+
+	fetchStart := p.tokens.clock.Now()
+	token, err := p.tokens.token()
+	// a token fetch waits on the provider, which is not engine processing time
+	saturation.AddWait(apiStream.GetID(), p.tokens.clock.Since(fetchStart))
+	if err != nil {
+		// the request is sent as is, the provider decides how to handle it
+		log.Warn().Err(err).Msgf("%s: no access token for %s", p.name, apiStream.GetURL())
+		p.updateMetrics(flowName, apiStream, resultUnavailable)
+		return noOp
+	}
+
+	authorization := bearerPrefix + token.AccessToken
+	if headers := request.GetHeaders(); headers != nil {
+		headers[authorizationHeader] = authorization
+	}
+	p.updateMetrics(flowName, apiStream, resultInjected)
+
+	return streamtypes.ProcessorIO{
+		Type: public_types.StreamTypeRequest,
+		ReqAction: &actions.ModifyHeadersAction{
+			HeadersToSet: map[string]string{authorizationHeader: authorization},
+		},
+		Name: "",
+	}
+}
+
+func (p *oauth2ClientCredentialsProcessor) onResponse(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	noOp := streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: &actions.NoOpAction{},
+		Name:       "",
+	}
+
+	response := apiStream.GetResponse()
+	request := apiStream.GetRequest()
+	if !p.retryOnUnauthorized || response == nil || request == nil ||
+		response.GetStatus() != http.StatusUnauthorized {
+		return noOp
+	}
+
+	// retried requests carry this header, so a request is retried only once
+	if request.DoesHeaderValueMatch(retryAttemptHeader, "true") {
+		log.Debug().Msgf("%s: %s was rejected again after a token refresh", p.name, apiStream.GetURL())
+		return noOp
+	}
+
+	rejectedToken, _ := request.GetHeader(authorizationHeader)
+	rejectedToken = strings.TrimPrefix(rejectedToken, bearerPrefix)
+	fetchStart := p.tokens.clock.Now()
+	token, err := p.tokens.replaceRejected(rejectedToken)
+	saturation.AddWait(apiStream.GetID(), p.tokens.clock.Since(fetchStart))
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s: failed to refresh the rejected access token", p.name)
+		p.updateMetrics(flowName, apiStream, resultUnavailable)
+		return noOp
+	}
+
+	log.Debug().Msgf("%s: access token rejected by %s, retrying with a new token",
+		p.name, apiStream.GetURL())
+	p.updateMetrics(flowName, apiStream, resultRetried)
+
+	return streamtypes.ProcessorIO{
+		Type: public_types.StreamTypeResponse,
+		RespAction: &actions.RetryRequestAction{
+			HeadersToSet: map[string]string{authorizationHeader: bearerPrefix + token.AccessToken},
+		},
+		Name: "",
+	}
+}
+
+func (p *oauth2ClientCredentialsProcessor) init() error {
+	config := tokenRequestConfig{authMethod: authMethodBasic}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		tokenURLParam,
+		&config.tokenURL); err != nil {
+		return fmt.Errorf("%s is required for %s", tokenURLParam, p.name)
+	}
+	parsedURL, err := url.Parse(config.tokenURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("%s must be an absolute http(s) URL for %s", tokenURLParam, p.name)
+	}
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		clientIDParam,
+		&config.clientID); err != nil || config.clientID == "" {
+		return fmt.Errorf("%s is required for %s", clientIDParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		clientSecretParam,
+		&config.clientSecret); err != nil || config.clientSecret == "" {
+		return fmt.Errorf("%s is required for %s", clientSecretParam, p.name)
+	}
+	config.clientID = utils.ResolveEnvValue(config.clientID)
+	config.clientSecret = utils.ResolveEnvValue(config.clientSecret)
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		scopesParam,
+		&config.scopes); err != nil {
+		log.Trace().Msgf("%s not defined for %s", scopesParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		audienceParam,
+		&config.audience); err != nil {
+		log.Trace().Msgf("%s not defined for %s", audienceParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		authMethodParam,
+		&config.authMethod); err != nil || config.authMethod == "" {
+		config.authMethod = authMethodBasic
+	}
+	if config.authMethod != authMethodBasic && config.authMethod != authMethodBody {
+		return fmt.Errorf("%s must be %s or %s for %s",
+			authMethodParam, authMethodBasic, authMethodBody, p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		retryOnUnauthorizedParam,
+		&p.retryOnUnauthorized); err != nil {
+		log.Trace().Msgf("%s not defined for %s", retryOnUnauthorizedParam, p.name)
+	}
+
+	refreshBefore := p.extractDuration(refreshBeforeExpirySecParam, defaultRefreshBeforeExpiry)
+	expiresIn := p.extractDuration(defaultExpiresInSecParam, defaultExpiresIn)
+	requestTimeout := p.extractDuration(tokenRequestTimeoutSecParam, defaultTokenRequestTimeout)
+	if requestTimeout <= 0 {
+		requestTimeout = defaultTokenRequestTimeout
+	}
+
+	clock := context_manager.Get().GetClock()
+	p.tokens = &tokenManager{
+		config:           config,
+		client:           &http.Client{Timeout: requestTimeout},
+		clock:            clock,
+		state:            lunar_context.NewSharedState[[]byte]().WithClock(clock),
+		leases:           lunar_context.NewSharedState[int64]().WithClock(clock),
+		cacheKey:         sharedStateKeyPrefix + credentialsKey(config),
+		leaseKey:         sharedStateKeyPrefix + credentialsKey(config) + "::lease",
+		refreshBefore:    refreshBefore,
+		defaultExpiresIn: expiresIn,
+		// the lease outlives the token request, so a slow endpoint isn't called twice
+		leaseTTL: requestTimeout + tokenRequestTimeoutLeaseSlop,
+	}
+	return nil
+}
+
+func (p *oauth2ClientCredentialsProcessor) extractDuration(
+	paramName string,
+	defaultValue time.Duration,
+) time.Duration {
+	var seconds int
+	if err := utils.ExtractIntParam(p.metaData.Parameters, paramName, &seconds); err != nil || seconds < 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (p *oauth2ClientCredentialsProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(tokenMetric,
+		metric.WithDescription(fmt.Sprintf("Access token handling count for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize token metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *oauth2ClientCredentialsProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	result string,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes, attribute.String("result", result))
+	attributes, recorded := p.labelManager.LimitCardinality(tokenMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
+
+// credentialsKey identifies the token of the credentials in the shared state
+func credentialsKey(config tokenRequestConfig) string {
+	digest := sha256.Sum256([]byte(strings.Join([]string{
+		config.tokenURL,
+		config.clientID,
+		strings.Join(config.scopes, " "),
+		config.audience,
+	}, "\n")))
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,223 @@
+package oauth2clientcredentials
+
+import (
+	"fmt"
+	"lunar/engine/actions"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tokenServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	status   int
+	delay    time.Duration
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	server := &tokenServer{status: http.StatusOK}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		count := server.requests.Add(1)
+		time.Sleep(server.delay)
+
+		clientID, clientSecret, _ := req.BasicAuth()
+		if req.FormValue("grant_type") != "client_credentials" ||
+			clientID != "my-client" || clientSecret != "my-secret" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if server.status != http.StatusOK {
+			writer.WriteHeader(server.status)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(writer, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`,
+			count, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOAuth2InjectsCachedToken(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	proc := createProcessor(t, server.URL)
+
+	for range 3 {
+		stream := newRequestStream(map[string]string{})
+		procIO, err := proc.Execute("oauth2-test", stream)
+		require.NoError(t, err)
+		require.Equal(t, &actions.ModifyHeadersAction{
+			HeadersToSet: map[string]string{authorizationHeader: "Bearer token-1"},
+		}, procIO.ReqAction)
+
+		authorization, _ := stream.GetHeader(authorizationHeader)
+		require.Equal(t, "Bearer token-1", authorization)
+	}
+	require.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestOAuth2SingleFlightRefresh(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	server.delay = 100 * time.Millisecond
+	proc := createProcessor(t, server.URL)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			procIO, err := proc.Execute("oauth2-test", newRequestStream(map[string]string{}))
+			require.NoError(t, err)
+			require.IsType(t, &actions.ModifyHeadersAction{}, procIO.ReqAction)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestOAuth2RetriesOnceOnUnauthorized(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	proc := createProcessor(t, server.URL)
+
+	_, err := proc.Execute("oauth2-test", newRequestStream(map[string]string{}))
+	require.NoError(t, err)
+
+	procIO, err := proc.Execute("oauth2-test", newResponseStream(http.StatusUnauthorized,
+		map[string]string{authorizationHeader: "Bearer token-1"}))
+	require.NoError(t, err)
+	require.Equal(t, &actions.RetryRequestAction{
+		HeadersToSet: map[string]string{authorizationHeader: "Bearer token-2"},
+	}, procIO.RespAction)
+	require.Equal(t, int32(2), server.requests.Load())
+
+	// a concurrent call rejected with the old token reuses the refreshed one
+	procIO, err = proc.Execute("oauth2-test", newResponseStream(http.StatusUnauthorized,
+		map[string]string{authorizationHeader: "Bearer token-1"}))
+	require.NoError(t, err)
+	require.IsType(t, &actions.RetryRequestAction{}, procIO.RespAction)
+	require.Equal(t, int32(2), server.requests.Load())
+
+	procIO, err = proc.Execute("oauth2-test", newResponseStream(http.StatusUnauthorized,
+		map[string]string{authorizationHeader: "Bearer token-2", retryAttemptHeader: "true"}))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, procIO.RespAction)
+
+	procIO, err = proc.Execute("oauth2-test", newResponseStream(http.StatusOK,
+		map[string]string{authorizationHeader: "Bearer token-2"}))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, procIO.RespAction)
+	require.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestOAuth2RefreshesBeforeExpiry(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+
+	server := newTokenServer(t, 120)
+	proc := createProcessor(t, server.URL)
+
+	_, err := proc.Execute("oauth2-test", newRequestStream(map[string]string{}))
+	require.NoError(t, err)
+
+	// within the refresh window the cached token is still used, while a new one is fetched
+	mockClock.AdvanceTime(70 * time.Second)
+	stream := newRequestStream(map[string]string{})
+	_, err = proc.Execute("oauth2-test", stream)
+	require.NoError(t, err)
+	authorization, _ := stream.GetHeader(authorizationHeader)
+	require.Equal(t, "Bearer token-1", authorization)
+
+	require.Eventually(t, func() bool {
+		stream := newRequestStream(map[string]string{})
+		_, _ = proc.Execute("oauth2-test", stream)
+		authorization, _ := stream.GetHeader(authorizationHeader)
+		return authorization == "Bearer token-2"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestOAuth2TokenEndpointFailure(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	server.status = http.StatusInternalServerError
+	proc := createProcessor(t, server.URL)
+
+	for range 3 {
+		stream := newRequestStream(map[string]string{})
+		procIO, err := proc.Execute("oauth2-test", stream)
+		require.NoError(t, err)
+		require.IsType(t, &actions.NoOpAction{}, procIO.ReqAction)
+		_, found := stream.GetHeader(authorizationHeader)
+		require.False(t, found)
+	}
+	// the failed refresh is not repeated for every request
+	require.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestOAuth2InvalidConfig(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("OAuth2ClientCredentials", map[string]any{
+		clientIDParam:     "my-client",
+		clientSecretParam: "my-secret",
+	}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("OAuth2ClientCredentials", map[string]any{
+		tokenURLParam:     "https://auth.example.com/token",
+		clientSecretParam: "my-secret",
+	}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("OAuth2ClientCredentials", map[string]any{
+		tokenURLParam:     "https://auth.example.com/token",
+		clientIDParam:     "my-client",
+		clientSecretParam: "my-secret",
+		authMethodParam:   "jwt",
+	}))
+	require.Error(t, err)
+}
+
+func createProcessor(t *testing.T, tokenURL string) streamtypes.ProcessorI {
+	metaData := test_utils.NewProcessorMetaData("OAuth2ClientCredentials", map[string]any{
+		tokenURLParam:     tokenURL,
+		clientIDParam:     "my-client",
+		clientSecretParam: "my-secret",
+		scopesParam:       []string{"read", "write"},
+	})
+	proc, err := NewProcessor(metaData)
+	require.NoError(t, err)
+	return proc
+}
+
+func newRequestStream(headers map[string]string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStream(
+		"https://api.example.com/orders",
+		headers,
+		map[string]string{},
+		"",
+		"",
+	)
+}
+
+func newResponseStream(status int, requestHeaders map[string]string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeResponse,
+		"GET",
+		"https://api.example.com/orders",
+		requestHeaders,
+		map[string]string{},
+		"",
+		"",
+		status,
+	)
+}
@@ -0,0 +1,255 @@
+package oauth2clientcredentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	authMethodBasic = "basic"
+	authMethodBody  = "body"
+
+	leasePollInterval = 100 * time.Millisecond
+	maxTokenBodySize  = 1 << 20
+)
+
+var errTokenUnavailable = errors.New("access token is not available")
+
+// cachedToken is the access token kept in the shared state
+type cachedToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+type tokenRequestConfig struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	audience     string
+	authMethod   string
+}
+
+// refreshCall is a token refresh shared by all the callers waiting for it
+type refreshCall struct {
+	done  chan struct{}
+	token *cachedToken
+	err   error
+}
+
+// tokenManager fetches access tokens and caches them in the shared state.
+// A single refresh runs at a time: locally through the in flight call,
+// and across gateways through a lease taken in the shared state.
+type tokenManager struct {
+	config           tokenRequestConfig
+	client           *http.Client
+	clock            clock.Clock
+	state            public_types.SharedStateI[[]byte]
+	leases           public_types.SharedStateI[int64]
+	cacheKey         string
+	leaseKey         string
+	refreshBefore    time.Duration
+	defaultExpiresIn time.Duration
+	leaseTTL         time.Duration
+
+	mutex     sync.Mutex
+	inflight  *refreshCall
+	failedAt  time.Time
+	lastError error
+}
+
+// token returns a valid access token. Tokens close to their expiry are refreshed
+// in the background, while expired or missing tokens are refreshed before returning.
+func (m *tokenManager) token() (*cachedToken, error) {
+	cached := m.cached()
+	now := m.clock.Now()
+	if cached != nil && now.Before(cached.ExpiresAt) {
+		if !now.Before(cached.ExpiresAt.Add(-m.refreshBefore)) {
+			m.startRefresh(cached)
+		}
+		return cached, nil
+	}
+	return m.refresh(cached)
+}
+
+// replaceRejected returns a new access token instead of the one the provider rejected
+func (m *tokenManager) replaceRejected(rejectedToken string) (*cachedToken, error) {
+	cached := m.cached()
+	if cached != nil && cached.AccessToken != rejectedToken && m.clock.Now().Before(cached.ExpiresAt) {
+		return cached, nil
+	}
+	return m.refresh(cached)
+}
+
+func (m *tokenManager) refresh(previous *cachedToken) (*cachedToken, error) {
+	call := m.startRefresh(previous)
+	<-call.done
+	return call.token, call.err
+}
+
+func (m *tokenManager) startRefresh(previous *cachedToken) *refreshCall {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.inflight != nil {
+		return m.inflight
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	// a failed refresh isn't repeated until its lease expires, so callers don't pile up on it
+	if m.lastError != nil && m.clock.Since(m.failedAt) < m.leaseTTL {
+		call.err = m.lastError
+		close(call.done)
+		return call
+	}
+
+	m.inflight = call
+	go func() {
+		call.token, call.err = m.doRefresh(previous)
+		m.mutex.Lock()
+		m.inflight = nil
+		m.lastError = call.err
+		if call.err != nil {
+			m.failedAt = m.clock.Now()
+		}
+		m.mutex.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+func (m *tokenManager) doRefresh(previous *cachedToken) (*cachedToken, error) {
+	if _, _, err := m.leases.AtomicIncWindow(m.leaseKey, 1, m.leaseTTL, 1); err != nil {
+		log.Trace().Msgf("token refresh for %s is running elsewhere, waiting for it", m.config.tokenURL)
+		return m.waitForRefresh(previous)
+	}
+
+	token, err := m.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode access token: %w", err)
+	}
+	if err := m.state.Set(m.cacheKey, data); err != nil {
+		log.Warn().Err(err).Msg("failed to store access token in shared state")
+	}
+
+	// the lease is kept after a failure, so the token endpoint isn't called again right away
+	if err := m.leases.AtomicWindowReset(m.leaseKey, m.leaseTTL); err != nil {
+		log.Trace().Err(err).Msg("failed to release token refresh lease")
+	}
+	return token, nil
+}
+
+// waitForRefresh waits for the lease holder to store a new token
+func (m *tokenManager) waitForRefresh(previous *cachedToken) (*cachedToken, error) {
+	deadline := m.clock.Now().Add(m.leaseTTL)
+	for {
+		cached := m.cached()
+		if cached != nil && m.clock.Now().Before(cached.ExpiresAt) &&
+			(previous == nil || cached.AccessToken != previous.AccessToken) {
+			return cached, nil
+		}
+		if !m.clock.Now().Before(deadline) {
+			if cached != nil && m.clock.Now().Before(cached.ExpiresAt) {
+				return cached, nil
+			}
+			return nil, errTokenUnavailable
+		}
+		<-m.clock.After(leasePollInterval)
+	}
+}
+
+func (m *tokenManager) cached() *cachedToken {
+	data, err := m.state.Get(m.cacheKey)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var token cachedToken
+	if err := json.Unmarshal(data, &token); err != nil || token.AccessToken == "" {
+		return nil
+	}
+	return &token
+}
+
+// fetch requests a new access token with the client credentials grant (RFC 6749, section 4.4)
+func (m *tokenManager) fetch() (*cachedToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(m.config.scopes) > 0 {
+		form.Set("scope", strings.Join(m.config.scopes, " "))
+	}
+	if m.config.audience != "" {
+		form.Set("audience", m.config.audience)
+	}
+	if m.config.authMethod == authMethodBody {
+		form.Set("client_id", m.config.clientID)
+		form.Set("client_secret", m.config.clientSecret)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, m.config.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if m.config.authMethod == authMethodBasic {
+		request.SetBasicAuth(url.QueryEscape(m.config.clientID), url.QueryEscape(m.config.clientSecret))
+	}
+
+	requestTime := m.clock.Now()
+	response, err := m.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("token request to %s failed: %w", m.config.tokenURL, err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxTokenBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint %s returned %d: %s",
+			m.config.tokenURL, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed tokenResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if parsed.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	if parsed.TokenType != "" && !strings.EqualFold(parsed.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported token type %s", parsed.TokenType)
+	}
+
+	expiresIn := m.defaultExpiresIn
+	if seconds, err := parsed.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		expiresIn = time.Duration(seconds) * time.Second
+	}
+
+	log.Debug().Msgf("fetched access token from %s, expires in %s", m.config.tokenURL, expiresIn)
+	return &cachedToken{
+		AccessToken: parsed.AccessToken,
+		ExpiresAt:   requestTime.Add(expiresIn),
+	}, nil
+}
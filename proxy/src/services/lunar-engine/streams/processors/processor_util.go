@@ -24,6 +24,7 @@ type ProcessorManager struct {
 	processorDefsByKey map[string]map[string]*streamtypes.ProcessorDefinition
 	resources          *resources.ResourceManagement
 	sharedMemory       publictypes.SharedStateI[string]
+	validationMode     bool
 }
 
 // NewProcessorManager creates a new processor manager
@@ -42,6 +43,12 @@ func NewProcessorManager(resources *resources.ResourceManagement) *ProcessorMana
 	}
 }
 
+// WithValidationMode creates processors which only validate flows and do not handle traffic
+func (pm *ProcessorManager) WithValidationMode() *ProcessorManager {
+	pm.validationMode = true
+	return pm
+}
+
 // Init loads all processors from the processors directory
 func (pm *ProcessorManager) Init() error {
 	log.Info().Msg("Loading processors")
@@ -135,12 +142,14 @@ func (pm *ProcessorManager) CreateProcessor(
 
 	procMetadata := &streamtypes.ProcessorMetaData{
 		Name:                procConf.GetKey(),
+		FlowName:            createdByFlow,
 		Parameters:          params,
 		Metrics:             procConf.ProcessorMetrics(),
 		ProcessorDefinition: *procDef,
 		Resources:           pm.resources,
 		SharedMemory:        pm.sharedMemory,
 		Clock:               ctxMng.GetClock(),
+		IsValidation:        pm.validationMode,
 	}
 
 	_, found := pm.GetProcessorInstance(createdByFlow, procConf.GetKey())
@@ -48,6 +48,16 @@ func TestProcessorManagerInit(t *testing.T) {
 	require.NotNil(t, mng.processors["TransformAPICall"])
 	require.NotNil(t, mng.processors["CustomScript"])
 	require.NotNil(t, mng.processors["UserDefinedTraces"])
+	require.NotNil(t, mng.processors["RedactPII"])
+	require.NotNil(t, mng.processors["ValidateSchema"])
+	require.NotNil(t, mng.processors["Mirror"])
+	require.NotNil(t, mng.processors["ConsumerIdentity"])
+	require.NotNil(t, mng.processors["OAuth2ClientCredentials"])
+	require.NotNil(t, mng.processors["SignRequest"])
+	require.NotNil(t, mng.processors["CredentialPool"])
+	require.NotNil(t, mng.processors["Replay"])
+	require.NotNil(t, mng.processors["FaultInjection"])
+	require.NotNil(t, mng.processors["AdaptiveShed"])
 }
 
 func TestProcessorManagerCreateProcessor(t *testing.T) {
@@ -1,23 +1,33 @@
 package processors
 
 import (
+	processor_adaptive_shed "lunar/engine/streams/processors/adaptive-shed"
 	processor_async_queue "lunar/engine/streams/processors/async-queue"
 	processor_async_retry "lunar/engine/streams/processors/async-retry"
+	processor_consumer_identity "lunar/engine/streams/processors/consumer-identity"
 	processor_count_llm_tokens "lunar/engine/streams/processors/count-llm-tokens"
+	processor_credential_pool "lunar/engine/streams/processors/credential-pool"
 	processor_custom_script "lunar/engine/streams/processors/custom-script"
+	processor_fault_injection "lunar/engine/streams/processors/fault-injection"
 	processor_filter "lunar/engine/streams/processors/filter-processor"
 	processor_generate_response "lunar/engine/streams/processors/generate-response"
 	processor_har_collector "lunar/engine/streams/processors/har-collector"
 	processor_limiter "lunar/engine/streams/processors/limiter"
+	processor_mirror "lunar/engine/streams/processors/mirror"
 	processor_mock "lunar/engine/streams/processors/mock"
+	processor_oauth2_client_credentials "lunar/engine/streams/processors/oauth2-client-credentials"
 	processor_queue "lunar/engine/streams/processors/queue"
 	processor_quota_dec "lunar/engine/streams/processors/quota-processor-dec"
 	processor_quota_inc "lunar/engine/streams/processors/quota-processor-inc"
 	processor_read_cache "lunar/engine/streams/processors/read-cache"
+	processor_redact_pii "lunar/engine/streams/processors/redact-pii"
+	processor_replay "lunar/engine/streams/processors/replay"
 	processor_retry "lunar/engine/streams/processors/retry"
+	processor_sign_request "lunar/engine/streams/processors/sign-request"
 	processor_transform_api_call "lunar/engine/streams/processors/transform-api-call"
 	processor_user_defined_metrics "lunar/engine/streams/processors/user-defined-metrics"
 	processor_user_defined_traces "lunar/engine/streams/processors/user-defined-traces"
+	processor_validate_schema "lunar/engine/streams/processors/validate-schema"
 	processor_write_cache "lunar/engine/streams/processors/write-cache"
 	stream_types "lunar/engine/streams/types"
 )
@@ -28,23 +38,33 @@ var internalProcessorRegistry map[string]ProcessorFactory
 
 func init() {
 	internalProcessorRegistry = map[string]ProcessorFactory{
-		"MockProcessor":      processor_mock.NewProcessor,
-		"Retry":              processor_retry.NewProcessor,
-		"Filter":             processor_filter.NewProcessor,
-		"Limiter":            processor_limiter.NewProcessor,
-		"GenerateResponse":   processor_generate_response.NewProcessor,
-		"AsyncQueue":         processor_async_queue.NewProcessor,
-		"AsyncRetry":         processor_async_retry.NewProcessor,
-		"Queue":              processor_queue.NewProcessor,
-		"QuotaProcessorInc":  processor_quota_inc.NewProcessor,
-		"QuotaProcessorDec":  processor_quota_dec.NewProcessor,
-		"UserDefinedMetrics": processor_user_defined_metrics.NewProcessor,
-		"CountLLMTokens":     processor_count_llm_tokens.NewProcessor,
-		"HARCollector":       processor_har_collector.NewProcessor,
-		"ReadCache":          processor_read_cache.NewProcessor,
-		"WriteCache":         processor_write_cache.NewProcessor,
-		"TransformAPICall":   processor_transform_api_call.NewProcessor,
-		"CustomScript":       processor_custom_script.NewProcessor,
-		"UserDefinedTraces":  processor_user_defined_traces.NewProcessor,
+		"MockProcessor":           processor_mock.NewProcessor,
+		"Retry":                   processor_retry.NewProcessor,
+		"Filter":                  processor_filter.NewProcessor,
+		"Limiter":                 processor_limiter.NewProcessor,
+		"GenerateResponse":        processor_generate_response.NewProcessor,
+		"AsyncQueue":              processor_async_queue.NewProcessor,
+		"AsyncRetry":              processor_async_retry.NewProcessor,
+		"Queue":                   processor_queue.NewProcessor,
+		"QuotaProcessorInc":       processor_quota_inc.NewProcessor,
+		"QuotaProcessorDec":       processor_quota_dec.NewProcessor,
+		"UserDefinedMetrics":      processor_user_defined_metrics.NewProcessor,
+		"CountLLMTokens":          processor_count_llm_tokens.NewProcessor,
+		"HARCollector":            processor_har_collector.NewProcessor,
+		"ReadCache":               processor_read_cache.NewProcessor,
+		"WriteCache":              processor_write_cache.NewProcessor,
+		"TransformAPICall":        processor_transform_api_call.NewProcessor,
+		"CustomScript":            processor_custom_script.NewProcessor,
+		"UserDefinedTraces":       processor_user_defined_traces.NewProcessor,
+		"RedactPII":               processor_redact_pii.NewProcessor,
+		"ValidateSchema":          processor_validate_schema.NewProcessor,
+		"Mirror":                  processor_mirror.NewProcessor,
+		"ConsumerIdentity":        processor_consumer_identity.NewProcessor,
+		"OAuth2ClientCredentials": processor_oauth2_client_credentials.NewProcessor,
+		"SignRequest":             processor_sign_request.NewProcessor,
+		"CredentialPool":          processor_credential_pool.NewProcessor,
+		"Replay":                  processor_replay.NewProcessor,
+		"FaultInjection":          processor_fault_injection.NewProcessor,
+		"AdaptiveShed":            processor_adaptive_shed.NewProcessor,
 	}
 }
@@ -7,6 +7,7 @@ import (
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
+	"lunar/engine/utils/saturation"
 	clock "lunar/toolkit-core/clock"
 	context_manager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/otel"
@@ -35,6 +36,9 @@ const (
 	defaultProcessingTimeout      = time.Second * time.Duration(30)
 	defaultPriorityWhenGroupFound = 999
 	defaultIdleTimeForQueue       = 100 * time.Millisecond
+
+	// QueuePositionContextKey holds the size of the queue right after the request was enqueued
+	QueuePositionContextKey = "queue_position"
 )
 
 type queueGroup struct {
@@ -308,8 +312,12 @@ func (pg *queueGroup) enqueue(flowName string, apiStream publictypes.APIStreamI)
 		return false
 	}
 
+	pg.setQueuePosition(apiStream)
+	saturation.AddQueued(1)
+
 	// This will take care of cleaning up the request from the queue.
 	defer func() {
+		saturation.AddQueued(-1)
 		go pg.removeRequest(req.GetID())
 	}()
 
@@ -318,7 +326,10 @@ func (pg *queueGroup) enqueue(flowName string, apiStream publictypes.APIStreamI)
 	// Wait until request is processed or TTL expires
 	pg.updateMetrics(flowName, apiStream, req, true, false)
 
-	if req.Wait() {
+	waitStart := context_manager.Get().GetClock().Now()
+	processed := req.Wait()
+	saturation.AddWait(apiStream.GetID(), context_manager.Get().GetClock().Since(waitStart))
+	if processed {
 		pg.logger.Trace().Str("requestID", req.GetID()).
 			Msgf("Request processing completed")
 		pg.updateHistogramMetric(flowName, apiStream, req, false)
@@ -333,6 +344,19 @@ func (pg *queueGroup) enqueue(flowName string, apiStream publictypes.APIStreamI)
 	return false
 }
 
+// setQueuePosition exposes the position of the request to the following processors,
+// so a rejection response can report it
+func (pg *queueGroup) setQueuePosition(apiStream publictypes.APIStreamI) {
+	lunarContext := apiStream.GetContext()
+	if lunarContext == nil {
+		return
+	}
+	err := lunarContext.GetTransactionalContext().Set(QueuePositionContextKey, pg.queue.Size())
+	if err != nil {
+		pg.logger.Trace().Err(err).Msg("Failed to store queue position in context")
+	}
+}
+
 func (pg *queueGroup) removeRequest(reqID string) {
 	pg.requestsWatcher.RemoveFromWatchList(reqID)
 	pg.queue.Remove(reqID)
@@ -353,6 +377,10 @@ func (pg *queueGroup) updateHistogramMetric(
 	attributes = append(attributes, attribute.Key("priority").Float64(req.GetPriority()))
 	attributes = append(attributes, attribute.Key("ttl_expired").Bool(ttlExpired))
 	attributes = append(attributes, attribute.Key("group").String(pg.groupName))
+	attributes, recorded := pg.labelManager.LimitCardinality(requestsTimeInQueueMetric, attributes)
+	if !recorded {
+		return
+	}
 	pg.requestsTimeInQueueMeterObj.Record(
 		ctx,
 		int64(clock.Now().Sub(req.GetTimestamp()).Milliseconds()),
@@ -381,11 +409,19 @@ func (pg *queueGroup) updateMetrics(
 	ctx := context.Background()
 	attributes = append(attributes, attribute.Key("priority").Float64(req.GetPriority()))
 	attributes = append(attributes, attribute.Key("group").String(pg.groupName))
-	pg.requestsInQueueMeterObj.Add(ctx, addValue, metric.WithAttributes(attributes...))
+	// a label set is kept or dropped by the cardinality limits on enqueue and dequeue alike,
+	// so the requests in queue are not left unbalanced
+	queueAttributes, recorded := pg.labelManager.LimitCardinality(requestsInQueueMetric, attributes)
+	if recorded {
+		pg.requestsInQueueMeterObj.Add(ctx, addValue, metric.WithAttributes(queueAttributes...))
+	}
 
 	if !enqueued {
 		attributes = append(attributes, attribute.Key("ttl_expired").Bool(ttlExpired))
-		pg.requestsHandledMeterObj.Add(ctx, 1, metric.WithAttributes(attributes...))
+		attributes, recorded = pg.labelManager.LimitCardinality(requestsHandledMetric, attributes)
+		if recorded {
+			pg.requestsHandledMeterObj.Add(ctx, 1, metric.WithAttributes(attributes...))
+		}
 	}
 }
 
@@ -460,11 +496,16 @@ func (p *queueProcessor) Execute(
 		}, nil
 	}
 
+	enqueuedAt := p.clock.Now()
 	canProcess := queue.enqueue(flowName, apiStream)
+	traceAttributes := []attribute.KeyValue{
+		attribute.Int64(streamtypes.TraceAttributeQueueWaitMs, p.clock.Now().Sub(enqueuedAt).Milliseconds()),
+	}
 	if canProcess {
 		return streamtypes.ProcessorIO{
-			Type: publictypes.StreamTypeAny,
-			Name: "allowed",
+			Type:            publictypes.StreamTypeAny,
+			Name:            "allowed",
+			TraceAttributes: traceAttributes,
 		}, nil
 	}
 
@@ -472,8 +513,9 @@ func (p *queueProcessor) Execute(
 		Msgf("request cannot be processed, will return early response")
 
 	return streamtypes.ProcessorIO{
-		Type: publictypes.StreamTypeAny,
-		Name: "blocked",
+		Type:            publictypes.StreamTypeAny,
+		Name:            "blocked",
+		TraceAttributes: traceAttributes,
 	}, nil
 }
 
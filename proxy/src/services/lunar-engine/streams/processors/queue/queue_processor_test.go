@@ -142,6 +142,9 @@ func TestQueueProcessor_EnqueueIfSlotAvailable(t *testing.T) {
 	procIO, err := queueProcessor.Execute("", getAPIStream())
 	require.NoError(t, err)
 	require.NotNil(t, procIO)
+	require.Len(t, procIO.TraceAttributes, 1)
+	require.Equal(t, stream_types.TraceAttributeQueueWaitMs, string(procIO.TraceAttributes[0].Key))
+	procIO.TraceAttributes = nil
 	require.Equal(t, getProcIO(allowedKey), procIO)
 }
 
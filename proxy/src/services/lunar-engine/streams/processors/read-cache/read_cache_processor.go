@@ -153,18 +153,23 @@ func (p *readCacheProcessor) updateMetrics(
 	}
 
 	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
-	preparedAttributes := metric.WithAttributes(attributes...)
+	addMetricFunc := func(metricName string, value int64) {
+		attributes, recorded := p.labelManager.LimitCardinality(metricName, attributes)
+		if !recorded {
+			return
+		}
+		p.metricObjects[metricName].Add(context.Background(), value, metric.WithAttributes(attributes...))
+	}
 
-	ctx := context.Background()
 	if cacheServedSize > 0 {
-		p.metricObjects[cacheSizeServedMetric].Add(ctx, int64(cacheServedSize), preparedAttributes)
+		addMetricFunc(cacheSizeServedMetric, int64(cacheServedSize))
 	}
 
 	metricObjID := cacheHitMetric
 	if cacheMiss {
 		metricObjID = cacheMissMetric
 	}
-	p.metricObjects[metricObjID].Add(ctx, 1, preparedAttributes)
+	addMetricFunc(metricObjID, 1)
 
 	log.Trace().Msgf("Metrics updated for %s", p.name)
 }
@@ -0,0 +1,189 @@
+package redactpii
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type redactAction string
+
+const (
+	actionMask redactAction = "mask"
+	actionHash redactAction = "hash"
+	actionDrop redactAction = "drop"
+)
+
+const (
+	EmailDetector      = "email"
+	PhoneDetector      = "phone"
+	CreditCardDetector = "credit_card"
+	IBANDetector       = "iban"
+	SSNDetector        = "ssn"
+	IPAddressDetector  = "ip_address"
+	JWTDetector        = "jwt"
+	APIKeyDetector     = "api_key"
+)
+
+type detector struct {
+	name     string
+	pattern  *regexp.Regexp
+	validate func(string) bool
+	action   redactAction
+}
+
+// builtInDetectorsOrder defines the order in which the built-in detectors are applied.
+// More specific patterns go first, so a JWT or a credit card number
+// is not partially consumed by a more generic detector (e.g. phone).
+var builtInDetectorsOrder = []string{
+	JWTDetector,
+	APIKeyDetector,
+	CreditCardDetector,
+	IBANDetector,
+	EmailDetector,
+	SSNDetector,
+	IPAddressDetector,
+	PhoneDetector,
+}
+
+var builtInPatterns = map[string]*regexp.Regexp{
+	EmailDetector: regexp.MustCompile(
+		`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	PhoneDetector: regexp.MustCompile(
+		`\+\d{1,3}[\s.\-]?\(?\d{1,4}\)?(?:[\s.\-]?\d{2,4}){2,3}|\(?\b\d{3}\)?[\s.\-]\d{3}[\s.\-]\d{4}\b`),
+	CreditCardDetector: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+	IBANDetector:       regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+	SSNDetector:        regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	IPAddressDetector: regexp.MustCompile(
+		`\b(?:\d{1,3}\.){3}\d{1,3}\b|\b(?:[A-Fa-f0-9]{1,4}:){7}[A-Fa-f0-9]{1,4}\b`),
+	JWTDetector: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+	APIKeyDetector: regexp.MustCompile(
+		`\b(?:sk|pk|rk)_(?:live|test)_[A-Za-z0-9]{16,}\b` + // Stripe style keys
+			`|\bsk-(?:proj-|ant-)?[A-Za-z0-9_\-]{20,}` + // OpenAI / Anthropic style keys
+			`|\bAKIA[0-9A-Z]{16}\b` + // AWS access key ID
+			`|\bgh[pousr]_[A-Za-z0-9]{36,}\b` + // GitHub tokens
+			`|\bxox[abpr]-[A-Za-z0-9\-]{10,}` + // Slack tokens
+			`|\bAIza[0-9A-Za-z_\-]{35}\b`), // Google API keys
+}
+
+var builtInValidators = map[string]func(string) bool{
+	CreditCardDetector: isValidLuhn,
+	IBANDetector:       isValidIBAN,
+	SSNDetector:        isValidSSN,
+	IPAddressDetector:  isValidIP,
+}
+
+func newRedactAction(raw string) (redactAction, error) {
+	action := redactAction(strings.ToLower(strings.TrimSpace(raw)))
+	switch action {
+	case actionMask, actionHash, actionDrop:
+		return action, nil
+	}
+	return "", fmt.Errorf("unsupported action '%s', valid actions are: %s, %s, %s",
+		raw, actionMask, actionHash, actionDrop)
+}
+
+func newBuiltInDetector(name string, action redactAction) (*detector, error) {
+	pattern, found := builtInPatterns[name]
+	if !found {
+		return nil, fmt.Errorf("unknown detector '%s'", name)
+	}
+	return &detector{
+		name:     name,
+		pattern:  pattern,
+		validate: builtInValidators[name],
+		action:   action,
+	}, nil
+}
+
+func newCustomDetector(name, rawPattern string, action redactAction) (*detector, error) {
+	pattern, err := regexp.Compile(rawPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile custom pattern '%s': %w", name, err)
+	}
+	return &detector{
+		name:    name,
+		pattern: pattern,
+		action:  action,
+	}, nil
+}
+
+// isValidLuhn checks a credit card candidate using the Luhn checksum
+func isValidLuhn(candidate string) bool {
+	digits := onlyDigits(candidate)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isValidIBAN checks an IBAN candidate using the ISO 13616 mod-97 checksum
+func isValidIBAN(candidate string) bool {
+	iban := strings.ReplaceAll(candidate, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	rearranged := iban[4:] + iban[:4]
+	var numeric strings.Builder
+	for _, char := range rearranged {
+		switch {
+		case char >= '0' && char <= '9':
+			numeric.WriteRune(char)
+		case char >= 'A' && char <= 'Z':
+			numeric.WriteString(strconv.Itoa(int(char-'A') + 10))
+		default:
+			return false
+		}
+	}
+
+	value, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(value, big.NewInt(97)).Int64() == 1
+}
+
+// isValidSSN filters out number ranges which are never assigned as US SSNs
+func isValidSSN(candidate string) bool {
+	parts := strings.Split(candidate, "-")
+	if len(parts) != 3 {
+		return false
+	}
+	area, group, serial := parts[0], parts[1], parts[2]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return false
+	}
+	return group != "00" && serial != "0000"
+}
+
+func isValidIP(candidate string) bool {
+	return net.ParseIP(candidate) != nil
+}
+
+func onlyDigits(raw string) string {
+	var builder strings.Builder
+	for _, char := range raw {
+		if char >= '0' && char <= '9' {
+			builder.WriteRune(char)
+		}
+	}
+	return builder.String()
+}
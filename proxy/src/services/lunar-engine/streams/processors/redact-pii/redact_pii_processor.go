@@ -0,0 +1,538 @@
+package redactpii
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/obfuscation"
+	"lunar/toolkit-core/otel"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	detectorsParam       = "detectors"
+	actionsParam         = "actions"
+	defaultActionParam   = "default_action"
+	customPatternsParam  = "custom_patterns"
+	maskCharParam        = "mask_char"
+	redactParam          = "redact"
+	scanBodyParam        = "scan_body"
+	scanHeadersParam     = "scan_headers"
+	scanQueryParamsParam = "scan_query_params"
+	excludedHeadersParam = "excluded_headers"
+
+	detectedConditionName = "detected"
+	cleanConditionName    = "clean"
+
+	// DetectedPIIContextKey holds the sorted list of detectors that matched
+	// in the transactional context, so later processors can act on it.
+	DetectedPIIContextKey = "redact_pii_detected"
+
+	detectionCountMetric = "lunar_redact_pii_detection_count"
+	detectorLabel        = "detector"
+
+	defaultMaskChar = "*"
+)
+
+var defaultExcludedHeaders = []string{"host", "content-length", "content-type", "authorization"}
+
+type redactPIIProcessor struct {
+	name            string
+	detectors       []*detector
+	maskChar        string
+	redactEnabled   bool
+	scanBody        bool
+	scanHeaders     bool
+	scanQueryParams bool
+	excludedHeaders map[string]struct{}
+	obfuscator      obfuscation.Obfuscator
+	metaData        *streamtypes.ProcessorMetaData
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &redactPIIProcessor{
+		name:            metaData.Name,
+		metaData:        metaData,
+		maskChar:        defaultMaskChar,
+		redactEnabled:   true,
+		scanBody:        true,
+		scanHeaders:     true,
+		scanQueryParams: true,
+		excludedHeaders: make(map[string]struct{}),
+		obfuscator:      obfuscation.Obfuscator{Hasher: obfuscation.SHA256Hasher{}},
+		labelManager:    lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *redactPIIProcessor) GetName() string {
+	return p.name
+}
+
+func (p *redactPIIProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired:    p.scanBody,
+		IsRequestModifier: true,
+	}
+}
+
+func (p *redactPIIProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		return p.onRequest(flowName, apiStream)
+	case public_types.StreamTypeResponse:
+		return p.onResponse(flowName, apiStream)
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *redactPIIProcessor) onRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	request, ok := apiStream.GetRequest().(*streamtypes.OnRequest)
+	if !ok {
+		log.Trace().Msgf("%s: failed to cast request to OnRequest", p.name)
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeRequest,
+			ReqAction: &actions.NoOpAction{},
+			Name:      cleanConditionName,
+			Failure:   true,
+		}, nil
+	}
+
+	findings := make(map[string]int)
+	headersChanged, headersRemoved := p.redactHeaders(request.Headers, findings)
+	queryChanged := p.redactQueryParams(request, findings)
+
+	bodyChanged := false
+	if p.scanBody {
+		if redactedBody := p.redact(request.Body, findings); redactedBody != request.Body {
+			request.SetBody(redactedBody)
+			request.BodyMap = decodeBodyMap(redactedBody)
+			bodyChanged = true
+		}
+	}
+
+	if headersChanged || queryChanged || bodyChanged {
+		apiStream.SetRequest(request)
+	}
+
+	var action actions.ReqLunarAction = &actions.NoOpAction{}
+	switch {
+	case queryChanged || bodyChanged || headersRemoved:
+		action = &actions.ModifyRequestAction{
+			HeadersToSet: request.Headers,
+			Body:         request.Body,
+			QueryParams:  request.Query,
+		}
+	case headersChanged:
+		action = &actions.ModifyHeadersAction{
+			HeadersToSet: request.Headers,
+		}
+	}
+
+	return streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		ReqAction: action,
+		Name:      p.handleFindings(flowName, apiStream, findings),
+	}, nil
+}
+
+func (p *redactPIIProcessor) onResponse(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	response, ok := apiStream.GetResponse().(*streamtypes.OnResponse)
+	if !ok {
+		log.Trace().Msgf("%s: failed to cast response to OnResponse", p.name)
+		return streamtypes.ProcessorIO{
+			Type:       public_types.StreamTypeResponse,
+			RespAction: &actions.NoOpAction{},
+			Name:       cleanConditionName,
+			Failure:    true,
+		}, nil
+	}
+
+	findings := make(map[string]int)
+	changed, _ := p.redactHeaders(response.Headers, findings)
+
+	if p.scanBody {
+		if redactedBody := p.redact(response.Body, findings); redactedBody != response.Body {
+			response.Body = redactedBody
+			response.BodyMap = decodeBodyMap(redactedBody)
+			response.Headers["content-length"] = strconv.Itoa(len(redactedBody))
+			response.UpdateSize()
+			changed = true
+		}
+	}
+
+	var action actions.RespLunarAction = &actions.NoOpAction{}
+	if changed {
+		apiStream.SetResponse(response)
+		action = &actions.ModifyResponseAction{
+			HeadersToSet: response.Headers,
+			Body:         response.Body,
+			Status:       response.Status,
+		}
+	}
+
+	return streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: action,
+		Name:       p.handleFindings(flowName, apiStream, findings),
+	}, nil
+}
+
+// redact applies all configured detectors on the given value.
+// Matches are counted into findings and, if redaction is enabled,
+// replaced according to the detector's action.
+func (p *redactPIIProcessor) redact(value string, findings map[string]int) string {
+	if value == "" {
+		return value
+	}
+
+	for _, det := range p.detectors {
+		value = det.pattern.ReplaceAllStringFunc(value, func(match string) string {
+			if det.validate != nil && !det.validate(match) {
+				return match
+			}
+			findings[det.name]++
+			if !p.redactEnabled {
+				return match
+			}
+			return p.applyAction(det.action, match)
+		})
+	}
+	return value
+}
+
+func (p *redactPIIProcessor) applyAction(action redactAction, match string) string {
+	switch action {
+	case actionHash:
+		return p.obfuscator.ObfuscateString(match)
+	case actionDrop:
+		return ""
+	default:
+		return strings.Repeat(p.maskChar, utf8.RuneCountInString(match))
+	}
+}
+
+// redactHeaders scans header values in place.
+// Headers left empty after redaction are removed, which is reported separately
+// since removing a header requires the whole request to be rebuilt.
+func (p *redactPIIProcessor) redactHeaders(
+	headers map[string]string,
+	findings map[string]int,
+) (changed, removed bool) {
+	if !p.scanHeaders {
+		return false, false
+	}
+
+	for name, value := range headers {
+		if _, excluded := p.excludedHeaders[strings.ToLower(name)]; excluded {
+			continue
+		}
+
+		redacted := p.redact(value, findings)
+		if redacted == value {
+			continue
+		}
+
+		changed = true
+		if strings.TrimSpace(redacted) == "" {
+			delete(headers, name)
+			removed = true
+			continue
+		}
+		headers[name] = redacted
+	}
+	return changed, removed
+}
+
+// redactQueryParams scans query param values and updates the request URL accordingly.
+// Params left without any value after redaction are removed.
+func (p *redactPIIProcessor) redactQueryParams(
+	request *streamtypes.OnRequest,
+	findings map[string]int,
+) bool {
+	if !p.scanQueryParams {
+		return false
+	}
+
+	parsedURL := request.GetParsedURL()
+	if parsedURL == nil {
+		return false
+	}
+
+	changed := false
+	queryValues := parsedURL.Query()
+	for key, values := range queryValues {
+		var redactedValues []string
+		for _, value := range values {
+			redacted := p.redact(value, findings)
+			if redacted != value {
+				changed = true
+			}
+			if redacted != "" {
+				redactedValues = append(redactedValues, redacted)
+			}
+		}
+
+		if len(redactedValues) == 0 {
+			queryValues.Del(key)
+			continue
+		}
+		queryValues[key] = redactedValues
+	}
+
+	if !changed {
+		return false
+	}
+
+	request.Query = queryValues.Encode()
+	request.UpdateURL(parsedURL.Host, parsedURL.Scheme, parsedURL.Path, request.Query)
+	return true
+}
+
+// handleFindings reports the detected PII and returns the output condition
+func (p *redactPIIProcessor) handleFindings(
+	flowName string,
+	apiStream public_types.APIStreamI,
+	findings map[string]int,
+) string {
+	if len(findings) == 0 {
+		return cleanConditionName
+	}
+
+	detected := make([]string, 0, len(findings))
+	for name := range findings {
+		detected = append(detected, name)
+	}
+	sort.Strings(detected)
+
+	log.Trace().Msgf("%s: detected PII in %v: %v", p.name, apiStream.GetType(), detected)
+
+	if lunarContext := apiStream.GetContext(); lunarContext != nil {
+		if err := lunarContext.GetTransactionalContext().
+			Set(DetectedPIIContextKey, detected); err != nil {
+			log.Trace().Err(err).Msgf("%s: failed to store detected PII in context", p.name)
+		}
+	}
+
+	p.updateMetrics(flowName, apiStream, findings)
+	return detectedConditionName
+}
+
+func (p *redactPIIProcessor) init() error {
+	var detectorNames []string
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		detectorsParam,
+		&detectorNames); err != nil || len(detectorNames) == 0 {
+		log.Trace().Msgf("%s not defined for %s, using all built-in detectors",
+			detectorsParam, p.name)
+		detectorNames = builtInDetectorsOrder
+	}
+
+	defaultActionRaw := string(actionMask)
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		defaultActionParam,
+		&defaultActionRaw); err != nil || defaultActionRaw == "" {
+		defaultActionRaw = string(actionMask)
+	}
+	defaultAction, err := newRedactAction(defaultActionRaw)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", defaultActionParam, err)
+	}
+
+	detectorActions := make(map[string]string)
+	if err := utils.ExtractMapOfStringParam(p.metaData.Parameters,
+		actionsParam,
+		detectorActions); err != nil {
+		log.Trace().Msgf("%s not defined for %s", actionsParam, p.name)
+	}
+
+	customPatterns := make(map[string]string)
+	if err := utils.ExtractMapOfStringParam(p.metaData.Parameters,
+		customPatternsParam,
+		customPatterns); err != nil {
+		log.Trace().Msgf("%s not defined for %s", customPatternsParam, p.name)
+	}
+
+	actionFor := func(name string) (redactAction, error) {
+		raw, found := detectorActions[name]
+		if !found {
+			return defaultAction, nil
+		}
+		return newRedactAction(raw)
+	}
+
+	requested := make(map[string]struct{})
+	for _, name := range detectorNames {
+		requested[strings.ToLower(strings.TrimSpace(name))] = struct{}{}
+	}
+	for _, name := range builtInDetectorsOrder {
+		if _, found := requested[name]; !found {
+			continue
+		}
+		delete(requested, name)
+
+		action, err := actionFor(name)
+		if err != nil {
+			return fmt.Errorf("invalid action for detector %s: %w", name, err)
+		}
+		det, err := newBuiltInDetector(name, action)
+		if err != nil {
+			return err
+		}
+		p.detectors = append(p.detectors, det)
+	}
+	for name := range requested {
+		if _, isCustom := customPatterns[name]; !isCustom {
+			return fmt.Errorf("unknown detector '%s'", name)
+		}
+	}
+
+	customNames := make([]string, 0, len(customPatterns))
+	for name := range customPatterns {
+		customNames = append(customNames, name)
+	}
+	sort.Strings(customNames)
+	for _, name := range customNames {
+		action, err := actionFor(name)
+		if err != nil {
+			return fmt.Errorf("invalid action for detector %s: %w", name, err)
+		}
+		det, err := newCustomDetector(name, customPatterns[name], action)
+		if err != nil {
+			return err
+		}
+		p.detectors = append(p.detectors, det)
+	}
+
+	if len(p.detectors) == 0 {
+		return fmt.Errorf("no detectors defined for %s", p.name)
+	}
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		maskCharParam,
+		&p.maskChar); err != nil || p.maskChar == "" {
+		p.maskChar = defaultMaskChar
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		redactParam,
+		&p.redactEnabled); err != nil {
+		log.Trace().Msgf("%s not defined for %s", redactParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		scanBodyParam,
+		&p.scanBody); err != nil {
+		log.Trace().Msgf("%s not defined for %s", scanBodyParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		scanHeadersParam,
+		&p.scanHeaders); err != nil {
+		log.Trace().Msgf("%s not defined for %s", scanHeadersParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		scanQueryParamsParam,
+		&p.scanQueryParams); err != nil {
+		log.Trace().Msgf("%s not defined for %s", scanQueryParamsParam, p.name)
+	}
+
+	excludedHeaders := defaultExcludedHeaders
+	if _, found := p.metaData.Parameters[excludedHeadersParam]; found {
+		if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+			excludedHeadersParam,
+			&excludedHeaders); err != nil {
+			log.Trace().Msgf("%s not defined for %s", excludedHeadersParam, p.name)
+		}
+	}
+	for _, header := range excludedHeaders {
+		p.excludedHeaders[strings.ToLower(header)] = struct{}{}
+	}
+
+	return nil
+}
+
+func (p *redactPIIProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(detectionCountMetric,
+		metric.WithDescription(fmt.Sprintf("PII detections count for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize detection count metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *redactPIIProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	findings map[string]int,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	for name, count := range findings {
+		detectorAttributes := append(attributes, attribute.String(detectorLabel, name))
+		detectorAttributes, recorded := p.labelManager.LimitCardinality(detectionCountMetric,
+			detectorAttributes)
+		if !recorded {
+			continue
+		}
+		p.metricObject.Add(context.Background(), int64(count),
+			metric.WithAttributes(detectorAttributes...))
+	}
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
+
+func decodeBodyMap(body string) map[string]any {
+	bodyMap := make(map[string]any)
+	if err := json.Unmarshal([]byte(body), &bodyMap); err != nil {
+		log.Trace().Err(err).Msg("redacted body is not a JSON object")
+	}
+	return bodyMap
+}
@@ -0,0 +1,266 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"lunar/engine/formats/har"
+	lunarMessages "lunar/engine/messages"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	cassetteFileExt  = ".har"
+	base64Encoding   = "base64"
+	keyPartSeparator = "\x1f"
+)
+
+// Headers describing the recorded wire format, the replayed body is always sent decoded
+var droppedResponseHeaders = map[string]struct{}{
+	"content-encoding":  {},
+	"content-length":    {},
+	"transfer-encoding": {},
+}
+
+// keyBuilder builds the match key of a request
+type keyBuilder func(public_types.TransactionI) []string
+
+// recording is a cassette entry along with the request key it was recorded for
+type recording struct {
+	key   []string
+	entry *har.Entry
+}
+
+// cassette holds the recordings of one flow, stored as <cassette_dir>/<flow>.har
+// in the format exported by HARCollector: one HAR entry JSON per line.
+// The key of every entry is rebuilt from its recorded request.
+type cassette struct {
+	path     string
+	buildKey keyBuilder
+
+	mu         sync.Mutex
+	recordings []*recording
+	byKey      map[string][]*recording
+	// cursor rotates between the recordings of the same key, in recording order
+	cursor map[string]int
+}
+
+func loadCassette(path string, buildKey keyBuilder) (*cassette, error) {
+	c := &cassette{
+		path:     path,
+		buildKey: buildKey,
+		byKey:    make(map[string][]*recording),
+		cursor:   make(map[string]int),
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			entry := &har.Entry{}
+			if unmarshalErr := json.Unmarshal(line, entry); unmarshalErr != nil {
+				log.Debug().Err(unmarshalErr).Msgf("Skipping line %d of cassette %s", lineNumber, path)
+			} else if indexErr := c.index(entry); indexErr != nil {
+				log.Debug().Err(indexErr).Msgf("Skipping line %d of cassette %s", lineNumber, path)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+		}
+	}
+	log.Debug().Msgf("Loaded %d recordings from cassette %s", len(c.recordings), path)
+	return c, nil
+}
+
+// record appends the entry to the cassette file, as HARCollector exports it
+func (c *cassette) record(entry *har.Entry) error {
+	encodedEntry, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal HAR entry: %w", err)
+	}
+	encodedEntry = append(encodedEntry, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.index(entry); err != nil {
+		return err
+	}
+	return c.appendToFile(encodedEntry)
+}
+
+// find returns the next recording of the key.
+// When closest is set and the key was not recorded, it returns the recording
+// of the same method and host which shares the most key parts.
+func (c *cassette) find(key []string, closest bool) *har.Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	joinedKey := strings.Join(key, keyPartSeparator)
+	if recordings := c.byKey[joinedKey]; len(recordings) > 0 {
+		next := c.cursor[joinedKey] % len(recordings)
+		c.cursor[joinedKey] = next + 1
+		return recordings[next].entry
+	}
+
+	if !closest {
+		return nil
+	}
+
+	var best *recording
+	bestScore := -1
+	for _, candidate := range c.recordings {
+		score := matchScore(key, candidate.key)
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.entry
+}
+
+func (c *cassette) index(entry *har.Entry) error {
+	request, err := requestFromEntry(entry)
+	if err != nil {
+		return err
+	}
+	rec := &recording{key: c.buildKey(request), entry: entry}
+	c.recordings = append(c.recordings, rec)
+	joinedKey := strings.Join(rec.key, keyPartSeparator)
+	c.byKey[joinedKey] = append(c.byKey[joinedKey], rec)
+	return nil
+}
+
+func (c *cassette) appendToFile(content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette %s: %w", c.path, err)
+	}
+	if _, err = file.Write(content); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write cassette %s: %w", c.path, err)
+	}
+	return file.Close()
+}
+
+// requestFromEntry rebuilds the recorded request, so its key is built as for a live request
+func requestFromEntry(entry *har.Entry) (public_types.TransactionI, error) {
+	parsedURL, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded URL %s: %w", entry.Request.URL, err)
+	}
+	// obfuscated URLs are recorded without their query string
+	if parsedURL.RawQuery == "" && len(entry.Request.QueryString) > 0 {
+		query := url.Values{}
+		for _, param := range entry.Request.QueryString {
+			query.Add(param.Name, param.Value)
+		}
+		parsedURL.RawQuery = query.Encode()
+	}
+
+	headers := make(map[string]string, len(entry.Request.Headers))
+	for _, header := range entry.Request.Headers {
+		name := strings.ToLower(header.Name)
+		// the recorded body is already decoded
+		if name == "content-encoding" {
+			continue
+		}
+		headers[name] = header.Value
+	}
+
+	var body string
+	if postData := entry.Request.PostData; postData != nil {
+		body = postData.Text
+		if body == "" && len(postData.Params) > 0 {
+			params := url.Values{}
+			for _, param := range postData.Params {
+				params.Add(param.Name, param.Value)
+			}
+			body = params.Encode()
+		}
+	}
+
+	return streamtypes.NewRequest(lunarMessages.OnRequest{
+		Method:  entry.Request.Method,
+		Scheme:  parsedURL.Scheme,
+		URL:     parsedURL.Host + parsedURL.Path,
+		Path:    parsedURL.Path,
+		Query:   parsedURL.RawQuery,
+		Headers: headers,
+		RawBody: []byte(body),
+	}), nil
+}
+
+// matchScore counts the key parts equal in both keys.
+// The first parts are the method and host of the request and must be equal.
+func matchScore(key, candidate []string) int {
+	if len(key) != len(candidate) || len(key) < fixedKeyParts {
+		return -1
+	}
+	for index := 0; index < fixedKeyParts; index++ {
+		if key[index] != candidate[index] {
+			return -1
+		}
+	}
+
+	score := 0
+	for index := fixedKeyParts; index < len(key); index++ {
+		if key[index] == candidate[index] {
+			score++
+		}
+	}
+	return score
+}
+
+// responseBody decodes the recorded response body
+func responseBody(entry *har.Entry) (string, error) {
+	if entry.Response.Content.Encoding != base64Encoding {
+		return entry.Response.Content.Text, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode recorded body: %w", err)
+	}
+	return string(decoded), nil
+}
+
+func responseHeaders(entry *har.Entry) map[string]string {
+	headers := make(map[string]string, len(entry.Response.Headers))
+	for _, header := range entry.Response.Headers {
+		if _, dropped := droppedResponseHeaders[strings.ToLower(header.Name)]; dropped {
+			continue
+		}
+		headers[header.Name] = header.Value
+	}
+	return headers
+}
@@ -0,0 +1,441 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	"lunar/engine/formats/har"
+	lunar_metrics "lunar/engine/metrics"
+	harcollector "lunar/engine/streams/processors/har-collector"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/streams/stream"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/obfuscation"
+	"lunar/engine/utils/saturation"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/jsonpath"
+	"lunar/toolkit-core/otel"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	modeParam            = "mode"
+	cassetteDirParam     = "cassette_dir"
+	matchKeyPartsParam   = "match_key_parts"
+	noMatchParam         = "no_match"
+	noMatchStatusParam   = "no_match_status"
+	noMatchBodyParam     = "no_match_body"
+	simulateLatencyParam = "simulate_latency"
+
+	obfuscateEnabledParam    = "obfuscate_enabled"
+	obfuscateExclusionsParam = "obfuscate_exclusions"
+
+	modeRecord = "record"
+	modeReplay = "replay"
+
+	noMatchPassthrough = "passthrough"
+	noMatchError       = "error"
+	noMatchClosest     = "closest"
+
+	defaultNoMatchStatus = 404
+	defaultNoMatchBody   = `{"error": "no recorded response matches the request"}`
+
+	// fixedKeyParts are the method and host, which lead every key
+	fixedKeyParts = 2
+
+	replayedConditionName    = "replayed"
+	notReplayedConditionName = "not_replayed"
+
+	requestsMetric = "lunar_replay_processor_requests_count"
+
+	resultRecorded = "recorded"
+	resultReplayed = "replayed"
+	resultMissed   = "missed"
+)
+
+var defaultMatchKeyParts = []string{"$.request.path"}
+
+// Headers carrying credentials, which are never recorded in clear text.
+// When obfuscate_enabled is set, obfuscate_exclusions decide for them as for any header.
+var credentialHeaders = map[string]struct{}{
+	"authorization":       {},
+	"proxy-authorization": {},
+	"x-api-key":           {},
+	"api-key":             {},
+	"cookie":              {},
+	"set-cookie":          {},
+}
+
+type replayProcessor struct {
+	name            string
+	mode            string
+	cassetteDir     string
+	matchKeyParts   []string
+	noMatch         string
+	noMatchStatus   int
+	noMatchBody     string
+	simulateLatency bool
+
+	obfuscateEnabled    bool
+	obfuscateExclusions []string
+	obfuscator          obfuscation.Obfuscator
+
+	cassettesMu sync.Mutex
+	cassettes   map[string]*cassette // by flow name
+
+	metaData     *streamtypes.ProcessorMetaData
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &replayProcessor{
+		name:         metaData.Name,
+		metaData:     metaData,
+		cassettes:    make(map[string]*cassette),
+		obfuscator:   obfuscation.Obfuscator{Hasher: obfuscation.SHA256Hasher{}},
+		labelManager: lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *replayProcessor) GetName() string {
+	return p.name
+}
+
+func (p *replayProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *replayProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		if p.mode == modeReplay {
+			return p.onReplayRequest(flowName, apiStream)
+		}
+		return notReplayed(apiStream.GetType()), nil
+	case public_types.StreamTypeResponse:
+		if p.mode == modeRecord {
+			p.onRecordResponse(flowName, apiStream)
+		}
+		return notReplayed(apiStream.GetType()), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *replayProcessor) init() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		modeParam,
+		&p.mode); err != nil {
+		log.Error().Err(err).Msgf("Missing %s parameter", modeParam)
+		return err
+	}
+	if p.mode != modeRecord && p.mode != modeReplay {
+		return fmt.Errorf("%s: unsupported %s '%s', expected '%s' or '%s'",
+			p.name, modeParam, p.mode, modeRecord, modeReplay)
+	}
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		cassetteDirParam,
+		&p.cassetteDir); err != nil {
+		log.Error().Err(err).Msgf("Missing %s parameter", cassetteDirParam)
+		return err
+	}
+	if p.cassetteDir == "" {
+		return fmt.Errorf("%v cannot be empty", cassetteDirParam)
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		matchKeyPartsParam,
+		&p.matchKeyParts); err != nil || len(p.matchKeyParts) == 0 {
+		log.Trace().Msgf("%s not defined for %v, using %v", matchKeyPartsParam, p.name, defaultMatchKeyParts)
+		p.matchKeyParts = defaultMatchKeyParts
+	}
+
+	p.noMatch = noMatchPassthrough
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		noMatchParam,
+		&p.noMatch); err != nil {
+		log.Trace().Msgf("%s not defined for %v", noMatchParam, p.name)
+	}
+	switch p.noMatch {
+	case noMatchPassthrough, noMatchError, noMatchClosest:
+	default:
+		return fmt.Errorf("%s: unsupported %s '%s'", p.name, noMatchParam, p.noMatch)
+	}
+
+	p.noMatchStatus = defaultNoMatchStatus
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		noMatchStatusParam,
+		&p.noMatchStatus); err != nil {
+		log.Trace().Msgf("%s not defined for %v", noMatchStatusParam, p.name)
+	}
+
+	p.noMatchBody = defaultNoMatchBody
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		noMatchBodyParam,
+		&p.noMatchBody); err != nil {
+		log.Trace().Msgf("%s not defined for %v", noMatchBodyParam, p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		simulateLatencyParam,
+		&p.simulateLatency); err != nil {
+		log.Trace().Msgf("%s not defined for %v", simulateLatencyParam, p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		obfuscateEnabledParam,
+		&p.obfuscateEnabled); err != nil {
+		log.Trace().Msgf("obfuscation disabled for %v", p.name)
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		obfuscateExclusionsParam,
+		&p.obfuscateExclusions); err != nil {
+		log.Trace().Msgf("obfuscation exclusions not defined for %v", p.name)
+	}
+
+	return nil
+}
+
+func (p *replayProcessor) onReplayRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	flowCassette, err := p.getCassette(flowName)
+	if err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+
+	key := p.buildKey(apiStream.GetRequest())
+	entry := flowCassette.find(key, p.noMatch == noMatchClosest)
+	if entry == nil {
+		log.Debug().Msgf("%s: no recording matches %v", p.name, key)
+		p.updateMetrics(flowName, apiStream, resultMissed)
+		if p.noMatch == noMatchError {
+			return replayed(&actions.EarlyResponseAction{
+				Status:  p.noMatchStatus,
+				Body:    p.noMatchBody,
+				Headers: map[string]string{"Content-Type": "application/json"},
+			}), nil
+		}
+		return notReplayed(apiStream.GetType()), nil
+	}
+
+	body, err := responseBody(entry)
+	if err != nil {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	if p.simulateLatency && entry.Time > 0 {
+		latency := time.Duration(entry.Time * float64(time.Millisecond))
+		context_manager.Get().GetClock().Sleep(latency)
+		saturation.AddWait(apiStream.GetID(), latency)
+	}
+
+	log.Trace().Msgf("%s: replaying recording of %v", p.name, key)
+	p.updateMetrics(flowName, apiStream, resultReplayed)
+	return replayed(&actions.EarlyResponseAction{
+		Status:  entry.Response.Status,
+		Body:    body,
+		Headers: responseHeaders(entry),
+	}), nil
+}
+
+func (p *replayProcessor) onRecordResponse(flowName string, apiStream public_types.APIStreamI) {
+	entry, err := harcollector.BuildHAREntry(apiStream, p.obfuscateEnabled, p.obfuscateExclusions)
+	if err != nil {
+		log.Debug().Err(err).Msgf("%s: failed to build HAR entry", p.name)
+		return
+	}
+	if !p.obfuscateEnabled {
+		p.obfuscateCredentials(entry.Request.Headers)
+		p.obfuscateCredentials(entry.Response.Headers)
+	}
+
+	flowCassette, err := p.getCassette(flowName)
+	if err != nil {
+		log.Error().Err(err).Msgf("%s: failed to load cassette", p.name)
+		return
+	}
+
+	if err := flowCassette.record(entry); err != nil {
+		log.Error().Err(err).Msgf("%s: failed to record response", p.name)
+		return
+	}
+	p.updateMetrics(flowName, apiStream, resultRecorded)
+}
+
+// obfuscateCredentials hashes the values of the credential headers, as HARCollector does
+func (p *replayProcessor) obfuscateCredentials(headers []har.Header) {
+	for i, header := range headers {
+		if _, found := credentialHeaders[strings.ToLower(header.Name)]; found {
+			headers[i].Value = p.obfuscator.ObfuscateString(header.Value)
+		}
+	}
+}
+
+// getCassette loads the cassette of the flow on first use
+func (p *replayProcessor) getCassette(flowName string) (*cassette, error) {
+	p.cassettesMu.Lock()
+	defer p.cassettesMu.Unlock()
+
+	if flowCassette, found := p.cassettes[flowName]; found {
+		return flowCassette, nil
+	}
+
+	fileName := strings.ReplaceAll(flowName, string(filepath.Separator), "_") + cassetteFileExt
+	flowCassette, err := loadCassette(filepath.Join(p.cassetteDir, fileName), p.buildKey)
+	if err != nil {
+		return nil, err
+	}
+	p.cassettes[flowName] = flowCassette
+	return flowCassette, nil
+}
+
+// buildKey extracts the method, the host and the configured key parts of the request.
+// A key part which is missing from the request is kept empty.
+func (p *replayProcessor) buildKey(request public_types.TransactionI) []string {
+	key := make([]string, 0, fixedKeyParts+len(p.matchKeyParts))
+	if request == nil {
+		return append(key, make([]string, fixedKeyParts+len(p.matchKeyParts))...)
+	}
+	key = append(key, request.GetMethod(), request.GetHost())
+
+	object := stream.AsObject(&requestStream{request: request})
+	for _, part := range p.matchKeyParts {
+		value, err := jsonpath.GetJSONPathValue(object, part)
+		if err != nil {
+			key = append(key, "")
+			continue
+		}
+		key = append(key, keyPartValue(value))
+	}
+	return key
+}
+
+// requestStream exposes a request as a request stream, so live and recorded requests
+// are keyed alike. Only the methods used by stream.AsObject are implemented.
+type requestStream struct {
+	public_types.APIStreamI
+	request public_types.TransactionI
+}
+
+func (s *requestStream) GetType() public_types.StreamType {
+	return public_types.StreamTypeRequest
+}
+
+func (s *requestStream) GetRequest() public_types.TransactionI {
+	return s.request
+}
+
+func (s *requestStream) GetResponse() public_types.TransactionI {
+	return nil
+}
+
+func keyPartValue(value any) string {
+	// query params are stored as lists
+	if values, ok := value.([]any); ok && len(values) == 1 {
+		value = values[0]
+	}
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case map[string]any, []any:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return fmt.Sprintf("%v", typed)
+		}
+		return string(encoded)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func replayed(action actions.ReqLunarAction) streamtypes.ProcessorIO {
+	return streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeResponse,
+		ReqAction: action,
+		Name:      replayedConditionName,
+	}
+}
+
+func notReplayed(streamType public_types.StreamType) streamtypes.ProcessorIO {
+	processorIO := streamtypes.ProcessorIO{
+		Type: streamType,
+		Name: notReplayedConditionName,
+	}
+	if streamType == public_types.StreamTypeRequest {
+		processorIO.ReqAction = &actions.NoOpAction{}
+	} else {
+		processorIO.RespAction = &actions.NoOpAction{}
+	}
+	return processorIO
+}
+
+func (p *replayProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(requestsMetric,
+		metric.WithDescription(fmt.Sprintf("Recorded and replayed requests of %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize requests metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *replayProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	result string,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes, attribute.String("result", result))
+	attributes, recorded := p.labelManager.LimitCardinality(requestsMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
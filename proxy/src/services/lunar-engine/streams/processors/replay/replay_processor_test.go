@@ -0,0 +1,234 @@
+package replay
+
+import (
+	"lunar/engine/actions"
+	"lunar/engine/formats/har"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	harcollector "lunar/engine/streams/processors/har-collector"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testFlow = "replay-flow"
+	testHost = "https://api.example.com"
+)
+
+func TestReplayRecordsAndReplays(t *testing.T) {
+	cassetteDir := t.TempDir()
+	recorder := createProcessor(t, map[string]any{
+		modeParam:        modeRecord,
+		cassetteDirParam: cassetteDir,
+	})
+	record(t, recorder, "/items/1", `{"id": 1}`, 200)
+	record(t, recorder, "/items/2", `{"id": 2}`, 200)
+
+	content, err := os.ReadFile(filepath.Join(cassetteDir, testFlow+cassetteFileExt))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	entry := har.Entry{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	require.Equal(t, testHost+"/items/2", entry.Request.URL)
+
+	player := createProcessor(t, map[string]any{
+		modeParam:        modeReplay,
+		cassetteDirParam: cassetteDir,
+	})
+	procIO, err := player.Execute(testFlow, newRequestStream("/items/2"))
+	require.NoError(t, err)
+	require.Equal(t, replayedConditionName, procIO.Name)
+	require.Equal(t, public_types.StreamTypeResponse, procIO.Type)
+	require.Equal(t, &actions.EarlyResponseAction{
+		Status:  200,
+		Body:    `{"id": 2}`,
+		Headers: map[string]string{"content-type": "application/json"},
+	}, procIO.ReqAction)
+}
+
+func TestReplayRotatesRecordingsOfTheSameKey(t *testing.T) {
+	cassetteDir := t.TempDir()
+	recorder := createProcessor(t, map[string]any{
+		modeParam:        modeRecord,
+		cassetteDirParam: cassetteDir,
+	})
+	record(t, recorder, "/jobs/7", `{"state": "running"}`, 200)
+	record(t, recorder, "/jobs/7", `{"state": "done"}`, 200)
+
+	player := createProcessor(t, map[string]any{
+		modeParam:        modeReplay,
+		cassetteDirParam: cassetteDir,
+	})
+	require.Equal(t, `{"state": "running"}`, replayedBody(t, player, "/jobs/7"))
+	require.Equal(t, `{"state": "done"}`, replayedBody(t, player, "/jobs/7"))
+	require.Equal(t, `{"state": "running"}`, replayedBody(t, player, "/jobs/7"))
+}
+
+func TestReplayNoMatch(t *testing.T) {
+	cassetteDir := t.TempDir()
+	recorder := createProcessor(t, map[string]any{
+		modeParam:          modeRecord,
+		cassetteDirParam:   cassetteDir,
+		matchKeyPartsParam: []string{"$.request.path", "$.request.query_param.page"},
+	})
+	record(t, recorder, "/items?page=1", `{"page": 1}`, 200)
+	record(t, recorder, "/orders?page=2", `{"page": 2}`, 200)
+
+	passthrough := createProcessor(t, map[string]any{
+		modeParam:          modeReplay,
+		cassetteDirParam:   cassetteDir,
+		matchKeyPartsParam: []string{"$.request.path", "$.request.query_param.page"},
+	})
+	procIO, err := passthrough.Execute(testFlow, newRequestStream("/items?page=3"))
+	require.NoError(t, err)
+	require.Equal(t, notReplayedConditionName, procIO.Name)
+	require.Equal(t, &actions.NoOpAction{}, procIO.ReqAction)
+
+	failing := createProcessor(t, map[string]any{
+		modeParam:          modeReplay,
+		cassetteDirParam:   cassetteDir,
+		matchKeyPartsParam: []string{"$.request.path", "$.request.query_param.page"},
+		noMatchParam:       noMatchError,
+		noMatchStatusParam: 501,
+	})
+	procIO, err = failing.Execute(testFlow, newRequestStream("/items?page=3"))
+	require.NoError(t, err)
+	require.Equal(t, replayedConditionName, procIO.Name)
+	action, ok := procIO.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, 501, action.Status)
+	require.Equal(t, defaultNoMatchBody, action.Body)
+
+	closest := createProcessor(t, map[string]any{
+		modeParam:          modeReplay,
+		cassetteDirParam:   cassetteDir,
+		matchKeyPartsParam: []string{"$.request.path", "$.request.query_param.page"},
+		noMatchParam:       noMatchClosest,
+	})
+	require.Equal(t, `{"page": 1}`, replayedBody(t, closest, "/items?page=3"))
+	require.Equal(t, `{"page": 2}`, replayedBody(t, closest, "/payments?page=2"))
+}
+
+func TestReplayHARCollectorExport(t *testing.T) {
+	cassetteDir := t.TempDir()
+	var export []byte
+	for _, path := range []string{"/users/1?page=1", "/users/1?page=2"} {
+		stream := test_utils.NewMockAPIStreamFull(
+			public_types.StreamTypeResponse,
+			"GET",
+			testHost+path,
+			map[string]string{},
+			map[string]string{"content-type": "application/json"},
+			"",
+			`{"path": "`+path+`"}`,
+			200,
+		)
+		entry, err := harcollector.BuildHAREntry(stream, false, nil)
+		require.NoError(t, err)
+		encodedEntry, err := json.Marshal(entry)
+		require.NoError(t, err)
+		export = append(append(export, encodedEntry...), '\n')
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(cassetteDir, testFlow+cassetteFileExt), export, 0o600))
+
+	player := createProcessor(t, map[string]any{
+		modeParam:          modeReplay,
+		cassetteDirParam:   cassetteDir,
+		matchKeyPartsParam: []string{"$.request.path", "$.request.query_param.page"},
+	})
+	require.Equal(t, `{"path": "/users/1?page=2"}`, replayedBody(t, player, "/users/1?page=2"))
+	require.Equal(t, `{"path": "/users/1?page=1"}`, replayedBody(t, player, "/users/1?page=1"))
+}
+
+func TestReplayObfuscatesCredentialsInCassette(t *testing.T) {
+	cassetteDir := t.TempDir()
+	recorder := createProcessor(t, map[string]any{
+		modeParam:        modeRecord,
+		cassetteDirParam: cassetteDir,
+	})
+	stream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeResponse,
+		"GET",
+		testHost+"/me",
+		map[string]string{"Authorization": "Bearer secret-token", "x-api-key": "secret-key"},
+		map[string]string{"content-type": "application/json", "set-cookie": "session=secret-cookie"},
+		"",
+		`{"id": 1}`,
+		200,
+	)
+	procIO, err := recorder.Execute(testFlow, stream)
+	require.NoError(t, err)
+	require.Equal(t, notReplayedConditionName, procIO.Name)
+
+	content, err := os.ReadFile(filepath.Join(cassetteDir, testFlow+cassetteFileExt))
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "Bearer")
+	require.NotContains(t, string(content), "secret-token")
+	require.NotContains(t, string(content), "secret-key")
+	require.NotContains(t, string(content), "secret-cookie")
+
+	// the rest of the recording is kept as is, so it can be replayed
+	player := createProcessor(t, map[string]any{
+		modeParam:        modeReplay,
+		cassetteDirParam: cassetteDir,
+	})
+	require.Equal(t, `{"id": 1}`, replayedBody(t, player, "/me"))
+}
+
+func TestReplayInvalidParams(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("Replay", map[string]any{
+		modeParam:        "rewind",
+		cassetteDirParam: t.TempDir(),
+	}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("Replay", map[string]any{
+		modeParam:        modeReplay,
+		cassetteDirParam: t.TempDir(),
+		noMatchParam:     "ignore",
+	}))
+	require.Error(t, err)
+}
+
+func record(t *testing.T, proc streamtypes.ProcessorI, path, body string, status int) {
+	stream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeResponse,
+		"GET",
+		testHost+path,
+		map[string]string{},
+		map[string]string{"content-type": "application/json", "content-length": "9"},
+		"",
+		body,
+		status,
+	)
+	procIO, err := proc.Execute(testFlow, stream)
+	require.NoError(t, err)
+	require.Equal(t, notReplayedConditionName, procIO.Name)
+}
+
+func replayedBody(t *testing.T, proc streamtypes.ProcessorI, path string) string {
+	procIO, err := proc.Execute(testFlow, newRequestStream(path))
+	require.NoError(t, err)
+	require.Equal(t, replayedConditionName, procIO.Name)
+	action, ok := procIO.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	return action.Body
+}
+
+func newRequestStream(path string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStream(testHost+path, map[string]string{}, map[string]string{}, "", "")
+}
+
+func createProcessor(t *testing.T, params map[string]any) streamtypes.ProcessorI {
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("Replay", params))
+	require.NoError(t, err)
+	return proc
+}
@@ -9,12 +9,14 @@ import (
 	public_types "lunar/engine/streams/public-types"
 	stream_types "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
+	"lunar/engine/utils/saturation"
 	"lunar/toolkit-core/otel"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -77,6 +79,9 @@ func (p *retryProcessor) Execute(
 			Type:    public_types.StreamTypeRequest,
 			Name:    "failed",
 			Failure: true,
+			TraceAttributes: []attribute.KeyValue{
+				attribute.Int(stream_types.TraceAttributeRetryAttempt, currentRetryCount),
+			},
 		}, nil
 	}
 
@@ -86,12 +91,16 @@ func (p *retryProcessor) Execute(
 		Dur("cooldown", cooldownDuration).Msg("waiting before retry")
 
 	<-p.metaData.Clock.After(cooldownDuration)
+	saturation.AddWait(APIStream.GetID(), cooldownDuration)
 
 	p.updateMetrics(retryCountMetric, flowName, APIStream)
 	return stream_types.ProcessorIO{
 		RespAction: &actions.RetryRequestAction{},
 		Type:       public_types.StreamTypeRequest,
 		Name:       "retry",
+		TraceAttributes: []attribute.KeyValue{
+			attribute.Int(stream_types.TraceAttributeRetryAttempt, currentRetryCount),
+		},
 	}, nil
 }
 
@@ -266,6 +275,10 @@ func (p *retryProcessor) updateMetrics(
 
 	updateMetricFunc := func(metricName string) {
 		if metricObj, ok := p.metricObjects[metricName]; ok {
+			attributes, recorded := p.labelManager.LimitCardinality(metricName, attributes)
+			if !recorded {
+				return
+			}
 			metricObj.Add(context.Background(), 1, metric.WithAttributes(attributes...))
 		}
 	}
@@ -0,0 +1,178 @@
+package signrequest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsAlgorithm      = "AWS4-HMAC-SHA256"
+	awsDateFormat     = "20060102"
+	awsDateTimeFormat = "20060102T150405Z"
+	awsScopeSuffix    = "aws4_request"
+	awsS3Service      = "s3"
+	awsUnsignedBody   = "UNSIGNED-PAYLOAD"
+
+	headerAuthorization    = "authorization"
+	headerAmzDate          = "x-amz-date"
+	headerAmzSecurityToken = "x-amz-security-token"
+	headerAmzContentSHA256 = "x-amz-content-sha256"
+	headerContentType      = "content-type"
+	headerHost             = "host"
+)
+
+// awsSigner signs requests with AWS Signature Version 4
+type awsSigner struct {
+	service          string
+	region           string
+	credentials      *awsCredentialsProvider
+	unsignedPayload  bool
+	setContentSHA256 bool
+}
+
+func (s *awsSigner) sign(request *signingRequest, now time.Time) (map[string]string, error) {
+	credentials, err := s.credentials.get()
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	amzDate := now.Format(awsDateTimeFormat)
+	scope := strings.Join([]string{now.Format(awsDateFormat), s.region, s.service, awsScopeSuffix}, "/")
+
+	payloadHash := awsUnsignedBody
+	if !s.unsignedPayload {
+		payloadHash = sha256Hex(request.body)
+	}
+
+	headersToSet := map[string]string{headerAmzDate: amzDate}
+	if credentials.sessionToken != "" {
+		headersToSet[headerAmzSecurityToken] = credentials.sessionToken
+	}
+	if s.setContentSHA256 || s.service == awsS3Service {
+		headersToSet[headerAmzContentSHA256] = payloadHash
+	}
+
+	signedHeaders := map[string]string{headerHost: request.host}
+	for name, value := range request.headers {
+		name = strings.ToLower(name)
+		if name == headerContentType || strings.HasPrefix(name, "x-amz-") {
+			signedHeaders[name] = value
+		}
+	}
+	for name, value := range headersToSet {
+		signedHeaders[name] = value
+	}
+
+	canonicalHeaders, signedHeaderNames := canonicalizeHeaders(signedHeaders)
+	canonicalRequest := strings.Join([]string{
+		request.method,
+		s.canonicalURI(request.path),
+		canonicalQuery(request.query),
+		canonicalHeaders,
+		signedHeaderNames,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		awsAlgorithm,
+		amzDate,
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), now.Format(awsDateFormat))
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, s.service)
+	signingKey = hmacSHA256(signingKey, awsScopeSuffix)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	headersToSet[headerAuthorization] = fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, credentials.accessKeyID, scope, signedHeaderNames, signature)
+	return headersToSet, nil
+}
+
+// canonicalURI encodes each path segment. Services other than S3 expect it encoded twice.
+// The request path is received as sent on the wire, so it is decoded first.
+func (s *awsSigner) canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	if decoded, err := url.PathUnescape(path); err == nil {
+		path = decoded
+	}
+	encoded := awsURIEncode(path, false)
+	if s.service != awsS3Service {
+		encoded = awsURIEncode(encoded, false)
+	}
+	return encoded
+}
+
+func canonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(values))
+	for key, keyValues := range values {
+		for _, value := range keyValues {
+			pairs = append(pairs, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func canonicalizeHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name)
+		canonical.WriteByte(':')
+		canonical.WriteString(strings.Join(strings.Fields(headers[name]), " "))
+		canonical.WriteByte('\n')
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+// awsURIEncode encodes everything but the unreserved characters (RFC 3986).
+// Slashes are kept unless encodeSlash is set.
+func awsURIEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		switch {
+		case (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9'),
+			char == '-', char == '_', char == '.', char == '~':
+			encoded.WriteByte(char)
+		case char == '/' && !encodeSlash:
+			encoded.WriteByte(char)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", char)
+		}
+	}
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	digest := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(digest[:])
+}
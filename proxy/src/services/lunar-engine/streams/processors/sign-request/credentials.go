@@ -0,0 +1,158 @@
+package signrequest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	awsAccessKeyIDEnv        = "AWS_ACCESS_KEY_ID"
+	awsSecretAccessKeyEnv    = "AWS_SECRET_ACCESS_KEY"
+	awsSessionTokenEnv       = "AWS_SESSION_TOKEN"
+	awsProfileEnv            = "AWS_PROFILE"
+	awsCredentialsFileEnv    = "AWS_SHARED_CREDENTIALS_FILE"
+	awsDefaultProfile        = "default"
+	awsDefaultCredentialsDir = ".aws"
+)
+
+var errNoAWSCredentials = errors.New("no AWS credentials found")
+
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// awsCredentialsProvider resolves credentials from the processor parameters,
+// then from the AWS environment variables and then from the shared credentials file.
+// The file is read again when it changes, so rotated credentials are picked up.
+type awsCredentialsProvider struct {
+	static          *awsCredentials
+	credentialsFile string
+	profile         string
+
+	mutex        sync.Mutex
+	fileModTime  time.Time
+	fromFile     *awsCredentials
+	fileReadErr  error
+	fileReadOnce bool
+}
+
+func newAWSCredentialsProvider(static awsCredentials, credentialsFile, profile string) *awsCredentialsProvider {
+	provider := &awsCredentialsProvider{
+		credentialsFile: credentialsFile,
+		profile:         profile,
+	}
+	if static.accessKeyID != "" && static.secretAccessKey != "" {
+		provider.static = &static
+	}
+	if provider.profile == "" {
+		provider.profile = os.Getenv(awsProfileEnv)
+	}
+	if provider.profile == "" {
+		provider.profile = awsDefaultProfile
+	}
+	if provider.credentialsFile == "" {
+		provider.credentialsFile = os.Getenv(awsCredentialsFileEnv)
+	}
+	if provider.credentialsFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			provider.credentialsFile = filepath.Join(home, awsDefaultCredentialsDir, "credentials")
+		}
+	}
+	return provider
+}
+
+func (p *awsCredentialsProvider) get() (*awsCredentials, error) {
+	if p.static != nil {
+		return p.static, nil
+	}
+
+	if accessKeyID, secretAccessKey := os.Getenv(awsAccessKeyIDEnv),
+		os.Getenv(awsSecretAccessKeyEnv); accessKeyID != "" && secretAccessKey != "" {
+		return &awsCredentials{
+			accessKeyID:     accessKeyID,
+			secretAccessKey: secretAccessKey,
+			sessionToken:    os.Getenv(awsSessionTokenEnv),
+		}, nil
+	}
+
+	if p.credentialsFile == "" {
+		return nil, errNoAWSCredentials
+	}
+	return p.getFromFile()
+}
+
+func (p *awsCredentialsProvider) getFromFile() (*awsCredentials, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info, err := os.Stat(p.credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoAWSCredentials, err)
+	}
+	if p.fileReadOnce && info.ModTime().Equal(p.fileModTime) {
+		return p.fromFile, p.fileReadErr
+	}
+
+	p.fileReadOnce = true
+	p.fileModTime = info.ModTime()
+	p.fromFile, p.fileReadErr = readCredentialsFile(p.credentialsFile, p.profile)
+	return p.fromFile, p.fileReadErr
+}
+
+// readCredentialsFile reads a profile of an AWS shared credentials (INI) file
+func readCredentialsFile(credentialsFile, profile string) (*awsCredentials, error) {
+	// The path is taken from the processor configuration, not from API calls
+	//nolint:gosec
+	file, err := os.Open(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoAWSCredentials, err)
+	}
+	defer file.Close()
+
+	var credentials awsCredentials
+	var inProfile bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.TrimSpace(strings.Trim(line, "[]"))
+			inProfile = section == profile || section == "profile "+profile
+			continue
+		}
+		if !inProfile {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "aws_access_key_id":
+			credentials.accessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			credentials.secretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			credentials.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", credentialsFile, err)
+	}
+
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return nil, fmt.Errorf("%w in profile %s of %s", errNoAWSCredentials, profile, credentialsFile)
+	}
+	return &credentials, nil
+}
@@ -0,0 +1,149 @@
+package signrequest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // required by providers which still sign with HMAC-SHA1
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	encodingHex    = "hex"
+	encodingBase64 = "base64"
+
+	timestampUnix        = "unix"
+	timestampUnixMillis  = "unix_ms"
+	timestampRFC3339     = "rfc3339"
+	defaultHMACTemplate  = "{method}\n{path}\n{timestamp}\n{body_sha256}"
+	headerPlaceholderTag = "header:"
+)
+
+var hashByAlgorithm = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z0-9_]+(?::[A-Za-z0-9_-]+)?)\}`)
+
+// hmacSigner signs a string built from a template of request parts, e.g.
+// "{method}\n{path}\n{timestamp}\n{body_sha256}". Supported placeholders:
+// method, host, path, query, body, body_sha256, timestamp, nonce and header:<name>.
+type hmacSigner struct {
+	secret          []byte
+	newHash         func() hash.Hash
+	template        string
+	encoding        string
+	signatureHeader string
+	signaturePrefix string
+	timestampHeader string
+	timestampFormat string
+	nonceHeader     string
+}
+
+func (s *hmacSigner) validate() error {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(s.template, -1) {
+		name := match[1]
+		if strings.HasPrefix(name, headerPlaceholderTag) {
+			continue
+		}
+		switch name {
+		case "method", "host", "path", "query", "body", "body_sha256", "timestamp", "nonce":
+		default:
+			return fmt.Errorf("unknown placeholder {%s} in signing template", name)
+		}
+	}
+	switch s.encoding {
+	case encodingHex, encodingBase64:
+	default:
+		return fmt.Errorf("unsupported signature encoding %s", s.encoding)
+	}
+	switch s.timestampFormat {
+	case timestampUnix, timestampUnixMillis, timestampRFC3339:
+	default:
+		return fmt.Errorf("unsupported timestamp format %s", s.timestampFormat)
+	}
+	return nil
+}
+
+func (s *hmacSigner) sign(request *signingRequest, now time.Time) (map[string]string, error) {
+	timestamp := s.formatTimestamp(now)
+	nonce := ""
+	if strings.Contains(s.template, "{nonce}") || s.nonceHeader != "" {
+		var err error
+		if nonce, err = newNonce(); err != nil {
+			return nil, err
+		}
+	}
+
+	stringToSign := placeholderPattern.ReplaceAllStringFunc(s.template, func(placeholder string) string {
+		name := strings.Trim(placeholder, "{}")
+		if headerName, isHeader := strings.CutPrefix(name, headerPlaceholderTag); isHeader {
+			return request.headers[strings.ToLower(headerName)]
+		}
+		switch name {
+		case "method":
+			return request.method
+		case "host":
+			return request.host
+		case "path":
+			return request.path
+		case "query":
+			return request.query
+		case "body":
+			return request.body
+		case "body_sha256":
+			return sha256Hex(request.body)
+		case "timestamp":
+			return timestamp
+		case "nonce":
+			return nonce
+		}
+		return placeholder
+	})
+
+	mac := hmac.New(s.newHash, s.secret)
+	mac.Write([]byte(stringToSign))
+	signature := mac.Sum(nil)
+
+	encoded := hex.EncodeToString(signature)
+	if s.encoding == encodingBase64 {
+		encoded = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	headersToSet := map[string]string{s.signatureHeader: s.signaturePrefix + encoded}
+	if s.timestampHeader != "" {
+		headersToSet[s.timestampHeader] = timestamp
+	}
+	if s.nonceHeader != "" {
+		headersToSet[s.nonceHeader] = nonce
+	}
+	return headersToSet, nil
+}
+
+func (s *hmacSigner) formatTimestamp(now time.Time) string {
+	switch s.timestampFormat {
+	case timestampUnixMillis:
+		return strconv.FormatInt(now.UnixMilli(), 10)
+	case timestampRFC3339:
+		return now.UTC().Format(time.RFC3339)
+	}
+	return strconv.FormatInt(now.Unix(), 10)
+}
+
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hex.EncodeToString(nonce), nil
+}
@@ -0,0 +1,327 @@
+package signrequest
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/otel"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	schemeParam = "scheme"
+
+	awsServiceParam            = "aws_service"
+	awsRegionParam             = "aws_region"
+	awsAccessKeyIDParam        = "aws_access_key_id"
+	awsSecretAccessKeyParam    = "aws_secret_access_key"
+	awsSessionTokenParam       = "aws_session_token"
+	awsCredentialsFileParam    = "aws_credentials_file"
+	awsProfileParam            = "aws_profile"
+	awsUnsignedPayloadParam    = "aws_unsigned_payload"
+	awsSignContentSHA256Param  = "aws_sign_content_sha256"
+	hmacSecretParam            = "hmac_secret"
+	hmacAlgorithmParam         = "hmac_algorithm"
+	hmacStringTemplateParam    = "hmac_string_template"
+	hmacSignatureHeaderParam   = "hmac_signature_header"
+	hmacSignaturePrefixParam   = "hmac_signature_prefix"
+	hmacEncodingParam          = "hmac_encoding"
+	hmacTimestampHeaderParam   = "hmac_timestamp_header"
+	hmacTimestampFormatParam   = "hmac_timestamp_format"
+	hmacNonceHeaderParam       = "hmac_nonce_header"
+	defaultHMACAlgorithm       = "sha256"
+	defaultHMACSignatureHeader = "x-signature"
+	defaultHMACTimestampHeader = "x-timestamp"
+
+	schemeAWSSigV4 = "aws_sigv4"
+	schemeHMAC     = "hmac"
+
+	signFailuresMetric = "lunar_sign_request_failures_count"
+)
+
+// signingRequest holds the parts of the request which are signed
+type signingRequest struct {
+	method  string
+	host    string
+	path    string
+	query   string
+	body    string
+	headers map[string]string
+}
+
+// signer returns the headers to set on the signed request
+type signer interface {
+	sign(request *signingRequest, now time.Time) (map[string]string, error)
+}
+
+type signRequestProcessor struct {
+	name     string
+	scheme   string
+	signer   signer
+	metaData *streamtypes.ProcessorMetaData
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &signRequestProcessor{
+		name:         metaData.Name,
+		metaData:     metaData,
+		labelManager: lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *signRequestProcessor) GetName() string {
+	return p.name
+}
+
+func (p *signRequestProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired:    true,
+		IsLastRequestStep: true,
+		IsRequestModifier: true,
+	}
+}
+
+// Execute signs the request as it is when the processor runs,
+// so it must be the last processor of the request flow.
+func (p *signRequestProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != public_types.StreamTypeRequest {
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	noOp := streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		ReqAction: &actions.NoOpAction{},
+		Name:      "",
+	}
+
+	request := apiStream.GetRequest()
+	if request == nil {
+		return noOp, nil
+	}
+
+	headers := request.GetHeaders()
+	toSign := &signingRequest{
+		method:  strings.ToUpper(request.GetMethod()),
+		host:    request.GetHost(),
+		path:    request.GetPath(),
+		query:   request.GetQuery(),
+		body:    request.GetBody(),
+		headers: make(map[string]string, len(headers)),
+	}
+	for name, value := range headers {
+		toSign.headers[strings.ToLower(name)] = value
+	}
+	if host, found := toSign.headers[headerHost]; found && host != "" {
+		toSign.host = host
+	}
+
+	headersToSet, err := p.signer.sign(toSign, context_manager.Get().GetClock().Now())
+	if err != nil {
+		// the request is sent unsigned, the provider decides how to handle it
+		log.Warn().Err(err).Msgf("%s: failed to sign %s", p.name, apiStream.GetURL())
+		p.updateMetrics(flowName, apiStream)
+		return noOp, nil
+	}
+
+	if headers != nil {
+		for name, value := range headersToSet {
+			headers[name] = value
+		}
+	}
+
+	return streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		ReqAction: &actions.ModifyHeadersAction{HeadersToSet: headersToSet},
+		Name:      "",
+	}, nil
+}
+
+func (p *signRequestProcessor) init() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		schemeParam,
+		&p.scheme); err != nil {
+		return fmt.Errorf("%s is required for %s", schemeParam, p.name)
+	}
+
+	switch p.scheme {
+	case schemeAWSSigV4:
+		return p.initAWSSigner()
+	case schemeHMAC:
+		return p.initHMACSigner()
+	}
+	return fmt.Errorf("%s must be %s or %s for %s", schemeParam, schemeAWSSigV4, schemeHMAC, p.name)
+}
+
+func (p *signRequestProcessor) initAWSSigner() error {
+	awsSigner := &awsSigner{}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		awsServiceParam,
+		&awsSigner.service); err != nil || awsSigner.service == "" {
+		return fmt.Errorf("%s is required for %s", awsServiceParam, p.name)
+	}
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		awsRegionParam,
+		&awsSigner.region); err != nil || awsSigner.region == "" {
+		return fmt.Errorf("%s is required for %s", awsRegionParam, p.name)
+	}
+
+	var static awsCredentials
+	var credentialsFile, profile string
+	for paramName, value := range map[string]*string{
+		awsAccessKeyIDParam:     &static.accessKeyID,
+		awsSecretAccessKeyParam: &static.secretAccessKey,
+		awsSessionTokenParam:    &static.sessionToken,
+		awsCredentialsFileParam: &credentialsFile,
+		awsProfileParam:         &profile,
+	} {
+		if err := utils.ExtractStrParam(p.metaData.Parameters, paramName, value); err != nil {
+			log.Trace().Msgf("%s not defined for %s", paramName, p.name)
+		}
+	}
+	static.accessKeyID = utils.ResolveEnvValue(static.accessKeyID)
+	static.secretAccessKey = utils.ResolveEnvValue(static.secretAccessKey)
+	static.sessionToken = utils.ResolveEnvValue(static.sessionToken)
+	if (static.accessKeyID == "") != (static.secretAccessKey == "") {
+		return fmt.Errorf("%s and %s must be set together for %s",
+			awsAccessKeyIDParam, awsSecretAccessKeyParam, p.name)
+	}
+	awsSigner.credentials = newAWSCredentialsProvider(static, credentialsFile, profile)
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		awsUnsignedPayloadParam,
+		&awsSigner.unsignedPayload); err != nil {
+		log.Trace().Msgf("%s not defined for %s", awsUnsignedPayloadParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		awsSignContentSHA256Param,
+		&awsSigner.setContentSHA256); err != nil {
+		log.Trace().Msgf("%s not defined for %s", awsSignContentSHA256Param, p.name)
+	}
+
+	p.signer = awsSigner
+	return nil
+}
+
+func (p *signRequestProcessor) initHMACSigner() error {
+	hmacSigner := &hmacSigner{
+		template:        defaultHMACTemplate,
+		encoding:        encodingHex,
+		signatureHeader: defaultHMACSignatureHeader,
+		timestampHeader: defaultHMACTimestampHeader,
+		timestampFormat: timestampUnix,
+	}
+
+	var secret string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		hmacSecretParam,
+		&secret); err != nil || secret == "" {
+		return fmt.Errorf("%s is required for %s", hmacSecretParam, p.name)
+	}
+	hmacSigner.secret = []byte(utils.ResolveEnvValue(secret))
+
+	algorithm := defaultHMACAlgorithm
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		hmacAlgorithmParam,
+		&algorithm); err != nil || algorithm == "" {
+		algorithm = defaultHMACAlgorithm
+	}
+	newHash, found := hashByAlgorithm[strings.ToLower(algorithm)]
+	if !found {
+		return fmt.Errorf("unsupported %s %s for %s", hmacAlgorithmParam, algorithm, p.name)
+	}
+	hmacSigner.newHash = newHash
+
+	for paramName, value := range map[string]*string{
+		hmacStringTemplateParam:  &hmacSigner.template,
+		hmacSignatureHeaderParam: &hmacSigner.signatureHeader,
+		hmacSignaturePrefixParam: &hmacSigner.signaturePrefix,
+		hmacEncodingParam:        &hmacSigner.encoding,
+		hmacTimestampHeaderParam: &hmacSigner.timestampHeader,
+		hmacTimestampFormatParam: &hmacSigner.timestampFormat,
+		hmacNonceHeaderParam:     &hmacSigner.nonceHeader,
+	} {
+		if err := utils.ExtractStrParam(p.metaData.Parameters, paramName, value); err != nil {
+			log.Trace().Msgf("%s not defined for %s", paramName, p.name)
+		}
+	}
+	if hmacSigner.signatureHeader == "" {
+		return fmt.Errorf("%s is required for %s", hmacSignatureHeaderParam, p.name)
+	}
+	hmacSigner.signatureHeader = strings.ToLower(hmacSigner.signatureHeader)
+	hmacSigner.timestampHeader = strings.ToLower(hmacSigner.timestampHeader)
+	hmacSigner.nonceHeader = strings.ToLower(hmacSigner.nonceHeader)
+
+	if err := hmacSigner.validate(); err != nil {
+		return fmt.Errorf("invalid HMAC configuration for %s: %w", p.name, err)
+	}
+
+	p.signer = hmacSigner
+	return nil
+}
+
+func (p *signRequestProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(signFailuresMetric,
+		metric.WithDescription(fmt.Sprintf("Requests which %s failed to sign", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize sign failures metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *signRequestProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes, attribute.String("scheme", p.scheme))
+	attributes, recorded := p.labelManager.LimitCardinality(signFailuresMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
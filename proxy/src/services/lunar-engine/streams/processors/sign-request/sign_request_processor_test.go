@@ -0,0 +1,186 @@
+package signrequest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"lunar/engine/actions"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// signingTime is the time used by the AWS Signature Version 4 test suite
+var signingTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+func TestAWSSigV4Vanilla(t *testing.T) {
+	clearAWSEnv(t)
+	proc := createProcessor(t, map[string]any{
+		schemeParam:             schemeAWSSigV4,
+		awsServiceParam:         "service",
+		awsRegionParam:          "us-east-1",
+		awsAccessKeyIDParam:     testAccessKeyID,
+		awsSecretAccessKeyParam: testSecretAccessKey,
+	})
+
+	headers := executeAt(t, proc, signingTime, newRequestStream("https://example.amazonaws.com/", "", nil))
+	require.Equal(t, "20150830T123600Z", headers[headerAmzDate])
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		headers[headerAuthorization])
+}
+
+func TestAWSSigV4CanonicalURI(t *testing.T) {
+	s3Signer := &awsSigner{service: awsS3Service}
+	require.Equal(t, "/bucket/my%20file.txt", s3Signer.canonicalURI("/bucket/my%20file.txt"))
+	require.Equal(t, "/bucket/my%20file.txt", s3Signer.canonicalURI("/bucket/my file.txt"))
+
+	serviceSigner := &awsSigner{service: "execute-api"}
+	require.Equal(t, "/stage/a%2520b", serviceSigner.canonicalURI("/stage/a%20b"))
+	require.Equal(t, "/", serviceSigner.canonicalURI(""))
+}
+
+func TestAWSSigV4CredentialsResolution(t *testing.T) {
+	clearAWSEnv(t)
+	params := map[string]any{
+		schemeParam:     schemeAWSSigV4,
+		awsServiceParam: "s3",
+		awsRegionParam:  "eu-west-1",
+	}
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	require.NoError(t, os.WriteFile(credentialsFile, []byte(
+		"[default]\naws_access_key_id = FROMDEFAULT\naws_secret_access_key = secret\n\n"+
+			"[deploy]\naws_access_key_id = FROMFILE\naws_secret_access_key = secret\n"+
+			"aws_session_token = session\n"), 0o600))
+	params[awsCredentialsFileParam] = credentialsFile
+	params[awsProfileParam] = "deploy"
+	proc := createProcessor(t, params)
+
+	headers := executeAt(t, proc, signingTime, newRequestStream("https://bucket.s3.amazonaws.com/key", "", nil))
+	require.Contains(t, headers[headerAuthorization], "Credential=FROMFILE/20150830/eu-west-1/s3/aws4_request")
+	require.Equal(t, "session", headers[headerAmzSecurityToken])
+	require.Equal(t, sha256Hex(""), headers[headerAmzContentSHA256])
+
+	// the environment takes precedence over the credentials file
+	t.Setenv(awsAccessKeyIDEnv, "FROMENV")
+	t.Setenv(awsSecretAccessKeyEnv, "secret")
+	headers = executeAt(t, proc, signingTime, newRequestStream("https://bucket.s3.amazonaws.com/key", "", nil))
+	require.Contains(t, headers[headerAuthorization], "Credential=FROMENV/")
+	require.NotContains(t, headers, headerAmzSecurityToken)
+}
+
+func TestAWSSigV4MissingCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	proc := createProcessor(t, map[string]any{
+		schemeParam:             schemeAWSSigV4,
+		awsServiceParam:         "execute-api",
+		awsRegionParam:          "us-east-1",
+		awsCredentialsFileParam: filepath.Join(t.TempDir(), "missing"),
+	})
+
+	stream := newRequestStream("https://api.example.com/orders", "", nil)
+	procIO, err := proc.Execute("sign-test", stream)
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, procIO.ReqAction)
+	_, found := stream.GetHeader(headerAuthorization)
+	require.False(t, found)
+}
+
+func TestHMACSignature(t *testing.T) {
+	proc := createProcessor(t, map[string]any{
+		schemeParam:              schemeHMAC,
+		hmacSecretParam:          "top-secret",
+		hmacStringTemplateParam:  "{method}|{path}|{query}|{timestamp}|{header:X-Account}|{body}",
+		hmacSignatureHeaderParam: "X-Hub-Signature",
+		hmacSignaturePrefixParam: "sha256=",
+		hmacEncodingParam:        encodingBase64,
+	})
+
+	stream := newRequestStream("https://api.example.com/orders?id=7", `{"amount":3}`,
+		map[string]string{"x-account": "acme"})
+	headers := executeAt(t, proc, signingTime, stream)
+
+	mac := hmac.New(sha256.New, []byte("top-secret"))
+	mac.Write([]byte(`GET|/orders|id=7|1440938160|acme|{"amount":3}`))
+	expected := "sha256=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	require.Equal(t, expected, headers["x-hub-signature"])
+	require.Equal(t, "1440938160", headers[defaultHMACTimestampHeader])
+
+	signature, _ := stream.GetHeader("x-hub-signature")
+	require.Equal(t, expected, signature)
+}
+
+func TestSignRequestInvalidConfig(t *testing.T) {
+	for _, params := range []map[string]any{
+		{},
+		{schemeParam: "digest"},
+		{schemeParam: schemeAWSSigV4, awsRegionParam: "us-east-1"},
+		{schemeParam: schemeAWSSigV4, awsServiceParam: "s3"},
+		{
+			schemeParam:         schemeAWSSigV4,
+			awsServiceParam:     "s3",
+			awsRegionParam:      "us-east-1",
+			awsAccessKeyIDParam: testAccessKeyID,
+		},
+		{schemeParam: schemeHMAC},
+		{schemeParam: schemeHMAC, hmacSecretParam: "secret", hmacAlgorithmParam: "md5"},
+		{schemeParam: schemeHMAC, hmacSecretParam: "secret", hmacStringTemplateParam: "{method}{url}"},
+		{schemeParam: schemeHMAC, hmacSecretParam: "secret", hmacEncodingParam: "base32"},
+	} {
+		_, err := NewProcessor(test_utils.NewProcessorMetaData("SignRequest", params))
+		require.Error(t, err, params)
+	}
+}
+
+func executeAt(
+	t *testing.T,
+	proc streamtypes.ProcessorI,
+	now time.Time,
+	stream public_types.APIStreamI,
+) map[string]string {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+	mockClock.AdvanceTime(now.Sub(mockClock.Now()))
+
+	procIO, err := proc.Execute("sign-test", stream)
+	require.NoError(t, err)
+	require.IsType(t, &actions.ModifyHeadersAction{}, procIO.ReqAction)
+	return procIO.ReqAction.(*actions.ModifyHeadersAction).HeadersToSet
+}
+
+func clearAWSEnv(t *testing.T) {
+	for _, name := range []string{
+		awsAccessKeyIDEnv, awsSecretAccessKeyEnv, awsSessionTokenEnv, awsProfileEnv, awsCredentialsFileEnv,
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+}
+
+func createProcessor(t *testing.T, params map[string]any) streamtypes.ProcessorI {
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("SignRequest", params))
+	require.NoError(t, err)
+	return proc
+}
+
+func newRequestStream(url, body string, headers map[string]string) public_types.APIStreamI {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return test_utils.NewMockAPIStream(url, headers, map[string]string{}, body, "")
+}
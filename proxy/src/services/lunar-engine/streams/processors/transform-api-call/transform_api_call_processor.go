@@ -12,16 +12,27 @@ import (
 )
 
 const (
-	setParam       = "set"
-	addParam       = "add"
-	deleteParam    = "delete"
-	obfuscateParam = "obfuscate"
+	setParam               = "set"
+	addParam               = "add"
+	deleteParam            = "delete"
+	obfuscateParam         = "obfuscate"
+	renameParam            = "rename"
+	moveParam              = "move"
+	copyParam              = "copy"
+	appendParam            = "append"
+	setHeadersParam        = "set_headers"
+	deleteHeadersParam     = "delete_headers"
+	setQueryParamsParam    = "set_query_params"
+	deleteQueryParamsParam = "delete_query_params"
+	expressionsParam       = "expressions"
 )
 
 type transformAPICallProcessor struct {
 	name           string
 	transformation *transformer
-	metaData       *streamtypes.ProcessorMetaData
+	// expressions guard the transformation, the stream is left untouched when none match
+	expressions public_types.KVOpExpressionsParam
+	metaData    *streamtypes.ProcessorMetaData
 }
 
 func NewProcessor(
@@ -46,7 +57,8 @@ func (p *transformAPICallProcessor) GetName() string {
 
 func (p *transformAPICallProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{
-		IsBodyRequired: true,
+		IsBodyRequired:    true,
+		IsRequestModifier: true,
 	}
 }
 
@@ -54,6 +66,15 @@ func (p *transformAPICallProcessor) Execute(
 	_ string,
 	apiStream public_types.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	if !p.expressions.IsEmpty() && !p.expressions.Validate(apiStream) {
+		log.Trace().Msgf("%s: expressions not matched, skipping transformation", p.name)
+		return streamtypes.ProcessorIO{
+			Type:       apiStream.GetType(),
+			ReqAction:  &actions.NoOpAction{},
+			RespAction: &actions.NoOpAction{},
+		}, nil
+	}
+
 	var err error
 	var reqAction actions.ReqLunarAction
 	var respAction actions.RespLunarAction
@@ -99,9 +120,52 @@ func (p *transformAPICallProcessor) init() error {
 		log.Trace().Msgf("No %s parameter found", obfuscateParam)
 	}
 
+	p.extractMapOfStringParam(renameParam, p.transformation.renameDefinitions)
+	p.extractMapOfStringParam(moveParam, p.transformation.moveDefinitions)
+	p.extractMapOfStringParam(copyParam, p.transformation.copyDefinitions)
+	p.extractMapOfAnyParam(appendParam, p.transformation.appendDefinitions)
+	p.extractMapOfAnyParam(setHeadersParam, p.transformation.setHeadersDefinitions)
+	p.extractMapOfAnyParam(setQueryParamsParam, p.transformation.setQueryParamsDefinitions)
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		deleteHeadersParam,
+		&p.transformation.deleteHeadersDefinitions); err != nil ||
+		len(p.transformation.deleteHeadersDefinitions) == 0 {
+		log.Trace().Msgf("No %s parameter found", deleteHeadersParam)
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		deleteQueryParamsParam,
+		&p.transformation.deleteQueryParamsDefinitions); err != nil ||
+		len(p.transformation.deleteQueryParamsDefinitions) == 0 {
+		log.Trace().Msgf("No %s parameter found", deleteQueryParamsParam)
+	}
+
+	if err := utils.ExtractKVOpExpressionsParam(p.metaData.Parameters,
+		expressionsParam,
+		&p.expressions); err != nil || p.expressions.IsEmpty() {
+		log.Trace().Msgf("No %s parameter found", expressionsParam)
+	}
+
 	if !p.transformation.IsTransformationsDefined() {
 		return fmt.Errorf("no transformations found")
 	}
 
 	return nil
 }
+
+func (p *transformAPICallProcessor) extractMapOfAnyParam(paramName string, result map[string]any) {
+	if err := utils.ExtractMapOfAnyParam(p.metaData.Parameters,
+		paramName,
+		result); err != nil || len(result) == 0 {
+		log.Trace().Msgf("No %s parameter found", paramName)
+	}
+}
+
+func (p *transformAPICallProcessor) extractMapOfStringParam(paramName string, result map[string]string) {
+	if err := utils.ExtractMapOfStringParam(p.metaData.Parameters,
+		paramName,
+		result); err != nil || len(result) == 0 {
+		log.Trace().Msgf("No %s parameter found", paramName)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"testing"
 
+	lunar_context "lunar/engine/streams/lunar-context"
 	public_types "lunar/engine/streams/public-types"
 	test_utils "lunar/engine/streams/test-utils"
 	streamtypes "lunar/engine/streams/types"
@@ -45,8 +46,10 @@ func TestMinimalTransformation(t *testing.T) {
 	procIO, err := proc.Execute("transform-test", stream)
 	require.NoError(t, err)
 
-	modReqAction := procIO.ReqAction.(*actions.ModifyHeadersAction)
-	require.NotNil(t, modReqAction)
+	// deleted headers are only removed by rebuilding the request
+	modReqAction, ok := procIO.ReqAction.(*actions.ModifyRequestAction)
+	require.True(t, ok)
+	require.NotContains(t, modReqAction.HeadersToSet, "Authorization")
 
 	require.Equal(t, "123456", stream.GetHeaders()["x-api-key"])
 	require.Equal(t, "", stream.GetHeaders()["Authorization"])
@@ -145,6 +148,181 @@ func TestTransformation(t *testing.T) {
 	require.Equal(t, 204, stream.GetResponse().GetStatus())
 }
 
+func TestTransformationAdaptsPayloadFormat(t *testing.T) {
+	stream := test_utils.NewMockAPIStream(
+		"https://api.openai.com/v1/chat/completions?api-version=2024-06-01",
+		map[string]string{
+			"Authorization": "Bearer sk-openai",
+			"Content-Type":  "application/json",
+		},
+		map[string]string{},
+		`{"model":"gpt-4o","max_completion_tokens":256,"stop":["END"],"user":"u-42",`+
+			`"messages":[{"role":"user","content":"Hello"}]}`,
+		"",
+	)
+	lunarContext := lunar_context.NewLunarContext(lunar_context.NewContext())
+	require.NoError(t, lunarContext.GetTransactionalContext().Set("anthropic_key", "sk-ant"))
+	stream.SetContext(lunarContext)
+
+	proc := newTransformationProcessor(t, map[string]any{
+		moveParam: map[string]any{
+			"$.request.body.max_completion_tokens": "$.request.body.max_tokens",
+			"$.request.body.user":                  "$.request.body.metadata.user_id",
+		},
+		renameParam: map[string]any{
+			"$.request.body.stop": "stop_sequences",
+		},
+		copyParam: map[string]any{
+			"$.request.body.model": "$.request.body.metadata.requested_model",
+		},
+		setParam: map[string]any{
+			"$.request.host":                  "api.anthropic.com",
+			"$.request.path":                  "/v1/messages",
+			"$.request.body.model":            "claude-sonnet-4",
+			"$.request.body.metadata.source":  map[string]any{"value_from": "$.request.path"},
+			"$.request.body.metadata.literal": "$.request.path",
+			"$.request.body.missing":          map[string]any{"value_from": "$.request.body.not_there"},
+		},
+		appendParam: map[string]any{
+			"$.request.body.messages": map[string]any{"role": "assistant", "content": "Sure,"},
+		},
+		setHeadersParam: map[string]any{
+			"x-api-key":         map[string]any{"value_from": "$context.anthropic_key"},
+			"anthropic-version": "2023-06-01",
+			"content-type":      "application/json",
+		},
+		deleteHeadersParam:     []string{"authorization"},
+		deleteQueryParamsParam: []string{"api-version"},
+		setQueryParamsParam:    map[string]any{"beta": "true"},
+	})
+
+	procIO, err := proc.Execute("transform-test", stream)
+	require.NoError(t, err)
+	require.False(t, procIO.Failure)
+
+	modReqAction, ok := procIO.ReqAction.(*actions.ModifyRequestAction)
+	require.True(t, ok)
+	require.Equal(t, "api.anthropic.com", modReqAction.Host)
+	require.Equal(t, "/v1/messages", modReqAction.Path)
+	require.Equal(t, "beta=true", modReqAction.QueryParams)
+	require.JSONEq(t, `{
+		"model": "claude-sonnet-4",
+		"max_tokens": 256,
+		"stop_sequences": ["END"],
+		"metadata": {
+			"user_id": "u-42",
+			"requested_model": "gpt-4o",
+			"source": "/v1/chat/completions",
+			"literal": "$.request.path"
+		},
+		"messages": [
+			{"role": "user", "content": "Hello"},
+			{"role": "assistant", "content": "Sure,"}
+		]
+	}`, modReqAction.Body)
+
+	headers := stream.GetHeaders()
+	require.Equal(t, "sk-ant", headers["x-api-key"])
+	require.Equal(t, "2023-06-01", headers["anthropic-version"])
+	require.Equal(t, "application/json", headers["content-type"])
+	require.NotContains(t, headers, "Authorization")
+	require.NotContains(t, headers, "Content-Type")
+}
+
+func TestTransformationQueryParamsOnly(t *testing.T) {
+	stream := test_utils.NewMockAPIStream(
+		"https://example.com/items?page=1",
+		map[string]string{},
+		map[string]string{},
+		"",
+		"",
+	)
+
+	proc := newTransformationProcessor(t, map[string]any{
+		setQueryParamsParam: map[string]any{"page": "2"},
+	})
+	procIO, err := proc.Execute("transform-test", stream)
+	require.NoError(t, err)
+
+	modReqAction, ok := procIO.ReqAction.(*actions.ModifyRequestAction)
+	require.True(t, ok)
+	require.Equal(t, "page=2", modReqAction.QueryParams)
+}
+
+func TestTransformationDeleteHeadersOnly(t *testing.T) {
+	stream := test_utils.NewMockAPIStream(
+		"https://example.com/items?page=1",
+		map[string]string{
+			"authorization": "Bearer secret",
+			"user-agent":    "Mozilla/5.0",
+		},
+		map[string]string{},
+		`{"dummy":"request"}`,
+		"",
+	)
+
+	proc := newTransformationProcessor(t, map[string]any{
+		deleteHeadersParam: []string{"authorization"},
+	})
+	procIO, err := proc.Execute("transform-test", stream)
+	require.NoError(t, err)
+
+	modReqAction, ok := procIO.ReqAction.(*actions.ModifyRequestAction)
+	require.True(t, ok, "a deleted header needs the request to be rebuilt")
+	require.NotContains(t, modReqAction.HeadersToSet, "authorization")
+	require.Equal(t, "Mozilla/5.0", modReqAction.HeadersToSet["user-agent"])
+	require.Equal(t, `{"dummy":"request"}`, modReqAction.Body)
+	require.Equal(t, "page=1", modReqAction.QueryParams)
+}
+
+func TestTransformationGuardedByExpressions(t *testing.T) {
+	proc := newTransformationProcessor(t, map[string]any{
+		expressionsParam: []string{"$.request[?(@.body.model == 'gpt-4o')]"},
+		setHeadersParam:  map[string]any{"x-provider": "openai"},
+	})
+
+	matching := test_utils.NewMockAPIStream(
+		"https://example.com/chat",
+		map[string]string{},
+		map[string]string{},
+		`{"model":"gpt-4o"}`,
+		"",
+	)
+	procIO, err := proc.Execute("transform-test", matching)
+	require.NoError(t, err)
+	require.IsType(t, &actions.ModifyHeadersAction{}, procIO.ReqAction)
+	require.Equal(t, "openai", matching.GetHeaders()["x-provider"])
+
+	other := test_utils.NewMockAPIStream(
+		"https://example.com/chat",
+		map[string]string{},
+		map[string]string{},
+		`{"model":"claude-sonnet-4"}`,
+		"",
+	)
+	procIO, err = proc.Execute("transform-test", other)
+	require.NoError(t, err)
+	require.Equal(t, &actions.NoOpAction{}, procIO.ReqAction)
+	require.NotContains(t, other.GetHeaders(), "x-provider")
+}
+
+func newTransformationProcessor(t *testing.T, params map[string]any) streamtypes.ProcessorI {
+	processorParams := make(map[string]streamtypes.ProcessorParam)
+	for key, value := range params {
+		processorParams[key] = streamtypes.ProcessorParam{
+			Name:  key,
+			Value: public_types.NewKeyValue(key, value).GetParamValue(),
+		}
+	}
+
+	proc, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "TransformAPICall",
+		Parameters: processorParams,
+	})
+	require.NoError(t, err)
+	return proc
+}
+
 func createTransformationProcessor(
 	t *testing.T,
 	deleteOps, obfuscateOps []string,
@@ -8,32 +8,62 @@ import (
 	public_types "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
 	"lunar/engine/utils/obfuscation"
+	"maps"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/ohler55/ojg/alt"
 	"github.com/ohler55/ojg/jp"
 	"github.com/ohler55/ojg/oj"
 
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// valueFromKey marks a dynamic value, e.g. {"value_from": "$.request.headers.x-user"}
+	valueFromKey = "value_from"
+	// contextValuePrefix marks a value read from the transactional context, e.g. $context.quota_id
+	contextValuePrefix = "$context."
+)
+
 type transformer struct {
 	setDefinitions       map[string]any
 	deleteDefinitions    []string
 	obfuscateDefinitions []string
+	renameDefinitions    map[string]string
+	moveDefinitions      map[string]string
+	copyDefinitions      map[string]string
+	appendDefinitions    map[string]any
+
+	setHeadersDefinitions        map[string]any
+	deleteHeadersDefinitions     []string
+	setQueryParamsDefinitions    map[string]any
+	deleteQueryParamsDefinitions []string
 
 	obfuscator obfuscation.Obfuscator
 }
 
 func newTransformer() *transformer {
 	return &transformer{
-		setDefinitions: make(map[string]any),
-		obfuscator:     obfuscation.Obfuscator{Hasher: obfuscation.SHA256Hasher{}},
+		setDefinitions:            make(map[string]any),
+		renameDefinitions:         make(map[string]string),
+		moveDefinitions:           make(map[string]string),
+		copyDefinitions:           make(map[string]string),
+		appendDefinitions:         make(map[string]any),
+		setHeadersDefinitions:     make(map[string]any),
+		setQueryParamsDefinitions: make(map[string]any),
+		obfuscator:                obfuscation.Obfuscator{Hasher: obfuscation.SHA256Hasher{}},
 	}
 }
 
 func (t *transformer) IsTransformationsDefined() bool {
-	return len(t.setDefinitions) > 0 || len(t.deleteDefinitions) > 0 || len(t.obfuscateDefinitions) > 0
+	return len(t.setDefinitions) > 0 || len(t.deleteDefinitions) > 0 || len(t.obfuscateDefinitions) > 0 ||
+		len(t.renameDefinitions) > 0 || len(t.moveDefinitions) > 0 || len(t.copyDefinitions) > 0 ||
+		len(t.appendDefinitions) > 0 ||
+		len(t.setHeadersDefinitions) > 0 || len(t.deleteHeadersDefinitions) > 0 ||
+		len(t.setQueryParamsDefinitions) > 0 || len(t.deleteQueryParamsDefinitions) > 0
 }
 
 // OnRequest applies the defined transformations on the request object.
@@ -45,12 +75,17 @@ func (t *transformer) OnRequest(obj public_types.APIStreamI) (actions.ReqLunarAc
 
 	originalHost := obj.GetRequest().GetHost()
 	originalBody := obj.GetRequest().GetBody()
+	originalQuery := encodeQuery(obj.GetRequest().GetQuery())
+	originalHeaders := make([]string, 0, len(obj.GetRequest().GetHeaders()))
+	for name := range obj.GetRequest().GetHeaders() {
+		originalHeaders = append(originalHeaders, name)
+	}
 	var originalPath, transformedPath string
 	if obj.GetRequest().GetParsedURL() != nil {
 		originalPath = obj.GetRequest().GetParsedURL().Path
 	}
 
-	data, newHost := t.doTransform(data)
+	data, newHost := t.doTransform(obj, data)
 	if newHost == "" {
 		newHost = obj.GetRequest().GetHost()
 	}
@@ -66,7 +101,9 @@ func (t *transformer) OnRequest(obj public_types.APIStreamI) (actions.ReqLunarAc
 
 	if obj.GetRequest().GetHost() == originalHost &&
 		obj.GetRequest().GetBody() == originalBody &&
-		transformedPath == originalPath {
+		encodeQuery(obj.GetRequest().GetQuery()) == originalQuery &&
+		transformedPath == originalPath &&
+		!isAnyHeaderRemoved(originalHeaders, obj.GetRequest()) {
 		log.Trace().Msg("only headers changed, skipping request modification")
 		return &actions.ModifyHeadersAction{
 			HeadersToSet: obj.GetHeaders(),
@@ -82,13 +119,28 @@ func (t *transformer) OnRequest(obj public_types.APIStreamI) (actions.ReqLunarAc
 	}, nil
 }
 
+// isAnyHeaderRemoved tells whether a header is missing from the transformed request.
+// Headers can only be removed by rebuilding the request, modifying headers only sets them.
+func isAnyHeaderRemoved(originalHeaders []string, request public_types.TransactionI) bool {
+	headers := make(map[string]struct{}, len(request.GetHeaders()))
+	for name := range request.GetHeaders() {
+		headers[strings.ToLower(name)] = struct{}{}
+	}
+	for _, name := range originalHeaders {
+		if _, found := headers[strings.ToLower(name)]; !found {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *transformer) OnResponse(obj public_types.APIStreamI) (actions.RespLunarAction, error) {
 	data, err := utils.ConvertStreamToDataMap(obj)
 	if err != nil {
 		return nil, err
 	}
 
-	data, _ = t.doTransform(data)
+	data, _ = t.doTransform(obj, data)
 
 	transformed, err := t.prepareResponse(obj.GetResponse(), data)
 	if err != nil {
@@ -103,20 +155,37 @@ func (t *transformer) OnResponse(obj public_types.APIStreamI) (actions.RespLunar
 	}, nil
 }
 
-func (t *transformer) doTransform(data map[string]any) (map[string]any, string) {
+func (t *transformer) doTransform(
+	obj public_types.APIStreamI,
+	data map[string]any,
+) (map[string]any, string) {
+	resolver := &valueResolver{apiStream: obj}
+
 	// Apply "delete" operations
 	data, err := t.performDelete(data)
 	if err != nil {
 		log.Trace().Err(err).Msg("failed to perform delete operations")
 	}
 
+	// Apply "rename", "move" and "copy" operations
+	data = t.performRelocate(data)
+
 	// Apply "set" operations
 	var newHost string
-	data, newHost, err = t.performSet(data)
+	data, newHost, err = t.performSet(data, resolver)
 	if err != nil {
 		log.Trace().Err(err).Msg("failed to perform set operations")
 	}
 
+	// Apply "append" operations
+	data = t.performAppend(data, resolver)
+
+	// Apply header and query param operations
+	t.performHeaders(data, obj.GetType(), resolver)
+	if obj.GetType().IsRequestType() {
+		t.performQueryParams(data, resolver)
+	}
+
 	// Apply "obfuscate" operations
 	data, err = t.performObfuscate(data)
 	if err != nil {
@@ -144,6 +213,7 @@ func (t *transformer) prepareRequest(
 	// should make headers zero, otherwise json.Unmarshal will perform union and undo delete operation
 	transformed.Headers = make(map[string]string)
 	transformed.ParsedQuery = make(map[string][]string)
+	transformed.BodyMap = nil
 	if err := json.Unmarshal(jsonData, transformed); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON to OnRequest: %w", err)
 	}
@@ -174,6 +244,7 @@ func (t *transformer) prepareResponse(
 
 	// should make headers zero, otherwise json.Unmarshal will perform union and undo delete operation
 	transformed.Headers = make(map[string]string)
+	transformed.BodyMap = nil
 	if err := json.Unmarshal(jsonData, transformed); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON to OnResponse: %w", err)
 	}
@@ -226,25 +297,29 @@ func (t *transformer) performObfuscate(data map[string]any) (map[string]any, err
 }
 
 // performSet applies the set definitions on the data map.
-func (t *transformer) performSet(data map[string]any) (map[string]any, string, error) {
+// Values may be dynamic, see valueResolver.
+func (t *transformer) performSet(
+	data map[string]any,
+	resolver *valueResolver,
+) (map[string]any, string, error) {
 	var newHost string
-	for path, val := range t.setDefinitions {
-		strVal := fmt.Sprintf("%v", val)
-		if strings.HasSuffix(path, ".host") {
-			newHost = strVal
+	for _, path := range slices.Sorted(maps.Keys(t.setDefinitions)) {
+		val, found := resolver.resolve(t.setDefinitions[path])
+		if !found {
+			log.Trace().Msgf("no value found for %s, skipping set", path)
 			continue
 		}
 
-		if strings.HasPrefix(strVal, "$") && isUpperCase(strVal) {
-			if envVal := os.Getenv(strings.TrimPrefix(strVal, "$")); envVal != "" {
-				val = envVal
+		if strings.HasSuffix(path, ".host") {
+			// the host is never read from the environment
+			if _, isDynamic := dynamicValuePath(t.setDefinitions[path]); !isDynamic {
+				val = t.setDefinitions[path]
 			}
+			newHost = fmt.Sprintf("%v", val)
+			continue
 		}
 
-		path = strings.Replace(path, ".body.", ".body_map.", 1)
-		path = strings.Replace(path, ".status_code", ".status", 1)
-
-		expr, err := jp.ParseString(path)
+		expr, err := jp.ParseString(normalizePath(path))
 		if err != nil {
 			log.Trace().Err(err).Msgf("failed to ParseString: %s", path)
 			continue
@@ -259,6 +334,285 @@ func (t *transformer) performSet(data map[string]any) (map[string]any, string, e
 	return data, newHost, nil
 }
 
+// performRelocate applies the rename, move and copy definitions on the data map.
+// Rename keeps the field under the same parent, move and copy take a destination path.
+func (t *transformer) performRelocate(data map[string]any) map[string]any {
+	for _, path := range slices.Sorted(maps.Keys(t.renameDefinitions)) {
+		source, err := jp.ParseString(normalizePath(path))
+		if err != nil || len(source) < 2 {
+			log.Trace().Err(err).Msgf("failed to parse JSONPath for rename: %s", path)
+			continue
+		}
+		destination := append(append(jp.Expr{}, source[:len(source)-1]...), jp.Child(t.renameDefinitions[path]))
+		data = relocate(data, source, destination, true)
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(t.moveDefinitions)) {
+		source, destination, err := parsePathPair(path, t.moveDefinitions[path])
+		if err != nil {
+			log.Trace().Err(err).Msgf("failed to parse JSONPath for move: %s", path)
+			continue
+		}
+		data = relocate(data, source, destination, true)
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(t.copyDefinitions)) {
+		source, destination, err := parsePathPair(path, t.copyDefinitions[path])
+		if err != nil {
+			log.Trace().Err(err).Msgf("failed to parse JSONPath for copy: %s", path)
+			continue
+		}
+		data = relocate(data, source, destination, false)
+	}
+	return data
+}
+
+// performAppend appends the resolved values to the arrays at the defined paths,
+// a missing array is created.
+func (t *transformer) performAppend(data map[string]any, resolver *valueResolver) map[string]any {
+	for _, path := range slices.Sorted(maps.Keys(t.appendDefinitions)) {
+		val, found := resolver.resolve(t.appendDefinitions[path])
+		if !found {
+			log.Trace().Msgf("no value found for %s, skipping append", path)
+			continue
+		}
+
+		expr, err := jp.ParseString(normalizePath(path))
+		if err != nil {
+			log.Trace().Err(err).Msgf("failed to parse JSONPath: %s", path)
+			continue
+		}
+
+		var items []any
+		if values := expr.Get(data); len(values) > 0 {
+			existing, isList := values[0].([]any)
+			if !isList {
+				log.Trace().Msgf("value at %s is not an array, skipping append", path)
+				continue
+			}
+			items = existing
+		}
+
+		if err := expr.Set(data, append(items, val)); err != nil {
+			log.Trace().Err(err).Msgf("failed to append value at %s", path)
+		}
+	}
+	return data
+}
+
+// performHeaders applies the header operations on the transaction of the stream type.
+// Header names are matched case-insensitively.
+func (t *transformer) performHeaders(
+	data map[string]any,
+	streamType public_types.StreamType,
+	resolver *valueResolver,
+) {
+	if len(t.setHeadersDefinitions) == 0 && len(t.deleteHeadersDefinitions) == 0 {
+		return
+	}
+
+	transaction := data[transactionKey(streamType)]
+	transactionMap, ok := transaction.(map[string]any)
+	if !ok {
+		log.Trace().Msgf("no %s found for header operations", transactionKey(streamType))
+		return
+	}
+	headers, _ := transactionMap["headers"].(map[string]any)
+	if headers == nil {
+		headers = make(map[string]any)
+		transactionMap["headers"] = headers
+	}
+
+	for _, name := range t.deleteHeadersDefinitions {
+		deleteFold(headers, name)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(t.setHeadersDefinitions)) {
+		val, found := resolver.resolve(t.setHeadersDefinitions[name])
+		if !found {
+			log.Trace().Msgf("no value found for header %s, skipping", name)
+			continue
+		}
+		deleteFold(headers, name)
+		headers[name] = fmt.Sprintf("%v", val)
+	}
+}
+
+// performQueryParams applies the query param operations on the request
+func (t *transformer) performQueryParams(data map[string]any, resolver *valueResolver) {
+	if len(t.setQueryParamsDefinitions) == 0 && len(t.deleteQueryParamsDefinitions) == 0 {
+		return
+	}
+
+	request, ok := data["request"].(map[string]any)
+	if !ok {
+		log.Trace().Msg("no request found for query param operations")
+		return
+	}
+	query, _ := request["parsed_query"].(map[string]any)
+	if query == nil {
+		query = make(map[string]any)
+		request["parsed_query"] = query
+	}
+
+	for _, name := range t.deleteQueryParamsDefinitions {
+		delete(query, name)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(t.setQueryParamsDefinitions)) {
+		val, found := resolver.resolve(t.setQueryParamsDefinitions[name])
+		if !found {
+			log.Trace().Msgf("no value found for query param %s, skipping", name)
+			continue
+		}
+		query[name] = []any{fmt.Sprintf("%v", val)}
+	}
+}
+
+// valueResolver resolves the values of set, append, header and query param operations.
+// A dynamic value is a map with a single value_from key:
+//   - {"value_from": "$.request..."} / {"value_from": "$.response..."} reads the stream
+//     as it was before the transformation
+//   - {"value_from": "$context.<key>"} reads the transactional context
+//
+// A $ENV_VAR (upper case) value is replaced with the environment variable, when defined.
+// Any other value is used as is.
+type valueResolver struct {
+	apiStream public_types.APIStreamI
+	source    map[string]any
+}
+
+func (r *valueResolver) resolve(val any) (any, bool) {
+	if path, isDynamic := dynamicValuePath(val); isDynamic {
+		if strings.HasPrefix(path, contextValuePrefix) {
+			return r.fromContext(strings.TrimPrefix(path, contextValuePrefix))
+		}
+		return r.fromStream(path)
+	}
+
+	strVal := fmt.Sprintf("%v", val)
+	if strings.HasPrefix(strVal, "$") && isUpperCase(strVal) {
+		if envVal := os.Getenv(strings.TrimPrefix(strVal, "$")); envVal != "" {
+			return envVal, true
+		}
+	}
+	return val, true
+}
+
+// dynamicValuePath returns the path of a {"value_from": <path>} value
+func dynamicValuePath(val any) (string, bool) {
+	valMap, isMap := val.(map[string]any)
+	if !isMap || len(valMap) != 1 {
+		return "", false
+	}
+	path, isString := valMap[valueFromKey].(string)
+	return path, isString
+}
+
+func (r *valueResolver) fromStream(path string) (any, bool) {
+	if r.source == nil {
+		source, err := utils.ConvertStreamToDataMap(r.apiStream)
+		if err != nil {
+			log.Trace().Err(err).Msg("failed to convert stream for expression")
+			return nil, false
+		}
+		r.source = source
+	}
+
+	expr, err := jp.ParseString(normalizePath(path))
+	if err != nil {
+		log.Trace().Err(err).Msgf("failed to parse JSONPath: %s", path)
+		return nil, false
+	}
+	values := expr.Get(r.source)
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
+
+func (r *valueResolver) fromContext(key string) (any, bool) {
+	if r.apiStream.GetContext() == nil {
+		return nil, false
+	}
+	val, err := r.apiStream.GetContext().GetTransactionalContext().Get(key)
+	if err != nil {
+		log.Trace().Err(err).Msgf("failed to get %s from the transactional context", key)
+		return nil, false
+	}
+	return val, true
+}
+
+// relocate copies the first value found at source to destination,
+// and removes the source when move is set.
+func relocate(data map[string]any, source, destination jp.Expr, move bool) map[string]any {
+	values := source.Get(data)
+	if len(values) == 0 {
+		log.Trace().Msgf("no value found at %s", source)
+		return data
+	}
+	val := values[0]
+
+	if move {
+		changedData, err := source.Remove(data)
+		if err != nil {
+			log.Trace().Err(err).Msgf("failed to remove value at %s", source)
+			return data
+		}
+		data = changedData.(map[string]any)
+	} else {
+		// the copy must not share nested objects with the source
+		val = alt.Dup(val)
+	}
+
+	if err := destination.Set(data, val); err != nil {
+		log.Trace().Err(err).Msgf("failed to set value at %s", destination)
+	}
+	return data
+}
+
+func parsePathPair(source, destination string) (jp.Expr, jp.Expr, error) {
+	sourceExpr, err := jp.ParseString(normalizePath(source))
+	if err != nil {
+		return nil, nil, err
+	}
+	destinationExpr, err := jp.ParseString(normalizePath(destination))
+	if err != nil {
+		return nil, nil, err
+	}
+	return sourceExpr, destinationExpr, nil
+}
+
+// normalizePath maps the user facing fields to the fields of the data map
+func normalizePath(path string) string {
+	path = strings.Replace(path, ".body.", ".body_map.", 1)
+	return strings.Replace(path, ".status_code", ".status", 1)
+}
+
+func transactionKey(streamType public_types.StreamType) string {
+	if streamType.IsRequestType() {
+		return "request"
+	}
+	return "response"
+}
+
+// encodeQuery returns the query in its canonical form, with the params sorted by key
+func encodeQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+func deleteFold(headers map[string]any, name string) {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			delete(headers, key)
+		}
+	}
+}
+
 func isUpperCase(s string) bool {
 	return s != "" && s == strings.ToUpper(s)
 }
@@ -96,6 +96,19 @@ func (p *userDefinedMetricsProcessor) Execute(
 		}
 	}
 
+	attributes, recorded := p.labelManager.LimitCardinality(metricPrefix+p.metricName, attributes)
+	if !recorded {
+		return streamtypes.ProcessorIO{
+			Type: publictypes.StreamTypeAny,
+			Name: "",
+		}, nil
+	}
+	for _, attr := range attributes {
+		if _, found := labelMap[string(attr.Key)]; found {
+			labelMap[string(attr.Key)] = attr.Value.AsString()
+		}
+	}
+
 	metricValue, err := getMetricValue(stream, p.metricValue)
 	if err != nil {
 		log.Error().
@@ -83,7 +83,8 @@ func (p *userDefinedProcessor) GetName() string {
 
 func (p *userDefinedProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{
-		IsBodyRequired: true,
+		IsBodyRequired:    true,
+		IsRequestModifier: true,
 	}
 }
 
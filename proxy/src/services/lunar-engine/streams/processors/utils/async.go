@@ -0,0 +1,33 @@
+package utils
+
+import (
+	public_types "lunar/engine/streams/public-types"
+	"strconv"
+)
+
+const (
+	// AsyncAttemptHeaderName is set by the async service on the requests it sends to the Engine
+	AsyncAttemptHeaderName = "X-Lunar-Async-Attempt"
+	// AsyncStateHeaderName tells the async service the request was not completed,
+	// it is sent again later when its value is AsyncStateRetry
+	AsyncStateHeaderName = "X-Lunar-Async-State"
+	AsyncStateRetry      = "retry"
+)
+
+// GetAsyncAttempt returns the attempt number of a request sent by the async service.
+// It returns false for requests which did not go through the async service.
+func GetAsyncAttempt(apiStream public_types.APIStreamI) (int, bool) {
+	request := apiStream.GetRequest()
+	if request == nil {
+		return 0, false
+	}
+	rawAttempt, found := request.GetHeader(AsyncAttemptHeaderName)
+	if !found {
+		return 0, false
+	}
+	attempt, err := strconv.Atoi(rawAttempt)
+	if err != nil || attempt < 1 {
+		return 0, false
+	}
+	return attempt, true
+}
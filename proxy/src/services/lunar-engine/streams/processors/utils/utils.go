@@ -6,6 +6,7 @@ import (
 	public_types "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -426,6 +427,16 @@ func ExtractKeyValuePair(raw string) (string, string) {
 	return parts[0], parts[1]
 }
 
+// ResolveEnvValue replaces a $ENV_VAR reference with the value of the environment variable
+func ResolveEnvValue(value string) string {
+	if name, isReference := strings.CutPrefix(value, "$"); isReference && name == strings.ToUpper(name) {
+		if envValue := os.Getenv(name); envValue != "" {
+			return envValue
+		}
+	}
+	return value
+}
+
 // Function to convert string to numeric type T
 func convertStringToNumeric[T Numeric](strVal string) (T, error) {
 	var zero T
@@ -303,3 +303,11 @@ func TestExtractMapFromParams(t *testing.T) {
 		require.EqualError(t, err, "result is nil")
 	})
 }
+
+func TestResolveEnvValue(t *testing.T) {
+	t.Setenv("UTILS_TEST_SECRET", "from-env")
+	require.Equal(t, "from-env", ResolveEnvValue("$UTILS_TEST_SECRET"))
+	require.Equal(t, "$UTILS_TEST_MISSING", ResolveEnvValue("$UTILS_TEST_MISSING"))
+	require.Equal(t, "$not_env", ResolveEnvValue("$not_env"))
+	require.Equal(t, "plain", ResolveEnvValue("plain"))
+}
@@ -0,0 +1,493 @@
+package validateschema
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const maxSchemaDepth = 64
+
+var (
+	uuidRegexp  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// Violation describes a single mismatch between an API call and its schema
+type Violation struct {
+	Location string `json:"location"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Field == "" {
+		return fmt.Sprintf("%s: %s", v.Location, v.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", v.Location, v.Field, v.Message)
+}
+
+// schemaValidator validates values against a subset of JSON Schema
+// (as used by OpenAPI 3.0/3.1). References are resolved against the root document.
+type schemaValidator struct {
+	root     map[string]any
+	patterns sync.Map // map[string]*regexp.Regexp
+}
+
+func newSchemaValidator(root map[string]any) *schemaValidator {
+	return &schemaValidator{root: root}
+}
+
+// Validate validates value against schema, reporting violations under location
+func (v *schemaValidator) Validate(
+	schema map[string]any,
+	value any,
+	location string,
+	field string,
+) []Violation {
+	var violations []Violation
+	v.validate(schema, value, location, field, 0, &violations)
+	return violations
+}
+
+func (v *schemaValidator) validate(
+	schema map[string]any,
+	value any,
+	location, field string,
+	depth int,
+	violations *[]Violation,
+) {
+	if schema == nil {
+		return
+	}
+	if depth > maxSchemaDepth {
+		v.report(violations, location, field, "schema is too deep or recursive")
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolveRef(ref)
+		if err != nil {
+			v.report(violations, location, field, err.Error())
+			return
+		}
+		v.validate(resolved, value, location, field, depth+1, violations)
+		return
+	}
+
+	if value == nil && schema["nullable"] == true {
+		return
+	}
+
+	v.validateCombinators(schema, value, location, field, depth, violations)
+
+	if enum, ok := schema["enum"].([]any); ok && !containsValue(enum, value) {
+		v.report(violations, location, field, fmt.Sprintf("value %v is not one of %v", value, enum))
+		return
+	}
+
+	if !v.validateType(schema, value, location, field, violations) {
+		return
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]any:
+		v.validateObject(schema, typedValue, location, field, depth, violations)
+	case []any:
+		v.validateArray(schema, typedValue, location, field, depth, violations)
+	case string:
+		v.validateString(schema, typedValue, location, field, violations)
+	default:
+		if number, isNumber := toFloat(value); isNumber {
+			v.validateNumber(schema, number, location, field, violations)
+		}
+	}
+}
+
+func (v *schemaValidator) validateCombinators(
+	schema map[string]any,
+	value any,
+	location, field string,
+	depth int,
+	violations *[]Violation,
+) {
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			v.validate(asMap(sub), value, location, field, depth+1, violations)
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(v.Validate(asMap(sub), value, location, field)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.report(violations, location, field, "value does not match any of the allowed schemas")
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if len(v.Validate(asMap(sub), value, location, field)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.report(violations, location, field,
+				fmt.Sprintf("value must match exactly one schema, matched %d", matches))
+		}
+	}
+}
+
+// validateType returns false if the value is not of the expected type
+func (v *schemaValidator) validateType(
+	schema map[string]any,
+	value any,
+	location, field string,
+	violations *[]Violation,
+) bool {
+	var allowedTypes []string
+	switch rawType := schema["type"].(type) {
+	case string:
+		allowedTypes = []string{rawType}
+	case []any:
+		for _, item := range rawType {
+			if typeName, ok := item.(string); ok {
+				allowedTypes = append(allowedTypes, typeName)
+			}
+		}
+	}
+	if len(allowedTypes) == 0 {
+		return true
+	}
+
+	for _, typeName := range allowedTypes {
+		if isOfType(typeName, value) {
+			return true
+		}
+	}
+	v.report(violations, location, field,
+		fmt.Sprintf("expected %s, got %s", strings.Join(allowedTypes, " or "), typeOf(value)))
+	return false
+}
+
+func (v *schemaValidator) validateObject(
+	schema map[string]any,
+	value map[string]any,
+	location, field string,
+	depth int,
+	violations *[]Violation,
+) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, rawName := range required {
+			name := fmt.Sprint(rawName)
+			if _, found := value[name]; !found {
+				v.report(violations, location, joinField(field, name), "is required")
+			}
+		}
+	}
+
+	properties := asMap(schema["properties"])
+	for name, propertyValue := range value {
+		if propertySchema, found := properties[name]; found {
+			v.validate(asMap(propertySchema), propertyValue, location,
+				joinField(field, name), depth+1, violations)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.report(violations, location, joinField(field, name), "additional property is not allowed")
+			}
+		case map[string]any:
+			v.validate(additional, propertyValue, location, joinField(field, name), depth+1, violations)
+		}
+	}
+
+	if minProperties, ok := toInt(schema["minProperties"]); ok && len(value) < minProperties {
+		v.report(violations, location, field,
+			fmt.Sprintf("must have at least %d properties", minProperties))
+	}
+	if maxProperties, ok := toInt(schema["maxProperties"]); ok && len(value) > maxProperties {
+		v.report(violations, location, field,
+			fmt.Sprintf("must have at most %d properties", maxProperties))
+	}
+}
+
+func (v *schemaValidator) validateArray(
+	schema map[string]any,
+	value []any,
+	location, field string,
+	depth int,
+	violations *[]Violation,
+) {
+	if minItems, ok := toInt(schema["minItems"]); ok && len(value) < minItems {
+		v.report(violations, location, field, fmt.Sprintf("must have at least %d items", minItems))
+	}
+	if maxItems, ok := toInt(schema["maxItems"]); ok && len(value) > maxItems {
+		v.report(violations, location, field, fmt.Sprintf("must have at most %d items", maxItems))
+	}
+	if schema["uniqueItems"] == true {
+	uniqueCheck:
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if valuesEqual(value[i], value[j]) {
+					v.report(violations, location, field, "items must be unique")
+					break uniqueCheck
+				}
+			}
+		}
+	}
+
+	items := asMap(schema["items"])
+	if items == nil {
+		return
+	}
+	for index, item := range value {
+		v.validate(items, item, location, fmt.Sprintf("%s[%d]", field, index), depth+1, violations)
+	}
+}
+
+func (v *schemaValidator) validateString(
+	schema map[string]any,
+	value string,
+	location, field string,
+	violations *[]Violation,
+) {
+	length := utf8.RuneCountInString(value)
+	if minLength, ok := toInt(schema["minLength"]); ok && length < minLength {
+		v.report(violations, location, field, fmt.Sprintf("length must be at least %d", minLength))
+	}
+	if maxLength, ok := toInt(schema["maxLength"]); ok && length > maxLength {
+		v.report(violations, location, field, fmt.Sprintf("length must be at most %d", maxLength))
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		compiled, err := v.compilePattern(pattern)
+		if err != nil {
+			v.report(violations, location, field, fmt.Sprintf("invalid pattern %s: %v", pattern, err))
+		} else if !compiled.MatchString(value) {
+			v.report(violations, location, field, fmt.Sprintf("does not match pattern %s", pattern))
+		}
+	}
+
+	if format, ok := schema["format"].(string); ok && !isValidFormat(format, value) {
+		v.report(violations, location, field, fmt.Sprintf("is not a valid %s", format))
+	}
+}
+
+func (v *schemaValidator) validateNumber(
+	schema map[string]any,
+	value float64,
+	location, field string,
+	violations *[]Violation,
+) {
+	if minimum, ok := toFloat(schema["minimum"]); ok {
+		if schema["exclusiveMinimum"] == true && value <= minimum {
+			v.report(violations, location, field, fmt.Sprintf("must be greater than %v", minimum))
+		} else if value < minimum {
+			v.report(violations, location, field, fmt.Sprintf("must be at least %v", minimum))
+		}
+	}
+	if maximum, ok := toFloat(schema["maximum"]); ok {
+		if schema["exclusiveMaximum"] == true && value >= maximum {
+			v.report(violations, location, field, fmt.Sprintf("must be less than %v", maximum))
+		} else if value > maximum {
+			v.report(violations, location, field, fmt.Sprintf("must be at most %v", maximum))
+		}
+	}
+	// JSON Schema 2019+ / OpenAPI 3.1 numeric form
+	if exclusiveMinimum, ok := toFloat(schema["exclusiveMinimum"]); ok && value <= exclusiveMinimum {
+		v.report(violations, location, field, fmt.Sprintf("must be greater than %v", exclusiveMinimum))
+	}
+	if exclusiveMaximum, ok := toFloat(schema["exclusiveMaximum"]); ok && value >= exclusiveMaximum {
+		v.report(violations, location, field, fmt.Sprintf("must be less than %v", exclusiveMaximum))
+	}
+	if multipleOf, ok := toFloat(schema["multipleOf"]); ok && multipleOf > 0 {
+		quotient := value / multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.report(violations, location, field, fmt.Sprintf("must be a multiple of %v", multipleOf))
+		}
+	}
+}
+
+// resolveRef resolves local references such as '#/components/schemas/User'
+func (v *schemaValidator) resolveRef(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %s, only local references are supported", ref)
+	}
+
+	var current any = v.root
+	for _, rawPart := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part := strings.ReplaceAll(strings.ReplaceAll(rawPart, "~1", "/"), "~0", "~")
+		currentMap, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("failed to resolve reference %s", ref)
+		}
+		if current, ok = currentMap[part]; !ok {
+			return nil, fmt.Errorf("failed to resolve reference %s", ref)
+		}
+	}
+
+	resolved, ok := current.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("reference %s is not a schema", ref)
+	}
+	return resolved, nil
+}
+
+func (v *schemaValidator) compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, found := v.patterns.Load(pattern); found {
+		return cached.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns.Store(pattern, compiled)
+	return compiled, nil
+}
+
+func (v *schemaValidator) report(violations *[]Violation, location, field, message string) {
+	*violations = append(*violations, Violation{
+		Location: location,
+		Field:    field,
+		Message:  message,
+	})
+}
+
+func isOfType(typeName string, value any) bool {
+	switch typeName {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		number, ok := toFloat(value)
+		return ok && number == math.Trunc(number)
+	}
+	return true
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if _, ok := toFloat(value); ok {
+		return "number"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+func isValidFormat(format, value string) bool {
+	switch format {
+	case "email":
+		return emailRegexp.MatchString(value)
+	case "uuid":
+		return uuidRegexp.MatchString(value)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() == nil
+	case "uri":
+		parsed, err := url.Parse(value)
+		return err == nil && parsed.Scheme != ""
+	}
+	// unknown formats are annotations only
+	return true
+}
+
+func containsValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if valuesEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func valuesEqual(a, b any) bool {
+	if aNumber, ok := toFloat(a); ok {
+		bNumber, ok := toFloat(b)
+		return ok && aNumber == bNumber
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(value any) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case uint64:
+		return float64(number), true
+	}
+	return 0, false
+}
+
+func toInt(value any) (int, bool) {
+	number, ok := toFloat(value)
+	return int(number), ok
+}
+
+func asMap(value any) map[string]any {
+	valueMap, _ := value.(map[string]any)
+	return valueMap
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
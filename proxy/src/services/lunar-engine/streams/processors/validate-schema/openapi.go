@@ -0,0 +1,325 @@
+package validateschema
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/urltree"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	paramInPath   = "path"
+	paramInQuery  = "query"
+	paramInHeader = "header"
+
+	defaultResponseKey = "default"
+)
+
+var supportedMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	schema   map[string]any
+}
+
+type operation struct {
+	validator    *schemaValidator
+	parameters   []*parameter
+	bodyRequired bool
+	bodySchema   map[string]any
+	// responses maps a status code ('200', '4XX' or 'default') to its JSON schema (may be nil)
+	responses map[string]map[string]any
+}
+
+// endpoint holds the operations of a single templated path, keyed by upper case method
+type endpoint struct {
+	template   string
+	operations map[string]*operation
+}
+
+type schemaRegistry struct {
+	tree *urltree.URLTree[endpoint]
+	// endpoints keeps the inserted values, so operations of the same path can be merged
+	endpoints map[string]*endpoint
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		tree:      urltree.NewURLTree[endpoint](false, 0),
+		endpoints: make(map[string]*endpoint),
+	}
+}
+
+func (r *schemaRegistry) lookup(rawURL string) (*endpoint, map[string]string, bool) {
+	result := r.tree.Lookup(rawURL)
+	if !result.Match || result.Value == nil {
+		return nil, nil, false
+	}
+	return result.Value, result.PathParams, true
+}
+
+func (r *schemaRegistry) addOperation(template, method string, op *operation) error {
+	template = strings.Trim(template, "/")
+	existing, found := r.endpoints[template]
+	if !found {
+		existing = &endpoint{
+			template:   template,
+			operations: make(map[string]*operation),
+		}
+		if err := r.tree.InsertDeclaredURL(template, existing); err != nil {
+			return fmt.Errorf("failed to register endpoint %s: %w", template, err)
+		}
+		r.endpoints[template] = existing
+	}
+	existing.operations[strings.ToUpper(method)] = op
+	return nil
+}
+
+// loadOpenAPISpec loads an OpenAPI 3 document (YAML or JSON) into the registry.
+// Paths are registered under each of the given hosts, or under the hosts of the document servers.
+func (r *schemaRegistry) loadOpenAPISpec(specPath string, hosts []string) error {
+	document, err := readDocument(specPath)
+	if err != nil {
+		return err
+	}
+
+	if version, _ := document["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return fmt.Errorf("%s is not an OpenAPI 3 document", specPath)
+	}
+
+	prefixes := hosts
+	if len(prefixes) == 0 {
+		prefixes = serverPrefixes(document)
+	}
+	if len(prefixes) == 0 {
+		return fmt.Errorf("no host defined for %s, set the 'hosts' parameter or 'servers' in the document",
+			specPath)
+	}
+
+	validator := newSchemaValidator(document)
+	for rawPath, rawPathItem := range asMap(document["paths"]) {
+		pathItem := asMap(rawPathItem)
+		if ref, ok := pathItem["$ref"].(string); ok {
+			if pathItem, err = validator.resolveRef(ref); err != nil {
+				return err
+			}
+		}
+		pathParameters := buildParameters(validator, pathItem["parameters"])
+
+		for _, method := range supportedMethods {
+			rawOperation, found := pathItem[method]
+			if !found {
+				continue
+			}
+			op := buildOperation(validator, asMap(rawOperation), pathParameters)
+			for _, prefix := range prefixes {
+				if err := r.addOperation(prefix+rawPath, method, op); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	log.Debug().Msgf("Loaded OpenAPI spec %s for %v", specPath, prefixes)
+	return nil
+}
+
+// loadEndpointSchema registers a plain JSON Schema for the body of a single endpoint.
+// The key is in the form of 'METHOD host/path', e.g. 'POST api.example.com/users/{id}'.
+func (r *schemaRegistry) loadEndpointSchema(key, schemaPath string) error {
+	method, template, found := strings.Cut(strings.TrimSpace(key), " ")
+	if !found || method == "" || template == "" {
+		return fmt.Errorf("invalid endpoint '%s', expected 'METHOD host/path'", key)
+	}
+
+	document, err := readDocument(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	op := &operation{
+		validator:    newSchemaValidator(document),
+		bodyRequired: true,
+		bodySchema:   document,
+		responses:    make(map[string]map[string]any),
+	}
+	return r.addOperation(strings.TrimSpace(template), method, op)
+}
+
+func buildOperation(
+	validator *schemaValidator,
+	rawOperation map[string]any,
+	pathParameters []*parameter,
+) *operation {
+	op := &operation{
+		validator: validator,
+		responses: make(map[string]map[string]any),
+	}
+
+	// operation level parameters override path level parameters with the same name and location
+	operationParameters := buildParameters(validator, rawOperation["parameters"])
+	overridden := make(map[string]struct{})
+	for _, param := range operationParameters {
+		overridden[param.in+":"+param.name] = struct{}{}
+	}
+	for _, param := range pathParameters {
+		if _, found := overridden[param.in+":"+param.name]; !found {
+			op.parameters = append(op.parameters, param)
+		}
+	}
+	op.parameters = append(op.parameters, operationParameters...)
+
+	if requestBody := resolveMap(validator, rawOperation["requestBody"]); requestBody != nil {
+		op.bodyRequired, _ = requestBody["required"].(bool)
+		op.bodySchema = jsonContentSchema(asMap(requestBody["content"]))
+	}
+
+	for status, rawResponse := range asMap(rawOperation["responses"]) {
+		response := resolveMap(validator, rawResponse)
+		statusKey := strings.ToUpper(status)
+		if strings.EqualFold(status, defaultResponseKey) {
+			statusKey = defaultResponseKey
+		}
+		op.responses[statusKey] = jsonContentSchema(asMap(response["content"]))
+	}
+	return op
+}
+
+func buildParameters(validator *schemaValidator, rawParameters any) []*parameter {
+	var parameters []*parameter
+	list, _ := rawParameters.([]any)
+	for _, rawParameter := range list {
+		param := resolveMap(validator, rawParameter)
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		if name == "" || in == "" {
+			continue
+		}
+		required, _ := param["required"].(bool)
+		if in == paramInPath {
+			required = true
+		}
+		if in == paramInHeader {
+			name = strings.ToLower(name)
+		}
+		parameters = append(parameters, &parameter{
+			name:     name,
+			in:       in,
+			required: required,
+			schema:   asMap(param["schema"]),
+		})
+	}
+	return parameters
+}
+
+// jsonContentSchema returns the schema of the JSON media type, if defined
+func jsonContentSchema(content map[string]any) map[string]any {
+	for mediaType, rawMedia := range content {
+		if isJSONContentType(mediaType) {
+			return asMap(asMap(rawMedia)["schema"])
+		}
+	}
+	return nil
+}
+
+func resolveMap(validator *schemaValidator, raw any) map[string]any {
+	value := asMap(raw)
+	if ref, ok := value["$ref"].(string); ok {
+		resolved, err := validator.resolveRef(ref)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to resolve OpenAPI reference")
+			return nil
+		}
+		return resolved
+	}
+	return value
+}
+
+// serverPrefixes extracts 'host/basePath' prefixes from the document servers
+func serverPrefixes(document map[string]any) []string {
+	var prefixes []string
+	servers, _ := document["servers"].([]any)
+	for _, rawServer := range servers {
+		rawURL, _ := asMap(rawServer)["url"].(string)
+		if rawURL == "" {
+			continue
+		}
+		if !strings.Contains(rawURL, "://") {
+			rawURL = "https://" + rawURL
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Hostname() == "" {
+			log.Debug().Msgf("skipping OpenAPI server %s without a host", rawURL)
+			continue
+		}
+		prefixes = append(prefixes, parsed.Hostname()+strings.TrimSuffix(parsed.Path, "/"))
+	}
+	return prefixes
+}
+
+// readDocument reads a YAML or JSON document.
+// Relative paths are resolved against the schemas folder of the config directory.
+func readDocument(documentPath string) (map[string]any, error) {
+	if !filepath.IsAbs(documentPath) {
+		documentPath = filepath.Join(
+			environment.GetCustomSchemasDirectory(environment.GetConfigRootDirectory()),
+			documentPath,
+		)
+	}
+
+	// The path is taken from the processor configuration, not from API calls
+	//nolint:gosec
+	data, err := os.ReadFile(documentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema document %s: %w", documentPath, err)
+	}
+
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse schema document %s: %w", documentPath, err)
+	}
+
+	document, ok := normalizeDocument(raw).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema document %s must be an object", documentPath)
+	}
+	return document, nil
+}
+
+// normalizeDocument converts YAML maps with non-string keys (e.g. response codes) to map[string]any
+func normalizeDocument(raw any) any {
+	switch value := raw.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = normalizeDocument(item)
+		}
+		return value
+	case map[any]any:
+		converted := make(map[string]any, len(value))
+		for key, item := range value {
+			converted[fmt.Sprint(key)] = normalizeDocument(item)
+		}
+		return converted
+	case []any:
+		for index, item := range value {
+			value[index] = normalizeDocument(item)
+		}
+		return value
+	}
+	return raw
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/json" ||
+		(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,505 @@
+package validateschema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/otel"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	specFileParam            = "spec_file"
+	hostsParam               = "hosts"
+	endpointSchemasParam     = "endpoint_schemas"
+	validateRequestsParam    = "validate_requests"
+	validateResponsesParam   = "validate_responses"
+	rejectUnknownParam       = "reject_unknown_endpoints"
+	rejectUnknownQueryParam  = "reject_unknown_query_params"
+	maxReportedViolationsArg = "max_reported_violations"
+
+	validConditionName   = "valid"
+	invalidConditionName = "invalid"
+
+	// ViolationsContextKey holds the []Violation found for the transaction
+	ViolationsContextKey = "validate_schema_violations"
+
+	invalidCountMetric = "lunar_validate_schema_invalid_count"
+
+	locationMethod   = "method"
+	locationEndpoint = "endpoint"
+	locationPath     = "path"
+	locationQuery    = "query"
+	locationHeader   = "header"
+	locationBody     = "body"
+	locationStatus   = "status"
+
+	defaultMaxReportedViolations = 20
+)
+
+type validateSchemaProcessor struct {
+	name                     string
+	registry                 *schemaRegistry
+	validateRequests         bool
+	validateResponses        bool
+	rejectUnknownEndpoints   bool
+	rejectUnknownQueryParams bool
+	maxReportedViolations    int
+	metaData                 *streamtypes.ProcessorMetaData
+
+	labelManager *lunar_metrics.LabelManager
+	metricObject metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &validateSchemaProcessor{
+		name:                  metaData.Name,
+		metaData:              metaData,
+		registry:              newSchemaRegistry(),
+		validateRequests:      true,
+		validateResponses:     true,
+		maxReportedViolations: defaultMaxReportedViolations,
+		labelManager:          lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *validateSchemaProcessor) GetName() string {
+	return p.name
+}
+
+func (p *validateSchemaProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *validateSchemaProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	var violations []Violation
+	switch apiStream.GetType() {
+	case public_types.StreamTypeRequest:
+		if p.validateRequests {
+			violations = p.validateRequest(apiStream.GetRequest())
+		}
+	case public_types.StreamTypeResponse:
+		if p.validateResponses {
+			violations = p.validateResponse(apiStream.GetRequest(), apiStream.GetResponse())
+		}
+	default:
+		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+	}
+
+	condition := validConditionName
+	if len(violations) > 0 {
+		condition = invalidConditionName
+		p.reportViolations(flowName, apiStream, violations)
+	}
+
+	return streamtypes.ProcessorIO{
+		Type:       apiStream.GetType(),
+		ReqAction:  &actions.NoOpAction{},
+		RespAction: &actions.NoOpAction{},
+		Name:       condition,
+	}, nil
+}
+
+func (p *validateSchemaProcessor) validateRequest(request public_types.TransactionI) []Violation {
+	if request == nil {
+		return nil
+	}
+
+	endpoint, pathParams, op, violations := p.findOperation(request.GetURL(), request.GetMethod())
+	if op == nil {
+		return violations
+	}
+	log.Trace().Msgf("%s: validating request against %s %s",
+		p.name, request.GetMethod(), endpoint.template)
+
+	var queryValues url.Values
+	if parsedURL := request.GetParsedURL(); parsedURL != nil {
+		queryValues = parsedURL.Query()
+	}
+
+	knownQueryParams := make(map[string]struct{})
+	for _, param := range op.parameters {
+		var values []string
+		var found bool
+		switch param.in {
+		case paramInPath:
+			var value string
+			value, found = pathParams[param.name]
+			values = []string{value}
+		case paramInQuery:
+			knownQueryParams[param.name] = struct{}{}
+			values, found = queryValues[param.name]
+		case paramInHeader:
+			var value string
+			value, found = request.GetHeader(param.name)
+			values = []string{value}
+		default:
+			continue
+		}
+
+		if !found {
+			if param.required {
+				violations = append(violations, Violation{
+					Location: param.in,
+					Field:    param.name,
+					Message:  "is required",
+				})
+			}
+			continue
+		}
+		violations = append(violations, p.validateParameter(op.validator, param, values)...)
+	}
+
+	if p.rejectUnknownQueryParams {
+		for name := range queryValues {
+			if _, known := knownQueryParams[name]; !known {
+				violations = append(violations, Violation{
+					Location: locationQuery,
+					Field:    name,
+					Message:  "unknown query parameter",
+				})
+			}
+		}
+	}
+
+	contentType, _ := request.GetHeader("content-type")
+	violations = append(violations,
+		validateBody(op.validator, op.bodySchema, op.bodyRequired, contentType, request.GetBody())...)
+	return violations
+}
+
+func (p *validateSchemaProcessor) validateResponse(
+	request public_types.TransactionI,
+	response public_types.TransactionI,
+) []Violation {
+	if response == nil {
+		return nil
+	}
+
+	method := response.GetMethod()
+	rawURL := response.GetURL()
+	if request != nil {
+		method = request.GetMethod()
+		rawURL = request.GetURL()
+	}
+
+	_, _, op, violations := p.findOperation(rawURL, method)
+	if op == nil || len(op.responses) == 0 {
+		return violations
+	}
+
+	schema, found := responseSchema(op.responses, response.GetStatus())
+	if !found {
+		return []Violation{{
+			Location: locationStatus,
+			Field:    strconv.Itoa(response.GetStatus()),
+			Message:  "status code is not documented",
+		}}
+	}
+
+	contentType, _ := response.GetHeader("content-type")
+	return validateBody(op.validator, schema, false, contentType, response.GetBody())
+}
+
+// findOperation returns the matching operation, or the violations explaining why none matched
+func (p *validateSchemaProcessor) findOperation(
+	rawURL, method string,
+) (*endpoint, map[string]string, *operation, []Violation) {
+	endpoint, pathParams, found := p.registry.lookup(normalizeLookupURL(rawURL))
+	if !found {
+		if p.rejectUnknownEndpoints {
+			return nil, nil, nil, []Violation{{
+				Location: locationEndpoint,
+				Field:    normalizeLookupURL(rawURL),
+				Message:  "endpoint is not defined in the schema",
+			}}
+		}
+		log.Trace().Msgf("%s: no schema defined for %s", p.name, rawURL)
+		return nil, nil, nil, nil
+	}
+
+	op, found := endpoint.operations[strings.ToUpper(method)]
+	if !found {
+		allowed := make([]string, 0, len(endpoint.operations))
+		for allowedMethod := range endpoint.operations {
+			allowed = append(allowed, allowedMethod)
+		}
+		sort.Strings(allowed)
+		return endpoint, pathParams, nil, []Violation{{
+			Location: locationMethod,
+			Field:    method,
+			Message:  fmt.Sprintf("method is not allowed for %s, allowed: %v", endpoint.template, allowed),
+		}}
+	}
+	return endpoint, pathParams, op, nil
+}
+
+// validateParameter coerces raw string values into the parameter schema type before validation
+func (p *validateSchemaProcessor) validateParameter(
+	validator *schemaValidator,
+	param *parameter,
+	values []string,
+) []Violation {
+	if param.schema == nil {
+		return nil
+	}
+
+	schema := param.schema
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := validator.resolveRef(ref)
+		if err != nil {
+			return []Violation{{Location: param.in, Field: param.name, Message: err.Error()}}
+		}
+		schema = resolved
+	}
+
+	var value any
+	if schemaType, _ := schema["type"].(string); schemaType == "array" {
+		if len(values) == 1 && param.in != paramInQuery {
+			values = strings.Split(values[0], ",")
+		}
+		items := make([]any, 0, len(values))
+		itemsSchema := asMap(schema["items"])
+		for _, raw := range values {
+			items = append(items, coerceValue(itemsSchema, raw))
+		}
+		value = items
+	} else {
+		value = coerceValue(schema, values[0])
+	}
+
+	return validator.Validate(schema, value, param.in, param.name)
+}
+
+func (p *validateSchemaProcessor) reportViolations(
+	flowName string,
+	apiStream public_types.APIStreamI,
+	violations []Violation,
+) {
+	if len(violations) > p.maxReportedViolations {
+		violations = violations[:p.maxReportedViolations]
+	}
+
+	log.Debug().Msgf("%s: %s %s failed schema validation: %v",
+		p.name, apiStream.GetMethod(), apiStream.GetURL(), violations)
+
+	if lunarContext := apiStream.GetContext(); lunarContext != nil {
+		if err := lunarContext.GetTransactionalContext().
+			Set(ViolationsContextKey, violations); err != nil {
+			log.Trace().Err(err).Msgf("%s: failed to store violations in context", p.name)
+		}
+	}
+
+	p.updateMetrics(flowName, apiStream)
+}
+
+func (p *validateSchemaProcessor) init() error {
+	var specFile string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		specFileParam,
+		&specFile); err != nil {
+		log.Trace().Msgf("%s not defined for %s", specFileParam, p.name)
+	}
+
+	var hosts []string
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		hostsParam,
+		&hosts); err != nil {
+		log.Trace().Msgf("%s not defined for %s", hostsParam, p.name)
+	}
+	for i, host := range hosts {
+		hosts[i] = normalizeLookupURL(host)
+	}
+
+	endpointSchemas := make(map[string]string)
+	if err := utils.ExtractMapOfStringParam(p.metaData.Parameters,
+		endpointSchemasParam,
+		endpointSchemas); err != nil {
+		log.Trace().Msgf("%s not defined for %s", endpointSchemasParam, p.name)
+	}
+
+	if specFile == "" && len(endpointSchemas) == 0 {
+		return fmt.Errorf("either %s or %s must be defined for %s",
+			specFileParam, endpointSchemasParam, p.name)
+	}
+
+	if specFile != "" {
+		if err := p.registry.loadOpenAPISpec(specFile, hosts); err != nil {
+			return err
+		}
+	}
+	for endpointKey, schemaFile := range endpointSchemas {
+		if err := p.registry.loadEndpointSchema(endpointKey, schemaFile); err != nil {
+			return err
+		}
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		validateRequestsParam,
+		&p.validateRequests); err != nil {
+		log.Trace().Msgf("%s not defined for %s", validateRequestsParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		validateResponsesParam,
+		&p.validateResponses); err != nil {
+		log.Trace().Msgf("%s not defined for %s", validateResponsesParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		rejectUnknownParam,
+		&p.rejectUnknownEndpoints); err != nil {
+		log.Trace().Msgf("%s not defined for %s", rejectUnknownParam, p.name)
+	}
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		rejectUnknownQueryParam,
+		&p.rejectUnknownQueryParams); err != nil {
+		log.Trace().Msgf("%s not defined for %s", rejectUnknownQueryParam, p.name)
+	}
+	if err := utils.ExtractIntParam(p.metaData.Parameters,
+		maxReportedViolationsArg,
+		&p.maxReportedViolations); err != nil || p.maxReportedViolations <= 0 {
+		p.maxReportedViolations = defaultMaxReportedViolations
+	}
+
+	return nil
+}
+
+func (p *validateSchemaProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(invalidCountMetric,
+		metric.WithDescription(fmt.Sprintf("Schema validation failures count for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize invalid count metric: %w", err)
+	}
+	p.metricObject = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *validateSchemaProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes, recorded := p.labelManager.LimitCardinality(invalidCountMetric, attributes)
+	if !recorded {
+		return
+	}
+	p.metricObject.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+
+	log.Trace().Msgf("Metrics updated for %s", p.name)
+}
+
+func validateBody(
+	validator *schemaValidator,
+	schema map[string]any,
+	required bool,
+	contentType, body string,
+) []Violation {
+	if strings.TrimSpace(body) == "" {
+		if required {
+			return []Violation{{Location: locationBody, Message: "body is required"}}
+		}
+		return nil
+	}
+	if schema == nil {
+		return nil
+	}
+	if contentType != "" && !isJSONContentType(contentType) {
+		return []Violation{{
+			Location: locationBody,
+			Message:  fmt.Sprintf("expected JSON content, got %s", contentType),
+		}}
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return []Violation{{Location: locationBody, Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	return validator.Validate(schema, value, locationBody, "")
+}
+
+// responseSchema finds the schema for the status code: exact, range (e.g. 4XX) and then default
+func responseSchema(responses map[string]map[string]any, status int) (map[string]any, bool) {
+	statusKey := strconv.Itoa(status)
+	if schema, found := responses[statusKey]; found {
+		return schema, true
+	}
+	if len(statusKey) == 3 {
+		if schema, found := responses[statusKey[:1]+"XX"]; found {
+			return schema, true
+		}
+	}
+	schema, found := responses[defaultResponseKey]
+	return schema, found
+}
+
+// coerceValue converts a raw parameter value into the type required by the schema.
+// Values which can't be converted are kept as strings, so the type check reports them.
+func coerceValue(schema map[string]any, raw string) any {
+	schemaType, _ := schema["type"].(string)
+	switch schemaType {
+	case "integer":
+		if value, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return float64(value)
+		}
+	case "number":
+		if value, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsNaN(value) {
+			return value
+		}
+	case "boolean":
+		if value, err := strconv.ParseBool(raw); err == nil {
+			return value
+		}
+	}
+	return raw
+}
+
+// normalizeLookupURL removes scheme and query, to match the URL tree format (host/path)
+func normalizeLookupURL(rawURL string) string {
+	if _, afterScheme, found := strings.Cut(rawURL, "://"); found {
+		rawURL = afterScheme
+	}
+	rawURL, _, _ = strings.Cut(rawURL, "?")
+	return strings.Trim(rawURL, "/")
+}
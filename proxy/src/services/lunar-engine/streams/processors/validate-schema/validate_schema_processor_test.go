@@ -0,0 +1,297 @@
+package validateschema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: Users API
+  version: "1.0"
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users:
+    get:
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+        - name: X-Tenant
+          in: header
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/User"
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/User"
+      responses:
+        "201":
+          description: created
+        4XX:
+          description: error
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [error]
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        schema:
+          type: integer
+    get:
+      responses:
+        default:
+          description: any
+components:
+  schemas:
+    User:
+      type: object
+      required: [name, email]
+      additionalProperties: false
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+          minLength: 1
+        email:
+          type: string
+          format: email
+        role:
+          type: string
+          enum: [admin, member]
+`
+
+func TestValidateSchemaValidRequest(t *testing.T) {
+	proc := createValidateSchemaProcessor(t, nil)
+
+	stream := test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"POST",
+		"https://api.example.com/v1/users",
+		map[string]string{"content-type": "application/json"},
+		map[string]string{},
+		`{"name":"Jane","email":"jane@example.com","role":"admin"}`,
+		"",
+		0,
+	)
+	procIO, err := proc.Execute("validate-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, validConditionName, procIO.Name)
+
+	stream = test_utils.NewMockAPIStream(
+		"https://api.example.com/v1/users?limit=10",
+		map[string]string{"x-tenant": "acme"},
+		map[string]string{},
+		"",
+		"",
+	)
+	procIO, err = proc.Execute("validate-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, validConditionName, procIO.Name)
+}
+
+func TestValidateSchemaInvalidRequest(t *testing.T) {
+	proc := createValidateSchemaProcessor(t, nil).(*validateSchemaProcessor)
+
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		headers  map[string]string
+		body     string
+		location string
+	}{
+		{"missing body", "POST", "https://api.example.com/v1/users", nil, "", locationBody},
+		{
+			"invalid body", "POST", "https://api.example.com/v1/users", nil,
+			`{"name":"","email":"not-an-email","role":"owner","extra":1}`, locationBody,
+		},
+		{"method not allowed", "DELETE", "https://api.example.com/v1/users", nil, "", locationMethod},
+		{
+			"query out of range", "GET", "https://api.example.com/v1/users?limit=500",
+			map[string]string{"x-tenant": "acme"}, "", locationQuery,
+		},
+		{"missing header", "GET", "https://api.example.com/v1/users", nil, "", locationHeader},
+		{"invalid path param", "GET", "https://api.example.com/v1/users/abc", nil, "", locationPath},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stream := test_utils.NewMockAPIStreamFull(
+				public_types.StreamTypeRequest,
+				testCase.method,
+				testCase.url,
+				testCase.headers,
+				map[string]string{},
+				testCase.body,
+				"",
+				0,
+			)
+			procIO, err := proc.Execute("validate-test", stream)
+			require.NoError(t, err)
+			require.Equal(t, invalidConditionName, procIO.Name)
+
+			violations := proc.validateRequest(stream.GetRequest())
+			require.NotEmpty(t, violations)
+			require.Equal(t, testCase.location, violations[0].Location)
+		})
+	}
+
+	violations := proc.validateRequest(test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"POST",
+		"https://api.example.com/v1/users",
+		map[string]string{},
+		map[string]string{},
+		`{"name":"","email":"not-an-email","role":"owner","extra":1}`,
+		"",
+		0,
+	).GetRequest())
+	require.Len(t, violations, 4)
+}
+
+func TestValidateSchemaResponse(t *testing.T) {
+	proc := createValidateSchemaProcessor(t, nil)
+
+	testCases := []struct {
+		method    string
+		url       string
+		status    int
+		body      string
+		condition string
+	}{
+		{"GET", "https://api.example.com/v1/users", 200, `[{"name":"a","email":"a@b.io"}]`, validConditionName},
+		{"GET", "https://api.example.com/v1/users", 200, `[{"name":"a"}]`, invalidConditionName},
+		{"GET", "https://api.example.com/v1/users", 500, `{}`, invalidConditionName},
+		{"POST", "https://api.example.com/v1/users", 422, `{"error":"bad"}`, validConditionName},
+		{"POST", "https://api.example.com/v1/users", 404, `{"message":"bad"}`, invalidConditionName},
+		{"GET", "https://api.example.com/v1/users/12", 503, `anything`, validConditionName},
+	}
+
+	for _, testCase := range testCases {
+		stream := test_utils.NewMockAPIStreamFull(
+			public_types.StreamTypeResponse,
+			testCase.method,
+			testCase.url,
+			map[string]string{},
+			map[string]string{"content-type": "application/json"},
+			"",
+			testCase.body,
+			testCase.status,
+		)
+		procIO, err := proc.Execute("validate-test", stream)
+		require.NoError(t, err)
+		require.Equal(t, testCase.condition, procIO.Name,
+			"%s %s %d", testCase.method, testCase.url, testCase.status)
+	}
+}
+
+func TestValidateSchemaUnknownEndpoint(t *testing.T) {
+	stream := test_utils.NewMockAPIStream(
+		"https://api.example.com/v1/orders",
+		map[string]string{},
+		map[string]string{},
+		"",
+		"",
+	)
+
+	proc := createValidateSchemaProcessor(t, nil)
+	procIO, err := proc.Execute("validate-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, validConditionName, procIO.Name)
+
+	proc = createValidateSchemaProcessor(t, map[string]any{rejectUnknownParam: true})
+	procIO, err = proc.Execute("validate-test", stream)
+	require.NoError(t, err)
+	require.Equal(t, invalidConditionName, procIO.Name)
+}
+
+func TestValidateSchemaEndpointSchema(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "order.json")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(
+		`{"type":"object","required":["amount"],"properties":{"amount":{"type":"number","exclusiveMinimum":0}}}`,
+	), 0o600))
+
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("ValidateSchema", map[string]any{
+		endpointSchemasParam: map[string]string{"POST shop.example.com/orders/{id}": schemaPath},
+	}))
+	require.NoError(t, err)
+
+	for body, condition := range map[string]string{
+		`{"amount":10.5}`: validConditionName,
+		`{"amount":0}`:    invalidConditionName,
+		`[1,2]`:           invalidConditionName,
+	} {
+		stream := test_utils.NewMockAPIStreamFull(
+			public_types.StreamTypeRequest,
+			"POST",
+			"https://shop.example.com/orders/42",
+			map[string]string{},
+			map[string]string{},
+			body,
+			"",
+			0,
+		)
+		procIO, err := proc.Execute("validate-test", stream)
+		require.NoError(t, err)
+		require.Equal(t, condition, procIO.Name, body)
+	}
+}
+
+func TestValidateSchemaInvalidConfig(t *testing.T) {
+	_, err := NewProcessor(test_utils.NewProcessorMetaData("ValidateSchema", map[string]any{}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("ValidateSchema", map[string]any{
+		specFileParam: "/does/not/exist.yaml",
+	}))
+	require.Error(t, err)
+
+	_, err = NewProcessor(test_utils.NewProcessorMetaData("ValidateSchema", map[string]any{
+		endpointSchemasParam: map[string]string{"shop.example.com/orders": "order.json"},
+	}))
+	require.Error(t, err)
+}
+
+func createValidateSchemaProcessor(t *testing.T, extraParams map[string]any) streamtypes.ProcessorI {
+	specPath := filepath.Join(t.TempDir(), "users.yaml")
+	require.NoError(t, os.WriteFile(specPath, []byte(testSpec), 0o600))
+
+	params := map[string]any{specFileParam: specPath}
+	for key, value := range extraParams {
+		params[key] = value
+	}
+
+	proc, err := NewProcessor(test_utils.NewProcessorMetaData("ValidateSchema", params))
+	require.NoError(t, err)
+	return proc
+}
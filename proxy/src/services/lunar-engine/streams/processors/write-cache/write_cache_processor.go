@@ -218,11 +218,16 @@ func (p *writeCacheProcessor) updateMetrics(
 	}
 
 	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
-	preparedAttributes := metric.WithAttributes(attributes...)
+	addMetricFunc := func(metricName string, value int64) {
+		attributes, recorded := p.labelManager.LimitCardinality(metricName, attributes)
+		if !recorded {
+			return
+		}
+		p.metricObjects[metricName].Add(context.Background(), value, metric.WithAttributes(attributes...))
+	}
 
-	ctx := context.Background()
-	p.metricObjects[cacheSizeMetric].Add(ctx, int64(cacheEntrySize), preparedAttributes)
-	p.metricObjects[cacheEntriesWrittenMetric].Add(ctx, 1, preparedAttributes)
+	addMetricFunc(cacheSizeMetric, int64(cacheEntrySize))
+	addMetricFunc(cacheEntriesWrittenMetric, 1)
 
 	log.Trace().Msgf("Metrics updated for %s", p.name)
 }
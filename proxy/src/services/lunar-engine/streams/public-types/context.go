@@ -7,6 +7,10 @@ import (
 	"golang.org/x/exp/constraints"
 )
 
+// SLOBurningContextKey is the flow context key telling whether an SLO flagging the flow
+// burns its error budget too fast
+const SLOBurningContextKey = "slo_burning"
+
 type ContextI interface {
 	Set(string, interface{}) error
 	Get(string) (interface{}, error)
@@ -50,6 +54,8 @@ type SharedStateI[T PersistentType] interface {
 	// This comment is relevant for both AtomicIncWindow and AtomicWindowResetIn
 	AtomicIncWindow(string, int64, time.Duration, int64) (int64, bool, error)
 	AtomicWindowResetIn(string, time.Duration) (time.Duration, bool, error)
+	// AtomicWindowCount returns the count of the current window without changing it
+	AtomicWindowCount(string, time.Duration) (int64, bool, error)
 	GetQuotaCounter(string) (int64, error)
 	Exists(string) bool
 }
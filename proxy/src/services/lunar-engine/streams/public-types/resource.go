@@ -16,6 +16,8 @@ type ResourceManagementI interface {
 
 type QuotaResourceI interface {
 	Allowed(APIStreamI) (bool, error)
+	// Available reports whether the request fits in the quota, without counting it
+	Available(APIStreamI) (bool, error)
 	Dec(APIStreamI) error
 	Inc(APIStreamI) error
 	ResetIn() time.Duration
@@ -183,6 +183,11 @@ func (v *ParamValue) GetFloat64() float64 {
 	return v.valueFloat64
 }
 
+// IsBool tells whether the value is a boolean, so unset optional parameters are told from false
+func (v *ParamValue) IsBool() bool {
+	return v != nil && v.valueType == ConfigurationParamBoolean
+}
+
 func (v *ParamValue) GetBool() bool {
 	if v.valueType != ConfigurationParamBoolean {
 		log.Debug().Str("type", string(v.valueType)).
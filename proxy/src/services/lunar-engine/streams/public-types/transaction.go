@@ -49,9 +49,12 @@ type APIStreamI interface {
 	GetRequest() TransactionI
 	GetResponse() TransactionI
 	GetContext() LunarContextI
+	// GetPathParams returns the path params matched by the URL of the flow filter
+	GetPathParams() map[string]string
 	SetRequest(TransactionI)
 	SetResponse(TransactionI)
 	SetContext(LunarContextI)
+	SetPathParams(map[string]string)
 	SetType(StreamType)
 	SetActionsType(StreamType)
 	JSONPathQuery(string) ([]any, error)
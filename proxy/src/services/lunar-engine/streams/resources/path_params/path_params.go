@@ -18,7 +18,8 @@ import (
 )
 
 const (
-	pathParamConfigEnvVar = "LUNAR_FLOWS_PATH_PARAM_CONFIG"
+	pathParamConfigEnvVar   = "LUNAR_FLOWS_PATH_PARAM_CONFIG"
+	pathParamConfigFileName = "policies.yaml"
 )
 
 type (
@@ -141,6 +142,11 @@ func (pp *PathParams) writePathParams() error {
 		})
 	}
 
+	// A validation run must not override the path params of the running configuration
+	if pp.validationPath != "" {
+		return createYAMLFile(policies, filepath.Join(pp.validationPath, pathParamConfigFileName))
+	}
+
 	policiesPath, err := GetPathParamConfigPath()
 	if err != nil {
 		return err
@@ -172,7 +178,7 @@ func GetPathParamConfigPath() (string, error) {
 		pathParamConfigEnvVar,
 		// Maybe we need to change the default value
 		// (using this one as this is what is used in the aggregation-output-plugin)
-		"./policies.yaml",
+		"./"+pathParamConfigFileName,
 	)
 	if pathErr != nil {
 		return "", pathErr
@@ -7,3 +7,21 @@ type PathParamsRaw struct {
 type PathParam struct {
 	URL string `yaml:"url" validate:"required"`
 }
+
+// PathParamSuggestion is a URL template proposed from the high cardinality segments of discovered URLs
+type PathParamSuggestion struct {
+	URL    string           `json:"url"`
+	Params []SuggestedParam `json:"params"`
+	// Cardinality is the number of distinct discovered URLs the template covers
+	Cardinality int      `json:"cardinality"`
+	Count       int      `json:"count"`
+	ExampleURLs []string `json:"example_urls"`
+}
+
+type SuggestedParam struct {
+	Name string `json:"name"`
+	// Kind is how the segment was recognized: uuid, numeric, hash, or converged
+	// when discovery already merged the segment values into an assumed path param
+	Kind        string `json:"kind"`
+	Cardinality int    `json:"cardinality"`
+}
@@ -0,0 +1,264 @@
+package pathparamsresource
+
+import (
+	"fmt"
+	"lunar/engine/utils/environment"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"lunar/toolkit-core/configuration"
+	"lunar/toolkit-core/urltree"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SuggestedPathParamsFileName is the path params resource accepted suggestions are written to
+	SuggestedPathParamsFileName = "suggested_path_params.yaml"
+
+	ParamKindUUID      = "uuid"
+	ParamKindNumeric   = "numeric"
+	ParamKindHash      = "hash"
+	ParamKindConverged = "converged"
+
+	// minSuggestionCardinality is the number of distinct URLs a template needs to be suggested,
+	// unless one of its segments can only be an identifier (e.g. a UUID)
+	minSuggestionCardinality = 2
+	maxExampleURLs           = 3
+	// minHashLength is the length from which hex or mixed alphanumeric segments are taken as hashes
+	minHashLength = 16
+)
+
+var (
+	uuidSegmentRegexp = regexp.MustCompile(
+		`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericSegmentRegexp = regexp.MustCompile(`^[0-9]+$`)
+	hexSegmentRegexp     = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	tokenSegmentRegexp   = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+	assumedParamRegexp   = regexp.MustCompile(`^_param_[0-9]+$`)
+)
+
+type suggestionCandidate struct {
+	segments     []string
+	kinds        map[int]string
+	values       map[int]map[string]struct{}
+	urls         map[string]struct{}
+	count        int
+	hasStrongKey bool
+}
+
+// SuggestPathParams proposes URL templates for the discovered URLs with identifier-like
+// segments (UUIDs, numeric IDs, hashes) and for the segments discovery already converged.
+// URLs matching the declared path params are left out.
+func SuggestPathParams(
+	output sharedDiscovery.Output,
+	declared []*PathParam,
+) []PathParamSuggestion {
+	declaredTree := urltree.NewURLTree[EmptyStruct](false, 0)
+	for _, pathParam := range declared {
+		if err := declaredTree.Insert(pathParam.URL, &EmptyStruct{}); err != nil {
+			log.Debug().Err(err).Msgf("Skipping declared path param %s", pathParam.URL)
+		}
+	}
+
+	candidates := map[string]*suggestionCandidate{}
+	for key, endpoint := range output.Endpoints {
+		_, url, found := strings.Cut(key, sharedDiscovery.EndpointDelimiter)
+		if !found || url == "" {
+			continue
+		}
+		if lookup := declaredTree.Lookup(url); lookup.Match && len(lookup.PathParams) > 0 {
+			continue
+		}
+
+		segments := strings.Split(url, "/")
+		kinds := map[int]string{}
+		for index, segment := range segments[1:] {
+			if kind := classifySegment(segment); kind != "" {
+				kinds[index+1] = kind
+			}
+		}
+		if len(kinds) == 0 {
+			continue
+		}
+
+		templateKey := templateKeyOf(segments, kinds)
+		candidate, found := candidates[templateKey]
+		if !found {
+			candidate = &suggestionCandidate{
+				segments: segments,
+				kinds:    kinds,
+				values:   map[int]map[string]struct{}{},
+				urls:     map[string]struct{}{},
+			}
+			candidates[templateKey] = candidate
+		}
+		candidate.urls[url] = struct{}{}
+		candidate.count += endpoint.Count
+		for index, kind := range kinds {
+			if candidate.values[index] == nil {
+				candidate.values[index] = map[string]struct{}{}
+			}
+			candidate.values[index][segments[index]] = struct{}{}
+			if kind != ParamKindNumeric {
+				candidate.hasStrongKey = true
+			}
+		}
+	}
+
+	suggestions := []PathParamSuggestion{}
+	for _, candidate := range candidates {
+		if len(candidate.urls) < minSuggestionCardinality && !candidate.hasStrongKey {
+			continue
+		}
+		suggestions = append(suggestions, candidate.toSuggestion())
+	}
+	slices.SortFunc(suggestions, func(a, b PathParamSuggestion) int {
+		if a.Cardinality != b.Cardinality {
+			return b.Cardinality - a.Cardinality
+		}
+		return strings.Compare(a.URL, b.URL)
+	})
+	return suggestions
+}
+
+func (c *suggestionCandidate) toSuggestion() PathParamSuggestion {
+	segments := slices.Clone(c.segments)
+	params := []SuggestedParam{}
+	names := map[string]struct{}{}
+	for index := 1; index < len(segments); index++ {
+		kind, isParam := c.kinds[index]
+		if !isParam {
+			continue
+		}
+		name := paramName(c.segments[index-1], len(params)+1, names)
+		names[name] = struct{}{}
+		segments[index] = "{" + name + "}"
+		params = append(params, SuggestedParam{
+			Name:        name,
+			Kind:        kind,
+			Cardinality: len(c.values[index]),
+		})
+	}
+
+	examples := make([]string, 0, len(c.urls))
+	for url := range c.urls {
+		examples = append(examples, url)
+	}
+	slices.Sort(examples)
+
+	return PathParamSuggestion{
+		URL:         strings.Join(segments, "/"),
+		Params:      params,
+		Cardinality: len(c.urls),
+		Count:       c.count,
+		ExampleURLs: examples[:min(len(examples), maxExampleURLs)],
+	}
+}
+
+func classifySegment(segment string) string {
+	if name, isParam := urltree.TryExtractPathParameter(segment); isParam {
+		if assumedParamRegexp.MatchString(name) {
+			return ParamKindConverged
+		}
+		// params declared in discovery are not suggested again
+		return ""
+	}
+	switch {
+	case uuidSegmentRegexp.MatchString(segment):
+		return ParamKindUUID
+	case numericSegmentRegexp.MatchString(segment):
+		return ParamKindNumeric
+	case len(segment) >= minHashLength && hexSegmentRegexp.MatchString(segment):
+		return ParamKindHash
+	case len(segment) >= minHashLength && tokenSegmentRegexp.MatchString(segment) &&
+		strings.ContainsFunc(segment, unicode.IsDigit) &&
+		strings.ContainsFunc(segment, unicode.IsLetter):
+		return ParamKindHash
+	}
+	return ""
+}
+
+func templateKeyOf(segments []string, kinds map[int]string) string {
+	template := slices.Clone(segments)
+	for index := range kinds {
+		template[index] = "{}"
+	}
+	return strings.Join(template, "/")
+}
+
+// paramName names a param after the segment preceding it, e.g. users/{user_id}
+func paramName(previousSegment string, position int, taken map[string]struct{}) string {
+	name := "param_" + strconv.Itoa(position)
+	if classifySegment(previousSegment) == "" && tokenSegmentRegexp.MatchString(previousSegment) {
+		resource := strings.ToLower(strings.ReplaceAll(previousSegment, "-", "_"))
+		switch {
+		case strings.HasSuffix(resource, "ies"):
+			resource = strings.TrimSuffix(resource, "ies") + "y"
+		case strings.HasSuffix(resource, "s") && !strings.HasSuffix(resource, "ss"):
+			resource = strings.TrimSuffix(resource, "s")
+		}
+		name = resource + "_id"
+	}
+	if _, found := taken[name]; found {
+		name = name + "_" + strconv.Itoa(position)
+	}
+	return name
+}
+
+// AcceptPathParams adds the URL templates to the suggested path params resource.
+// The templates are validated against all the path params resources before it is written.
+func AcceptPathParams(urls []string) ([]string, error) {
+	dir := environment.GetPathParamsDirectory()
+	if dir == "" {
+		return nil, fmt.Errorf("%s is not set", environment.PathParamsDirectoryEnvVar)
+	}
+
+	pathParams := newPathParams()
+	if err := pathParams.loadAndParsePathParamsFiles(); err != nil {
+		return nil, err
+	}
+	accepted := []string{}
+	for _, url := range urls {
+		if slices.ContainsFunc(pathParams.GetPathParams(), func(pathParam *PathParam) bool {
+			return pathParam.URL == url
+		}) {
+			continue
+		}
+		if err := pathParams.SetPathParams(url); err != nil {
+			return nil, fmt.Errorf("cannot accept %s: %w", url, err)
+		}
+		accepted = append(accepted, url)
+	}
+	if len(accepted) == 0 {
+		return accepted, nil
+	}
+
+	location := filepath.Join(dir, SuggestedPathParamsFileName)
+	suggested := &PathParamsRaw{}
+	if _, err := os.Stat(location); err == nil {
+		config, readErr := configuration.DecodeYAML[PathParamsRaw](location)
+		if readErr != nil {
+			return nil, readErr
+		}
+		if config.UnmarshaledData != nil {
+			suggested = config.UnmarshaledData
+		}
+	}
+	for _, url := range accepted {
+		suggested.PathParams = append(suggested.PathParams, &PathParam{URL: url})
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := createYAMLFile(suggested, location); err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
@@ -0,0 +1,125 @@
+package pathparamsresource_test
+
+import (
+	"lunar/engine/utils/environment"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pathparamsresource "lunar/engine/streams/resources/path_params"
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/stretchr/testify/require"
+)
+
+func discoveryOutput(urls ...string) sharedDiscovery.Output {
+	output := sharedDiscovery.Output{Endpoints: map[string]sharedDiscovery.EndpointOutput{}}
+	for _, url := range urls {
+		output.Endpoints["GET"+sharedDiscovery.EndpointDelimiter+url] = sharedDiscovery.EndpointOutput{
+			Count: 2,
+		}
+	}
+	return output
+}
+
+func TestSuggestPathParams(t *testing.T) {
+	output := discoveryOutput(
+		"api.example.com/users/1/orders/10",
+		"api.example.com/users/2/orders/11",
+		"api.example.com/users/2/orders/12",
+		"api.example.com/sessions/3f2b8c1e-4b7a-4c1d-9a8e-2f6d5c4b3a21",
+		"api.example.com/blobs/d41d8cd98f00b204e9800998ecf8427e",
+		"api.example.com/categories/{_param_1}",
+		"api.example.com/v1/2024",
+		"api.example.com/health",
+	)
+
+	suggestions := pathparamsresource.SuggestPathParams(output, nil)
+	require.Equal(t, []pathparamsresource.PathParamSuggestion{
+		{
+			URL: "api.example.com/users/{user_id}/orders/{order_id}",
+			Params: []pathparamsresource.SuggestedParam{
+				{Name: "user_id", Kind: pathparamsresource.ParamKindNumeric, Cardinality: 2},
+				{Name: "order_id", Kind: pathparamsresource.ParamKindNumeric, Cardinality: 3},
+			},
+			Cardinality: 3,
+			Count:       6,
+			ExampleURLs: []string{
+				"api.example.com/users/1/orders/10",
+				"api.example.com/users/2/orders/11",
+				"api.example.com/users/2/orders/12",
+			},
+		},
+		{
+			URL: "api.example.com/blobs/{blob_id}",
+			Params: []pathparamsresource.SuggestedParam{
+				{Name: "blob_id", Kind: pathparamsresource.ParamKindHash, Cardinality: 1},
+			},
+			Cardinality: 1,
+			Count:       2,
+			ExampleURLs: []string{"api.example.com/blobs/d41d8cd98f00b204e9800998ecf8427e"},
+		},
+		{
+			URL: "api.example.com/categories/{category_id}",
+			Params: []pathparamsresource.SuggestedParam{
+				{Name: "category_id", Kind: pathparamsresource.ParamKindConverged, Cardinality: 1},
+			},
+			Cardinality: 1,
+			Count:       2,
+			ExampleURLs: []string{"api.example.com/categories/{_param_1}"},
+		},
+		{
+			URL: "api.example.com/sessions/{session_id}",
+			Params: []pathparamsresource.SuggestedParam{
+				{Name: "session_id", Kind: pathparamsresource.ParamKindUUID, Cardinality: 1},
+			},
+			Cardinality: 1,
+			Count:       2,
+			ExampleURLs: []string{"api.example.com/sessions/3f2b8c1e-4b7a-4c1d-9a8e-2f6d5c4b3a21"},
+		},
+	}, suggestions)
+}
+
+func TestSuggestPathParamsSkipsDeclared(t *testing.T) {
+	output := discoveryOutput("api.example.com/users/1", "api.example.com/users/2")
+	suggestions := pathparamsresource.SuggestPathParams(output, []*pathparamsresource.PathParam{
+		{URL: "api.example.com/users/{id}"},
+	})
+	require.Empty(t, suggestions)
+}
+
+func TestAcceptPathParams(t *testing.T) {
+	tempDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tempDir, "params.yaml"), []byte(`
+path_params:
+    - url: "api.example.com/items/{item_id}"
+`), 0o644)
+	require.NoError(t, err)
+
+	os.Setenv(environment.PathParamsDirectoryEnvVar, tempDir)
+	defer os.Unsetenv(environment.PathParamsDirectoryEnvVar)
+
+	accepted, err := pathparamsresource.AcceptPathParams([]string{"api.example.com/users/{user_id}"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.example.com/users/{user_id}"}, accepted)
+
+	accepted, err = pathparamsresource.AcceptPathParams([]string{
+		"api.example.com/users/{user_id}",
+		"api.example.com/orders/{order_id}",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.example.com/orders/{order_id}"}, accepted)
+
+	_, err = pathparamsresource.AcceptPathParams([]string{"api.example.com/items/{id}"})
+	require.Error(t, err)
+
+	urls := []string{}
+	for _, pathParam := range pathparamsresource.NewPathParams().GetPathParams() {
+		urls = append(urls, pathParam.URL)
+	}
+	require.ElementsMatch(t, []string{
+		"api.example.com/items/{item_id}",
+		"api.example.com/users/{user_id}",
+		"api.example.com/orders/{order_id}",
+	}, urls)
+}
@@ -138,6 +138,24 @@ func (cs *concurrentStrategy) Allowed(APIStream public_types.APIStreamI) (bool,
 	return true, nil
 }
 
+func (cs *concurrentStrategy) Available(APIStream public_types.APIStreamI) (bool, error) {
+	reqID := APIStream.GetID()
+	switch {
+	case cs.checkReqStatus(reqID, reqAllowed):
+	case cs.checkReqStatus(reqID, reqNotFound):
+		if cs.getCountFromContext(cs.concurrentSetKey) >= cs.maxRequestCount {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+
+	if cs.parent != nil {
+		return cs.parent.GetQuota().Available(APIStream)
+	}
+	return true, nil
+}
+
 func (cs *concurrentStrategy) Dec(APIStream public_types.APIStreamI) error {
 	reqID := APIStream.GetID()
 	cs.mutex.Lock()
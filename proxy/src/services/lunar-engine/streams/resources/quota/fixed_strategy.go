@@ -187,6 +187,31 @@ func (q *quota) Allowed(APIStream publicTypes.APIStreamI) bool {
 	return value
 }
 
+// available tells whether the request fits in the window, without counting it
+func (q *quota) available(APIStream publicTypes.APIStreamI) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if allowed, found := q.allowedByReqID[APIStream.GetID()]; found {
+		return allowed
+	}
+	if q.withSpillover && q.getCountFromContext(q.spilloverCountKey) > 0 {
+		return true
+	}
+
+	incrBy, err := q.extractCountF(APIStream)
+	if err != nil {
+		q.logger.Trace().Err(err).Msg("Failed to extract count")
+		incrBy = 0
+	}
+	currentCount, _, err := q.context.AtomicWindowCount(q.currentCountKey, q.window)
+	if err != nil {
+		q.logger.Trace().Err(err).Msg("Failed to get window count")
+		return false
+	}
+	return currentCount+incrBy <= q.maxCount
+}
+
 func (q *quota) getCountFromContext(counterKey string) int64 {
 	// We don't need to lock here as we are already in a mutex lock
 	// (keep it in mind for future reference)
@@ -382,6 +407,22 @@ func (fw *fixedWindow) Allowed(APIStream publicTypes.APIStreamI) (bool, error) {
 	return false, nil
 }
 
+func (fw *fixedWindow) Available(APIStream publicTypes.APIStreamI) (bool, error) {
+	fw.windowAligning()
+	quotaObj, err := fw.getQuota(APIStream)
+	if err != nil {
+		return false, err
+	}
+
+	if !quotaObj.available(APIStream) {
+		return false, nil
+	}
+	if fw.parent != nil {
+		return fw.parent.GetQuota().Available(APIStream)
+	}
+	return true, nil
+}
+
 func (fw *fixedWindow) Dec(APIStream publicTypes.APIStreamI) error {
 	fw.windowAligning()
 	quotaObj, err := fw.getQuota(APIStream)
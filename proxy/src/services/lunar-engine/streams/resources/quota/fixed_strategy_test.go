@@ -99,6 +99,49 @@ func TestFixedWindowsMonthlyRenewal(t *testing.T) {
 	assert.False(t, allowed)
 }
 
+func TestFixedWindowAvailableDoesNotCountRequest(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	defer context_manager.Get().SetRealClock()
+
+	fixedWindow, err := NewFixedStrategy(&QuotaConfig{
+		ID: "available-test",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{Max: 1, Interval: 1, IntervalUnit: "minute"},
+			},
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	APIStreamA := streamtypes.NewRequestAPIStream(
+		lunar_messages.OnRequest{ID: "available-a"}, sharedState)
+	APIStreamB := streamtypes.NewRequestAPIStream(
+		lunar_messages.OnRequest{ID: "available-b"}, sharedState)
+
+	// checking the quota leaves room for the request that uses it
+	for range 3 {
+		available, err := fixedWindow.Available(APIStreamB)
+		assert.Nil(t, err)
+		assert.True(t, available)
+	}
+
+	assert.Nil(t, fixedWindow.Inc(APIStreamA))
+	allowed, err := fixedWindow.Allowed(APIStreamA)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	available, err := fixedWindow.Available(APIStreamB)
+	assert.Nil(t, err)
+	assert.False(t, available)
+
+	mockClock.AdvanceTime(2 * time.Minute)
+	setMemoryTime(mockClock.Now())
+
+	available, err = fixedWindow.Available(APIStreamB)
+	assert.Nil(t, err)
+	assert.True(t, available)
+}
+
 func TestFixedWindowCustomCounterHandlesQuotaByHeaderValue(t *testing.T) {
 	var allowed bool
 	var err error
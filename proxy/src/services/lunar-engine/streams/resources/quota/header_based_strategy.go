@@ -51,6 +51,10 @@ func (hs *headerBasedStrategy) Allowed(_ publictypes.APIStreamI) (bool, error) {
 	return true, nil
 }
 
+func (hs *headerBasedStrategy) Available(_ publictypes.APIStreamI) (bool, error) {
+	return true, nil
+}
+
 func (hs *headerBasedStrategy) Dec(_ publictypes.APIStreamI) error {
 	return nil
 }
@@ -1,13 +1,18 @@
 package stream
 
 import (
+	"context"
 	"fmt"
 	streamconfig "lunar/engine/streams/config"
+	decisionlog "lunar/engine/streams/decision-log"
 	internaltypes "lunar/engine/streams/internal-types"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/otel"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type (
@@ -24,6 +29,7 @@ type ShortCircuitData struct {
 
 type Stream struct {
 	getMeasureProcExecFunc func(string) MeasureExecutorFunc
+	decisions              *decisionlog.Transaction
 	Request                *streamconfig.RequestStream
 	Response               *streamconfig.ResponseStream
 }
@@ -40,6 +46,12 @@ func (s *Stream) WithProcExecutionMeasurement(fnMeasure func(string) MeasureExec
 	return s
 }
 
+// WithDecisions records the processor executions in the decision log transaction
+func (s *Stream) WithDecisions(transaction *decisionlog.Transaction) *Stream {
+	s.decisions = transaction
+	return s
+}
+
 func (s *Stream) GetRequestStream() *streamconfig.RequestStream {
 	return s.Request
 }
@@ -48,7 +60,10 @@ func (s *Stream) GetResponseStream() *streamconfig.ResponseStream {
 	return s.Response
 }
 
+// ExecuteFlow walks the flow from the given node.
+// Every processor execution is traced in a span, child of the flow span carried by ctx.
 func (s *Stream) ExecuteFlow(
+	ctx context.Context,
 	flow internaltypes.FlowI,
 	apiStream publictypes.APIStreamI,
 	node internaltypes.FlowGraphNodeI,
@@ -60,12 +75,30 @@ func (s *Stream) ExecuteFlow(
 	var err error
 	var shortCircuitData *ShortCircuitData // internaltypes.FlowGraphNodeI
 	var procIO streamtypes.ProcessorIO
+	_, span := otel.Tracer(ctx, "processor#"+node.GetProcessorKey())
 	if s.getMeasureProcExecFunc != nil {
 		measureFunc := s.getMeasureProcExecFunc(node.GetProcessorKey())
 		procIO, err = measureFunc(flow.GetName(), apiStream, closureFunc)
 	} else {
 		procIO, err = closureFunc()
 	}
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("lunar.flow.name", flow.GetName()),
+			attribute.String("lunar.processor.key", node.GetProcessorKey()),
+			attribute.String("lunar.processor.name", node.GetProcessor().GetName()),
+			attribute.String("lunar.processor.condition", procIO.Name),
+		)
+		span.SetAttributes(procIO.TraceAttributes...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if procIO.Failure {
+			span.SetStatus(codes.Error, "processor failure")
+		}
+	}
+	span.End()
+	s.decisions.AddStep(flow.GetName(), apiStream, node.GetProcessorKey(), procIO, err)
 	if err != nil {
 		return shortCircuitData,
 			fmt.Errorf("failed to execute processor %s: %w", node.GetProcessorKey(), err)
@@ -128,7 +161,7 @@ func (s *Stream) ExecuteFlow(
 		// meaning there is no condition defined (procIO.Name is empty).
 		if edge.GetCondition() == procIO.Name {
 			targetNode := edge.GetTargetNode()
-			if shortCircuitData, err = s.ExecuteFlow(flow, apiStream, targetNode, actions); err != nil {
+			if shortCircuitData, err = s.ExecuteFlow(ctx, flow, apiStream, targetNode, actions); err != nil {
 				return shortCircuitData, fmt.Errorf("failed to execute flow: %w", err)
 			}
 		}
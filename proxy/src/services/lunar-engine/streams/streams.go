@@ -1,11 +1,13 @@
 package streams
 
 import (
+	"context"
 	"fmt"
 	"lunar/engine/communication"
 	lunar_messages "lunar/engine/messages"
 	"lunar/engine/metrics"
 	streamconfig "lunar/engine/streams/config"
+	decisionlog "lunar/engine/streams/decision-log"
 	streamfilter "lunar/engine/streams/filter"
 	streamflow "lunar/engine/streams/flow"
 	internaltypes "lunar/engine/streams/internal-types"
@@ -19,8 +21,12 @@ import (
 	"lunar/engine/utils"
 	"lunar/engine/utils/environment"
 	"lunar/toolkit-core/network"
+	"lunar/toolkit-core/otel"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ metrics.FlowMetricsProviderI = &Stream{}
@@ -42,6 +48,9 @@ type Stream struct {
 	loadedConfig      network.ConfigurationData
 	lunarHub          *communication.HubCommunication
 	metricsData       *metrics_data.FlowMetricsData
+	decisionLog       *decisionlog.DecisionLog
+	flowURLs          map[string][]string
+	isFlowBurningSLO  func(string) bool
 
 	validationMode bool // if true - any error will stop initialization
 	validationPath string
@@ -73,6 +82,7 @@ func (s *Stream) OnError(transactionID string) {
 	onResponse.SequenceID = transactionID
 	apiStream := stream_types.NewResponseAPIStream(onResponse, lunar_context.NewMemoryState[[]byte]())
 	s.resources.OnRequestDrop(apiStream)
+	s.decisionLog.Abort(transactionID)
 }
 
 func (s *Stream) GetLoadedConfig() network.ConfigurationData {
@@ -99,24 +109,41 @@ func (s *Stream) GetProcessorExecutionData() *metrics.MetricData {
 	return s.metricsData.GetProcessorExecutionData()
 }
 
+// WithDecisionLog records the decisions taken on every transaction in the decision log
+func (s *Stream) WithDecisionLog(decisionLog *decisionlog.DecisionLog) *Stream {
+	s.decisionLog = decisionLog
+	return s
+}
+
 func (s *Stream) WithHub(hub *communication.HubCommunication) *Stream {
 	s.lunarHub = hub
 	return s
 }
 
+// WithSLOStatus sets the flow context flag of the flows flagged by a burning SLO
+func (s *Stream) WithSLOStatus(isFlowBurningSLO func(string) bool) *Stream {
+	s.isFlowBurningSLO = isFlowBurningSLO
+	return s
+}
+
+// GetFlowURLs returns the filter URLs of every user flow
+func (s *Stream) GetFlowURLs() map[string][]string {
+	return s.flowURLs
+}
+
 // WithValidationMode sets the stream engine to validation mode.
 // In validation mode, any error will stop initialization.
 // Used for validation purposes.
 func (s *Stream) WithValidationMode() *Stream {
 	s.validationMode = true
+	s.processorsManager.WithValidationMode()
 	return s
 }
 
 // WithValidationPath sets the path to the validation file.
 func (s *Stream) WithValidationPath(validationPath string) *Stream {
-	s.validationMode = true
 	s.validationPath = validationPath
-	return s
+	return s.WithValidationMode()
 }
 
 // Initialize initializes the stream engine by creating flows from the stream config.
@@ -129,8 +156,10 @@ func (s *Stream) Initialize() error {
 	}
 
 	var userFlows []string
-	for key := range flowsDefinition {
+	s.flowURLs = make(map[string][]string, len(flowsDefinition))
+	for key, flow := range flowsDefinition {
 		userFlows = append(userFlows, key)
+		s.flowURLs[key] = flow.GetFilter().GetURLs()
 	}
 
 	err = s.attachSystemFlows(flowsDefinition)
@@ -229,6 +258,7 @@ func (s *Stream) InitializeHubCommunication() {
 }
 
 func (s *Stream) ExecuteFlow(
+	ctx context.Context,
 	apiStream publictypes.APIStreamI,
 	actions *streamconfig.StreamActions,
 ) error {
@@ -240,22 +270,56 @@ func (s *Stream) ExecuteFlow(
 		log.Debug().Msgf("No flow found for %v", apiStream.GetURL())
 		return nil
 	}
+	apiStream.SetPathParams(flowsToExecute.GetPathParams())
 
-	s.apiStreams = stream.NewStream().
-		WithProcExecutionMeasurement(s.metricsData.GetProcMeasureExecFunc)
+	decisions := s.decisionLog.Begin(apiStream)
+	if userFlows, found := flowsToExecute.GetUserFlow(); found {
+		for _, userFlow := range userFlows {
+			decisions.MatchFlows(userFlow.GetName())
+		}
+	}
 
+	// the decisions belong to this call, so every call walks the flows with its own stream
+	flowStream := stream.NewStream().
+		WithProcExecutionMeasurement(s.metricsData.GetProcMeasureExecFunc).
+		WithDecisions(decisions)
+
+	ctx = traceContext(ctx, apiStream)
 	var err error
 	if apiStream.GetType().IsRequestType() {
 		s.metricsData.IncrementRequestsThroughFlows(apiStream)
-		err = s.executeReq(flowsToExecute, apiStream, actions)
+		err = s.executeReq(ctx, flowStream, flowsToExecute, apiStream, actions)
 
 	} else if apiStream.GetType().IsResponseType() {
-		err = s.executeRes(flowsToExecute, apiStream, actions, nil)
+		err = s.executeRes(ctx, flowStream, flowsToExecute, apiStream, actions, nil)
 	}
 
+	s.decisionLog.Finish(decisions, apiStream, actions)
 	return err
 }
 
+// traceContext returns the context the flow spans start from.
+// The flow spans are children of the span carried by ctx, which is linked to the incoming
+// traceparent. Without a parent span, they continue the incoming trace or start a new one.
+func traceContext(ctx context.Context, apiStream publictypes.APIStreamI) context.Context {
+	var incoming trace.SpanContext
+	if request := apiStream.GetRequest(); !utils.IsInterfaceNil(request) {
+		incoming = trace.SpanContextFromContext(otel.ExtractTraceContext(ctx, request.GetHeaders()))
+	}
+
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		if incoming.IsValid() {
+			return trace.ContextWithRemoteSpanContext(ctx, incoming)
+		}
+		return ctx
+	}
+	if incoming.IsValid() && incoming.TraceID() != parent.SpanContext().TraceID() {
+		parent.AddLink(trace.Link{SpanContext: incoming})
+	}
+	return ctx
+}
+
 // getFlows gets the flows from the flows directory.
 // It can be either the directory defined by ENV var or the validation directory.
 func (s *Stream) getFlows() (map[string]internaltypes.FlowRepI, error) {
@@ -283,6 +347,8 @@ func (s *Stream) getFlows() (map[string]internaltypes.FlowRepI, error) {
 }
 
 func (s *Stream) executeReq(
+	ctx context.Context,
+	flowStream *stream.Stream,
 	flowsToExecute internaltypes.FilterTreeResultI,
 	apiStream publictypes.APIStreamI,
 	actions *streamconfig.StreamActions,
@@ -298,7 +364,7 @@ func (s *Stream) executeReq(
 
 			log.Trace().Msgf("Executing system start request flow %v", systemFlow.GetName())
 			defer systemFlow.CleanExecution()
-			_, err = s.executeFlow(systemFlow, apiStream, actions, nil)
+			_, err = s.executeFlow(ctx, flowStream, systemFlow, apiStream, actions, nil)
 			if err != nil {
 				return fmt.Errorf("failed to execute system flow: %w", err)
 			}
@@ -312,7 +378,7 @@ func (s *Stream) executeReq(
 			log.Debug().Msgf("Executing request flow %v", userFlow.GetName())
 			defer userFlow.CleanExecution()
 			var shortCircuitData *stream.ShortCircuitData
-			shortCircuitData, err = s.executeFlow(userFlow, apiStream, actions, nil)
+			shortCircuitData, err = s.executeFlow(ctx, flowStream, userFlow, apiStream, actions, nil)
 			if err != nil {
 				return fmt.Errorf("failed to execute flow: %w", err)
 			}
@@ -335,7 +401,7 @@ func (s *Stream) executeReq(
 		for _, systemFlow := range systemFlowEnd {
 			log.Trace().Msgf("Executing system end request flow %v", systemFlow.GetName())
 			defer systemFlow.CleanExecution()
-			_, err = s.executeFlow(systemFlow, apiStream, actions, nil)
+			_, err = s.executeFlow(ctx, flowStream, systemFlow, apiStream, actions, nil)
 			if err != nil {
 				return fmt.Errorf("failed to execute system flow: %w", err)
 			}
@@ -350,12 +416,14 @@ func (s *Stream) executeReq(
 			log.Trace().Msgf("No flow found for %v", apiStream.GetURL())
 			return nil
 		}
-		return s.executeRes(flowsToExecute, apiStream, actions, ShortCircuit)
+		return s.executeRes(ctx, flowStream, flowsToExecute, apiStream, actions, ShortCircuit)
 	}
 	return nil
 }
 
 func (s *Stream) executeRes(
+	ctx context.Context,
+	flowStream *stream.Stream,
 	flowsToExecute internaltypes.FilterTreeResultI,
 	apiStream publictypes.APIStreamI,
 	actions *streamconfig.StreamActions,
@@ -369,7 +437,7 @@ func (s *Stream) executeRes(
 			systemFlow := systemFlows[flowIndex]
 			log.Trace().Msgf("Executing system start response flow %v", systemFlow.GetName())
 			defer systemFlow.CleanExecution()
-			_, err = s.executeFlow(systemFlow, apiStream, actions, nil)
+			_, err = s.executeFlow(ctx, flowStream, systemFlow, apiStream, actions, nil)
 			if err != nil {
 				return fmt.Errorf("failed to execute system flow: %w", err)
 			}
@@ -382,9 +450,9 @@ func (s *Stream) executeRes(
 			log.Debug().Msgf("Executing userFlow response flow %v", userFlow.GetName())
 			defer userFlow.CleanExecution()
 			if shortCircuit != nil && shortCircuit.flow.GetName() == userFlow.GetName() {
-				_, err = s.executeFlow(userFlow, apiStream, actions, shortCircuit.node)
+				_, err = s.executeFlow(ctx, flowStream, userFlow, apiStream, actions, shortCircuit.node)
 			} else {
-				_, err = s.executeFlow(userFlow, apiStream, actions, nil)
+				_, err = s.executeFlow(ctx, flowStream, userFlow, apiStream, actions, nil)
 			}
 			if err != nil {
 				return fmt.Errorf("failed to execute user flow: %w", err)
@@ -398,7 +466,7 @@ func (s *Stream) executeRes(
 			systemFlow := systemFlows[flowIndex]
 			log.Trace().Msgf("Executing system end response flow %v", systemFlow.GetName())
 			defer systemFlow.CleanExecution()
-			_, err = s.executeFlow(systemFlow, apiStream, actions, nil)
+			_, err = s.executeFlow(ctx, flowStream, systemFlow, apiStream, actions, nil)
 			if err != nil {
 				return fmt.Errorf("failed to execute system flow: %w", err)
 			}
@@ -410,6 +478,8 @@ func (s *Stream) executeRes(
 }
 
 func (s *Stream) executeFlow(
+	ctx context.Context,
+	flowStream *stream.Stream,
 	flow internaltypes.FlowI,
 	apiStream publictypes.APIStreamI,
 	actions *streamconfig.StreamActions,
@@ -423,6 +493,7 @@ func (s *Stream) executeFlow(
 	}
 
 	apiStream.SetContext(flow.GetExecutionContext())
+	s.setSLOBurning(flow.GetName(), apiStream)
 
 	log.Trace().Msgf("Flow %v found for %v", flow.GetName(), apiStream.GetURL())
 	flowDirection := flow.GetDirection(apiStream.GetType())
@@ -455,13 +526,36 @@ func (s *Stream) executeFlow(
 		}
 	}
 
+	// the flow name is set on start, it selects the sampling ratio of the flow
+	ctx, span := otel.Tracer(ctx, "flow#"+flow.GetName(),
+		trace.WithAttributes(otel.FlowNameAttribute.String(flow.GetName())))
+	defer span.End()
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("lunar.flow.direction", apiStream.GetType().String()),
+			attribute.String("lunar.stream.id", apiStream.GetID()),
+		)
+		if response := apiStream.GetResponse(); apiStream.GetType().IsResponseType() &&
+			!utils.IsInterfaceNil(response) {
+			span.SetAttributes(attribute.Int(stream_types.TraceAttributeResponseStatus, response.GetStatus()))
+			if response.GetStatus() >= 500 {
+				span.SetStatus(codes.Error, "upstream error")
+			}
+		}
+	}
+
 	var err error
 	closureFunc := func() error {
-		shortCircuitData, err = s.apiStreams.ExecuteFlow(flow, apiStream, node, actions)
+		shortCircuitData, err = flowStream.ExecuteFlow(ctx, flow, apiStream, node, actions)
 		return err
 	}
 
-	return shortCircuitData, s.metricsData.MeasureFlowExecutionTime(flow.GetName(), closureFunc)
+	err = s.metricsData.MeasureFlowExecutionTime(flow.GetName(), closureFunc)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return shortCircuitData, err
 }
 
 func (s *Stream) GetAPIStreams() *stream.Stream {
@@ -635,6 +729,19 @@ func (s *Stream) attachSystemFlows(
 	return nil
 }
 
+func (s *Stream) setSLOBurning(flowName string, apiStream publictypes.APIStreamI) {
+	if s.isFlowBurningSLO == nil || utils.IsInterfaceNil(apiStream.GetContext()) {
+		return
+	}
+	flowContext := apiStream.GetContext().GetFlowContext()
+	if utils.IsInterfaceNil(flowContext) {
+		return
+	}
+	if err := flowContext.Set(publictypes.SLOBurningContextKey, s.isFlowBurningSLO(flowName)); err != nil {
+		log.Trace().Err(err).Msgf("Failed to set SLO status of flow %s", flowName)
+	}
+}
+
 func newStream(
 	resources *resources.ResourceManagement,
 	metricData *metrics_data.FlowMetricsData,
@@ -1,10 +1,13 @@
 package streams
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	lunar_messages "lunar/engine/messages"
 	stream_config "lunar/engine/streams/config"
+	decisionlog "lunar/engine/streams/decision-log"
 	test_processors "lunar/engine/streams/flow/test-processors"
 	internal_types "lunar/engine/streams/internal-types"
 	lunar_context "lunar/engine/streams/lunar-context"
@@ -15,12 +18,19 @@ import (
 	stream_types "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
 	context_manager "lunar/toolkit-core/context-manager"
+	lunar_otel "lunar/toolkit-core/otel"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var sharedState = lunar_context.NewMemoryState[[]byte]()
@@ -86,6 +96,305 @@ func TestRequestBodyFromResponseStream(t *testing.T) {
 	require.Equal(t, resBody, apiStreamRes.GetResponse().GetBody(), "Response body is not correct")
 }
 
+func TestExecuteFlowEmitsSpans(t *testing.T) {
+	stream, recorder := newTracedStream(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentSpanID = "00f067aa0ba902b7"
+	apiStream := newTracedAPIStream(traceID, parentSpanID)
+	err := stream.ExecuteFlow(context.Background(), apiStream, &stream_config.StreamActions{
+		Request:  &stream_config.RequestStream{},
+		Response: &stream_config.ResponseStream{},
+	})
+	require.NoError(t, err, "Failed to execute flow")
+
+	flowSpans := map[string]bool{}
+	processorSpans := 0
+	for _, span := range recorder.Ended() {
+		require.Equal(t, traceID, span.SpanContext().TraceID().String())
+		switch {
+		case strings.HasPrefix(span.Name(), "flow#"):
+			require.Equal(t, parentSpanID, span.Parent().SpanID().String())
+			flowSpans[span.SpanContext().SpanID().String()] = true
+		case strings.HasPrefix(span.Name(), "processor#"):
+			processorSpans++
+			keys := map[string]bool{}
+			for _, attr := range span.Attributes() {
+				keys[string(attr.Key)] = true
+			}
+			require.True(t, keys["lunar.processor.key"], "processor key attribute is missing")
+			require.True(t, keys["lunar.processor.condition"], "condition attribute is missing")
+		}
+	}
+	require.NotEmpty(t, flowSpans, "expected flow spans")
+	require.Positive(t, processorSpans, "expected processor spans")
+	for _, span := range recorder.Ended() {
+		if strings.HasPrefix(span.Name(), "processor#") {
+			require.True(t, flowSpans[span.Parent().SpanID().String()], "processor span is not a child of a flow span")
+		}
+	}
+}
+
+func TestExecuteFlowSpansAreChildrenOfTheCallerSpan(t *testing.T) {
+	stream, recorder := newTracedStream(t)
+
+	const incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const incomingSpanID = "00f067aa0ba902b7"
+	ctx, routingSpan := otel.Tracer("test").Start(context.Background(), "routing#lunarOnRequestMessage")
+	apiStream := newTracedAPIStream(incomingTraceID, incomingSpanID)
+	err := stream.ExecuteFlow(ctx, apiStream, &stream_config.StreamActions{
+		Request:  &stream_config.RequestStream{},
+		Response: &stream_config.ResponseStream{},
+	})
+	require.NoError(t, err, "Failed to execute flow")
+	routingSpan.End()
+
+	flowSpans := 0
+	for _, span := range recorder.Ended() {
+		switch {
+		case strings.HasPrefix(span.Name(), "flow#"):
+			flowSpans++
+			require.Equal(t, routingSpan.SpanContext().SpanID(), span.Parent().SpanID())
+		case span.Name() == "routing#lunarOnRequestMessage":
+			require.Len(t, span.Links(), 1)
+			require.Equal(t, incomingTraceID, span.Links()[0].SpanContext.TraceID().String())
+			require.Equal(t, incomingSpanID, span.Links()[0].SpanContext.SpanID().String())
+		}
+	}
+	require.Positive(t, flowSpans, "expected flow spans")
+}
+
+func TestExecuteFlowSamplesFlowSpansByFlowRatio(t *testing.T) {
+	sampleAll := 1.0
+	stream, recorder := newTracedStream(t, sdktrace.WithSampler(lunar_otel.NewSampler(
+		&lunar_otel.TraceConfig{
+			SampleRatio:      &sampleAll,
+			FlowSampleRatios: map[string]float64{"InfraTeam1": 0},
+		},
+	)))
+
+	ctx, routingSpan := otel.Tracer("test").Start(context.Background(), "routing#lunarOnRequestMessage")
+	apiStream := newTracedAPIStream("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	err := stream.ExecuteFlow(ctx, apiStream, &stream_config.StreamActions{
+		Request:  &stream_config.RequestStream{},
+		Response: &stream_config.ResponseStream{},
+	})
+	require.NoError(t, err, "Failed to execute flow")
+	routingSpan.End()
+
+	var spanNames []string
+	for _, span := range recorder.Ended() {
+		spanNames = append(spanNames, span.Name())
+	}
+	require.Contains(t, spanNames, "routing#lunarOnRequestMessage")
+	require.Contains(t, spanNames, "flow#GoogleMapsGeocodingCache")
+	require.NotContains(t, spanNames, "flow#InfraTeam1", "the flow ratio overrides the sampled parent")
+}
+
+// newTracedStream creates a stream of the 2-flows test case, recording the spans it emits
+func newTracedStream(
+	t *testing.T,
+	options ...sdktrace.TracerProviderOption,
+) (*Stream, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	options = append(options, sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(options...))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	procMng := createTestProcessorManager(
+		t,
+		[]string{
+			"removePII",
+			"readCache",
+			"checkLimit",
+			"generateResponse",
+			"globalStream",
+			"writeCache",
+			"LogAPM",
+			"readXXX",
+			"writeXXX",
+		},
+	)
+	stream, err := NewStream()
+	require.NoError(t, err, "Failed to create stream")
+	stream.processorsManager = procMng
+	flowReps := createFlowRepresentation(t, "2-flows-test*")
+
+	prevFlowsDir := setFlowRepDirectory(filepath.Join("flow", "test-cases", "2-flows-test-case"))
+	t.Cleanup(func() { revertFlowRepDirectory(prevFlowsDir) })
+
+	err = stream.Initialize()
+	require.NoError(t, err, "Failed to create flows")
+	err = stream.createFlows(flowReps)
+	require.NoError(t, err, "Failed to create flows")
+	return stream, recorder
+}
+
+func newTracedAPIStream(traceID, spanID string) public_types.APIStreamI {
+	apiStream := stream_types.NewAPIStream("APIStreamName", public_types.StreamTypeRequest, sharedState)
+	apiStream.SetRequest(stream_types.NewRequest(lunar_messages.OnRequest{
+		Method: "GET",
+		Scheme: "https",
+		URL:    "maps.googleapis.com/maps/api/geocode/json",
+		Headers: map[string]string{
+			"Traceparent": "00-" + traceID + "-" + spanID + "-01",
+		},
+	}))
+	return apiStream
+}
+
+func TestExecuteFlowRecordsDecisions(t *testing.T) {
+	procMng := createTestProcessorManager(
+		t,
+		[]string{
+			"removePII",
+			"readCache",
+			"checkLimit",
+			"generateResponse",
+			"globalStream",
+			"writeCache",
+			"LogAPM",
+			"readXXX",
+			"writeXXX",
+		},
+	)
+	stream, err := NewStream()
+	require.NoError(t, err, "Failed to create stream")
+	stream.processorsManager = procMng
+	decisionLog := decisionlog.New(decisionlog.Config{}, nil, context_manager.Get().GetClock())
+	stream.WithDecisionLog(decisionLog)
+	flowReps := createFlowRepresentation(t, "2-flows-test*")
+
+	defer revertFlowRepDirectory(setFlowRepDirectory(filepath.Join("flow", "test-cases", "2-flows-test-case")))
+
+	err = stream.Initialize()
+	require.NoError(t, err, "Failed to create flows")
+	err = stream.createFlows(flowReps)
+	require.NoError(t, err, "Failed to create flows")
+
+	onRequest := lunar_messages.OnRequest{
+		ID:     "decision-1",
+		Method: "GET",
+		Scheme: "https",
+		URL:    "maps.googleapis.com/maps/api/geocode/json",
+	}
+	apiStream := stream_types.NewRequestAPIStream(onRequest, sharedState)
+	err = stream.ExecuteFlow(context.Background(), apiStream, &stream_config.StreamActions{
+		Request: &stream_config.RequestStream{},
+	})
+	require.NoError(t, err, "Failed to execute request flow")
+
+	apiStream = stream_types.NewResponseAPIStream(lunar_messages.OnResponse{
+		ID:     onRequest.ID,
+		Method: onRequest.Method,
+		URL:    onRequest.URL,
+		Status: 200,
+	}, sharedState)
+	err = stream.ExecuteFlow(context.Background(), apiStream, &stream_config.StreamActions{
+		Response: &stream_config.ResponseStream{},
+	})
+	require.NoError(t, err, "Failed to execute response flow")
+
+	data, found := decisionLog.Get(onRequest.ID)
+	require.True(t, found, "decision record is missing")
+	var record decisionlog.Record
+	require.NoError(t, json.Unmarshal(data, &record))
+	require.NotEmpty(t, record.Flows, "expected matched flows")
+	require.NotEmpty(t, record.Steps, "expected processor steps")
+	require.Equal(t, 200, record.StatusCode)
+	require.NotEmpty(t, record.Action)
+}
+
+func TestExecuteFlowRecordsDecisionsConcurrently(t *testing.T) {
+	procMng := createTestProcessorManager(
+		t,
+		[]string{
+			"removePII",
+			"readCache",
+			"checkLimit",
+			"generateResponse",
+			"globalStream",
+			"writeCache",
+			"LogAPM",
+			"readXXX",
+			"writeXXX",
+		},
+	)
+	stream, err := NewStream()
+	require.NoError(t, err, "Failed to create stream")
+	stream.processorsManager = procMng
+	decisionLog := decisionlog.New(decisionlog.Config{}, nil, context_manager.Get().GetClock())
+	stream.WithDecisionLog(decisionLog)
+	flowReps := createFlowRepresentation(t, "2-flows-test*")
+
+	defer revertFlowRepDirectory(setFlowRepDirectory(filepath.Join("flow", "test-cases", "2-flows-test-case")))
+
+	err = stream.Initialize()
+	require.NoError(t, err, "Failed to create flows")
+	err = stream.createFlows(flowReps)
+	require.NoError(t, err, "Failed to create flows")
+
+	const requests = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			onRequest := lunar_messages.OnRequest{
+				ID:     id,
+				Method: "GET",
+				Scheme: "https",
+				URL:    "maps.googleapis.com/maps/api/geocode/json",
+			}
+			apiStream := stream_types.NewRequestAPIStream(onRequest, sharedState)
+			if err := stream.ExecuteFlow(context.Background(), apiStream, &stream_config.StreamActions{
+				Request: &stream_config.RequestStream{},
+			}); err != nil {
+				errs <- err
+				return
+			}
+			apiStream = stream_types.NewResponseAPIStream(lunar_messages.OnResponse{
+				ID:     onRequest.ID,
+				Method: onRequest.Method,
+				URL:    onRequest.URL,
+				Status: 200,
+			}, sharedState)
+			errs <- stream.ExecuteFlow(context.Background(), apiStream, &stream_config.StreamActions{
+				Response: &stream_config.ResponseStream{},
+			})
+		}(fmt.Sprintf("concurrent-decision-%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err, "Failed to execute request flow")
+	}
+
+	data, found := decisionLog.Get("concurrent-decision-0")
+	require.True(t, found, "decision record is missing")
+	var expected decisionlog.Record
+	require.NoError(t, json.Unmarshal(data, &expected))
+	require.NotEmpty(t, expected.Steps, "expected processor steps")
+	require.Equal(t, 200, expected.StatusCode)
+
+	for i := 1; i < requests; i++ {
+		data, found := decisionLog.Get(fmt.Sprintf("concurrent-decision-%d", i))
+		require.True(t, found, "decision record %d is missing", i)
+		var record decisionlog.Record
+		require.NoError(t, json.Unmarshal(data, &record))
+		require.Len(t, record.Steps, len(expected.Steps), "steps of record %d", i)
+		require.Equal(t, expected.Flows, record.Flows, "flows of record %d", i)
+		require.Equal(t, 200, record.StatusCode, "status of record %d", i)
+	}
+}
+
 func TestExecuteFlows(t *testing.T) {
 	procMng := createTestProcessorManager(
 		t,
@@ -128,11 +437,11 @@ func TestExecuteFlows(t *testing.T) {
 		Request:  &stream_config.RequestStream{},
 		Response: &stream_config.ResponseStream{},
 	}
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	apiStream.SetType(public_types.StreamTypeResponse)
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	// Test for 3 flows
@@ -172,7 +481,7 @@ func TestExecuteFlows(t *testing.T) {
 		Headers: map[string]string{},
 	}))
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 }
 
@@ -301,7 +610,7 @@ func TestEarlyResponseFlow(t *testing.T) {
 	err = globalContext.Set(test_processors.GlobalKeyCacheHit, true)
 	require.NoError(t, err, "Failed to set global context value")
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err := globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -315,7 +624,7 @@ func TestEarlyResponseFlow(t *testing.T) {
 	err = globalContext.Set(test_processors.GlobalKeyCacheHit, false)
 	require.NoError(t, err, "Failed to set global context value")
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err = globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -327,7 +636,7 @@ func TestEarlyResponseFlow(t *testing.T) {
 	err = globalContext.Set(test_processors.GlobalKeyExecutionOrder, []string{})
 	require.NoError(t, err, "Failed to set global context value")
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err = globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -384,7 +693,7 @@ func TestEarlyResponseFromAnotherFlow(t *testing.T) {
 	err = globalContext.Set(test_processors.GlobalKeyCacheHit, true)
 	require.NoError(t, err, "Failed to set global context value")
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err := globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -430,7 +739,7 @@ func TestFilterProcessorFlow(t *testing.T) {
 		Response: &stream_config.ResponseStream{},
 	}
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err := globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -444,7 +753,7 @@ func TestFilterProcessorFlow(t *testing.T) {
 	err = globalContext.Set(test_processors.GlobalKeyExecutionOrder, []string{})
 	require.NoError(t, err, "Failed to set global context value")
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err = globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -458,7 +767,7 @@ func TestFilterProcessorFlow(t *testing.T) {
 	err = globalContext.Set(test_processors.GlobalKeyExecutionOrder, []string{})
 	require.NoError(t, err, "Failed to set global context value")
 
-	err = stream.ExecuteFlow(apiStream, flowActions)
+	err = stream.ExecuteFlow(context.Background(), apiStream, flowActions)
 	require.NoError(t, err, "Failed to execute flow")
 
 	execOrder, err = globalContext.Get(test_processors.GlobalKeyExecutionOrder)
@@ -18,6 +18,8 @@ type mockAPIStream struct {
 	method     string
 	Request    public_types.TransactionI `json:"request,omitempty"`
 	Response   public_types.TransactionI `json:"response,omitempty"`
+	context    public_types.LunarContextI
+	pathParams map[string]string
 }
 
 func NewMockAPIStream(
@@ -141,10 +143,16 @@ func (m *mockAPIStream) DoesHeaderValueMatch(headerName, headerValue string) boo
 	}
 	return false
 }
-func (m *mockAPIStream) GetContext() public_types.LunarContextI { return nil }
+func (m *mockAPIStream) GetContext() public_types.LunarContextI { return m.context }
 func (m *mockAPIStream) SetRequest(public_types.TransactionI)   {}
 func (m *mockAPIStream) SetResponse(public_types.TransactionI)  {}
-func (m *mockAPIStream) SetContext(public_types.LunarContextI) {
+func (m *mockAPIStream) SetContext(context public_types.LunarContextI) {
+	m.context = context
+}
+
+func (m *mockAPIStream) GetPathParams() map[string]string { return m.pathParams }
+func (m *mockAPIStream) SetPathParams(pathParams map[string]string) {
+	m.pathParams = pathParams
 }
 
 func (m *mockAPIStream) SetType(actionType public_types.StreamType) {
@@ -162,7 +170,8 @@ func (m *mockAPIStream) JSONPathQuery(path string) ([]any, error) {
 func (m *mockAPIStream) JSONPathWrite(string, interface{}) error { return nil }
 func (m *mockAPIStream) SetActionsType(public_types.StreamType)  {}
 
-func (m *mockAPIStream) WithLunarContext(public_types.LunarContextI) public_types.APIStreamI {
+func (m *mockAPIStream) WithLunarContext(context public_types.LunarContextI) public_types.APIStreamI {
+	m.context = context
 	return m
 }
 
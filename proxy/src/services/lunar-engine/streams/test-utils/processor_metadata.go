@@ -0,0 +1,21 @@
+package testutils
+
+import (
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+)
+
+// NewProcessorMetaData builds the metadata of a processor with the given parameters
+func NewProcessorMetaData(name string, params map[string]any) *streamtypes.ProcessorMetaData {
+	processorParams := make(map[string]streamtypes.ProcessorParam, len(params))
+	for key, value := range params {
+		processorParams[key] = streamtypes.ProcessorParam{
+			Name:  key,
+			Value: public_types.NewParamValue(value),
+		}
+	}
+	return &streamtypes.ProcessorMetaData{
+		Name:       name,
+		Parameters: processorParams,
+	}
+}
@@ -4,6 +4,19 @@ import (
 	"lunar/engine/actions"
 	publictypes "lunar/engine/streams/public-types"
 	"lunar/toolkit-core/network"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Attributes reported by processors on the span of their execution
+const (
+	TraceAttributeQueueWaitMs   = "lunar.queue.wait_ms"
+	TraceAttributeRetryAttempt  = "lunar.retry.attempt"
+	TraceAttributeQuotaID       = "lunar.quota.id"
+	TraceAttributeQuotaDecision = "lunar.quota.decision"
+	TraceAttributeRateLimited   = "lunar.rate_limited"
+	// TraceAttributeResponseStatus is set on the spans of the response flows
+	TraceAttributeResponseStatus = "http.response.status_code"
 )
 
 type ProcessorDefinition struct {
@@ -36,4 +49,6 @@ type ProcessorIO struct {
 	RespAction   actions.RespLunarAction
 	ShortCircuit *ShortCircuit
 	Failure      bool // for case if we want measure failure without returning error
+	// TraceAttributes are added to the span of the processor execution
+	TraceAttributes []attribute.KeyValue `yaml:"-"`
 }
@@ -7,6 +7,11 @@ import (
 type ProcessorRequirement struct {
 	IsBodyRequired       bool
 	IsReqCaptureRequired bool
+	// IsLastRequestStep is set by processors which must not be followed by another processor
+	// in the request flow, e.g. when they sign the request as it is when they run
+	IsLastRequestStep bool
+	// IsRequestModifier is set by processors which change the request sent to the provider
+	IsRequestModifier bool
 }
 
 type ProcessorI interface {
@@ -22,12 +27,14 @@ type ProcessorParam struct {
 
 type ProcessorMetaData struct {
 	Name                string
+	FlowName            string // the flow which created the processor
 	ProcessorDefinition ProcessorDefinition
 	Parameters          map[string]ProcessorParam
 	Metrics             *publictypes.ProcessorMetrics
 	Resources           publictypes.ResourceManagementI
 	Clock               publictypes.ClockI
 	SharedMemory        publictypes.SharedStateI[string]
+	IsValidation        bool // the processor only validates flows and does not handle traffic
 }
 
 func (p *ProcessorMetaData) IsMetricsEnabled() bool {
@@ -22,6 +22,7 @@ type APIStream struct {
 	Request                    public_types.TransactionI `json:"request,omitempty"`
 	Response                   public_types.TransactionI `json:"response,omitempty"`
 	context                    public_types.LunarContextI
+	pathParams                 map[string]string
 	resources                  public_types.ResourceManagementI
 	shareState                 public_types.SharedStateI[[]byte]
 	gc                         *lunar_context.ExpireWatcher[[]byte]
@@ -168,6 +169,14 @@ func (s *APIStream) SetContext(context public_types.LunarContextI) {
 	s.context = context
 }
 
+func (s *APIStream) GetPathParams() map[string]string {
+	return s.pathParams
+}
+
+func (s *APIStream) SetPathParams(pathParams map[string]string) {
+	s.pathParams = pathParams
+}
+
 func (s *APIStream) SetRequest(request public_types.TransactionI) {
 	s.actionType = public_types.StreamTypeRequest
 	s.streamType = public_types.StreamTypeRequest
@@ -68,11 +68,15 @@ const (
 	backupDirEnv                                              string = "LUNAR_PROXY_CONFIG_BACKUP_DIR"
 	backupDirDefault                                          string = "/etc/lunar-proxy-backup"
 	maxBackupEnv                                              string = "LUNAR_LUNAR_PROXY_CONFIG_MAX_BACKUPS"
+	policiesMigrationDirEnv                                   string = "LUNAR_POLICIES_MIGRATION_DIR"
+	policiesMigrationDirDefault                               string = "/etc/lunar-proxy-migrated"
 	defaultMaxBackups                                         int    = 10
 
 	FlowsFolder       string = "flows"
 	PathParamsFolder  string = "path_params"
 	QuotasFolder      string = "quotas"
+	SchemasFolder     string = "schemas"
+	KeysFolder        string = "keys"
 	GatewayConfigFile string = "gateway_config.yaml"
 
 	lunarHubDefaultValue                            string = "hub.lunar.dev"
@@ -89,11 +93,92 @@ type GatewayConfig struct {
 	BlockedDomains []string            `yaml:"blocked_domains"`
 	Exporters      map[string]Exporter `yaml:"exporters"`
 	TraceExporter  TraceExporter       `yaml:"trace_exporter"`
+	// MetricsExporter pushes the metrics of the engine and the async service to an OTLP endpoint
+	MetricsExporter *MetricsExporter `yaml:"metrics_exporter,omitempty"`
+	// DecisionLog records what the flows did with every transaction
+	DecisionLog *DecisionLog `yaml:"decision_log,omitempty"`
+	// SLOs are tracked from the transactions of their flow, endpoint or labeled endpoint
+	SLOs []SLO `yaml:"slos,omitempty"`
 }
 
 type TraceExporter struct {
 	TraceExporterID string `yaml:"trace_exporter_id"`
 	TracesEndpoint  string `yaml:"traces_endpoint"`
+	// ExportEngineTraces exports the flow and processor spans of the engine to TracesEndpoint.
+	// They are also exported when OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set.
+	ExportEngineTraces bool                 `yaml:"export_engine_traces,omitempty"`
+	Protocol           string               `yaml:"protocol,omitempty"` // grpc (default) or http
+	Headers            map[string]string    `yaml:"headers,omitempty"`
+	TLS                *TraceExporterTLS    `yaml:"tls,omitempty"`
+	Sampling           *TraceSamplingConfig `yaml:"sampling,omitempty"`
+}
+
+type TraceExporterTLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+type TraceSamplingConfig struct {
+	// Ratio of the sampled traces which have no sampled parent, all of them when not set
+	Ratio *float64 `yaml:"ratio,omitempty"`
+	// Flows overrides the ratio per flow name
+	Flows        map[string]float64 `yaml:"flows,omitempty"`
+	TailSampling *TailSampling      `yaml:"tail_sampling,omitempty"`
+}
+
+// TailSampling keeps the traces which were not sampled,
+// when they have an error, a retry, a rate limit or are slower than the latency threshold
+type TailSampling struct {
+	Enabled            bool `yaml:"enabled"`
+	DecisionWaitSec    int  `yaml:"decision_wait_sec,omitempty"`
+	MaxTraces          int  `yaml:"max_traces,omitempty"`
+	LatencyThresholdMs int  `yaml:"latency_threshold_ms,omitempty"`
+}
+
+type MetricsExporter struct {
+	Endpoint    string            `yaml:"endpoint"`
+	Protocol    string            `yaml:"protocol,omitempty"` // grpc (default) or http
+	IntervalSec int               `yaml:"interval_sec,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Temporality string            `yaml:"temporality,omitempty"` // cumulative (default) or delta
+	TLS         *TraceExporterTLS `yaml:"tls,omitempty"`
+	// DisablePrometheus stops serving the metrics for Prometheus, leaving the push export only
+	DisablePrometheus bool `yaml:"disable_prometheus,omitempty"`
+}
+
+type DecisionLog struct {
+	Enabled bool `yaml:"enabled"`
+	// ExporterID is the exporter the records are written to, they are only kept in memory when not set
+	ExporterID string `yaml:"exporter_id,omitempty"`
+	// SampleRatio of the exported records, all of them when not set
+	SampleRatio  *float64 `yaml:"sample_ratio,omitempty"`
+	RedactFields []string `yaml:"redact_fields,omitempty"`
+	// RecentTransactions is the number of records kept to be queried by request ID
+	RecentTransactions int `yaml:"recent_transactions,omitempty"`
+}
+
+// SLO is an availability or a latency objective of a flow, an endpoint or a labeled endpoint
+type SLO struct {
+	Name string `yaml:"name"`
+	// Type is availability (share of non-5xx responses) or latency (share of calls under LatencyThresholdMs)
+	Type               string  `yaml:"type"`
+	Target             float64 `yaml:"target"`
+	LatencyThresholdMs float64 `yaml:"latency_threshold_ms,omitempty"`
+	// Window is the rolling period of the error budget (e.g. 7d or 12h), 7 days when not set
+	Window string `yaml:"window,omitempty"`
+
+	// Flow, Endpoint (a discovered URL, e.g. api.com/users/{id}) or LabeledEndpoint
+	// (a pattern of the labeled_endpoints of metrics.yaml) select the transactions of the SLO
+	Flow            string `yaml:"flow,omitempty"`
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	Method          string `yaml:"method,omitempty"`
+	LabeledEndpoint string `yaml:"labeled_endpoint,omitempty"`
+
+	// FlagFlows sets the slo_burning flow context flag of the flows of the SLO
+	// while it burns its error budget too fast
+	FlagFlows bool `yaml:"flag_flows,omitempty"`
 }
 
 // Exporter represents an individual exporter configuration
@@ -137,6 +222,15 @@ func SetConfigBackupDirectory(dir string) string {
 	return prev
 }
 
+func GetPoliciesMigrationDirectory() string {
+	dir := os.Getenv(policiesMigrationDirEnv)
+	if dir == "" {
+		log.Warn().Msgf("%s is not set, using default", policiesMigrationDirEnv)
+		return policiesMigrationDirDefault
+	}
+	return dir
+}
+
 func GetConfigMaxBackups() int {
 	raw := os.Getenv(maxBackupEnv)
 	if raw == "" {
@@ -193,6 +287,14 @@ func GetCustomQuotasDirectory(root string) string {
 	return path.Join(root, QuotasFolder)
 }
 
+func GetCustomSchemasDirectory(root string) string {
+	return path.Join(root, SchemasFolder)
+}
+
+func GetCustomKeysDirectory(root string) string {
+	return path.Join(root, KeysFolder)
+}
+
 func GetCustomGatewayConfigPath(root string) string {
 	return path.Join(root, GatewayConfigFile)
 }
@@ -0,0 +1,46 @@
+package environment
+
+import (
+	"lunar/toolkit-core/otel"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LoadMetricsExporterConfig reads the metrics exporter of the gateway config,
+// it is nil when the gateway config is missing or has no metrics exporter
+func LoadMetricsExporterConfig() *otel.MetricsConfig {
+	gatewayConfig, err := LoadGatewayConfig()
+	if err != nil {
+		log.Debug().Err(err).Msg("Gateway config not loaded, using the default metrics config")
+		return nil
+	}
+	return gatewayConfig.MetricsExporter.ToMetricsConfig()
+}
+
+func (e *MetricsExporter) ToMetricsConfig() *otel.MetricsConfig {
+	if e == nil {
+		return nil
+	}
+	return &otel.MetricsConfig{
+		Endpoint:          e.Endpoint,
+		Protocol:          e.Protocol,
+		Headers:           e.Headers,
+		TLS:               e.TLS.ToTLSConfig(),
+		Interval:          time.Duration(e.IntervalSec) * time.Second,
+		Temporality:       e.Temporality,
+		DisablePrometheus: e.DisablePrometheus,
+	}
+}
+
+func (t *TraceExporterTLS) ToTLSConfig() *otel.TLSConfig {
+	if t == nil {
+		return nil
+	}
+	return &otel.TLSConfig{
+		CAFile:             t.CAFile,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+}
@@ -0,0 +1,79 @@
+// Package saturation collects the load signals of the gateway,
+// which are read by the processors shedding traffic under overload.
+package saturation
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencySmoothing is the weight of the latest observation in the processing latency average
+const latencySmoothing = 0.2
+
+var (
+	latencyMu         sync.Mutex
+	processingLatency float64 // nanoseconds, exponentially weighted moving average
+	waits             = map[string]time.Duration{}
+
+	queueDepth atomic.Int64
+)
+
+// AddWait records time a processor spent waiting while handling a transaction
+// (e.g. in a queue, a retry cooldown or a call to an external service),
+// which is not part of the engine processing latency
+func AddWait(transactionID string, wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	waits[transactionID] += wait
+}
+
+// ObserveProcessingLatency records the time the engine took to handle an SPOE message
+// of a transaction, without the time its processors spent waiting
+func ObserveProcessingLatency(transactionID string, latency time.Duration) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	latency -= waits[transactionID]
+	delete(waits, transactionID)
+	if latency < 0 {
+		latency = 0
+	}
+
+	if processingLatency == 0 {
+		processingLatency = float64(latency)
+		return
+	}
+	processingLatency += latencySmoothing * (float64(latency) - processingLatency)
+}
+
+// ProcessingLatency returns the moving average of the SPOE message handling time
+func ProcessingLatency() time.Duration {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	return time.Duration(processingLatency)
+}
+
+// AddQueued updates the number of requests waiting in the queues of the gateway
+func AddQueued(delta int64) {
+	queueDepth.Add(delta)
+}
+
+// QueueDepth returns the number of requests waiting in the queues of the gateway
+func QueueDepth() int64 {
+	return queueDepth.Load()
+}
+
+// Reset clears the collected signals
+func Reset() {
+	latencyMu.Lock()
+	processingLatency = 0
+	waits = map[string]time.Duration{}
+	latencyMu.Unlock()
+	queueDepth.Store(0)
+}